@@ -116,10 +116,8 @@ func selectFieldsWithPrimaryCondition(sql2kvRocksdb *octopus.Octopus) {
 	if err != nil {
 		panic(err)
 	}
-	for rowName, rowValue := range row.ColumnValue {
-		name := rowName
-		value := rowValue
-		fmt.Println("name:", name, ",value:", value)
+	for i, field := range res.Fields() {
+		fmt.Println("name:", field.Name, ",value:", row.ValueString(i))
 	}
 }
 
@@ -138,10 +136,8 @@ func selectAllFieldWithPrimaryCinditionRange(sql2kvRocksdb *octopus.Octopus) {
 
 	for res.Next(&row) {
 		fmt.Println("rowid:", row.RowId)
-		for rowName, rowValue := range row.ColumnValue {
-			name := rowName
-			value := rowValue
-			fmt.Println("name:", name, ",value:", value)
+		for i, field := range res.Fields() {
+			fmt.Println("name:", field.Name, ",value:", row.ValueString(i))
 		}
 	}
 }
@@ -163,24 +159,23 @@ func selectRange(sql2kvRocksdb *octopus.Octopus) {
 	}
 	for res.Next(&row) {
 		fmt.Println("rowid:", row.RowId)
-		for rowName, rowValue := range row.ColumnValue {
-			name := rowName
-			value := rowValue
-			fmt.Println("name:", name, ",value:", value)
+		for i, field := range res.Fields() {
+			fmt.Println("name:", field.Name, ",value:", row.ValueString(i))
 		}
 	}
 
 	fmt.Println("---------------------------------")
-	sql = "select * from utxo_asset_transfer_1542610800000_1542614399999 where TXTYPE=4"
+	sql = "select * from utxo_asset_transfer_1542610800000_1542614399999 where HASH='04dfa58d91e64791e908d4ba8eeecbbb250ee493f0a4ffd1787e91b70226d96f' AND HASHINDEX=0 AND TXTYPE=4"
 
 	res, err = sql2kvRocksdb.Query(sql)
+	if err != nil {
+		panic(err)
+	}
 
 	for res.Next(&row) {
 		fmt.Println("rowid:", row.RowId)
-		for rowName, rowValue := range row.ColumnValue {
-			name := rowName
-			value := rowValue
-			fmt.Println("name:", name, ",value:", value)
+		for i, field := range res.Fields() {
+			fmt.Println("name:", field.Name, ",value:", row.ValueString(i))
 		}
 	}
 
@@ -188,14 +183,25 @@ func selectRange(sql2kvRocksdb *octopus.Octopus) {
 	sql = "select * from utxo_asset_transfer_1542610800000_1542614399999 where HASH='05dfa58d91e64791e908d4ba8eeecbbb250ee493f0a4ffd1787e91b70226d96f'"
 
 	res, err = sql2kvRocksdb.Query(sql)
+	if err != nil {
+		panic(err)
+	}
 
 	for res.Next(&row) {
 		fmt.Println("rowid:", row.RowId)
-		for rowName, rowValue := range row.ColumnValue {
-			name := rowName
-			value := rowValue
-			fmt.Println("name:", name, ",value:", value)
+		for i, field := range res.Fields() {
+			fmt.Println("name:", field.Name, ",value:", row.ValueString(i))
 		}
 	}
 	fmt.Println("---------------------------------")
+	sql = "select * from utxo_asset_transfer_1542610800000_1542614399999 where PUBLICHASH='b713df4ed24854aa00864457452712ca473370f4294fe0349991047e09acb39e' AND TXTIME>1542614204000 LIMIT 0,3"
+
+	res, err = sql2kvRocksdb.Query(sql)
+	if err != nil {
+		panic(err)
+	}
+	for res.Next(&row) {
+		fmt.Println("rowid:", row.RowId)
+	}
+	fmt.Println("---------------------------------")
 }
@@ -0,0 +1,32 @@
+package kv
+
+//一组修改 由Storage.Write一次原子写入 全部生效或全部不生效
+type Batch struct {
+	pairs []Pair //值为nil表示删除
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+//写入键值 value为nil时写入空值
+func (b *Batch) Put(key, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	b.pairs = append(b.pairs, Pair{Key: key, Value: value})
+}
+
+//删除键
+func (b *Batch) Delete(key []byte) {
+	b.pairs = append(b.pairs, Pair{Key: key})
+}
+
+func (b *Batch) Len() int {
+	return len(b.pairs)
+}
+
+//按加入的顺序返回全部修改 同一个键以最后一次修改为准
+func (b *Batch) Pairs() []Pair {
+	return b.pairs
+}
@@ -0,0 +1,32 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+)
+
+//事务冲突 事务开始后其他事务提交了它读过或写入的键 重试整个事务可能成功
+type ConflictError struct {
+	Key        []byte
+	StartTs    uint64 //冲突事务的开始时间戳
+	ConflictTs uint64 //其他事务提交的时间戳
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("txn(startTs:%d) conflict on key(%x) committed at %d, please retry", e.StartTs, e.Key, e.ConflictTs)
+}
+
+//等锁超时 语句失败 事务中之前的修改仍然保留
+var ErrLockWaitTimeout = errors.New("lock wait timeout exceeded, try restarting transaction")
+
+//等锁时发现死锁 等待的事务作为牺牲者回滚
+var ErrDeadlock = errors.New("deadlock found when trying to get lock, try restarting transaction")
+
+//错误是否可以通过重试事务解决
+func IsRetryable(err error) bool {
+	if err == ErrDeadlock {
+		return true
+	}
+	_, ok := err.(*ConflictError)
+	return ok
+}
@@ -21,7 +21,7 @@ type RowsIterator interface {
 	ValidForPrefix(prefix []byte) bool
 	//关闭迭代器
 	Close()
-	//移动迭代器指针到指定的key
+	//移动迭代器指针到指定的key 逆序迭代器移动到不大于key的最后一个键
 	Seek(key []byte) RowsIterator
 }
 
@@ -34,6 +34,8 @@ type Storage interface {
 	Scan(startKey,endKey []byte, limit int) []Pair
 	//创建迭代器
 	NewScanIterator(startKey, endKey []byte) RowsIterator
+	//创建逆序迭代器 从endKey之前的最后一个键向前迭代到startKey
+	NewReverseScanIterator(startKey, endKey []byte) RowsIterator
 	//存储键值
 	Put(key, value []byte) error
 	//批量存储
@@ -42,6 +44,8 @@ type Storage interface {
 	Delete(key []byte) error
 	//批量删除
 	BatchDelete(keys [][]byte) error
+	//原子写入一组修改
+	Write(batch *Batch) error
 	//关闭数据库文件
 	Close()error
 }
@@ -0,0 +1,158 @@
+package kv
+
+import (
+	"bytes"
+	"sort"
+)
+
+//内存中的写缓存 值为nil表示删除
+type MemBuffer struct {
+	values map[string][]byte
+	keys   []string //排好序的键 有新键加入后重新排序
+	sorted bool
+}
+
+func NewMemBuffer() *MemBuffer {
+	return &MemBuffer{values: make(map[string][]byte), sorted: true}
+}
+
+//获取缓存中的值 ok为false时缓存中没有这个键
+func (mb *MemBuffer) Get(key []byte) (value []byte, ok bool) {
+	value, ok = mb.values[string(key)]
+	return value, ok
+}
+
+//写入键值 value为nil时记录删除
+func (mb *MemBuffer) Set(key, value []byte) {
+	k := string(key)
+	if _, ok := mb.values[k]; !ok {
+		mb.keys = append(mb.keys, k)
+		mb.sorted = false
+	}
+	mb.values[k] = value
+}
+
+func (mb *MemBuffer) Len() int {
+	return len(mb.values)
+}
+
+//按键的顺序返回范围内的全部键值 endKey为空时不限制上界
+//返回的是当前内容的拷贝 之后的写入不会影响返回结果
+func (mb *MemBuffer) Pairs(startKey, endKey []byte) []Pair {
+	if !mb.sorted {
+		sort.Strings(mb.keys)
+		mb.sorted = true
+	}
+	i := sort.SearchStrings(mb.keys, string(startKey))
+	var pairs []Pair
+	for ; i < len(mb.keys); i++ {
+		key := []byte(mb.keys[i])
+		if len(endKey) > 0 && bytes.Compare(key, endKey) >= 0 {
+			break
+		}
+		pairs = append(pairs, Pair{Key: key, Value: mb.values[mb.keys[i]]})
+	}
+	return pairs
+}
+
+//合并写缓存和底层存储的迭代器 键相同时使用缓存中的值 跳过缓存中删除的键
+type UnionIterator struct {
+	base      RowsIterator
+	pairs     []Pair //按迭代顺序排列的缓存键值
+	pos       int
+	reverse   bool
+	useBuffer bool //当前键值来自缓存
+	valid     bool
+}
+
+//pairs为缓存在迭代范围内的键值 按键的升序排列
+func NewUnionIterator(base RowsIterator, pairs []Pair, reverse bool) *UnionIterator {
+	if reverse {
+		for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+			pairs[i], pairs[j] = pairs[j], pairs[i]
+		}
+	}
+	it := &UnionIterator{base: base, pairs: pairs, reverse: reverse}
+	it.update()
+	return it
+}
+
+//按迭代方向比较 a在b之前时小于0
+func (it *UnionIterator) compare(a, b []byte) int {
+	if it.reverse {
+		return bytes.Compare(b, a)
+	}
+	return bytes.Compare(a, b)
+}
+
+//选出当前位置 底层存储中被缓存覆盖或删除的键直接跳过
+func (it *UnionIterator) update() {
+	for {
+		baseValid := it.base.Valid()
+		if it.pos >= len(it.pairs) {
+			it.useBuffer, it.valid = false, baseValid
+			return
+		}
+		pair := it.pairs[it.pos]
+		if baseValid {
+			c := it.compare(it.base.Key(), pair.Key)
+			if c < 0 {
+				it.useBuffer, it.valid = false, true
+				return
+			}
+			if c == 0 {
+				it.base.Next()
+			}
+		}
+		if pair.Value == nil {
+			it.pos++
+			continue
+		}
+		it.useBuffer, it.valid = true, true
+		return
+	}
+}
+
+func (it *UnionIterator) Key() []byte {
+	if it.useBuffer {
+		return it.pairs[it.pos].Key
+	}
+	return it.base.Key()
+}
+
+func (it *UnionIterator) Value() []byte {
+	if it.useBuffer {
+		return it.pairs[it.pos].Value
+	}
+	return it.base.Value()
+}
+
+func (it *UnionIterator) Next() {
+	if it.useBuffer {
+		it.pos++
+	} else {
+		it.base.Next()
+	}
+	it.update()
+}
+
+func (it *UnionIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *UnionIterator) ValidForPrefix(prefix []byte) bool {
+	return it.valid && bytes.HasPrefix(it.Key(), prefix)
+}
+
+func (it *UnionIterator) Close() {
+	it.base.Close()
+}
+
+func (it *UnionIterator) Seek(key []byte) RowsIterator {
+	it.base.Seek(key)
+	it.pos = sort.Search(len(it.pairs), func(i int) bool {
+		return it.compare(it.pairs[i].Key, key) >= 0
+	})
+	it.update()
+	return it
+}
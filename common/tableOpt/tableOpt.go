@@ -1,35 +1,96 @@
 package tableOpt
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/statistics"
 	"github.com/CDDSCLab/chaosdb/table"
 )
 
+//参数中的表名为按表名存储元数据使用的名称 其他数据库中的表带有数据库前缀 见table.FullTableName
 type TableOpt interface {
 	//表是否存在
 	TableExists(tableName string) (bool, error)
+	//数据库中按表名排序的全部表名
+	ListTables(db *table.DBInfo) ([]string, error)
+	//按名称获取数据库信息 数据库不存在时返回nil
+	GetDatabase(dbName string) (*table.DBInfo, error)
+	//按名称排序的全部数据库
+	ListDatabases() ([]*table.DBInfo, error)
+	//创建数据库 分配唯一的数据库id
+	CreateDatabase(dbName string) (*table.DBInfo, error)
+	//删除数据库和其中的全部表
+	DropDatabase(dbName string) error
 	//获取唯一表id
 	GetUniqTableId() uint64
 	//根据表名获取表信息
 	GetTableInfo(tableName string) (*table.MyTableInfo, error)
-	//设置表信息
-	//SetTableInfo(tableInfo *table.MyTableInfo) error
+	//设置表信息 修改表结构时使用
+	SetTableInfo(tableInfo *table.MyTableInfo) error
 	//获取表中自增id和行号
 	GetTableInfoIds(tableName string) (*table.MyTableInfoIds, error)
 	//设置表中自增id和行号
 	SetTableInfoIds(tableName string, tableInfoIds *table.MyTableInfoIds) error
 	//创建表
 	CreateTable(tableInfo *table.MyTableInfo) error
+	//删除表 表信息 统计信息和全部数据一起删除
+	DropTable(tableName string) error
+	//清空表中的数据和统计信息 自增id从1开始
+	TruncateTable(tableName string) error
+	//修改表名 新表名在dbId对应的数据库中 只移动按表名存储的元数据 行数据和索引不变
+	RenameTable(oldName string, dbId uint64, newTableName string) error
+	//从progress记录的位置开始为最多limit行写入索引键 更新并保存回填进度
+	BackfillIndex(tableInfo *table.MyTableInfo, index *table.Index, progress *table.BackfillProgress, limit int) error
+	//获取表上没有完成的索引回填进度 没有时返回nil
+	GetBackfillProgress(tableName string) (*table.BackfillProgress, error)
+	//删除索引的全部索引键
+	DeleteIndex(tableInfo *table.MyTableInfo, index *table.Index) error
+	//从startKey开始按当前表结构重写最多limit行 返回下一批开始的行键 全部重写完成时返回nil
+	RewriteRows(tableInfo *table.MyTableInfo, startKey []byte, limit int) ([]byte, error)
 	//新增记录
 	AddRecords(tableInfo *table.MyTableInfo, rows []table.Rows) error
 	//根据主键字段获取行信息
 	GetRowByPrimaryField(tableName string, primaryKey []byte) (*table.Row, error)
 	//根据唯一索引字段行信息
-	GetRowIdByUniqueField(tableName string, uniqueKey []byte) (string, error)
+	GetRowIdByUniqueField(tableName string, uniqueKey []byte) (uint64, error)
 	//获取范围内的行
 	GetRows(tableName string, startKey, endKey []byte) (kv.RowsIterator, error)
+	//逆序获取范围内的行
+	GetRowsReverse(tableName string, startKey, endKey []byte) (kv.RowsIterator, error)
+	//获取表的统计信息 没有收集过时返回nil
+	GetTableStats(tableName string) (*statistics.Table, error)
+	//保存表的统计信息
+	SetTableStats(tableName string, stats *statistics.Table) error
 	//删除记录
 	DeleteRecords(tableName string, delKeys [][]byte) error
 	//获取全部记录--测试查看数据时使用
 	ScanLimit(tableName string, limit int) []kv.Pair
+	//给键加锁 在事务中加的锁到事务结束时释放
+	LockKeys(keys [][]byte, exclusive bool) error
+	//开始事务
+	Begin() Txn
+}
+
+//事务中的表操作 提交前其他事务看不到事务中的修改
+type Txn interface {
+	TableOpt
+	//提交事务 全部修改一次写入
+	Commit() error
+	//回滚事务 丢弃全部修改
+	Rollback()
+}
+
+//数据库中的表按表名存储元数据使用的名称 dbName为空时为默认数据库
+func FullTableName(opt TableOpt, dbName, tableName string) (string, error) {
+	dbInfo, err := opt.GetDatabase(dbName)
+	if err != nil {
+		return "", err
+	}
+	if dbInfo == nil {
+		errStr := fmt.Sprintf("Unknown database '%s'", dbName)
+		return "", errors.New(errStr)
+	}
+	return dbInfo.FullTableName(tableName), nil
 }
@@ -15,6 +15,9 @@ import (
 //按照默认比较器排序(ASCⅡ的大小)结果如下：
 //t_r_uxto_1=>[{...,...}] t_r_uxto_10=>[{...,...}] t_r_uxto_2=>[{...,...}]
 //自定义比较器逻辑：按照固定字符拆分键值，如果是字符，按照ASCII比较大小，如果是数字(48~57) 转换为10进制数字进行比较
+//
+//Deprecated: 键已改为util/codekey中的memcomparable编码，leveldb使用默认比较器即可正确排序，
+//该比较器无法处理包含分隔符的值和负数，不要再使用
 type StringAndNumberComparator struct {
 }
 
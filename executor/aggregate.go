@@ -0,0 +1,193 @@
+package executor
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//哈希聚合 按分组列的值分组 每组的结果行为组内第一行的全部列加上聚合函数的结果
+type hashAggExec struct {
+	childExec
+	groupBy    []expression.Expression
+	aggFuncs   []*expression.AggFunc
+	columns    int //子节点的列数
+	groups     map[string]*aggGroup
+	order      []*aggGroup //按第一次出现的顺序输出
+	rows       []*table.Row
+	pos        int
+	aggregated bool
+}
+
+type aggGroup struct {
+	firstRow []types.Datum
+	ctxs     []*expression.AggContext
+}
+
+func newHashAggExec(child Executor, plan *planner.PhysicalHashAgg) *hashAggExec {
+	return &hashAggExec{
+		childExec: childExec{child: child},
+		groupBy:   plan.GroupBy,
+		aggFuncs:  plan.AggFuncs,
+		columns:   len(plan.Schema().Columns) - len(plan.AggFuncs),
+		groups:    make(map[string]*aggGroup),
+	}
+}
+
+func (e *hashAggExec) newGroup(firstRow []types.Datum) *aggGroup {
+	group := &aggGroup{firstRow: firstRow, ctxs: make([]*expression.AggContext, len(e.aggFuncs))}
+	for i, aggFunc := range e.aggFuncs {
+		group.ctxs[i] = aggFunc.NewContext()
+	}
+	return group
+}
+
+//加入一行
+func (e *hashAggExec) add(row *table.Row) error {
+	values := make([]types.Datum, len(e.groupBy))
+	for i, expr := range e.groupBy {
+		d, err := expr.Eval(row.Datums)
+		if err != nil {
+			return err
+		}
+		values[i] = d
+	}
+	key, err := codekey.EncodeDatums(nil, values...)
+	if err != nil {
+		return err
+	}
+	group, ok := e.groups[string(key)]
+	if !ok {
+		group = e.newGroup(row.Datums)
+		e.groups[string(key)] = group
+		e.order = append(e.order, group)
+	}
+	for i, aggFunc := range e.aggFuncs {
+		err = aggFunc.Update(group.ctxs[i], row.Datums)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//数据全部加入后计算每组的结果 没有分组列时空输入也有一行结果
+func (e *hashAggExec) finish() error {
+	if len(e.groupBy) == 0 && len(e.order) == 0 {
+		e.order = append(e.order, e.newGroup(make([]types.Datum, e.columns)))
+	}
+	for _, group := range e.order {
+		results := make([]types.Datum, len(e.aggFuncs))
+		for i, aggFunc := range e.aggFuncs {
+			d, err := aggFunc.Result(group.ctxs[i])
+			if err != nil {
+				return err
+			}
+			results[i] = d
+		}
+		e.rows = append(e.rows, aggregateRow(group.firstRow, results))
+	}
+	e.groups, e.order = nil, nil
+	return nil
+}
+
+//由组内第一行和聚合结果组成结果行
+func aggregateRow(firstRow []types.Datum, results []types.Datum) *table.Row {
+	row := &table.Row{Datums: make([]types.Datum, 0, len(firstRow)+len(results))}
+	row.Datums = append(row.Datums, firstRow...)
+	row.Datums = append(row.Datums, results...)
+	return row
+}
+
+func (e *hashAggExec) Next() (*table.Row, bool, error) {
+	if !e.aggregated {
+		for {
+			row, ok, err := e.child.Next()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				break
+			}
+			err = e.add(row)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		err := e.finish()
+		if err != nil {
+			return nil, false, err
+		}
+		e.aggregated = true
+	}
+	if e.pos >= len(e.rows) {
+		return nil, false, nil
+	}
+	row := e.rows[e.pos]
+	e.pos++
+	return row, true, nil
+}
+
+//不扫描数据直接得到聚合结果 结果行中表的列都为NULL
+//COUNT(*)使用表的行数 MIN和MAX使用主键或索引的两端
+type metaAggExec struct {
+	*BaseExecutor
+	plan *planner.PhysicalMetaAgg
+	done bool
+}
+
+func (e *metaAggExec) Next() (*table.Row, bool, error) {
+	if e.done {
+		return nil, false, nil
+	}
+	e.done = true
+	results := make([]types.Datum, len(e.plan.Sources))
+	for i, source := range e.plan.Sources {
+		var err error
+		if source.Column == nil {
+			results[i], err = e.rowsCount()
+		} else {
+			results[i], err = e.indexEndValue(source)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return aggregateRow(make([]types.Datum, len(e.plan.Table.Columns)), results), true, nil
+}
+
+func (e *metaAggExec) Close() {}
+
+//表的当前行数
+func (e *metaAggExec) rowsCount() (types.Datum, error) {
+	tableInfoIds, err := e.TableOpt.GetTableInfoIds(e.plan.Table.FullName())
+	if err != nil {
+		return types.Datum{}, err
+	}
+	return types.NewIntDatum(int64(tableInfoIds.RowsCount)), nil
+}
+
+//列在主键或索引一端的非NULL值 没有非NULL值时为NULL
+func (e *metaAggExec) indexEndValue(source *planner.MetaSource) (types.Datum, error) {
+	tableInfo := e.plan.Table
+	scanRange, err := planner.MetaSourceRange(tableInfo, source)
+	if err != nil {
+		return types.Datum{}, err
+	}
+	iter, err := rangesIterator(e.TableOpt, tableInfo.FullName(), []planner.KeyRange{scanRange}, source.Max)
+	if err != nil {
+		return types.Datum{}, err
+	}
+	defer iter.Close()
+	if !iter.Valid() {
+		return types.Datum{}, nil
+	}
+	row, err := iteratorRow(e.TableOpt, tableInfo, iter, source.Index == nil)
+	if err != nil {
+		return types.Datum{}, err
+	}
+	return row.Datums[tableInfo.ColumnOffset(source.Column.Idx)], nil
+}
@@ -0,0 +1,317 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type AlterTableExecutor struct {
+	*BaseExecutor
+}
+
+func NewAlterTableExecutor(tableOpt tableOpt.TableOpt) *AlterTableExecutor {
+	return &AlterTableExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//删除索引和修改列在执行前一起在表信息的副本上检查 有错误时不修改表
+//先删除索引 再一次写入全部列的修改 之后按顺序添加索引和修改表名
+//修改列不重写已有的行 ALGORITHM=COPY时在全部修改之后按新的表结构重写已有的行
+func (ae *AlterTableExecutor) Exec(stmt *ast.AlterTableStmt) error {
+	tableName, err := fullTableName(ae.TableOpt, stmt.Table)
+	if err != nil {
+		return err
+	}
+	var dropIndexes, others []*ast.AlterTableSpec
+	var alters []func(tableInfo *table.MyTableInfo) error
+	rewrite := false
+	for _, spec := range stmt.Specs {
+		spec := spec
+		switch spec.Tp {
+		case ast.AlterTableDropIndex:
+			dropIndexes = append(dropIndexes, spec)
+		case ast.AlterTableAddColumns:
+			alters = append(alters, func(tableInfo *table.MyTableInfo) error {
+				return addColumns(tableInfo, spec)
+			})
+		case ast.AlterTableDropColumn:
+			alters = append(alters, func(tableInfo *table.MyTableInfo) error {
+				name := spec.OldColumnName.Name.L
+				if spec.IfExists && tableInfo.ColumnOffsetByName(name) < 0 {
+					return errSkipAlter
+				}
+				return tableInfo.DropColumn(name)
+			})
+		case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+			alters = append(alters, func(tableInfo *table.MyTableInfo) error {
+				return modifyColumn(tableInfo, spec)
+			})
+		case ast.AlterTableRenameColumn:
+			alters = append(alters, func(tableInfo *table.MyTableInfo) error {
+				return renameColumn(tableInfo, spec.OldColumnName.Name.L, spec.NewColumnName.Name.L)
+			})
+		case ast.AlterTableAlterColumn:
+			alters = append(alters, func(tableInfo *table.MyTableInfo) error {
+				return alterColumnDefault(tableInfo, spec.NewColumns[0])
+			})
+		case ast.AlterTableAddConstraint, ast.AlterTableRenameTable:
+			others = append(others, spec)
+		case ast.AlterTableAlgorithm:
+			rewrite = spec.Algorithm == ast.AlgorithmTypeCopy
+		case ast.AlterTableLock:
+			//修改表结构时不锁表
+		default:
+			errStr := fmt.Sprintf("alter table type(%d) no support", spec.Tp)
+			return errors.New(errStr)
+		}
+	}
+
+	err = ae.checkAlters(tableName, dropIndexes, alters)
+	if err != nil {
+		return err
+	}
+	for _, spec := range dropIndexes {
+		err = dropIndex(ae.TableOpt, tableName, spec.Name, spec.IfExists)
+		if err != nil {
+			return err
+		}
+	}
+	if len(alters) > 0 {
+		err = ae.alterColumns(tableName, alters)
+		if err != nil {
+			return err
+		}
+	}
+	for _, spec := range others {
+		switch spec.Tp {
+		case ast.AlterTableAddConstraint:
+			err = ae.addConstraint(tableName, spec.Constraint)
+		case ast.AlterTableRenameTable:
+			//之后的修改作用在新表名上
+			tableName, err = renameTable(ae.TableOpt, tableName, spec.NewTable)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if rewrite {
+		return rewriteTable(ae.TableOpt, tableName)
+	}
+	return nil
+}
+
+//在表信息的副本上依次删除索引和修改列 只检查不写入
+func (ae *AlterTableExecutor) checkAlters(tableName string, dropIndexes []*ast.AlterTableSpec, alters []func(tableInfo *table.MyTableInfo) error) error {
+	if len(dropIndexes) == 0 && len(alters) == 0 {
+		return nil
+	}
+	ok, _ := ae.TableOpt.TableExists(tableName)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][AlterTable] table(%s) is not exists", tableName)
+		return errors.New(errStr)
+	}
+	tableInfo, err := ae.TableOpt.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	tableInfo = tableInfo.Clone()
+	for _, spec := range dropIndexes {
+		if _, ok := tableInfo.Indices[strings.ToLower(spec.Name)]; !ok && spec.IfExists {
+			continue
+		}
+		_, err = tableInfo.DropIndex(spec.Name)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = applyAlters(tableInfo, alters)
+	return err
+}
+
+//ADD INDEX和ADD UNIQUE
+func (ae *AlterTableExecutor) addConstraint(tableName string, cons *ast.Constraint) error {
+	columnNames := make([]string, 0, len(cons.Keys))
+	for _, indexCol := range cons.Keys {
+		columnNames = append(columnNames, indexCol.Column.Name.L)
+	}
+	switch cons.Tp {
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		return addIndex(ae.TableOpt, tableName, cons.Name, columnNames, true, cons.IfNotExists)
+	case ast.ConstraintKey, ast.ConstraintIndex:
+		return addIndex(ae.TableOpt, tableName, cons.Name, columnNames, false, cons.IfNotExists)
+	default:
+		errStr := fmt.Sprintf("alter table constraint type(%d) no support", cons.Tp)
+		return errors.New(errStr)
+	}
+}
+
+//IF EXISTS和IF NOT EXISTS跳过的修改
+var errSkipAlter = errors.New("skip alter")
+
+//在表信息的副本上执行全部列的修改 全部成功后一次写入新的表信息
+func (ae *AlterTableExecutor) alterColumns(tableName string, alters []func(tableInfo *table.MyTableInfo) error) error {
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	ok, _ := ae.TableOpt.TableExists(tableName)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][AlterTable] table(%s) is not exists", tableName)
+		return errors.New(errStr)
+	}
+	tableInfo, err := ae.TableOpt.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	tableInfo = tableInfo.Clone()
+	changed, err := applyAlters(tableInfo, alters)
+	if err != nil || !changed {
+		return err
+	}
+	return ae.TableOpt.SetTableInfo(tableInfo)
+}
+
+//依次执行列的修改 返回是否有修改没有被跳过
+func applyAlters(tableInfo *table.MyTableInfo, alters []func(tableInfo *table.MyTableInfo) error) (bool, error) {
+	changed := false
+	for _, alter := range alters {
+		err := alter(tableInfo)
+		if err == errSkipAlter {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+//由列定义构造列 不支持添加或修改列时定义索引和自增
+func parseColumnDef(tableInfo *table.MyTableInfo, def *ast.ColumnDef) (*table.Column, error) {
+	for _, option := range def.Options {
+		switch option.Tp {
+		case ast.ColumnOptionPrimaryKey, ast.ColumnOptionUniqKey, ast.ColumnOptionAutoIncrement:
+			errStr := fmt.Sprintf("column(%s) option type(%d) no support in alter table", def.Name.Name.L, option.Tp)
+			return nil, errors.New(errStr)
+		}
+	}
+	tp := *def.Tp
+	column := &table.Column{Name: def.Name.Name.L, MysqlType: &tp}
+	err := parseColumnOptions(tableInfo, column, def.Options)
+	if err != nil {
+		return nil, err
+	}
+	return column, nil
+}
+
+func addColumns(tableInfo *table.MyTableInfo, spec *ast.AlterTableSpec) error {
+	if len(spec.NewConstraints) > 0 {
+		return errors.New("add column with constraint no support")
+	}
+	added := 0
+	for _, def := range spec.NewColumns {
+		if spec.IfNotExists && tableInfo.ColumnOffsetByName(def.Name.Name.L) >= 0 {
+			continue
+		}
+		column, err := parseColumnDef(tableInfo, def)
+		if err != nil {
+			return err
+		}
+		err = tableInfo.AddColumn(column, spec.Position)
+		if err != nil {
+			return err
+		}
+		added++
+	}
+	if added == 0 {
+		return errSkipAlter
+	}
+	return nil
+}
+
+//MODIFY COLUMN不改变列名 CHANGE COLUMN可以修改列名
+func modifyColumn(tableInfo *table.MyTableInfo, spec *ast.AlterTableSpec) error {
+	def := spec.NewColumns[0]
+	oldName := def.Name.Name.L
+	if spec.Tp == ast.AlterTableChangeColumn {
+		oldName = spec.OldColumnName.Name.L
+	}
+	if spec.IfExists && tableInfo.ColumnOffsetByName(oldName) < 0 {
+		return errSkipAlter
+	}
+	column, err := parseColumnDef(tableInfo, def)
+	if err != nil {
+		return err
+	}
+	return tableInfo.ModifyColumn(oldName, column, spec.Position)
+}
+
+//RENAME COLUMN只修改列名 列的类型和约束不变
+func renameColumn(tableInfo *table.MyTableInfo, oldName, newName string) error {
+	offset := tableInfo.ColumnOffsetByName(oldName)
+	if offset < 0 {
+		errStr := fmt.Sprintf("Unknown column '%s' in '%s'", oldName, tableInfo.TableName)
+		return errors.New(errStr)
+	}
+	column := *tableInfo.Columns[offset]
+	tp := *column.MysqlType
+	column.MysqlType = &tp
+	column.Name = newName
+	return tableInfo.ModifyColumn(oldName, &column, nil)
+}
+
+//ALTER COLUMN SET DEFAULT和DROP DEFAULT
+func alterColumnDefault(tableInfo *table.MyTableInfo, def *ast.ColumnDef) error {
+	name := def.Name.Name.L
+	offset := tableInfo.ColumnOffsetByName(name)
+	if offset < 0 {
+		errStr := fmt.Sprintf("Unknown column '%s' in '%s'", name, tableInfo.TableName)
+		return errors.New(errStr)
+	}
+	//按列的类型检查默认值 SET DEFAULT解析出的选项没有类型
+	column := *tableInfo.Columns[offset]
+	column.DefaultValue = nil
+	for _, option := range def.Options {
+		option := &ast.ColumnOption{Tp: ast.ColumnOptionDefaultValue, Expr: option.Expr}
+		err := parseColumnOptions(tableInfo, &column, []*ast.ColumnOption{option})
+		if err != nil {
+			return err
+		}
+	}
+	return tableInfo.SetColumnDefault(name, column.DefaultValue)
+}
+
+//按当前表结构分批重写表中已有的行 重写时其他语句可以同时读写
+func rewriteTable(opt tableOpt.TableOpt, tableName string) error {
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	tableInfo, err := opt.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	var startKey []byte
+	for {
+		var nextKey []byte
+		err := runBatch(opt, func(txn tableOpt.Txn) error {
+			var err error
+			nextKey, err = txn.RewriteRows(tableInfo, startKey, BackfillBatchSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if nextKey == nil {
+			excutorLogger.Infof("rewrite rows of table(%s) with schema version %d", tableName, tableInfo.SchemaVersion)
+			return nil
+		}
+		startKey = nextKey
+	}
+}
@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/statistics"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+)
+
+type AnalyzeExecutor struct {
+	*BaseExecutor
+}
+
+func NewAnalyzeExecutor(tableOpt tableOpt.TableOpt) *AnalyzeExecutor {
+	return &AnalyzeExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//收集表的统计信息 行数据和每个索引上各建一个直方图
+func (ae *AnalyzeExecutor) Exec(plan *planner.Analyze) error {
+	for _, tableInfo := range plan.Tables {
+		stats, err := ae.analyzeTable(tableInfo)
+		if err != nil {
+			return err
+		}
+		err = ae.TableOpt.SetTableStats(tableInfo.FullName(), stats)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ae *AnalyzeExecutor) analyzeTable(tableInfo *table.MyTableInfo) (*statistics.Table, error) {
+	rowPrefix := codekey.EncodeRowPrefix(tableInfo.TableId)
+	rowRange := planner.KeyRange{StartKey: rowPrefix, EndKey: codekey.PrefixNext(rowPrefix)}
+	rows, err := ae.buildHistogram(tableInfo.FullName(), rowRange, func(key []byte) ([]byte, error) {
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := statistics.NewTable(rows.TotalCount())
+	stats.Rows = rows
+	for _, index := range tableInfo.PublicIndexList() {
+		indexPrefix := codekey.EncodeIndexPrefix(tableInfo.TableId, index.Id)
+		indexRange := planner.KeyRange{StartKey: indexPrefix, EndKey: codekey.PrefixNext(indexPrefix)}
+		columns := len(index.Columns)
+		//去掉索引键末尾的行号 相同的索引值对应同一个键
+		hist, err := ae.buildHistogram(tableInfo.FullName(), indexRange, func(key []byte) ([]byte, error) {
+			b := key[len(indexPrefix):]
+			for i := 0; i < columns; i++ {
+				var err error
+				b, _, err = codekey.DecodeDatum(b)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return key[:len(key)-len(b)], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		stats.Indices[index.Id] = hist
+	}
+	return stats, nil
+}
+
+//扫描两遍 第一遍统计键数确定桶的大小 第二遍按顺序加入键
+func (ae *AnalyzeExecutor) buildHistogram(tableName string, r planner.KeyRange, keyOf func([]byte) ([]byte, error)) (*statistics.Histogram, error) {
+	iter, err := rangesIterator(ae.TableOpt, tableName, []planner.KeyRange{r}, false)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	for ; iter.Valid(); iter.Next() {
+		count++
+	}
+	iter.Close()
+
+	iter, err = rangesIterator(ae.TableOpt, tableName, []planner.KeyRange{r}, false)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	builder := statistics.NewHistogramBuilder(count, statistics.DefaultBucketCount)
+	for ; iter.Valid(); iter.Next() {
+		key, err := keyOf(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		builder.Add(key)
+	}
+	return builder.Histogram(), nil
+}
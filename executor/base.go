@@ -3,300 +3,27 @@ package executor
 import (
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 
-	"github.com/CDDSCLab/chaosdb/common/kv"
 	"github.com/CDDSCLab/chaosdb/common/tableOpt"
-	"github.com/CDDSCLab/chaosdb/opt/common"
+	"github.com/CDDSCLab/chaosdb/planner"
 	"github.com/CDDSCLab/chaosdb/table"
-	"github.com/CDDSCLab/chaosdb/util/codekey"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/op/go-logging"
-	"github.com/pingcap/parser/opcode"
-	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/parser/ast"
 )
 
 var excutorLogger = logging.MustGetLogger("executor")
 
+//语句中的表名对应的元数据名称 没有指定数据库时为默认数据库
+func fullTableName(opt tableOpt.TableOpt, name *ast.TableName) (string, error) {
+	return tableOpt.FullTableName(opt, name.Schema.L, name.Name.L)
+}
+
 type BaseExecutor struct {
 	TableInfo    *table.MyTableInfo
 	TableInfoIds *table.MyTableInfoIds
 	TableOpt     tableOpt.TableOpt
-}
-
-func (be *BaseExecutor) getQueryResultWithoutWhere(selectField []string, limit *table.Limit) (*QueryResult, error) {
-	var queryRes QueryResult
-	//没有条件 获取所有表数据 范围查询
-	sb := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10), "1")
-	eb := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10), strconv.FormatUint(be.TableInfoIds.AutoIncId, 10))
-	rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, sb.Bytes(), eb.Bytes())
-	if err != nil {
-		errStr := fmt.Sprintf("GetRows iterator error:%s", err)
-		return nil, errors.New(errStr)
-	}
-	//sbseek := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatInt(be.TableInfo.TableId, 10), strconv.FormatInt(1+limit.Offset, 10))
-
-	//rowIter.Seek(sbseek.Bytes())
-	queryRes.isPriKey = true
-	queryRes.pointSelect = false
-	queryRes.rowsIterator = rowIter
-	if limit.Count != 0 {
-		queryRes.returnCount = limit.Count
-	}
-
-	queryRes.columnList = selectField
-	queryRes.be = be
-	return &queryRes, nil
-}
-
-func (be *BaseExecutor) getQueryResultWithWhere(selectFiled []string, where *table.Where, limit *table.Limit) (*QueryResult, error) {
-
-	//条件字段合法性 :必须是索引列(1.存在 2.是索引)
-	_, isUniqColumn := be.TableInfo.UniqIndices[where.LeftColumn]
-	isPrimaryColumn := be.TableInfo.PriKey.Name == where.LeftColumn
-	_, isIndexColumn := be.TableInfo.Indices[where.LeftColumn]
-	if !isUniqColumn && !isPrimaryColumn && !isIndexColumn {
-		errStr := fmt.Sprintf("The where field(%s) must be a index Column", where.LeftColumn)
-		return nil, errors.New(errStr)
-	}
-
-	var queryRes QueryResult
-	switch where.Opt {
-	case opcode.EQ:
-		//主键-单点
-		if isPrimaryColumn {
-			if !types.IsTypeNumeric(where.RightType.Tp) {
-				errStr := fmt.Sprintf("The where of primary field(%s) must be a numeric type", where.LeftColumn)
-				return nil, errors.New(errStr)
-			}
-			rightValue := strconv.FormatInt(where.RightValue.GetInt64(), 10)
-			//构造主键key tableId_whereColumnValueId(rowId)
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				rightValue)
-			row, err := be.TableOpt.GetRowByPrimaryField(be.TableInfo.TableName, b.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("GetRowByPrimaryField error,key:%s", b.String())
-				return nil, errors.New(errStr)
-			}
-			queryRes.isPriKey = true
-			queryRes.pointSelect = true
-			queryRes.row = row
-			//唯一索引 单点
-		} else if isUniqColumn {
-			var rightValue string
-			if types.IsTypeNumeric(where.RightType.Tp) {
-				rightValue = strconv.FormatInt(where.RightValue.GetInt64(), 10)
-			} else if types.IsTypeChar(where.RightType.Tp) {
-				rightValue = where.RightValue.GetString()
-			}
-			//构造唯一key tableId_whereColumnId_whereColumnValue
-			ub := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.UniqIndices[where.LeftColumn].Idx, 10),
-				rightValue)
-			rowId, err := be.TableOpt.GetRowIdByUniqueField(be.TableInfo.TableName, ub.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("GetRowIdByUniqueField error,key:%s", ub.String())
-				return nil, errors.New(errStr)
-			}
-
-			pb := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10), rowId)
-			row, err := be.TableOpt.GetRowByPrimaryField(be.TableInfo.TableName, pb.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("GetRowByUniqueField error,key:%s", pb.String())
-				return nil, errors.New(errStr)
-			}
-			queryRes.isPriKey = false
-			queryRes.pointSelect = true
-			queryRes.row = row
-			//普通索引 范围
-		} else if isIndexColumn {
-			var rightValue string
-			//取出条件右值
-			if types.IsTypeNumeric(where.RightType.Tp) {
-				rightValue = strconv.FormatInt(where.RightValue.GetInt64(), 10)
-
-			} else if types.IsTypeChar(where.RightType.Tp) {
-				rightValue = where.RightValue.GetString()
-
-			}
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.Indices[where.LeftColumn].Idx, 10),
-				rightValue)
-
-			start := b.String() + "_1"
-			//fmt.Println("startKey:", start)
-
-			//只给startKey 我们除了满足条件的前缀key以外，迭代器中还会有全部其他的key
-			//最好的方式是给出endKey 这样会只有符合条件的key 但是rocksdb 在结果集调用next方式时，这个迭代器会无效....
-			//现在的处理办法，在next中判断前缀，如果出现不同的前缀，则关闭此迭代器
-			//end := ""
-			//end := b.String() + "_" + strconv.FormatInt(be.TableInfo.RowsCount+1, 10)
-			//fmt.Println("endKey:", end)
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, []byte(start), nil)
-
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-
-			//for ; rowIter.ValidForPrefix(b.Bytes()); rowIter.Next() {
-			//	fmt.Println("key:", string(rowIter.Key()))
-			//}
-			queryRes.validPrefix = b.String()
-			queryRes.isPriKey = false
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		}
-	case opcode.GT:
-		//右值必须是是数字
-		if !types.IsTypeNumeric(where.RightType.Tp) {
-			errStr := fmt.Sprint("The where of '>','<' condition must be a  numeric type")
-			return nil, errors.New(errStr)
-		}
-		rightValue := where.RightValue.GetUint64()
-		if isPrimaryColumn {
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, b.Bytes(), []byte(""))
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			bseek := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(rightValue+limit.Offset, 10))
-			rowIter.Seek(bseek.Bytes())
-			if limit.Offset == 0 {
-				rowIter.Next()
-			}
-			queryRes.isPriKey = true
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		} else if isUniqColumn {
-			ub := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.UniqIndices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, ub.Bytes(), nil)
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			ubseek := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.UniqIndices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue+limit.Offset, 10))
-			rowIter.Seek(ubseek.Bytes())
-			if limit.Offset == 0 {
-				rowIter.Next()
-			}
-			queryRes.isPriKey = false
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		} else if isIndexColumn {
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.Indices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, b.Bytes(), nil)
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			bseek := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.Indices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue+limit.Offset, 10))
-			rowIter.Seek(bseek.Bytes())
-			if limit.Offset == 0 {
-				rowIter.Next()
-			}
-			queryRes.isPriKey = false
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		}
-	case opcode.LT:
-		if !types.IsTypeNumeric(where.RightType.Tp) {
-			errStr := fmt.Sprint("The where of '>','<' condition must be a  numeric type")
-			return nil, errors.New(errStr)
-		}
-		rightValue := where.RightValue.GetUint64()
-		if isPrimaryColumn {
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, []byte{}, b.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			if limit.Offset != 0 {
-				bseek := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-					strconv.FormatUint(limit.Offset, 10))
-				rowIter.Seek(bseek.Bytes())
-			}
-			queryRes.isPriKey = true
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		} else if isUniqColumn {
-			ub := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.UniqIndices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, []byte{}, ub.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			queryRes.isPriKey = false
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		} else if isIndexColumn {
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(be.TableInfo.TableId, 10),
-				strconv.FormatUint(be.TableInfo.Indices[where.LeftColumn].Idx, 10),
-				strconv.FormatUint(rightValue, 10))
-			rowIter, err := be.TableOpt.GetRows(be.TableInfo.TableName, []byte{}, b.Bytes())
-			if err != nil {
-				errStr := fmt.Sprintf("Useing where Condition:%s GetRows iterator error:%s", opcode.EQ.String(), err)
-				return nil, errors.New(errStr)
-			}
-			rowIter.Next()
-			queryRes.isPriKey = false
-			queryRes.pointSelect = false
-			queryRes.rowsIterator = rowIter
-			if limit.Count != 0 {
-				queryRes.returnCount = limit.Count
-			}
-		}
-	case opcode.NE:
-		errStr := fmt.Sprintf("Useing where Condition:%s is no support", opcode.NE.String())
-		return nil, errors.New(errStr)
-	case opcode.GE:
-		errStr := fmt.Sprintf("Useing where Condition:%s is no support", opcode.GE.String())
-		return nil, errors.New(errStr)
-	case opcode.LE:
-		errStr := fmt.Sprintf("Useing where Condition:%s is no support", opcode.LE.String())
-		return nil, errors.New(errStr)
-	default:
-		errStr := fmt.Sprintf("Useing where Condition:%s is no support", opcode.EQ.String())
-		return nil, errors.New(errStr)
-	}
-	queryRes.be = be
-	queryRes.columnList = selectFiled
-	return &queryRes, nil
+	runtimeStats map[planner.PhysicalPlan]*runtimeStats //不为nil时记录每个算子的实际行数和耗时
 }
 
 func (be *BaseExecutor) getTableInfo(tableName string) error {
@@ -328,118 +55,158 @@ func (be *BaseExecutor) getTableInfo(tableName string) error {
 	return nil
 }
 
-type QueryResult struct {
-	isPriKey     bool            //是否为主键查询  主键查询可直接拼接key
-	rowsIterator kv.RowsIterator //对外行迭代器
-	pointSelect  bool            //点查结果集 Or 范围查结果集
-	row          *table.Row      //点查结果
-	returnCount  uint64          //对外返回结果集中合法数据总条数
-	hasReturn    uint64          //已经返回的合法数据条数
-	columnList   []string        //选择列
-	be           *BaseExecutor   //
-	validPrefix  string          //键前缀
+//由物理计划构造执行器树
+func (be *BaseExecutor) buildExecutor(plan planner.PhysicalPlan) (Executor, error) {
+	be.bindSubqueries(planExprs(plan))
+	exec, err := be.buildPlanExecutor(plan)
+	if err != nil || be.runtimeStats == nil {
+		return exec, err
+	}
+	stats := &runtimeStats{}
+	be.runtimeStats[plan] = stats
+	return &statsExec{Executor: exec, stats: stats}, nil
 }
 
-func (qr *QueryResult) Next(row *table.Row) bool {
-
-	if qr.pointSelect {
-		tmpRow, err := qr.GetRow()
-		if err != nil {
-			errStr := fmt.Sprintf("get row error:%s", err)
-			excutorLogger.Errorf(errStr)
-			return false
-		}
-		if qr.hasReturn == 1 {
-			return false
-		} else {
-			*row = *tmpRow
-			qr.hasReturn++
-			return true
-		}
+func (be *BaseExecutor) buildPlanExecutor(plan planner.PhysicalPlan) (Executor, error) {
+	switch x := plan.(type) {
+	case *planner.PhysicalPointGet:
+		return &pointGetExec{BaseExecutor: be, plan: x}, nil
+	case *planner.PhysicalTableScan:
+		return be.newTableScanExec(x)
+	case *planner.PhysicalIndexScan:
+		return be.newIndexScanExec(x)
+	case *planner.PhysicalMetaAgg:
+		return &metaAggExec{BaseExecutor: be, plan: x}, nil
+	case *planner.PhysicalNestedLoopJoin, *planner.PhysicalHashJoin, *planner.PhysicalIndexJoin:
+		return be.buildJoinExec(x)
 	}
-	row.ColumnValue = make(map[string]string)
-
-	if !qr.rowsIterator.Valid() {
-		qr.rowsIterator.Close()
-		return false
+	children := plan.Children()
+	if len(children) != 1 {
+		errStr := fmt.Sprintf("plan(%T) no support", plan)
+		return nil, errors.New(errStr)
 	}
-	if qr.validPrefix != "" {
-		if !qr.rowsIterator.ValidForPrefix([]byte(qr.validPrefix)) {
-			qr.rowsIterator.Close()
-			return false
-		}
+	child, err := be.buildExecutor(children[0])
+	if err != nil {
+		return nil, err
 	}
-
-	if (qr.returnCount > 0) && (qr.hasReturn >= qr.returnCount) {
-		qr.rowsIterator.Close()
-		return false
+	switch x := plan.(type) {
+	case *planner.PhysicalSelection:
+		return &selectionExec{childExec: childExec{child: child}, conditions: x.Conditions}, nil
+	case *planner.PhysicalHashAgg:
+		return newHashAggExec(child, x), nil
+	case *planner.PhysicalSort:
+		return newSortExec(child, x.ByItems, 0), nil
+	case *planner.PhysicalTopN:
+		//排序时只保留前offset+count行 再由limit跳过offset行
+		sorter := newSortExec(child, x.ByItems, x.Offset+x.Count)
+		return &limitExec{childExec: childExec{child: sorter}, offset: x.Offset, count: x.Count}, nil
+	case *planner.PhysicalLimit:
+		return &limitExec{childExec: childExec{child: child}, offset: x.Offset, count: x.Count}, nil
+	case *planner.PhysicalProjection:
+		return &projectionExec{childExec: childExec{child: child}, exprs: x.Exprs}, nil
 	}
+	child.Close()
+	errStr := fmt.Sprintf("plan(%T) no support", plan)
+	return nil, errors.New(errStr)
+}
 
-	//范围查询 获取行id
-
-	if qr.isPriKey {
-		//如果查询条件是主键 直接通过迭代器value获取行信息
-		jsoniter := jsoniter.ConfigCompatibleWithStandardLibrary
-		var tmp table.Row
-		jsoniter.Unmarshal(qr.rowsIterator.Value(), &tmp)
-		row.RowId = tmp.RowId
-		for _, column := range qr.columnList {
-			row.ColumnValue[column] = tmp.ColumnValue[column]
-		}
-	} else {
-		//唯一索引 值为rowid
-		rowid := string(qr.rowsIterator.Value())
+//查询结果集 按执行器树逐行返回
+type QueryResult struct {
+	exec    Executor        //根执行器
+	fields  []*table.Column //结果集的列信息
+	point   bool            //点查且没有聚合 可以通过GetRow取出结果
+	closed  bool            //执行器是否已经关闭
+	err     error           //读取中遇到的错误
+	onClose []func()        //关闭时依次调用
+}
 
-		//普通索引 键中取出rowid
-		if rowid == "" {
-			keySlice := strings.Split(string(qr.rowsIterator.Key()), common.Separator)
-			rowid = keySlice[len(keySlice)-1]
-		}
+//执行物理计划得到结果集
+func (be *BaseExecutor) buildQueryResult(plan planner.PhysicalPlan) (*QueryResult, error) {
+	exec, err := be.buildExecutor(plan)
+	if err != nil {
+		return nil, err
+	}
+	qr := &QueryResult{exec: exec, point: isPointPlan(plan)}
+	for _, column := range plan.Schema().Columns {
+		qr.fields = append(qr.fields, column.Info)
+	}
+	return qr, nil
+}
 
-		//拼接行信息键 主键id键
-		b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix, strconv.FormatUint(qr.be.TableInfo.TableId, 10), rowid)
+//计划是否为点查 中间没有聚合
+func isPointPlan(plan planner.PhysicalPlan) bool {
+	switch plan.(type) {
+	case *planner.PhysicalPointGet:
+		return true
+	case *planner.PhysicalHashAgg, *planner.PhysicalMetaAgg:
+		return false
+	}
+	children := plan.Children()
+	return len(children) == 1 && isPointPlan(children[0])
+}
 
-		//for ; qr.rowsIterator.Valid(); qr.rowsIterator.Next() {
-		//	kk := string(qr.rowsIterator.Key())
-		//	vv := string(qr.rowsIterator.Value())
-		//	fmt.Println("k:", kk, ",v:", vv)
-		//}
-		//获取行信息
-		rowtmp, err := qr.be.TableOpt.GetRowByPrimaryField(qr.be.TableInfo.TableName, b.Bytes())
+//结果集的列信息 与Next返回行中的值一一对应
+func (qr *QueryResult) Fields() []*table.Column {
+	return qr.fields
+}
 
-		if err != nil {
-			errStr := fmt.Sprintf("GetRowByPrimaryField error,key:%s", b.String())
-			excutorLogger.Errorf(errStr)
-			qr.rowsIterator.Close()
-			return false
-		}
+//取出下一行 没有数据或出错时关闭结果集并返回false
+func (qr *QueryResult) Next(row *table.Row) bool {
+	if qr.closed {
+		return false
+	}
+	tmp, ok, err := qr.exec.Next()
+	if err != nil {
+		excutorLogger.Errorf("get next row error:%s", err)
+		qr.err = err
+		qr.Close()
+		return false
+	}
+	if !ok {
+		qr.Close()
+		return false
+	}
+	*row = *tmp
+	return true
+}
 
-		row.RowId = rowtmp.RowId
-		//过滤字段数据
-		for _, column := range qr.columnList {
-			row.ColumnValue[column] = rowtmp.ColumnValue[column]
-		}
+//释放迭代器和排序使用的临时文件 结果没有读完时由调用方关闭
+func (qr *QueryResult) Close() {
+	if qr.closed {
+		return
 	}
+	qr.closed = true
+	qr.exec.Close()
+	for _, f := range qr.onClose {
+		f()
+	}
+}
 
-	qr.hasReturn++
-	qr.rowsIterator.Next()
+//结果集关闭时调用f 用于释放读取使用的快照
+func (qr *QueryResult) OnClose(f func()) {
+	qr.onClose = append(qr.onClose, f)
+}
 
-	return true
+//读取中遇到的错误 Next返回false后调用 正常读完时为nil
+func (qr *QueryResult) Err() error {
+	return qr.err
 }
 
+//点查结果
 func (qr *QueryResult) GetRow() (*table.Row, error) {
-
-	if qr.pointSelect {
-		//返回对应列
-		row := table.Row{}
-		row.ColumnValue = make(map[string]string)
-		row.RowId = qr.row.RowId
-		for _, cloumn := range qr.columnList {
-			row.ColumnValue[cloumn] = qr.row.ColumnValue[cloumn]
-		}
-		return &row, nil
-	} else {
+	if !qr.point {
 		errStr := fmt.Sprintf("multi-rows call QueryResult.Next to get row")
 		return nil, errors.New(errStr)
 	}
+	defer qr.Close()
+	row, ok, err := qr.exec.Next()
+	if err != nil {
+		qr.err = err
+		return nil, err
+	}
+	if !ok {
+		errStr := fmt.Sprintf("row not found")
+		return nil, errors.New(errStr)
+	}
+	return row, nil
 }
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type CreateDatabaseExecutor struct {
+	*BaseExecutor
+}
+
+func NewCreateDatabaseExecutor(tableOpt tableOpt.TableOpt) *CreateDatabaseExecutor {
+	return &CreateDatabaseExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//数据库名称和表名一样按小写处理 字符集等选项被忽略
+func (ce *CreateDatabaseExecutor) Exec(stmt *ast.CreateDatabaseStmt) error {
+	name := strings.ToLower(stmt.Name)
+	err := table.CheckTableName(name)
+	if err != nil {
+		errStr := fmt.Sprintf("Incorrect database name '%s'", stmt.Name)
+		return errors.New(errStr)
+	}
+
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	dbInfo, err := ce.TableOpt.GetDatabase(name)
+	if err != nil {
+		return err
+	}
+	if dbInfo != nil {
+		if stmt.IfNotExists {
+			return nil
+		}
+		errStr := fmt.Sprintf("Can't create database '%s'; database exists", stmt.Name)
+		return errors.New(errStr)
+	}
+	dbInfo, err = ce.TableOpt.CreateDatabase(name)
+	if err != nil {
+		return err
+	}
+	excutorLogger.Infof("create database(%s) with id %d", dbInfo.Name, dbInfo.Id)
+	return nil
+}
@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+//每个事务回填的行数
+const BackfillBatchSize = 1024
+
+//一批回填遇到事务冲突时的重试次数
+const backfillRetryLimit = 10
+
+//修改表结构的语句依次执行
+var ddlMu sync.Mutex
+
+type CreateIndexExecutor struct {
+	*BaseExecutor
+}
+
+func NewCreateIndexExecutor(tableOpt tableOpt.TableOpt) *CreateIndexExecutor {
+	return &CreateIndexExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+func (ce *CreateIndexExecutor) Exec(stmt *ast.CreateIndexStmt) error {
+	if stmt.KeyType != ast.IndexKeyTypeNone && stmt.KeyType != ast.IndexKeyTypeUnique {
+		errStr := fmt.Sprintf("index key type(%d) no support", stmt.KeyType)
+		return errors.New(errStr)
+	}
+	columnNames := make([]string, 0, len(stmt.IndexColNames))
+	for _, indexCol := range stmt.IndexColNames {
+		columnNames = append(columnNames, indexCol.Column.Name.L)
+	}
+	tableName, err := fullTableName(ce.TableOpt, stmt.Table)
+	if err != nil {
+		return err
+	}
+	unique := stmt.KeyType == ast.IndexKeyTypeUnique
+	return addIndex(ce.TableOpt, tableName, stmt.IndexName, columnNames, unique, stmt.IfNotExists)
+}
+
+//在已有数据的表上添加索引
+//索引先以只写状态加入表结构 之后的修改都会维护索引 再分批回填已有的行 回填完成后查询才能使用
+//回填失败时删除索引 同一个索引的回填中断后再次执行时从保存的进度继续
+func addIndex(tableOpt tableOpt.TableOpt, tableName, name string, columnNames []string, unique, ifNotExists bool) error {
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	ok, _ := tableOpt.TableExists(tableName)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][CreateIndex] table(%s) is not exists", tableName)
+		return errors.New(errStr)
+	}
+	tableInfo, err := tableOpt.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+
+	index, ok := tableInfo.Indices[strings.ToLower(name)]
+	if ok && !(index.State == table.IndexStateWriteOnly && sameIndex(index, columnNames, unique)) {
+		if ifNotExists {
+			return nil
+		}
+		errStr := fmt.Sprintf("Duplicate key name '%s'", index.Name)
+		return errors.New(errStr)
+	}
+	progress := &table.BackfillProgress{}
+	if ok {
+		//继续没有完成的回填
+		saved, err := tableOpt.GetBackfillProgress(tableName)
+		if err != nil {
+			return err
+		}
+		if saved != nil && saved.IndexId == index.Id {
+			progress = saved
+		}
+		excutorLogger.Infof("resume backfill index(%s) of table(%s) from %d rows", index.Name, tableName, progress.Rows)
+	} else {
+		tableInfo = tableInfo.Clone()
+		index, err = tableInfo.AddIndex(name, columnNames, unique)
+		if err != nil {
+			return err
+		}
+		index.State = table.IndexStateWriteOnly
+		err = tableOpt.SetTableInfo(tableInfo)
+		if err != nil {
+			return err
+		}
+	}
+	progress.IndexId = index.Id
+
+	err = backfillIndex(tableOpt, tableInfo, index, progress)
+	if err != nil {
+		excutorLogger.Warningf("backfill index(%s) of table(%s) error(%s)", index.Name, tableName, err)
+		//索引已经不在表结构中时不会再写入 再删除已经回填的索引键
+		dropInfo := tableInfo.Clone()
+		dropInfo.DropIndex(index.Name)
+		if dropErr := tableOpt.SetTableInfo(dropInfo); dropErr != nil {
+			return dropErr
+		}
+		if dropErr := tableOpt.DeleteIndex(dropInfo, index); dropErr != nil {
+			return dropErr
+		}
+		return err
+	}
+
+	tableInfo = tableInfo.Clone()
+	tableInfo.Indices[index.Name].State = table.IndexStatePublic
+	return tableOpt.SetTableInfo(tableInfo)
+}
+
+//只写状态的索引和要添加的索引定义相同
+func sameIndex(index *table.Index, columnNames []string, unique bool) bool {
+	if index.Unique != unique || len(index.Columns) != len(columnNames) {
+		return false
+	}
+	for i, columnName := range columnNames {
+		if index.Columns[i] != columnName {
+			return false
+		}
+	}
+	return true
+}
+
+//分批回填索引 每批在单独的事务中写入索引键和进度
+func backfillIndex(opt tableOpt.TableOpt, tableInfo *table.MyTableInfo, index *table.Index, progress *table.BackfillProgress) error {
+	for !progress.Done {
+		var batch table.BackfillProgress
+		err := runBatch(opt, func(txn tableOpt.Txn) error {
+			batch = *progress
+			return txn.BackfillIndex(tableInfo, index, &batch, BackfillBatchSize)
+		})
+		if err != nil {
+			return err
+		}
+		*progress = batch
+		excutorLogger.Infof("backfill index(%s) of table(%s): %d rows", index.Name, tableInfo.TableName, progress.Rows)
+	}
+	return nil
+}
+
+//在单独的事务中执行一批修改 遇到事务冲突时重试这一批
+func runBatch(opt tableOpt.TableOpt, fn func(txn tableOpt.Txn) error) error {
+	var err error
+	for i := 0; i <= backfillRetryLimit; i++ {
+		txn := opt.Begin()
+		err = fn(txn)
+		if err != nil {
+			txn.Rollback()
+		} else {
+			err = txn.Commit()
+		}
+		if !kv.IsRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/CDDSCLab/chaosdb/table"
 
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types/parser_driver"
 )
 
 type CreateTableExecutor struct {
@@ -19,8 +21,7 @@ type CreateTableExecutor struct {
 func NewCreateTableExecutor(tableOpt tableOpt.TableOpt) *CreateTableExecutor {
 
 	tableInfo := &table.MyTableInfo{
-		Indices:     make(map[string]*table.Column),
-		UniqIndices: make(map[string]*table.Column),
+		Indices: make(map[string]*table.Index),
 	}
 	return &CreateTableExecutor{BaseExecutor: &BaseExecutor{
 		TableOpt:  tableOpt,
@@ -33,10 +34,25 @@ func (ce *CreateTableExecutor) Exec(createStmtNode *ast.CreateTableStmt) error {
 	//标志
 	ce.IfNotExists = createStmtNode.IfNotExists
 	//表名
-	ce.TableInfo.TableName = createStmtNode.Table.Name.String()
+	ce.TableInfo.TableName = createStmtNode.Table.Name.L
+	err := table.CheckTableName(ce.TableInfo.TableName)
+	if err != nil {
+		return err
+	}
+	//表所在的数据库
+	dbName := createStmtNode.Table.Schema.L
+	dbInfo, err := ce.TableOpt.GetDatabase(dbName)
+	if err != nil {
+		return err
+	}
+	if dbInfo == nil {
+		errStr := fmt.Sprintf("Unknown database '%s'", dbName)
+		return errors.New(errStr)
+	}
+	ce.TableInfo.DBId = dbInfo.Id
 
 	//检测表是否已创建
-	ok, err := ce.TableOpt.TableExists(ce.TableInfo.TableName)
+	ok, err := ce.TableOpt.TableExists(ce.TableInfo.FullName())
 	if ok {
 		if !ce.IfNotExists {
 			errStr := fmt.Sprintf("[executor][parseAst2TableInfo] table(%s) is exists", ce.TableInfo.TableName)
@@ -65,6 +81,10 @@ func (ce *CreateTableExecutor) parseAst2TableInfo(stmt *ast.CreateTableStmt) err
 		column := &table.Column{Idx: uint64(i) + 1, Name: col.Name.Name.L, MysqlType: col.Tp}
 
 		ce.TableInfo.Columns = append(ce.TableInfo.Columns, column)
+		err := ce.parseColumnOptions(column, col.Options)
+		if err != nil {
+			return err
+		}
 	}
 	for _, cons := range stmt.Constraints {
 		err := ce.TableInfo.ParseTableConstraint(cons)
@@ -72,7 +92,57 @@ func (ce *CreateTableExecutor) parseAst2TableInfo(stmt *ast.CreateTableStmt) err
 			return err
 		}
 	}
+	ce.TableInfo.MaxColumnId = uint64(len(ce.TableInfo.Columns))
 	ce.TableInfo.BuildColumnList()
 	//excutorLogger.Infof("[executor][createTable] tableInfo:%s", ce.TableInfo.String())
 	return nil
 }
+
+//解析列定义中的约束 非空约束记录在列类型的Flag中
+func (ce *CreateTableExecutor) parseColumnOptions(column *table.Column, options []*ast.ColumnOption) error {
+	return parseColumnOptions(ce.TableInfo, column, options)
+}
+
+func parseColumnOptions(tableInfo *table.MyTableInfo, column *table.Column, options []*ast.ColumnOption) error {
+	for _, option := range options {
+		switch option.Tp {
+		case ast.ColumnOptionNotNull:
+			column.MysqlType.Flag |= mysql.NotNullFlag
+		case ast.ColumnOptionNull:
+			column.MysqlType.Flag &^= mysql.NotNullFlag
+		case ast.ColumnOptionAutoIncrement:
+			column.MysqlType.Flag |= mysql.AutoIncrementFlag
+		case ast.ColumnOptionPrimaryKey:
+			column.MysqlType.Flag |= mysql.NotNullFlag | mysql.PriKeyFlag
+			tableInfo.PriKey = column
+		case ast.ColumnOptionUniqKey:
+			_, err := tableInfo.AddIndex("", []string{column.Name}, true)
+			if err != nil {
+				return err
+			}
+		case ast.ColumnOptionDefaultValue:
+			valueExpr, ok := option.Expr.(*driver.ValueExpr)
+			if !ok {
+				errStr := fmt.Sprintf("default value of column(%s) must be a constant", column.Name)
+				return errors.New(errStr)
+			}
+			//DEFAULT NULL 等同于没有默认值
+			if valueExpr.Datum.IsNull() {
+				column.DefaultValue = nil
+				continue
+			}
+			//检查默认值能否转换为列类型
+			_, err := column.CastValue(valueExpr.Datum)
+			if err != nil {
+				errStr := fmt.Sprintf("invalid default value for column(%s):%s", column.Name, err)
+				return errors.New(errStr)
+			}
+			defaultValue, err := valueExpr.Datum.ToString()
+			if err != nil {
+				return err
+			}
+			column.DefaultValue = &defaultValue
+		}
+	}
+	return nil
+}
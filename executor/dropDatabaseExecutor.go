@@ -0,0 +1,42 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type DropDatabaseExecutor struct {
+	*BaseExecutor
+}
+
+func NewDropDatabaseExecutor(tableOpt tableOpt.TableOpt) *DropDatabaseExecutor {
+	return &DropDatabaseExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//删除数据库中的全部表 默认数据库不能删除
+func (de *DropDatabaseExecutor) Exec(stmt *ast.DropDatabaseStmt) error {
+	name := strings.ToLower(stmt.Name)
+
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	dbInfo, err := de.TableOpt.GetDatabase(name)
+	if err != nil {
+		return err
+	}
+	if dbInfo == nil {
+		if stmt.IfExists {
+			return nil
+		}
+		errStr := fmt.Sprintf("Can't drop database '%s'; database doesn't exist", stmt.Name)
+		return errors.New(errStr)
+	}
+	return de.TableOpt.DropDatabase(name)
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type DropIndexExecutor struct {
+	*BaseExecutor
+}
+
+func NewDropIndexExecutor(tableOpt tableOpt.TableOpt) *DropIndexExecutor {
+	return &DropIndexExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+func (de *DropIndexExecutor) Exec(stmt *ast.DropIndexStmt) error {
+	tableName, err := fullTableName(de.TableOpt, stmt.Table)
+	if err != nil {
+		return err
+	}
+	return dropIndex(de.TableOpt, tableName, stmt.IndexName, stmt.IfExists)
+}
+
+//先从表结构中删除索引 之后的修改不再写入索引 再删除全部索引键
+func dropIndex(tableOpt tableOpt.TableOpt, tableName, name string, ifExists bool) error {
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	ok, _ := tableOpt.TableExists(tableName)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][DropIndex] table(%s) is not exists", tableName)
+		return errors.New(errStr)
+	}
+	tableInfo, err := tableOpt.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	if _, ok := tableInfo.Indices[strings.ToLower(name)]; !ok && ifExists {
+		return nil
+	}
+	tableInfo = tableInfo.Clone()
+	index, err := tableInfo.DropIndex(name)
+	if err != nil {
+		return err
+	}
+	err = tableOpt.SetTableInfo(tableInfo)
+	if err != nil {
+		return err
+	}
+	return tableOpt.DeleteIndex(tableInfo, index)
+}
@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type DropTableExecutor struct {
+	*BaseExecutor
+}
+
+func NewDropTableExecutor(tableOpt tableOpt.TableOpt) *DropTableExecutor {
+	return &DropTableExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//依次删除语句中的表 IF EXISTS时跳过不存在的表
+func (de *DropTableExecutor) Exec(stmt *ast.DropTableStmt) error {
+	if stmt.IsView {
+		errStr := fmt.Sprintf("drop view no support")
+		return errors.New(errStr)
+	}
+	for _, tableName := range stmt.Tables {
+		name, err := fullTableName(de.TableOpt, tableName)
+		if err != nil {
+			return err
+		}
+		ok, _ := de.TableOpt.TableExists(name)
+		if !ok {
+			if stmt.IfExists {
+				continue
+			}
+			errStr := fmt.Sprintf("[executor][DropTable] table(%s) is not exists", tableName.Name)
+			return errors.New(errStr)
+		}
+		err = de.TableOpt.DropTable(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//执行器 按物理计划树执行 每次返回一行
+//返回的行中的值与计划的Schema一一对应 结果没有读完时由调用方关闭
+type Executor interface {
+	Next() (*table.Row, bool, error)
+	Close()
+}
+
+//只有一个子节点的执行器
+type childExec struct {
+	child Executor
+}
+
+func (e *childExec) Close() {
+	e.child.Close()
+}
+
+//过滤
+type selectionExec struct {
+	childExec
+	conditions []expression.Expression
+}
+
+func (e *selectionExec) Next() (*table.Row, bool, error) {
+	for {
+		row, ok, err := e.child.Next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		ok, err = matchConditions(e.conditions, row)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return row, true, nil
+		}
+	}
+}
+
+//跳过offset行后取count行 count为0时不限制行数
+type limitExec struct {
+	childExec
+	offset uint64
+	count  uint64
+	output uint64 //已经返回的行数
+}
+
+func (e *limitExec) Next() (*table.Row, bool, error) {
+	//取够count行后不再读取子节点 LIMIT 0时直接返回空结果
+	if e.output >= e.count {
+		return nil, false, nil
+	}
+	for ; e.offset > 0; e.offset-- {
+		_, ok, err := e.child.Next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+	row, ok, err := e.child.Next()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	e.output++
+	return row, true, nil
+}
+
+//投影 按选择列表达式求值
+type projectionExec struct {
+	childExec
+	exprs []expression.Expression
+}
+
+func (e *projectionExec) Next() (*table.Row, bool, error) {
+	src, ok, err := e.child.Next()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	row := &table.Row{RowId: src.RowId, Datums: make([]types.Datum, len(e.exprs))}
+	for i, expr := range e.exprs {
+		row.Datums[i], err = expr.Eval(src.Datums)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return row, true, nil
+}
+
+//排序 topN大于0时只保留前topN行 读出全部子节点的数据后再输出
+type sortExec struct {
+	childExec
+	sorter *rowSorter
+	sorted bool
+}
+
+func newSortExec(child Executor, items []*planner.ByItem, topN uint64) *sortExec {
+	return &sortExec{childExec: childExec{child: child}, sorter: newRowSorter(items, topN)}
+}
+
+func (e *sortExec) Next() (*table.Row, bool, error) {
+	if !e.sorted {
+		for {
+			row, ok, err := e.child.Next()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				break
+			}
+			err = e.sorter.add(row)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		err := e.sorter.finish()
+		if err != nil {
+			return nil, false, err
+		}
+		e.sorted = true
+	}
+	return e.sorter.next()
+}
+
+//释放排序使用的临时文件
+func (e *sortExec) Close() {
+	e.child.Close()
+	e.sorter.close()
+}
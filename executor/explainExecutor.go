@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//算子执行时的统计 耗时包括子节点的耗时
+type runtimeStats struct {
+	rows uint64
+	time time.Duration
+}
+
+//记录被包装的执行器返回的行数和耗时
+type statsExec struct {
+	Executor
+	stats *runtimeStats
+}
+
+func (e *statsExec) Next() (*table.Row, bool, error) {
+	start := time.Now()
+	row, ok, err := e.Executor.Next()
+	e.stats.time += time.Since(start)
+	if ok {
+		e.stats.rows++
+	}
+	return row, ok, err
+}
+
+type ExplainExecutor struct {
+	*BaseExecutor
+}
+
+func NewExplainExecutor(tableOpt tableOpt.TableOpt) *ExplainExecutor {
+	return &ExplainExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//EXPLAIN ANALYZE先执行语句 更新和删除会修改数据
+func (ee *ExplainExecutor) Query(plan *planner.Explain) (*QueryResult, error) {
+	var total time.Duration
+	if plan.Analyze {
+		ee.runtimeStats = make(map[planner.PhysicalPlan]*runtimeStats)
+		start := time.Now()
+		err := ee.execute(plan.TargetPlan)
+		if err != nil {
+			return nil, err
+		}
+		total = time.Since(start)
+	}
+	exec := &rowsExec{}
+	for _, explainRow := range plan.Rows {
+		values := []string{explainRow.ID, fmt.Sprintf("%.2f", explainRow.EstRows)}
+		if plan.Analyze {
+			stats := ee.runtimeStats[explainRow.Plan]
+			if explainRow.Plan == nil {
+				//更新和删除的行数为读出的行数
+				stats = &runtimeStats{time: total}
+				if child := ee.runtimeStats[plan.Rows[1].Plan]; child != nil {
+					stats.rows = child.rows
+				}
+			}
+			if stats == nil {
+				//没有执行到的算子
+				stats = &runtimeStats{}
+			}
+			values = append(values, fmt.Sprint(stats.rows), stats.time.String())
+		}
+		values = append(values, explainRow.Info)
+		row := &table.Row{Datums: make([]types.Datum, 0, len(values))}
+		for _, value := range values {
+			row.Datums = append(row.Datums, types.NewStringDatum(value))
+		}
+		exec.rows = append(exec.rows, row)
+	}
+	qr := &QueryResult{exec: exec}
+	for _, column := range plan.Schema().Columns {
+		qr.fields = append(qr.fields, column.Info)
+	}
+	return qr, nil
+}
+
+//执行语句 查询的结果直接丢弃
+func (ee *ExplainExecutor) execute(plan planner.Plan) error {
+	switch x := plan.(type) {
+	case *planner.Update:
+		exec := &UpdateExecutor{BaseExecutor: &BaseExecutor{TableOpt: ee.TableOpt, runtimeStats: ee.runtimeStats}}
+		return exec.Exec(x)
+	case *planner.Delete:
+		exec := &DeleteExecutor{BaseExecutor: &BaseExecutor{TableOpt: ee.TableOpt, runtimeStats: ee.runtimeStats}}
+		return exec.Exec(x)
+	case planner.PhysicalPlan:
+		exec, err := ee.buildExecutor(x)
+		if err != nil {
+			return err
+		}
+		defer exec.Close()
+		for {
+			_, ok, err := exec.Next()
+			if err != nil || !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//内存中的结果行
+type rowsExec struct {
+	rows []*table.Row
+	pos  int
+}
+
+func (e *rowsExec) Next() (*table.Row, bool, error) {
+	if e.pos >= len(e.rows) {
+		return nil, false, nil
+	}
+	row := e.rows[e.pos]
+	e.pos++
+	return row, true, nil
+}
+
+func (e *rowsExec) Close() {}
@@ -0,0 +1,355 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb/types"
+)
+
+//连接 外侧的每一行从内侧取出候选行 组合后按连接条件过滤
+type joinExec struct {
+	outer      Executor
+	inner      innerSource
+	joinType   planner.JoinType
+	innerIdx   int
+	conditions []expression.Expression //等值条件和其他条件 候选行都需要重新判断
+	leftWidth  int
+	rightWidth int
+	pending    []*table.Row //外侧当前行的连接结果中还没有返回的行
+}
+
+//内侧 按外侧的一行返回候选行
+type innerSource interface {
+	rows(outer *table.Row) ([]*table.Row, error)
+	Close()
+}
+
+func (be *BaseExecutor) buildJoinExec(plan planner.PhysicalPlan) (Executor, error) {
+	var e *joinExec
+	var outerKeys, innerKeys []*expression.Column
+	switch x := plan.(type) {
+	case *planner.PhysicalNestedLoopJoin:
+		e = newJoinExec(plan, x.JoinType, x.InnerIdx, x.EqualConditions, x.OtherConditions)
+	case *planner.PhysicalHashJoin:
+		e = newJoinExec(plan, x.JoinType, x.InnerIdx, x.EqualConditions, x.OtherConditions)
+		outerKeys, innerKeys = x.OuterKeys(), x.InnerKeys()
+	case *planner.PhysicalIndexJoin:
+		e = newJoinExec(plan, x.JoinType, x.InnerIdx, x.EqualConditions, x.OtherConditions)
+		inner, err := be.newLookupInner(x)
+		if err != nil {
+			return nil, err
+		}
+		e.inner = inner
+	default:
+		errStr := fmt.Sprintf("plan(%T) no support", plan)
+		return nil, errors.New(errStr)
+	}
+	children := plan.Children()
+	outer, err := be.buildExecutor(children[1-e.innerIdx])
+	if err != nil {
+		return nil, err
+	}
+	e.outer = outer
+	if e.inner != nil {
+		return e, nil
+	}
+	inner, err := be.buildExecutor(children[e.innerIdx])
+	if err != nil {
+		outer.Close()
+		return nil, err
+	}
+	if outerKeys != nil {
+		e.inner = &hashInner{child: inner, outerKeys: outerKeys, innerKeys: innerKeys}
+	} else {
+		e.inner = &nestedLoopInner{child: inner}
+	}
+	return e, nil
+}
+
+func newJoinExec(plan planner.PhysicalPlan, joinType planner.JoinType, innerIdx int, eqConds []*expression.ScalarFunction, otherConds []expression.Expression) *joinExec {
+	children := plan.Children()
+	return &joinExec{
+		joinType:   joinType,
+		innerIdx:   innerIdx,
+		conditions: joinExprs(eqConds, otherConds),
+		leftWidth:  len(children[0].Schema().Columns),
+		rightWidth: len(children[1].Schema().Columns),
+	}
+}
+
+//连接条件 等值条件在前
+func joinExprs(eqConds []*expression.ScalarFunction, otherConds []expression.Expression) []expression.Expression {
+	exprs := make([]expression.Expression, 0, len(eqConds)+len(otherConds))
+	for _, eq := range eqConds {
+		exprs = append(exprs, eq)
+	}
+	return append(exprs, otherConds...)
+}
+
+//组合外侧和内侧的行 左侧的值在前 inner为nil时内侧的列为NULL
+func (e *joinExec) makeRow(outer, inner *table.Row) *table.Row {
+	left, right := outer, inner
+	if e.innerIdx == 0 {
+		left, right = inner, outer
+	}
+	row := &table.Row{Datums: make([]types.Datum, 0, e.leftWidth+e.rightWidth)}
+	if left != nil {
+		row.Datums = append(row.Datums, left.Datums...)
+	} else {
+		row.Datums = append(row.Datums, make([]types.Datum, e.leftWidth)...)
+	}
+	if right != nil {
+		row.Datums = append(row.Datums, right.Datums...)
+	} else {
+		row.Datums = append(row.Datums, make([]types.Datum, e.rightWidth)...)
+	}
+	return row
+}
+
+//外侧的一行和候选行中满足条件的组合 外连接没有匹配的行时输出一行内侧为NULL
+//半连接有匹配时输出外侧的行 反半连接没有匹配时输出 保留行号用于更新和删除
+func (e *joinExec) join(outer *table.Row, inners []*table.Row) ([]*table.Row, error) {
+	if e.joinType == planner.SemiJoin || e.joinType == planner.AntiSemiJoin {
+		matched, err := e.matchAny(outer, inners)
+		if err != nil {
+			return nil, err
+		}
+		if matched == (e.joinType == planner.SemiJoin) {
+			return []*table.Row{outer}, nil
+		}
+		return nil, nil
+	}
+	var rows []*table.Row
+	for _, inner := range inners {
+		row := e.makeRow(outer, inner)
+		ok, err := matchConditions(e.conditions, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 && e.joinType != planner.InnerJoin {
+		rows = append(rows, e.makeRow(outer, nil))
+	}
+	return rows, nil
+}
+
+//候选行中是否有满足条件的行
+func (e *joinExec) matchAny(outer *table.Row, inners []*table.Row) (bool, error) {
+	for _, inner := range inners {
+		ok, err := matchConditions(e.conditions, e.makeRow(outer, inner))
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (e *joinExec) Next() (*table.Row, bool, error) {
+	for len(e.pending) == 0 {
+		outer, ok, err := e.outer.Next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		inners, err := e.inner.rows(outer)
+		if err != nil {
+			return nil, false, err
+		}
+		e.pending, err = e.join(outer, inners)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	row := e.pending[0]
+	e.pending = e.pending[1:]
+	return row, true, nil
+}
+
+func (e *joinExec) Close() {
+	e.outer.Close()
+	e.inner.Close()
+}
+
+//读出子节点的全部行
+func readAll(child Executor) ([]*table.Row, error) {
+	var rows []*table.Row
+	for {
+		row, ok, err := child.Next()
+		if err != nil || !ok {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+//嵌套循环连接的内侧 第一次使用时读到内存中 每个外侧的行都和全部行匹配
+type nestedLoopInner struct {
+	child  Executor
+	loaded bool
+	all    []*table.Row
+}
+
+func (s *nestedLoopInner) rows(outer *table.Row) ([]*table.Row, error) {
+	if !s.loaded {
+		var err error
+		s.all, err = readAll(s.child)
+		if err != nil {
+			return nil, err
+		}
+		s.loaded = true
+	}
+	return s.all, nil
+}
+
+func (s *nestedLoopInner) Close() {
+	s.child.Close()
+}
+
+//哈希连接的内侧 第一次使用时按等值条件的列建哈希表
+type hashInner struct {
+	child     Executor
+	outerKeys []*expression.Column
+	innerKeys []*expression.Column
+	buckets   map[string][]*table.Row
+}
+
+func (s *hashInner) rows(outer *table.Row) ([]*table.Row, error) {
+	if s.buckets == nil {
+		all, err := readAll(s.child)
+		if err != nil {
+			return nil, err
+		}
+		s.buckets = make(map[string][]*table.Row)
+		for _, row := range all {
+			key, ok, err := joinKey(s.innerKeys, row)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				s.buckets[string(key)] = append(s.buckets[string(key)], row)
+			}
+		}
+	}
+	key, ok, err := joinKey(s.outerKeys, outer)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return s.buckets[string(key)], nil
+}
+
+func (s *hashInner) Close() {
+	s.child.Close()
+}
+
+//行在等值条件的列上的哈希键 有NULL时没有匹配的行
+//数字都转换为浮点数 字符串按字节 比较相等的值得到相同的键 不相等的值由连接条件过滤
+func joinKey(keys []*expression.Column, row *table.Row) ([]byte, bool, error) {
+	values := make([]types.Datum, 0, len(keys))
+	for _, key := range keys {
+		d, err := key.Eval(row.Datums)
+		if err != nil {
+			return nil, false, err
+		}
+		if d.IsNull() {
+			return nil, false, nil
+		}
+		if types.IsString(key.Info.MysqlType.Tp) {
+			values = append(values, types.NewBytesDatum(d.GetBytes()))
+			continue
+		}
+		f, err := d.ToFloat64(table.StmtCtx)
+		if err != nil {
+			return nil, false, err
+		}
+		if f == 0 {
+			//-0和0相等
+			f = 0
+		}
+		values = append(values, types.NewFloat64Datum(f))
+	}
+	key, err := codekey.EncodeDatums(nil, values...)
+	if err != nil {
+		return nil, false, err
+	}
+	return key, true, nil
+}
+
+//索引连接的内侧 按外侧的值在主键或索引上查找
+type lookupInner struct {
+	*BaseExecutor
+	plan       *planner.PhysicalIndexJoin
+	outerKeys  []*expression.Column
+	tableInfo  *table.MyTableInfo
+	index      *table.Index //为nil时按主键查找
+	conditions []expression.Expression
+	lock       ast.SelectLockType
+	scan       planner.PhysicalPlan
+	stats      *runtimeStats //EXPLAIN ANALYZE时记录查找得到的行数和耗时
+}
+
+func (be *BaseExecutor) newLookupInner(plan *planner.PhysicalIndexJoin) (*lookupInner, error) {
+	s := &lookupInner{BaseExecutor: be, plan: plan, outerKeys: plan.OuterKeys(), scan: plan.Children()[plan.InnerIdx]}
+	switch x := s.scan.(type) {
+	case *planner.PhysicalTableScan:
+		s.tableInfo, s.conditions, s.lock = x.Table, x.Conditions, x.Lock
+	case *planner.PhysicalIndexScan:
+		s.tableInfo, s.index, s.conditions, s.lock = x.Table, x.Index, x.Conditions, x.Lock
+	default:
+		errStr := fmt.Sprintf("index join inner plan(%T) no support", s.scan)
+		return nil, errors.New(errStr)
+	}
+	//每次查找使用的扫描不经过buildExecutor
+	be.bindSubqueries(s.conditions)
+	if be.runtimeStats != nil {
+		s.stats = &runtimeStats{}
+		be.runtimeStats[s.scan] = s.stats
+	}
+	return s, nil
+}
+
+func (s *lookupInner) rows(outer *table.Row) ([]*table.Row, error) {
+	if s.stats != nil {
+		start := time.Now()
+		defer func() {
+			s.stats.time += time.Since(start)
+		}()
+	}
+	values := make([]types.Datum, 0, len(s.outerKeys))
+	for _, key := range s.outerKeys {
+		d, err := key.Eval(outer.Datums)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, d)
+	}
+	ranges, err := s.plan.LookupRanges(values)
+	if err != nil || len(ranges) == 0 {
+		return nil, err
+	}
+	iter, err := rangesIterator(s.TableOpt, s.tableInfo.FullName(), ranges, false)
+	if err != nil {
+		return nil, err
+	}
+	scan := &scanExec{BaseExecutor: s.BaseExecutor, tableInfo: s.tableInfo, index: s.index, conditions: s.conditions, lock: s.lock, iter: iter}
+	defer scan.Close()
+	rows, err := readAll(scan)
+	if err != nil {
+		return nil, err
+	}
+	if s.stats != nil {
+		s.stats.rows += uint64(len(rows))
+	}
+	return rows, nil
+}
+
+func (s *lookupInner) Close() {}
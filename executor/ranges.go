@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/planner"
+)
+
+//按顺序扫描多个范围 跳过空范围 desc为真时从后向前扫描
+func rangesIterator(tableOpt tableOpt.TableOpt, tableName string, ranges []planner.KeyRange, desc bool) (kv.RowsIterator, error) {
+	iters := make([]kv.RowsIterator, 0, len(ranges))
+	for i := range ranges {
+		r := ranges[i]
+		if desc {
+			r = ranges[len(ranges)-1-i]
+		}
+		if len(r.EndKey) > 0 && bytes.Compare(r.StartKey, r.EndKey) >= 0 {
+			continue
+		}
+		var iter kv.RowsIterator
+		var err error
+		if desc {
+			iter, err = tableOpt.GetRowsReverse(tableName, r.StartKey, r.EndKey)
+		} else {
+			iter, err = tableOpt.GetRows(tableName, r.StartKey, r.EndKey)
+		}
+		if err != nil {
+			for _, it := range iters {
+				it.Close()
+			}
+			errStr := fmt.Sprintf("GetRows iterator error:%s", err)
+			return nil, errors.New(errStr)
+		}
+		iters = append(iters, iter)
+	}
+	if len(iters) == 1 {
+		return iters[0], nil
+	}
+	it := &multiRangeIterator{iters: iters}
+	it.skipInvalid()
+	return it, nil
+}
+
+//依次遍历多个迭代器
+type multiRangeIterator struct {
+	iters []kv.RowsIterator
+}
+
+//关闭已经遍历完的迭代器
+func (it *multiRangeIterator) skipInvalid() {
+	for len(it.iters) > 0 && !it.iters[0].Valid() {
+		it.iters[0].Close()
+		it.iters = it.iters[1:]
+	}
+}
+
+func (it *multiRangeIterator) Key() []byte {
+	return it.iters[0].Key()
+}
+
+func (it *multiRangeIterator) Value() []byte {
+	return it.iters[0].Value()
+}
+
+func (it *multiRangeIterator) Next() {
+	it.iters[0].Next()
+	it.skipInvalid()
+}
+
+func (it *multiRangeIterator) Valid() bool {
+	return len(it.iters) > 0
+}
+
+func (it *multiRangeIterator) ValidForPrefix(prefix []byte) bool {
+	return it.Valid() && it.iters[0].ValidForPrefix(prefix)
+}
+
+func (it *multiRangeIterator) Close() {
+	for _, iter := range it.iters {
+		iter.Close()
+	}
+	it.iters = nil
+}
+
+func (it *multiRangeIterator) Seek(key []byte) kv.RowsIterator {
+	for len(it.iters) > 0 {
+		it.iters[0].Seek(key)
+		if it.iters[0].Valid() {
+			break
+		}
+		it.iters[0].Close()
+		it.iters = it.iters[1:]
+	}
+	return it
+}
@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type RenameTableExecutor struct {
+	*BaseExecutor
+}
+
+func NewRenameTableExecutor(tableOpt tableOpt.TableOpt) *RenameTableExecutor {
+	return &RenameTableExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//按顺序依次修改表名 可以通过中间表名交换两个表
+func (re *RenameTableExecutor) Exec(stmt *ast.RenameTableStmt) error {
+	tableToTables := stmt.TableToTables
+	if len(tableToTables) == 0 {
+		tableToTables = []*ast.TableToTable{{OldTable: stmt.OldTable, NewTable: stmt.NewTable}}
+	}
+	for _, tableToTable := range tableToTables {
+		oldName, err := fullTableName(re.TableOpt, tableToTable.OldTable)
+		if err != nil {
+			return err
+		}
+		_, err = renameTable(re.TableOpt, oldName, tableToTable.NewTable)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//新表名指定其他数据库时把表移动到该数据库中 返回新表名对应的元数据名称
+func renameTable(opt tableOpt.TableOpt, oldName string, newName *ast.TableName) (string, error) {
+	ddlMu.Lock()
+	defer ddlMu.Unlock()
+
+	ok, _ := opt.TableExists(oldName)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][RenameTable] table(%s) is not exists", oldName)
+		return "", errors.New(errStr)
+	}
+	err := table.CheckTableName(newName.Name.L)
+	if err != nil {
+		return "", err
+	}
+	dbInfo, err := opt.GetDatabase(newName.Schema.L)
+	if err != nil {
+		return "", err
+	}
+	if dbInfo == nil {
+		errStr := fmt.Sprintf("Unknown database '%s'", newName.Schema)
+		return "", errors.New(errStr)
+	}
+	err = opt.RenameTable(oldName, dbInfo.Id, newName.Name.L)
+	if err != nil {
+		return "", err
+	}
+	return dbInfo.FullTableName(newName.Name.L), nil
+}
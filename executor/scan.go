@@ -0,0 +1,240 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb/types"
+)
+
+//行是否满足全部过滤条件
+func matchConditions(conds []expression.Expression, row *table.Row) (bool, error) {
+	for _, cond := range conds {
+		ok, err := expression.EvalBool(cond, row.Datums)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+//按行号读取整行数据
+func getRow(tableOpt tableOpt.TableOpt, tableInfo *table.MyTableInfo, rowId uint64) (*table.Row, error) {
+	//构造主键key tb{tableId}_r{rowId}
+	b := codekey.EncodeRowKey(tableInfo.TableId, rowId)
+	row, err := tableOpt.GetRowByPrimaryField(tableInfo.FullName(), b)
+	if err != nil {
+		errStr := fmt.Sprintf("GetRowByPrimaryField error,key:%x", b)
+		return nil, errors.New(errStr)
+	}
+	return row, nil
+}
+
+//给行加锁后读取加锁时的最新数据 行已经被删除时返回nil
+//FOR UPDATE加排他锁 LOCK IN SHARE MODE加共享锁 行的索引键一起加锁
+func lockRow(tableOpt tableOpt.TableOpt, tableInfo *table.MyTableInfo, rowId uint64, lock ast.SelectLockType) (*table.Row, error) {
+	exclusive := lock == ast.SelectLockForUpdate
+	key := codekey.EncodeRowKey(tableInfo.TableId, rowId)
+	err := tableOpt.LockKeys([][]byte{key}, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	row, err := getRow(tableOpt, tableInfo, rowId)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	//修改行的事务提交时需要行锁 持有行锁时行的索引键不会被其他事务修改
+	indexKeys, err := tableInfo.IndexKeys(row)
+	if err != nil {
+		return nil, err
+	}
+	err = tableOpt.LockKeys(indexKeys, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+//迭代器当前位置对应的整行数据 isPriKey表示迭代的是行数据还是索引
+func iteratorRow(tableOpt tableOpt.TableOpt, tableInfo *table.MyTableInfo, iter kv.RowsIterator, isPriKey bool) (*table.Row, error) {
+	if isPriKey {
+		//如果查询条件是主键 直接通过迭代器value获取行信息
+		_, rowid, err := codekey.DecodeRowKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		return tableInfo.DecodeRow(rowid, iter.Value())
+	}
+	//索引的值均为rowid
+	rowid, err := codekey.DecodeIndexValue(iter.Value())
+	if err != nil {
+		return nil, err
+	}
+	row, err := getRow(tableOpt, tableInfo, rowid)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		errStr := fmt.Sprintf("GetRowByPrimaryField error,key:%x", codekey.EncodeRowKey(tableInfo.TableId, rowid))
+		return nil, errors.New(errStr)
+	}
+	return row, nil
+}
+
+//由索引键得到行数据 索引列和数字主键之外的列为NULL
+func indexKeyRow(tableInfo *table.MyTableInfo, index *table.Index, key, value []byte) (*table.Row, error) {
+	rowId, err := codekey.DecodeIndexValue(value)
+	if err != nil {
+		return nil, err
+	}
+	row := &table.Row{RowId: rowId, Datums: make([]types.Datum, len(tableInfo.Columns))}
+	columns, err := tableInfo.IndexColumns(index)
+	if err != nil {
+		return nil, err
+	}
+	b := key[len(codekey.EncodeIndexPrefix(tableInfo.TableId, index.Id)):]
+	for _, column := range columns {
+		var d types.Datum
+		b, d, err = codekey.DecodeDatum(b)
+		if err != nil {
+			return nil, err
+		}
+		//索引键中字符串解码为字节 小数按最大精度解码 转换回列类型
+		row.Datums[tableInfo.ColumnOffset(column.Idx)], err = column.CastValue(d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if priKey := tableInfo.PriKey; priKey != nil && types.IsTypeNumeric(priKey.MysqlType.Tp) {
+		row.Datums[tableInfo.ColumnOffset(priKey.Idx)], err = priKey.CastValue(types.NewUintDatum(rowId))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+//主键点查
+type pointGetExec struct {
+	*BaseExecutor
+	plan *planner.PhysicalPointGet
+	pos  int
+}
+
+func (e *pointGetExec) Next() (*table.Row, bool, error) {
+	for e.pos < len(e.plan.RowIds) {
+		rowId := e.plan.RowIds[e.pos]
+		e.pos++
+		var row *table.Row
+		var err error
+		if e.plan.Lock != ast.SelectLockNone {
+			row, err = lockRow(e.TableOpt, e.plan.Table, rowId, e.plan.Lock)
+		} else {
+			row, err = getRow(e.TableOpt, e.plan.Table, rowId)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if row == nil {
+			continue
+		}
+		//其余条件不满足时结果为空
+		ok, err := matchConditions(e.plan.Conditions, row)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return row, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (e *pointGetExec) Close() {}
+
+//按范围扫描行数据或索引 取出的行经过过滤条件
+type scanExec struct {
+	*BaseExecutor
+	tableInfo  *table.MyTableInfo
+	index      *table.Index //扫描索引时不为nil
+	covering   bool
+	conditions []expression.Expression
+	lock       ast.SelectLockType
+	iter       kv.RowsIterator
+}
+
+func (be *BaseExecutor) newTableScanExec(plan *planner.PhysicalTableScan) (*scanExec, error) {
+	iter, err := rangesIterator(be.TableOpt, plan.Table.FullName(), plan.Ranges, plan.Desc)
+	if err != nil {
+		return nil, err
+	}
+	return &scanExec{BaseExecutor: be, tableInfo: plan.Table, conditions: plan.Conditions, lock: plan.Lock, iter: iter}, nil
+}
+
+func (be *BaseExecutor) newIndexScanExec(plan *planner.PhysicalIndexScan) (*scanExec, error) {
+	iter, err := rangesIterator(be.TableOpt, plan.Table.FullName(), plan.Ranges, plan.Desc)
+	if err != nil {
+		errStr := fmt.Sprintf("Useing index(%s) GetRows iterator error:%s", plan.Index.Name, err)
+		return nil, errors.New(errStr)
+	}
+	return &scanExec{
+		BaseExecutor: be,
+		tableInfo:    plan.Table,
+		index:        plan.Index,
+		covering:     plan.Covering,
+		conditions:   plan.Conditions,
+		lock:         plan.Lock,
+		iter:         iter,
+	}, nil
+}
+
+//迭代器当前位置对应的行数据
+func (e *scanExec) currentRow() (*table.Row, error) {
+	if e.covering {
+		return indexKeyRow(e.tableInfo, e.index, e.iter.Key(), e.iter.Value())
+	}
+	return iteratorRow(e.TableOpt, e.tableInfo, e.iter, e.index == nil)
+}
+
+func (e *scanExec) Next() (*table.Row, bool, error) {
+	for e.iter.Valid() {
+		row, err := e.currentRow()
+		if err != nil {
+			return nil, false, err
+		}
+		e.iter.Next()
+
+		//加锁后重新读取 快照之后被删除的行跳过
+		if e.lock != ast.SelectLockNone {
+			row, err = lockRow(e.TableOpt, e.tableInfo, row.RowId, e.lock)
+			if err != nil {
+				return nil, false, err
+			}
+			if row == nil {
+				continue
+			}
+		}
+
+		//过滤不满足条件的数据
+		ok, err := matchConditions(e.conditions, row)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return row, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (e *scanExec) Close() {
+	e.iter.Close()
+}
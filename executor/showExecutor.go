@@ -0,0 +1,200 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type ShowExecutor struct {
+	*BaseExecutor
+}
+
+func NewShowExecutor(tableOpt tableOpt.TableOpt) *ShowExecutor {
+	return &ShowExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+//结果行全部在内存中生成 再经过LIKE和WHERE条件过滤
+func (se *ShowExecutor) Query(plan *planner.Show) (*QueryResult, error) {
+	var rows [][]interface{}
+	var err error
+	switch plan.Tp {
+	case ast.ShowDatabases:
+		rows, err = se.showDatabases()
+	case ast.ShowTables:
+		rows, err = se.showTables(plan)
+	case ast.ShowColumns:
+		rows = showColumns(plan.Table, plan.Column)
+	case ast.ShowIndex:
+		rows = showIndex(plan.Table)
+	case ast.ShowCreateTable:
+		rows = [][]interface{}{{plan.Table.TableName, ShowCreateTable(plan.Table)}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	exec := &rowsExec{}
+	for _, values := range rows {
+		row := &table.Row{Datums: types.MakeDatums(values...)}
+		ok, err := matchConditions(plan.Conditions, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			exec.rows = append(exec.rows, row)
+		}
+	}
+	qr := &QueryResult{exec: exec}
+	for _, column := range plan.Schema().Columns {
+		qr.fields = append(qr.fields, column.Info)
+	}
+	return qr, nil
+}
+
+func (se *ShowExecutor) showDatabases() ([][]interface{}, error) {
+	dbInfos, err := se.TableOpt.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, 0, len(dbInfos))
+	for _, dbInfo := range dbInfos {
+		rows = append(rows, []interface{}{dbInfo.Name})
+	}
+	return rows, nil
+}
+
+func (se *ShowExecutor) showTables(plan *planner.Show) ([][]interface{}, error) {
+	tableNames, err := se.TableOpt.ListTables(plan.DB)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		row := []interface{}{tableName}
+		if plan.Full {
+			row = append(row, "BASE TABLE")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+//DESCRIBE和SHOW COLUMNS 每列一行
+func showColumns(tableInfo *table.MyTableInfo, columnName string) [][]interface{} {
+	var rows [][]interface{}
+	for _, column := range tableInfo.Columns {
+		if columnName != "" && column.Name != columnName {
+			continue
+		}
+		null := "YES"
+		if column.NotNull() {
+			null = "NO"
+		}
+		var defaultValue interface{}
+		if column.DefaultValue != nil {
+			defaultValue = *column.DefaultValue
+		}
+		extra := ""
+		if mysql.HasAutoIncrementFlag(column.MysqlType.Flag) {
+			extra = "auto_increment"
+		}
+		rows = append(rows, []interface{}{column.Name, column.MysqlType.InfoSchemaStr(), null, columnKey(tableInfo, column), defaultValue, extra})
+	}
+	return rows
+}
+
+//和mysql一样 主键列为PRI 单列唯一索引的列为UNI 其他索引的第一列为MUL
+func columnKey(tableInfo *table.MyTableInfo, column *table.Column) string {
+	if tableInfo.PriKey != nil && tableInfo.PriKey.Idx == column.Idx {
+		return "PRI"
+	}
+	if index, ok := tableInfo.Indices[table.PrimaryIndexName]; ok && index.HasColumn(column.Name) {
+		return "PRI"
+	}
+	key := ""
+	for _, index := range tableInfo.IndexList() {
+		if index.Columns[0] != column.Name {
+			continue
+		}
+		if index.Unique && len(index.Columns) == 1 {
+			return "UNI"
+		}
+		key = "MUL"
+	}
+	return key
+}
+
+//每个索引的每列一行 单列主键作为PRIMARY索引
+func showIndex(tableInfo *table.MyTableInfo) [][]interface{} {
+	var rows [][]interface{}
+	if priKey := tableInfo.PriKey; priKey != nil {
+		rows = append(rows, []interface{}{tableInfo.TableName, 0, "PRIMARY", 1, priKey.Name, "", "BTREE", "YES"})
+	}
+	for _, index := range tableInfo.IndexList() {
+		name := index.Name
+		if name == table.PrimaryIndexName {
+			name = "PRIMARY"
+		}
+		nonUnique := 1
+		if index.Unique {
+			nonUnique = 0
+		}
+		//回填没有完成的索引查询不可用
+		visible := "YES"
+		if index.State != table.IndexStatePublic {
+			visible = "NO"
+		}
+		for i, columnName := range index.Columns {
+			null := ""
+			if column, err := tableInfo.FindCol(tableInfo.Columns, columnName); err == nil && !column.NotNull() {
+				null = "YES"
+			}
+			rows = append(rows, []interface{}{tableInfo.TableName, nonUnique, name, i + 1, columnName, null, "BTREE", visible})
+		}
+	}
+	return rows
+}
+
+//由表信息重新生成建表语句
+func ShowCreateTable(tableInfo *table.MyTableInfo) string {
+	lines := make([]string, 0, len(tableInfo.Columns)+len(tableInfo.Indices)+1)
+	for _, column := range tableInfo.Columns {
+		line := fmt.Sprintf("  `%s` %s", column.Name, column.MysqlType.InfoSchemaStr())
+		if column.NotNull() {
+			line += " NOT NULL"
+		}
+		if column.DefaultValue != nil {
+			line += fmt.Sprintf(" DEFAULT '%s'", strings.Replace(*column.DefaultValue, "'", "''", -1))
+		} else if !column.NotNull() {
+			line += " DEFAULT NULL"
+		}
+		if mysql.HasAutoIncrementFlag(column.MysqlType.Flag) {
+			line += " AUTO_INCREMENT"
+		}
+		lines = append(lines, line)
+	}
+	if priKey := tableInfo.PriKey; priKey != nil {
+		lines = append(lines, fmt.Sprintf("  PRIMARY KEY (`%s`)", priKey.Name))
+	}
+	for _, index := range tableInfo.IndexList() {
+		columns := "`" + strings.Join(index.Columns, "`,`") + "`"
+		switch {
+		case index.Name == table.PrimaryIndexName:
+			lines = append(lines, fmt.Sprintf("  PRIMARY KEY (%s)", columns))
+		case index.Unique:
+			lines = append(lines, fmt.Sprintf("  UNIQUE KEY `%s` (%s)", index.Name, columns))
+		default:
+			lines = append(lines, fmt.Sprintf("  KEY `%s` (%s)", index.Name, columns))
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE `%s` (\n%s\n)", tableInfo.TableName, strings.Join(lines, ",\n"))
+}
@@ -0,0 +1,357 @@
+package executor
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/rowcodec"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//排序时内存中保留数据的上限(字节) 超过后将已排序的数据写入临时文件
+var sortMemoryLimit int64 = 64 << 20
+
+//待排序的行 keys为排序项的值 seq为读入顺序 排序项相同时保持读入顺序
+type sortRow struct {
+	row  *table.Row
+	keys []types.Datum
+	seq  uint64
+}
+
+//排序 数据超过内存上限时分段排序写入临时文件 最后多路归并
+//topN大于0时只保留前topN行 不使用临时文件
+type rowSorter struct {
+	items   []*planner.ByItem
+	topN    uint64
+	rows    []*sortRow
+	memSize int64
+	seq     uint64
+	runs    []*sortRun
+	merger  *runMerger
+	pos     int
+	err     error
+}
+
+func newRowSorter(items []*planner.ByItem, topN uint64) *rowSorter {
+	return &rowSorter{items: items, topN: topN}
+}
+
+func (s *rowSorter) newSortRow(row *table.Row, seq uint64) (*sortRow, error) {
+	sr := &sortRow{row: row, keys: make([]types.Datum, len(s.items)), seq: seq}
+	for i, item := range s.items {
+		d, err := item.Expr.Eval(row.Datums)
+		if err != nil {
+			return nil, err
+		}
+		sr.keys[i] = d
+	}
+	return sr, nil
+}
+
+//比较两行 NULL最小 比较出错时记录错误
+func (s *rowSorter) less(a, b *sortRow) bool {
+	for i, item := range s.items {
+		cmp, err := compareNullable(a.keys[i], b.keys[i])
+		if err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			return false
+		}
+		if cmp == 0 {
+			continue
+		}
+		if item.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return a.seq < b.seq
+}
+
+func compareNullable(a, b types.Datum) (int, error) {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0, nil
+	case a.IsNull():
+		return -1, nil
+	case b.IsNull():
+		return 1, nil
+	}
+	return a.CompareDatum(table.StmtCtx, &b)
+}
+
+//加入一行
+func (s *rowSorter) add(row *table.Row) error {
+	sr, err := s.newSortRow(row, s.seq)
+	if err != nil {
+		return err
+	}
+	s.seq++
+	if s.topN > 0 {
+		//大顶堆 保留最小的topN行
+		if uint64(len(s.rows)) < s.topN {
+			heap.Push((*topNHeap)(s), sr)
+		} else if s.less(sr, s.rows[0]) {
+			s.rows[0] = sr
+			heap.Fix((*topNHeap)(s), 0)
+		}
+		return s.err
+	}
+	s.rows = append(s.rows, sr)
+	s.memSize += rowMemSize(row)
+	if s.memSize > sortMemoryLimit {
+		return s.spill()
+	}
+	return nil
+}
+
+//估算一行数据占用的内存
+func rowMemSize(row *table.Row) int64 {
+	size := int64(64)
+	for i := range row.Datums {
+		size += 72
+		switch row.Datums[i].Kind() {
+		case types.KindString, types.KindBytes:
+			size += int64(len(row.Datums[i].GetBytes()))
+		}
+	}
+	return size
+}
+
+//内存中的数据排序
+func (s *rowSorter) sortRows() error {
+	sort.Slice(s.rows, func(i, j int) bool {
+		return s.less(s.rows[i], s.rows[j])
+	})
+	return s.err
+}
+
+//内存中的数据排序后写入临时文件
+func (s *rowSorter) spill() error {
+	err := s.sortRows()
+	if err != nil {
+		return err
+	}
+	run, err := newSortRun(s.rows)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+	s.rows = nil
+	s.memSize = 0
+	return nil
+}
+
+//数据全部加入后排序 之后通过next按顺序取出
+func (s *rowSorter) finish() error {
+	if len(s.runs) == 0 {
+		return s.sortRows()
+	}
+	if len(s.rows) > 0 {
+		err := s.spill()
+		if err != nil {
+			return err
+		}
+	}
+	merger := &runMerger{sorter: s}
+	for _, run := range s.runs {
+		err := merger.push(run)
+		if err != nil {
+			return err
+		}
+	}
+	s.merger = merger
+	return nil
+}
+
+//按顺序取出下一行
+func (s *rowSorter) next() (*table.Row, bool, error) {
+	if s.merger != nil {
+		return s.merger.next()
+	}
+	if s.pos >= len(s.rows) {
+		return nil, false, nil
+	}
+	row := s.rows[s.pos].row
+	s.pos++
+	return row, true, nil
+}
+
+//删除临时文件
+func (s *rowSorter) close() {
+	for _, run := range s.runs {
+		run.close()
+	}
+	s.runs = nil
+	s.rows = nil
+}
+
+//topN使用的大顶堆 堆顶为当前保留的最大行
+type topNHeap rowSorter
+
+func (h *topNHeap) Len() int           { return len(h.rows) }
+func (h *topNHeap) Less(i, j int) bool { return (*rowSorter)(h).less(h.rows[j], h.rows[i]) }
+func (h *topNHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *topNHeap) Push(x interface{}) { h.rows = append(h.rows, x.(*sortRow)) }
+func (h *topNHeap) Pop() interface{} {
+	last := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return last
+}
+
+//临时文件中的一段有序数据
+//每行的格式为 长度(uvarint) 读入顺序(8字节) 行号(8字节) 行数据
+//行数据按值的位置编码 排序的数据可能是聚合结果 不一定和表结构一致
+type sortRun struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+func newSortRun(rows []*sortRow) (*sortRun, error) {
+	file, err := ioutil.TempFile("", "chaosdb_sort")
+	if err != nil {
+		return nil, err
+	}
+	run := &sortRun{file: file}
+	writer := bufio.NewWriter(file)
+	head := make([]byte, binary.MaxVarintLen64+16)
+	for _, sr := range rows {
+		value, err := encodeSortRow(sr.row)
+		if err != nil {
+			run.close()
+			return nil, err
+		}
+		n := binary.PutUvarint(head, uint64(16+len(value)))
+		binary.BigEndian.PutUint64(head[n:], sr.seq)
+		binary.BigEndian.PutUint64(head[n+8:], sr.row.RowId)
+		_, err = writer.Write(head[:n+16])
+		if err == nil {
+			_, err = writer.Write(value)
+		}
+		if err != nil {
+			run.close()
+			return nil, err
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		run.close()
+		return nil, err
+	}
+	run.reader = bufio.NewReader(file)
+	return run, nil
+}
+
+//读出下一行 没有数据时返回nil
+func (r *sortRun) next() (seq uint64, row *table.Row, err error) {
+	size, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if size < 16 {
+		errStr := fmt.Sprintf("sort run row size(%d) is invalid", size)
+		return 0, nil, errors.New(errStr)
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r.reader, buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	seq = binary.BigEndian.Uint64(buf)
+	row, err = decodeSortRow(binary.BigEndian.Uint64(buf[8:]), buf[16:])
+	return seq, row, err
+}
+
+func encodeSortRow(row *table.Row) ([]byte, error) {
+	positions := make([]uint64, len(row.Datums))
+	for i := range positions {
+		positions[i] = uint64(i)
+	}
+	return rowcodec.EncodeRow(positions, row.Datums)
+}
+
+func decodeSortRow(rowId uint64, value []byte) (*table.Row, error) {
+	values, err := rowcodec.DecodeRow(value)
+	if err != nil {
+		return nil, err
+	}
+	row := &table.Row{RowId: rowId, Datums: make([]types.Datum, len(values))}
+	for i := range row.Datums {
+		d, ok := values[uint64(i)]
+		if !ok {
+			errStr := fmt.Sprintf("sort run row has no value at %d", i)
+			return nil, errors.New(errStr)
+		}
+		row.Datums[i] = d
+	}
+	return row, nil
+}
+
+func (r *sortRun) close() {
+	r.file.Close()
+	os.Remove(r.file.Name())
+}
+
+//多路归并 堆中保存每段数据的当前行
+type runMerger struct {
+	sorter *rowSorter
+	heads  []*mergeHead
+}
+
+type mergeHead struct {
+	row *sortRow
+	run *sortRun
+}
+
+//读入一段数据的下一行放入堆中
+func (m *runMerger) push(run *sortRun) error {
+	seq, row, err := run.next()
+	if err != nil || row == nil {
+		return err
+	}
+	sr, err := m.sorter.newSortRow(row, seq)
+	if err != nil {
+		return err
+	}
+	heap.Push(m, &mergeHead{row: sr, run: run})
+	return m.sorter.err
+}
+
+func (m *runMerger) next() (*table.Row, bool, error) {
+	if len(m.heads) == 0 {
+		return nil, false, nil
+	}
+	head := heap.Pop(m).(*mergeHead)
+	err := m.push(head.run)
+	if err != nil {
+		return nil, false, err
+	}
+	return head.row.row, true, nil
+}
+
+func (m *runMerger) Len() int           { return len(m.heads) }
+func (m *runMerger) Less(i, j int) bool { return m.sorter.less(m.heads[i].row, m.heads[j].row) }
+func (m *runMerger) Swap(i, j int)      { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+func (m *runMerger) Push(x interface{}) { m.heads = append(m.heads, x.(*mergeHead)) }
+func (m *runMerger) Pop() interface{} {
+	last := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return last
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+func newSortTable() *table.MyTableInfo {
+	return &table.MyTableInfo{
+		TableId:   1,
+		TableName: "t",
+		Columns: []*table.Column{
+			{Idx: 1, Name: "a", MysqlType: field_types.NewFieldType(mysql.TypeLonglong)},
+			{Idx: 2, Name: "s", MysqlType: field_types.NewFieldType(mysql.TypeVarchar)},
+		},
+	}
+}
+
+func sortedRowIds(t *testing.T, s *rowSorter, rows []*table.Row) []uint64 {
+	for _, row := range rows {
+		if err := s.add(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint64
+	for {
+		row, ok, err := s.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		ids = append(ids, row.RowId)
+	}
+	return ids
+}
+
+func TestRowSorter(t *testing.T) {
+	tableInfo := newSortTable()
+	values := []interface{}{5, 3, nil, 3, 8, 1, 7, nil, 2, 3}
+	var rows []*table.Row
+	for i, v := range values {
+		row := &table.Row{RowId: uint64(i + 1), Datums: []types.Datum{types.NewDatum(v), types.NewStringDatum("s")}}
+		rows = append(rows, row)
+	}
+	column := &expression.Column{Offset: 0, Name: "a", Info: tableInfo.Columns[0]}
+	asc := []*planner.ByItem{{Expr: column}}
+	desc := []*planner.ByItem{{Expr: column, Desc: true}}
+
+	//NULL最小 值相同时保持读入顺序
+	ascIds := []uint64{3, 8, 6, 9, 2, 4, 10, 1, 7, 5}
+	descIds := []uint64{5, 7, 1, 2, 4, 10, 9, 6, 3, 8}
+
+	cases := []struct {
+		items []*planner.ByItem
+		topN  uint64
+		limit int64
+		ids   []uint64
+	}{
+		{asc, 0, 64 << 20, ascIds},
+		{desc, 0, 64 << 20, descIds},
+		//每行都写入临时文件 多路归并
+		{asc, 0, 1, ascIds},
+		{desc, 0, 1, descIds},
+		{asc, 0, 300, ascIds},
+		{asc, 4, 1, ascIds[:4]},
+		{desc, 3, 64 << 20, descIds[:3]},
+		{desc, 20, 64 << 20, descIds},
+	}
+	defer func(limit int64) { sortMemoryLimit = limit }(sortMemoryLimit)
+	for i, ca := range cases {
+		sortMemoryLimit = ca.limit
+		s := newRowSorter(ca.items, ca.topN)
+		ids := sortedRowIds(t, s, rows)
+		runs := s.runs
+		s.close()
+		if !reflect.DeepEqual(ids, ca.ids) {
+			t.Fatalf("case %d: got %v, want %v", i, ids, ca.ids)
+		}
+		if ca.topN == 0 && ca.limit < 64<<20 && len(runs) < 2 {
+			t.Fatalf("case %d: expect spilled runs, got %d", i, len(runs))
+		}
+		for _, run := range runs {
+			if _, err := os.Stat(run.file.Name()); !os.IsNotExist(err) {
+				t.Fatalf("case %d: temp file %s not removed", i, filepath.Base(run.file.Name()))
+			}
+		}
+	}
+}
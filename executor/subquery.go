@@ -0,0 +1,96 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//物理计划中求值的表达式
+func planExprs(plan planner.PhysicalPlan) []expression.Expression {
+	switch x := plan.(type) {
+	case *planner.PhysicalPointGet:
+		return x.Conditions
+	case *planner.PhysicalTableScan:
+		return x.Conditions
+	case *planner.PhysicalIndexScan:
+		return x.Conditions
+	case *planner.PhysicalSelection:
+		return x.Conditions
+	case *planner.PhysicalNestedLoopJoin:
+		return joinExprs(x.EqualConditions, x.OtherConditions)
+	case *planner.PhysicalHashJoin:
+		return joinExprs(x.EqualConditions, x.OtherConditions)
+	case *planner.PhysicalIndexJoin:
+		return joinExprs(x.EqualConditions, x.OtherConditions)
+	case *planner.PhysicalHashAgg:
+		exprs := append([]expression.Expression{}, x.GroupBy...)
+		for _, aggFunc := range x.AggFuncs {
+			exprs = append(exprs, aggFunc.Args...)
+		}
+		return exprs
+	case *planner.PhysicalSort:
+		return byItemExprs(x.ByItems)
+	case *planner.PhysicalTopN:
+		return byItemExprs(x.ByItems)
+	case *planner.PhysicalProjection:
+		return x.Exprs
+	}
+	return nil
+}
+
+func byItemExprs(byItems []*planner.ByItem) []expression.Expression {
+	exprs := make([]expression.Expression, 0, len(byItems))
+	for _, item := range byItems {
+		exprs = append(exprs, item.Expr)
+	}
+	return exprs
+}
+
+//设置表达式中子查询的执行方法 子查询在求值时执行
+func (be *BaseExecutor) bindSubqueries(exprs []expression.Expression) {
+	for _, expr := range exprs {
+		switch x := expr.(type) {
+		case *expression.ScalarFunction:
+			be.bindSubqueries(x.Args)
+		case *expression.Subquery:
+			if x.Left != nil {
+				be.bindSubqueries([]expression.Expression{x.Left})
+			}
+			x.Run = be.subqueryRunner(x.Plan)
+		}
+	}
+}
+
+//每次执行子查询时按计划重新构造执行器 子查询的算子不记录EXPLAIN ANALYZE的信息
+func (be *BaseExecutor) subqueryRunner(p interface{}) func(limit int) ([][]types.Datum, error) {
+	return func(limit int) ([][]types.Datum, error) {
+		plan, ok := p.(planner.PhysicalPlan)
+		if !ok {
+			errStr := fmt.Sprintf("subquery plan(%T) no support", p)
+			return nil, errors.New(errStr)
+		}
+		sub := &BaseExecutor{TableOpt: be.TableOpt}
+		exec, err := sub.buildExecutor(plan)
+		if err != nil {
+			return nil, err
+		}
+		defer exec.Close()
+		var rows [][]types.Datum
+		for limit == 0 || len(rows) < limit {
+			row, ok, err := exec.Next()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			rows = append(rows, row.Datums)
+		}
+		return rows, nil
+	}
+}
@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+
+	"github.com/pingcap/parser/ast"
+)
+
+type TruncateTableExecutor struct {
+	*BaseExecutor
+}
+
+func NewTruncateTableExecutor(tableOpt tableOpt.TableOpt) *TruncateTableExecutor {
+	return &TruncateTableExecutor{BaseExecutor: &BaseExecutor{
+		TableOpt: tableOpt,
+	}}
+}
+
+func (te *TruncateTableExecutor) Exec(stmt *ast.TruncateTableStmt) error {
+	name, err := fullTableName(te.TableOpt, stmt.Table)
+	if err != nil {
+		return err
+	}
+	ok, _ := te.TableOpt.TableExists(name)
+	if !ok {
+		errStr := fmt.Sprintf("[executor][TruncateTable] table(%s) is not exists", stmt.Table.Name)
+		return errors.New(errStr)
+	}
+	return te.TableOpt.TruncateTable(name)
+}
@@ -1,38 +1,17 @@
 package executor
 
 import (
-	"fmt"
-
-	"github.com/pingcap/parser/ast"
-	"github.com/pingcap/parser/opcode"
-	field_types "github.com/pingcap/parser/types"
-	"github.com/pkg/errors"
-	"github.com/pingcap/tidb/types"
-	"github.com/pingcap/tidb/types/parser_driver"
-
-	"strconv"
-	"strings"
-
 	"github.com/CDDSCLab/chaosdb/common/tableOpt"
-	"github.com/CDDSCLab/chaosdb/opt/common"
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/planner"
 	"github.com/CDDSCLab/chaosdb/table"
-	"github.com/CDDSCLab/chaosdb/util/codekey"
-)
 
-type Assign struct {
-	ColumnName string
-	AssignType *field_types.FieldType
-	AssignVale *types.Datum
-	IsIndex    bool
-	IsUnique   bool
-	IndexId    uint64
-}
+	"github.com/pingcap/tidb/types"
+)
 
 type UpdateExecutor struct {
 	*BaseExecutor
-	lists []Assign
-	where *table.Where
-	limit *table.Limit
+	assignments []*planner.Assignment
 }
 
 func NewUpdateExecutor(tableOpt tableOpt.TableOpt) *UpdateExecutor {
@@ -41,114 +20,98 @@ func NewUpdateExecutor(tableOpt tableOpt.TableOpt) *UpdateExecutor {
 	}}
 }
 
-func (ue *UpdateExecutor) Exec(updateStmtNode *ast.UpdateStmt) error {
-	tableSource := updateStmtNode.TableRefs.TableRefs.Left.(*ast.TableSource)
-	tableName := tableSource.Source.(*ast.TableName)
-	err := ue.getTableInfo(tableName.Name.L)
-	if err != nil {
-		return err
-	}
-
-	//update 必须有条件，避免全表更新
-	if updateStmtNode.Where == nil {
-		errStr := fmt.Sprintf("delete must hava a where condition")
-		return errors.New(errStr)
-	}
-
-	//limit获取
-	limit := &table.Limit{}
-	if updateStmtNode.Limit != nil {
-		limit.Offset = updateStmtNode.Limit.Offset.(*driver.ValueExpr).Datum.GetUint64()
-		limit.Count = updateStmtNode.Limit.Count.(*driver.ValueExpr).Datum.GetUint64()
-	}
-	ue.limit = limit
-
-	//获取更新字段
-	ue.lists = make([]Assign, 0)
-	for _, assignment := range updateStmtNode.List {
-		var assign Assign
-		//不可更新主键字段
-		if assignment.Column.Name.L == ue.TableInfo.PriKey.Name {
-			errStr := fmt.Sprintf("Primary field can not update")
-			return errors.New(errStr)
-		}
-		if uniqColumn, ok := ue.TableInfo.UniqIndices[assignment.Column.Name.L]; ok {
-			assign.IsUnique = true
-			assign.IndexId = uniqColumn.Idx
-		}
-		if indexColumn, ok := ue.TableInfo.Indices[assignment.Column.Name.L]; ok {
-			assign.IsIndex = true
-			assign.IndexId = indexColumn.Idx
-		}
-		assign.ColumnName = assignment.Column.Name.L
-		assign.AssignType = assignment.Expr.GetType()
-		assign.AssignVale = &assignment.Expr.(*driver.ValueExpr).Datum
-		ue.lists = append(ue.lists, assign)
-	}
-
-	operationExpr := updateStmtNode.Where.(*ast.BinaryOperationExpr)
-	where := &table.Where{}
-	//只支持单个where，where表达式操作符只包含以下操作 >= <= = != > <
-	if operationExpr.Op == opcode.GE || operationExpr.Op == opcode.LE || operationExpr.Op == opcode.EQ ||
-		operationExpr.Op == opcode.NE || operationExpr.Op == opcode.LT || operationExpr.Op == opcode.GT {
-		where.Opt = operationExpr.Op
-		where.LeftColumn = operationExpr.L.(*ast.ColumnNameExpr).Name.String()
-		where.RightType = operationExpr.R.GetType()
-		where.RightValue = &operationExpr.R.(*driver.ValueExpr).Datum
-		ue.where = where
-	} else {
-		errStr := fmt.Sprintf("no support %s where operator", operationExpr.Op.String())
-		return errors.New(errStr)
+func (ue *UpdateExecutor) Exec(plan *planner.Update) error {
+	ue.TableInfo = plan.Table
+	ue.assignments = plan.Assignments
+	exprs := make([]expression.Expression, 0, len(ue.assignments))
+	for _, assignment := range ue.assignments {
+		exprs = append(exprs, assignment.Expr)
 	}
-	selectField := make([]string, 0)
-	selectField = strings.Split(ue.TableInfo.ColumnList, ",")
-	queryRes, err := ue.getQueryResultWithWhere(selectField, ue.where, ue.limit)
+	ue.bindSubqueries(exprs)
+	queryRes, err := ue.buildQueryResult(plan.SelectPlan)
 	if err != nil {
-		excutorLogger.Errorf("get records error when delete:%s", err)
+		excutorLogger.Errorf("get records error when update:%s", err)
 		return err
 	}
+	defer queryRes.Close()
 	var row table.Row
 	for queryRes.Next(&row) {
 		var addRows = make(table.Rows, 0)
-		var deleteKeys = make([][]byte, 0)
 		var batchRows = make([]table.Rows, 0)
-		//excutorLogger.Infof("row:%v\n", row)
 		//根据表中 唯一索引和普通索引的字段，收集需要删除的字段
-		for _, list := range ue.lists {
-			if list.IsUnique {
-				//是唯一索引，删除索引键
-				uniqKey := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix,
-					strconv.FormatUint(ue.TableInfo.TableId, 10), strconv.FormatUint(list.IndexId, 10),
-					row.ColumnValue[list.ColumnName])
-				deleteKeys = append(deleteKeys, uniqKey.Bytes())
+		deleteKeys, err := ue.indexKeysOfAssign(&row)
+		if err != nil {
+			return err
+		}
+		//新值都在旧的整行数据上求值
+		values := make([]types.Datum, len(ue.assignments))
+		for i, assignment := range ue.assignments {
+			value, err := assignment.Expr.Eval(row.Datums)
+			if err != nil {
+				return err
 			}
-			if list.IsIndex {
-				indexKey := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(ue.TableInfo.TableId, 10),
-					strconv.FormatUint(list.IndexId, 10), row.ColumnValue[list.ColumnName], strconv.FormatUint(row.RowId, 10))
-				deleteKeys = append(deleteKeys, indexKey.Bytes())
+			//更新值转换为列类型
+			values[i], err = assignment.Column.CheckedValue(value)
+			if err != nil {
+				return err
 			}
-			//字段不是索引 直接更新行数据
-			row.ColumnValue[list.ColumnName] = list.AssignVale.GetString()
 		}
-		addRows = append(addRows, &row)
-		//for _, row := range addRows {
-		//	fmt.Println(row)
-		//}
-		//for _, key := range deleteKeys {
-		//	fmt.Println(string(key))
-		//}
+		newRow := &table.Row{RowId: row.RowId, Datums: append([]types.Datum{}, row.Datums...)}
+		for i, assignment := range ue.assignments {
+			newRow.Datums[assignment.Offset] = values[i]
+		}
+		addRows = append(addRows, newRow)
 		batchRows = append(batchRows, addRows)
-		err := ue.TableOpt.AddRecords(ue.TableInfo, batchRows)
+		//先写入新记录 唯一索引值重复时不修改任何数据 再删除值改变了的旧索引键
+		err = ue.TableOpt.AddRecords(ue.TableInfo, batchRows)
 		if err != nil {
-			excutorLogger.Errorf("set NewRecords errror", err)
+			excutorLogger.Errorf("set NewRecords errror:%s", err)
 			return err
 		}
-		err = ue.TableOpt.DeleteRecords(ue.TableInfo.TableName, deleteKeys)
+		newKeys, err := ue.TableInfo.IndexKeys(newRow)
 		if err != nil {
-			excutorLogger.Errorf("delete Records errror", err)
+			return err
+		}
+		err = ue.TableOpt.DeleteRecords(ue.TableInfo.FullName(), changedKeys(deleteKeys, newKeys))
+		if err != nil {
+			excutorLogger.Errorf("delete Records errror:%s", err)
 			return err
 		}
 	}
+	//等锁超时、死锁等错误会结束结果集
+	return queryRes.Err()
+}
 
-	return nil
+//更新字段为索引列时 收集包含更新字段的索引中旧值对应的索引键
+func (ue *UpdateExecutor) indexKeysOfAssign(row *table.Row) ([][]byte, error) {
+	var keys [][]byte
+	for _, index := range ue.TableInfo.IndexList() {
+		for _, assignment := range ue.assignments {
+			if !index.HasColumn(assignment.Column.Name) {
+				continue
+			}
+			key, err := ue.TableInfo.IndexKey(index, row)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			break
+		}
+	}
+	return keys, nil
+}
+
+//旧索引键中不在新索引键里的键
+func changedKeys(oldKeys, newKeys [][]byte) [][]byte {
+	kept := make(map[string]struct{}, len(newKeys))
+	for _, key := range newKeys {
+		kept[string(key)] = struct{}{}
+	}
+	var keys [][]byte
+	for _, key := range oldKeys {
+		if _, ok := kept[string(key)]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
@@ -0,0 +1,193 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+//聚合函数 参数在表的行数据上求值
+type AggFunc struct {
+	Name     string       //函数名称 小写
+	Args     []Expression //参数
+	Distinct bool         //是否只聚合不同的值
+}
+
+//支持的聚合函数和参数个数 maxArgs为-1表示参数个数不限
+var aggFuncArgs = map[string][2]int{
+	ast.AggFuncCount: {1, -1},
+	ast.AggFuncSum:   {1, 1},
+	ast.AggFuncAvg:   {1, 1},
+	ast.AggFuncMax:   {1, 1},
+	ast.AggFuncMin:   {1, 1},
+}
+
+//构造聚合函数
+func NewAggFunc(name string, distinct bool, args ...Expression) (*AggFunc, error) {
+	name = strings.ToLower(name)
+	argCount, ok := aggFuncArgs[name]
+	if !ok {
+		errStr := fmt.Sprintf("aggregate function(%s) is not support", name)
+		return nil, errors.New(errStr)
+	}
+	if len(args) < argCount[0] || (argCount[1] >= 0 && len(args) > argCount[1]) {
+		errStr := fmt.Sprintf("incorrect parameter count in the call to function(%s)", name)
+		return nil, errors.New(errStr)
+	}
+	return &AggFunc{Name: name, Args: args, Distinct: distinct}, nil
+}
+
+func (a *AggFunc) String() string {
+	args := make([]string, 0, len(a.Args))
+	for _, arg := range a.Args {
+		args = append(args, arg.String())
+	}
+	if a.Distinct {
+		return fmt.Sprintf("%s(distinct %s)", a.Name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s(%s)", a.Name, strings.Join(args, ", "))
+}
+
+//结果类型 sum和avg对整数和定点数返回定点数 其余返回浮点数
+func (a *AggFunc) RetType() *field_types.FieldType {
+	switch a.Name {
+	case ast.AggFuncCount:
+		return field_types.NewFieldType(mysql.TypeLonglong)
+	case ast.AggFuncSum, ast.AggFuncAvg:
+		switch RetType(a.Args[0]).Tp {
+		case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeNewDecimal:
+			return field_types.NewFieldType(mysql.TypeNewDecimal)
+		}
+		return field_types.NewFieldType(mysql.TypeDouble)
+	}
+	return RetType(a.Args[0])
+}
+
+//聚合的中间结果
+type AggContext struct {
+	count int64           //参与聚合的行数
+	value types.Datum     //sum和avg的累加值 max和min的当前值
+	seen  map[string]bool //distinct时已经聚合过的值
+}
+
+func (a *AggFunc) NewContext() *AggContext {
+	ctx := &AggContext{}
+	if a.Distinct {
+		ctx.seen = make(map[string]bool)
+	}
+	return ctx
+}
+
+//聚合一行数据 参数为NULL的行不参与聚合
+func (a *AggFunc) Update(ctx *AggContext, row []types.Datum) error {
+	args := make([]types.Datum, 0, len(a.Args))
+	for _, arg := range a.Args {
+		d, err := arg.Eval(row)
+		if err != nil {
+			return err
+		}
+		if d.IsNull() {
+			return nil
+		}
+		args = append(args, d)
+	}
+	if a.Distinct {
+		key, err := codekey.EncodeDatums(nil, args...)
+		if err != nil {
+			return err
+		}
+		if ctx.seen[string(key)] {
+			return nil
+		}
+		ctx.seen[string(key)] = true
+	}
+	ctx.count++
+	switch a.Name {
+	case ast.AggFuncSum, ast.AggFuncAvg:
+		sum, err := addDatum(ctx.value, args[0])
+		if err != nil {
+			return err
+		}
+		ctx.value = sum
+	case ast.AggFuncMax, ast.AggFuncMin:
+		if ctx.value.IsNull() {
+			ctx.value = args[0]
+			return nil
+		}
+		cmp, err := compareDatum(args[0], ctx.value)
+		if err != nil {
+			return err
+		}
+		if (a.Name == ast.AggFuncMax && cmp > 0) || (a.Name == ast.AggFuncMin && cmp < 0) {
+			ctx.value = args[0]
+		}
+	}
+	return nil
+}
+
+//聚合结果 没有参与聚合的行时count为0 其余为NULL
+func (a *AggFunc) Result(ctx *AggContext) (types.Datum, error) {
+	switch a.Name {
+	case ast.AggFuncCount:
+		return types.NewIntDatum(ctx.count), nil
+	case ast.AggFuncAvg:
+		if ctx.count == 0 {
+			return nullDatum, nil
+		}
+		if ctx.value.Kind() == types.KindMysqlDecimal {
+			avg := new(types.MyDecimal)
+			err := types.DecimalDiv(ctx.value.GetMysqlDecimal(), types.NewDecFromInt(ctx.count), avg, types.DivFracIncr)
+			if err != nil {
+				return nullDatum, err
+			}
+			return types.NewDecimalDatum(avg), nil
+		}
+		return types.NewFloat64Datum(ctx.value.GetFloat64() / float64(ctx.count)), nil
+	}
+	return ctx.value, nil
+}
+
+//累加 整数和定点数按定点数计算 其余按浮点数计算
+func addDatum(sum, d types.Datum) (types.Datum, error) {
+	exact := sum.IsNull() || sum.Kind() == types.KindMysqlDecimal
+	switch d.Kind() {
+	case types.KindInt64, types.KindUint64, types.KindMysqlDecimal:
+	default:
+		exact = false
+	}
+	if exact {
+		dec, err := d.ToDecimal(table.StmtCtx)
+		if err != nil {
+			return nullDatum, err
+		}
+		if sum.IsNull() {
+			return types.NewDecimalDatum(dec), nil
+		}
+		to := new(types.MyDecimal)
+		err = types.DecimalAdd(sum.GetMysqlDecimal(), dec, to)
+		if err != nil {
+			return nullDatum, err
+		}
+		return types.NewDecimalDatum(to), nil
+	}
+	f, err := d.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	if !sum.IsNull() {
+		s, err := sum.ToFloat64(table.StmtCtx)
+		if err != nil {
+			return nullDatum, err
+		}
+		f += s
+	}
+	return types.NewFloat64Datum(f), nil
+}
@@ -0,0 +1,317 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/types/parser_driver"
+)
+
+//构造表达式时由计划构造提供的子查询和外层查询
+type Context interface {
+	//在外层查询中查找列 没有找到时返回nil
+	OuterColumn(name *ast.ColumnName) (*CorrelatedColumn, error)
+	//构造子查询的计划 schema为当前查询的列 子查询中可以引用 第二个返回值为结果的列数
+	BuildSubquery(query *ast.SubqueryExpr, schema *Schema) (*Subquery, int, error)
+}
+
+//将ast表达式转换为可以求值的表达式 列按名称在schema中查找
+func Build(expr ast.ExprNode, schema *Schema) (Expression, error) {
+	b := &builder{schema: schema}
+	return b.build(expr)
+}
+
+//构造可以包含聚合函数的表达式 聚合函数替换为对聚合结果的列引用
+//第i个聚合函数的结果位于schema全部列之后的第i列 相同的聚合函数只计算一次
+func BuildWithAggregates(expr ast.ExprNode, schema *Schema, aggFuncs *[]*AggFunc) (Expression, error) {
+	b := &builder{schema: schema, aggFuncs: aggFuncs}
+	return b.build(expr)
+}
+
+//构造可以包含子查询的表达式 aggFuncs为nil时不允许使用聚合函数
+func BuildInContext(expr ast.ExprNode, schema *Schema, aggFuncs *[]*AggFunc, ctx Context) (Expression, error) {
+	b := &builder{schema: schema, aggFuncs: aggFuncs, ctx: ctx}
+	return b.build(expr)
+}
+
+type builder struct {
+	schema   *Schema
+	aggFuncs *[]*AggFunc //为nil时不允许使用聚合函数
+	ctx      Context     //为nil时不允许使用子查询
+}
+
+func (b *builder) build(expr ast.ExprNode) (Expression, error) {
+	switch x := expr.(type) {
+	case *driver.ValueExpr:
+		return &Constant{Value: x.Datum}, nil
+	case *ast.ParenthesesExpr:
+		return b.build(x.Expr)
+	case *ast.ColumnNameExpr:
+		//当前查询中没有的列在外层查询中查找
+		if b.ctx != nil && !b.schema.HasColumn(x.Name) {
+			column, err := b.ctx.OuterColumn(x.Name)
+			if err != nil || column != nil {
+				return column, err
+			}
+		}
+		offset, err := b.schema.FindColumn(x.Name)
+		if err != nil {
+			return nil, err
+		}
+		column := b.schema.Columns[offset]
+		return &Column{Offset: offset, Name: column.Name, Info: column.Info}, nil
+	case *ast.BinaryOperationExpr:
+		return b.buildBinaryOperation(x)
+	case *ast.UnaryOperationExpr:
+		return b.buildUnaryOperation(x)
+	case *ast.AggregateFuncExpr:
+		return b.buildAggregate(x)
+	case *ast.FuncCallExpr:
+		return b.buildFuncCall(x)
+	case *ast.CaseExpr:
+		return b.buildCase(x)
+	case *ast.IsNullExpr:
+		arg, err := b.build(x.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return newFunctionWithNot(x.Not, ast.IsNull, arg)
+	case *ast.SubqueryExpr:
+		return b.buildSubquery(x, ScalarSubquery, nil)
+	case *ast.ExistsSubqueryExpr:
+		query, ok := x.Sel.(*ast.SubqueryExpr)
+		if !ok {
+			errStr := fmt.Sprintf("expression(%T) in EXISTS is not support", x.Sel)
+			return nil, errors.New(errStr)
+		}
+		subquery, err := b.buildSubquery(query, ExistsSubquery, nil)
+		if err != nil || !x.Not {
+			return subquery, err
+		}
+		return NewFunction(ast.UnaryNot, subquery)
+	case *ast.PatternInExpr:
+		if x.Sel != nil {
+			query, ok := x.Sel.(*ast.SubqueryExpr)
+			if !ok {
+				errStr := fmt.Sprintf("expression(%T) in IN is not support", x.Sel)
+				return nil, errors.New(errStr)
+			}
+			left, err := b.build(x.Expr)
+			if err != nil {
+				return nil, err
+			}
+			subquery, err := b.buildSubquery(query, InSubquery, left)
+			if err != nil || !x.Not {
+				return subquery, err
+			}
+			return NewFunction(ast.UnaryNot, subquery)
+		}
+		args, err := b.buildList(append([]ast.ExprNode{x.Expr}, x.List...))
+		if err != nil {
+			return nil, err
+		}
+		return newFunctionWithNot(x.Not, ast.In, args...)
+	case *ast.BetweenExpr:
+		//a BETWEEN b AND c 等价于 a>=b AND a<=c
+		args, err := b.buildList([]ast.ExprNode{x.Expr, x.Left, x.Right})
+		if err != nil {
+			return nil, err
+		}
+		ge, err := NewFunction(ast.GE, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		le, err := NewFunction(ast.LE, args[0], args[2])
+		if err != nil {
+			return nil, err
+		}
+		return newFunctionWithNot(x.Not, ast.LogicAnd, ge, le)
+	case *ast.PatternLikeExpr:
+		args, err := b.buildList([]ast.ExprNode{x.Expr, x.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		escape := &Constant{Value: types.NewIntDatum(int64(x.Escape))}
+		return newFunctionWithNot(x.Not, ast.Like, args[0], args[1], escape)
+	}
+	errStr := fmt.Sprintf("expression(%T) is not support", expr)
+	return nil, errors.New(errStr)
+}
+
+func (b *builder) buildList(exprs []ast.ExprNode) ([]Expression, error) {
+	args := make([]Expression, 0, len(exprs))
+	for _, expr := range exprs {
+		arg, err := b.build(expr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+//构造函数调用 not为真时在外层加NOT
+func newFunctionWithNot(not bool, funcName string, args ...Expression) (Expression, error) {
+	expr, err := NewFunction(funcName, args...)
+	if err != nil || !not {
+		return expr, err
+	}
+	return NewFunction(ast.UnaryNot, expr)
+}
+
+func (b *builder) buildBinaryOperation(expr *ast.BinaryOperationExpr) (Expression, error) {
+	funcName, ok := opcode.Ops[expr.Op]
+	if !ok {
+		errStr := fmt.Sprintf("operator(%d) is not support", expr.Op)
+		return nil, errors.New(errStr)
+	}
+	args, err := b.buildList([]ast.ExprNode{expr.L, expr.R})
+	if err != nil {
+		return nil, err
+	}
+	switch expr.Op {
+	case opcode.Plus, opcode.Minus, opcode.Mul, opcode.Div, opcode.IntDiv, opcode.Mod:
+		return foldConstant(NewFunction(funcName, args...))
+	}
+	return NewFunction(funcName, args...)
+}
+
+//函数调用 TRIM的方向转换为常量参数
+func (b *builder) buildFuncCall(expr *ast.FuncCallExpr) (Expression, error) {
+	args := make([]Expression, 0, len(expr.Args))
+	for _, arg := range expr.Args {
+		if direction, ok := arg.(*ast.TrimDirectionExpr); ok {
+			args = append(args, &Constant{Value: types.NewIntDatum(int64(direction.Direction))})
+			continue
+		}
+		e, err := b.build(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+	return foldConstant(NewFunction(expr.FnName.L, args...))
+}
+
+//CASE 参数为 条件1 结果1 条件2 结果2 ... [ELSE结果]
+//CASE value WHEN x 的条件为 value = x
+func (b *builder) buildCase(expr *ast.CaseExpr) (Expression, error) {
+	var value Expression
+	if expr.Value != nil {
+		var err error
+		value, err = b.build(expr.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args := make([]Expression, 0, 2*len(expr.WhenClauses)+1)
+	for _, when := range expr.WhenClauses {
+		cond, err := b.build(when.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			cond, err = NewFunction(ast.EQ, value, cond)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result, err := b.build(when.Result)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cond, result)
+	}
+	if expr.ElseClause != nil {
+		result, err := b.build(expr.ElseClause)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, result)
+	}
+	return foldConstant(NewFunction(ast.Case, args...))
+}
+
+func (b *builder) buildUnaryOperation(expr *ast.UnaryOperationExpr) (Expression, error) {
+	arg, err := b.build(expr.V)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.Op {
+	case opcode.Plus:
+		return arg, nil
+	case opcode.Minus:
+		return foldConstant(NewFunction(ast.UnaryMinus, arg))
+	case opcode.Not:
+		return NewFunction(ast.UnaryNot, arg)
+	}
+	errStr := fmt.Sprintf("operator(%s) is not support", expr.Op.String())
+	return nil, errors.New(errStr)
+}
+
+//聚合函数的参数在表的行数据上求值 不能再包含聚合函数
+func (b *builder) buildAggregate(expr *ast.AggregateFuncExpr) (Expression, error) {
+	if b.aggFuncs == nil {
+		return nil, errors.New("Invalid use of group function")
+	}
+	argBuilder := &builder{schema: b.schema, ctx: b.ctx}
+	args, err := argBuilder.buildList(expr.Args)
+	if err != nil {
+		return nil, err
+	}
+	aggFunc, err := NewAggFunc(expr.F, expr.Distinct, args...)
+	if err != nil {
+		return nil, err
+	}
+	name := aggFunc.String()
+	info := &table.Column{Name: name, MysqlType: aggFunc.RetType()}
+	for i, f := range *b.aggFuncs {
+		if f.String() == name {
+			return &Column{Offset: len(b.schema.Columns) + i, Name: name, Info: info}, nil
+		}
+	}
+	*b.aggFuncs = append(*b.aggFuncs, aggFunc)
+	return &Column{Offset: len(b.schema.Columns) + len(*b.aggFuncs) - 1, Name: name, Info: info}, nil
+}
+
+//子查询 标量子查询和IN的子查询只能有一列结果
+func (b *builder) buildSubquery(query *ast.SubqueryExpr, kind SubqueryKind, left Expression) (Expression, error) {
+	if b.ctx == nil {
+		return nil, errors.New("subquery is not support here")
+	}
+	subquery, columns, err := b.ctx.BuildSubquery(query, b.schema)
+	if err != nil {
+		return nil, err
+	}
+	if kind != ExistsSubquery && columns != 1 {
+		return nil, errors.New("Operand should contain 1 column(s)")
+	}
+	subquery.Kind, subquery.Left = kind, left
+	return subquery, nil
+}
+
+//参数全部为常量时直接求值
+func foldConstant(expr Expression, err error) (Expression, error) {
+	if err != nil {
+		return nil, err
+	}
+	sf, ok := expr.(*ScalarFunction)
+	if !ok {
+		return expr, nil
+	}
+	for _, arg := range sf.Args {
+		if _, ok := arg.(*Constant); !ok {
+			return expr, nil
+		}
+	}
+	value, err := sf.Eval(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Constant{Value: value}, nil
+}
@@ -0,0 +1,443 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/stringutil"
+)
+
+//函数实现 参数已经求值
+type builtinFunc func(args []types.Datum) (types.Datum, error)
+
+//函数定义 maxArgs为-1表示参数个数不限 retType由参数推导结果类型
+type funcClass struct {
+	minArgs  int
+	maxArgs  int
+	function builtinFunc
+	retType  retTypeFunc
+}
+
+//由参数推导函数结果的类型
+type retTypeFunc func(args []Expression) *field_types.FieldType
+
+//结果为固定类型
+func fixedType(tp byte) retTypeFunc {
+	return func(args []Expression) *field_types.FieldType {
+		return field_types.NewFieldType(tp)
+	}
+}
+
+var (
+	intType      = fixedType(mysql.TypeLonglong)
+	doubleType   = fixedType(mysql.TypeDouble)
+	stringType   = fixedType(mysql.TypeVarString)
+	datetimeType = fixedType(mysql.TypeDatetime)
+	dateType     = fixedType(mysql.TypeDate)
+)
+
+//数值类型按整数 定点数 浮点数分类 字符串等按浮点数计算
+func numericClass(tp byte) byte {
+	switch tp {
+	case mysql.TypeNull, mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+		return mysql.TypeLonglong
+	case mysql.TypeNewDecimal:
+		return mysql.TypeNewDecimal
+	}
+	return mysql.TypeDouble
+}
+
+//算术运算的结果类型 有浮点数时为浮点数 有定点数时为定点数 否则为整数
+func arithmeticType(args []Expression) *field_types.FieldType {
+	tp := byte(mysql.TypeLonglong)
+	for _, arg := range args {
+		switch numericClass(RetType(arg).Tp) {
+		case mysql.TypeDouble:
+			tp = mysql.TypeDouble
+		case mysql.TypeNewDecimal:
+			if tp == mysql.TypeLonglong {
+				tp = mysql.TypeNewDecimal
+			}
+		}
+	}
+	return field_types.NewFieldType(tp)
+}
+
+//除法的结果为定点数 有浮点数时为浮点数
+func divType(args []Expression) *field_types.FieldType {
+	if tp := arithmeticType(args); tp.Tp == mysql.TypeDouble {
+		return tp
+	}
+	return field_types.NewFieldType(mysql.TypeNewDecimal)
+}
+
+//CEIL和FLOOR 浮点数的结果为浮点数 否则为整数
+func roundingType(args []Expression) *field_types.FieldType {
+	if tp := arithmeticType(args); tp.Tp == mysql.TypeDouble {
+		return tp
+	}
+	return field_types.NewFieldType(mysql.TypeLonglong)
+}
+
+//结果为参数之一时的类型 参数类型相同时为该类型 都为数值时按算术运算合并 否则为字符串
+func mergedType(args []Expression) *field_types.FieldType {
+	var merged *field_types.FieldType
+	numeric := true
+	var notNull []Expression
+	for _, arg := range args {
+		tp := RetType(arg)
+		if tp.Tp == mysql.TypeNull {
+			continue
+		}
+		notNull = append(notNull, arg)
+		if !types.IsTypeNumeric(tp.Tp) {
+			numeric = false
+		}
+		if merged == nil {
+			merged = tp
+		} else if merged.Tp != tp.Tp {
+			merged = field_types.NewFieldType(mysql.TypeVarString)
+		}
+	}
+	switch {
+	case merged == nil:
+		return field_types.NewFieldType(mysql.TypeNull)
+	case merged.Tp != mysql.TypeVarString && numeric:
+		return merged
+	case numeric:
+		return arithmeticType(notNull)
+	}
+	return merged
+}
+
+//IF的结果为后两个参数之一
+func ifType(args []Expression) *field_types.FieldType {
+	return mergedType(args[1:])
+}
+
+//CASE的结果为各个结果和ELSE结果之一
+func caseType(args []Expression) *field_types.FieldType {
+	var results []Expression
+	for i := 1; i < len(args); i += 2 {
+		results = append(results, args[i])
+	}
+	if len(args)%2 == 1 {
+		results = append(results, args[len(args)-1])
+	}
+	return mergedType(results)
+}
+
+//NULLIF的结果为第一个参数
+func firstArgType(args []Expression) *field_types.FieldType {
+	return RetType(args[0])
+}
+
+//常量的类型
+func constantType(d types.Datum) *field_types.FieldType {
+	switch d.Kind() {
+	case types.KindNull:
+		return field_types.NewFieldType(mysql.TypeNull)
+	case types.KindInt64:
+		return field_types.NewFieldType(mysql.TypeLonglong)
+	case types.KindUint64:
+		tp := field_types.NewFieldType(mysql.TypeLonglong)
+		tp.Flag |= mysql.UnsignedFlag
+		return tp
+	case types.KindFloat32, types.KindFloat64:
+		return field_types.NewFieldType(mysql.TypeDouble)
+	case types.KindMysqlDecimal:
+		return field_types.NewFieldType(mysql.TypeNewDecimal)
+	case types.KindMysqlTime:
+		return field_types.NewFieldType(d.GetMysqlTime().Type)
+	case types.KindMysqlDuration:
+		return field_types.NewFieldType(mysql.TypeDuration)
+	}
+	return field_types.NewFieldType(mysql.TypeVarString)
+}
+
+//内置函数表 键为函数名称
+var funcs = map[string]funcClass{
+	//比较和逻辑运算
+	ast.EQ:         {2, 2, compareFunc(func(cmp int) bool { return cmp == 0 }), intType},
+	ast.NE:         {2, 2, compareFunc(func(cmp int) bool { return cmp != 0 }), intType},
+	ast.LT:         {2, 2, compareFunc(func(cmp int) bool { return cmp < 0 }), intType},
+	ast.LE:         {2, 2, compareFunc(func(cmp int) bool { return cmp <= 0 }), intType},
+	ast.GT:         {2, 2, compareFunc(func(cmp int) bool { return cmp > 0 }), intType},
+	ast.GE:         {2, 2, compareFunc(func(cmp int) bool { return cmp >= 0 }), intType},
+	ast.NullEQ:     {2, 2, builtinNullEQ, intType},
+	ast.LogicAnd:   {2, 2, builtinAnd, intType},
+	ast.LogicOr:    {2, 2, builtinOr, intType},
+	ast.LogicXor:   {2, 2, builtinXor, intType},
+	ast.UnaryNot:   {1, 1, builtinNot, intType},
+	ast.UnaryMinus: {1, 1, builtinUnaryMinus, arithmeticType},
+	ast.IsNull:     {1, 1, builtinIsNull, intType},
+	ast.In:         {2, -1, builtinIn, intType},
+	ast.Like:       {3, 3, builtinLike, intType},
+
+	//算术运算
+	ast.Plus:   {2, 2, arithmeticFunc(ast.Plus), arithmeticType},
+	ast.Minus:  {2, 2, arithmeticFunc(ast.Minus), arithmeticType},
+	ast.Mul:    {2, 2, arithmeticFunc(ast.Mul), arithmeticType},
+	ast.Div:    {2, 2, arithmeticFunc(ast.Div), divType},
+	ast.IntDiv: {2, 2, arithmeticFunc(ast.IntDiv), intType},
+	ast.Mod:    {2, 2, arithmeticFunc(ast.Mod), arithmeticType},
+
+	//字符串函数
+	ast.Concat:          {1, -1, builtinConcat, stringType},
+	ast.ConcatWS:        {2, -1, builtinConcatWS, stringType},
+	ast.Upper:           {1, 1, builtinUpper, stringType},
+	ast.Ucase:           {1, 1, builtinUpper, stringType},
+	ast.Lower:           {1, 1, builtinLower, stringType},
+	ast.Lcase:           {1, 1, builtinLower, stringType},
+	ast.Length:          {1, 1, builtinLength, intType},
+	ast.CharLength:      {1, 1, builtinCharLength, intType},
+	ast.CharacterLength: {1, 1, builtinCharLength, intType},
+	ast.Substring:       {2, 3, builtinSubstring, stringType},
+	ast.Substr:          {2, 3, builtinSubstring, stringType},
+	ast.Left:            {2, 2, builtinLeft, stringType},
+	ast.Right:           {2, 2, builtinRight, stringType},
+	ast.Trim:            {1, 3, builtinTrim, stringType},
+	ast.LTrim:           {1, 1, builtinLTrim, stringType},
+	ast.RTrim:           {1, 1, builtinRTrim, stringType},
+	ast.Replace:         {3, 3, builtinReplace, stringType},
+	ast.Reverse:         {1, 1, builtinReverse, stringType},
+	ast.Repeat:          {2, 2, builtinRepeat, stringType},
+	ast.Lpad:            {3, 3, builtinLpad, stringType},
+	ast.Rpad:            {3, 3, builtinRpad, stringType},
+	ast.Instr:           {2, 2, builtinInstr, intType},
+	ast.Locate:          {2, 3, builtinLocate, intType},
+	ast.Strcmp:          {2, 2, builtinStrcmp, intType},
+
+	//数学函数
+	ast.Abs:      {1, 1, builtinAbs, arithmeticType},
+	ast.Ceil:     {1, 1, roundingFunc(true), roundingType},
+	ast.Ceiling:  {1, 1, roundingFunc(true), roundingType},
+	ast.Floor:    {1, 1, roundingFunc(false), roundingType},
+	ast.Round:    {1, 2, builtinRound, arithmeticType},
+	ast.Truncate: {2, 2, builtinTruncate, arithmeticType},
+	ast.Pow:      {2, 2, builtinPow, doubleType},
+	ast.Power:    {2, 2, builtinPow, doubleType},
+	ast.Sqrt:     {1, 1, builtinSqrt, doubleType},
+	ast.Sign:     {1, 1, builtinSign, intType},
+	ast.Greatest: {2, -1, extremeFunc(true), mergedType},
+	ast.Least:    {2, -1, extremeFunc(false), mergedType},
+
+	//日期和时间函数
+	ast.Now:              {0, 0, builtinNow, datetimeType},
+	ast.CurrentTimestamp: {0, 0, builtinNow, datetimeType},
+	ast.Sysdate:          {0, 0, builtinNow, datetimeType},
+	ast.Curdate:          {0, 0, builtinCurdate, dateType},
+	ast.CurrentDate:      {0, 0, builtinCurdate, dateType},
+	ast.Date:             {1, 1, builtinDate, dateType},
+	ast.Year:             {1, 1, timePartFunc(types.MysqlTime.Year), intType},
+	ast.Month:            {1, 1, timePartFunc(types.MysqlTime.Month), intType},
+	ast.Day:              {1, 1, timePartFunc(types.MysqlTime.Day), intType},
+	ast.DayOfMonth:       {1, 1, timePartFunc(types.MysqlTime.Day), intType},
+	ast.Hour:             {1, 1, timePartFunc(types.MysqlTime.Hour), intType},
+	ast.Minute:           {1, 1, timePartFunc(types.MysqlTime.Minute), intType},
+	ast.Second:           {1, 1, timePartFunc(types.MysqlTime.Second), intType},
+	ast.DateFormat:       {2, 2, builtinDateFormat, stringType},
+	ast.DateDiff:         {2, 2, builtinDateDiff, intType},
+	ast.UnixTimestamp:    {0, 1, builtinUnixTimestamp, intType},
+	ast.FromUnixTime:     {1, 1, builtinFromUnixTime, datetimeType},
+
+	//流程控制函数
+	ast.If:       {3, 3, builtinIf, ifType},
+	ast.Ifnull:   {2, 2, builtinCoalesce, mergedType},
+	ast.Coalesce: {1, -1, builtinCoalesce, mergedType},
+	ast.Nullif:   {2, 2, builtinNullif, firstArgType},
+	ast.Case:     {2, -1, builtinCase, caseType},
+}
+
+var (
+	trueDatum  = types.NewIntDatum(1)
+	falseDatum = types.NewIntDatum(0)
+	nullDatum  = types.Datum{}
+)
+
+func boolDatum(b bool) types.Datum {
+	if b {
+		return trueDatum
+	}
+	return falseDatum
+}
+
+//比较两个值 调用方保证都不为NULL
+func compareDatum(a, b types.Datum) (int, error) {
+	return a.CompareDatum(table.StmtCtx, &b)
+}
+
+//比较运算 任意一边为NULL时结果为NULL
+func compareFunc(check func(cmp int) bool) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		if args[0].IsNull() || args[1].IsNull() {
+			return nullDatum, nil
+		}
+		cmp, err := compareDatum(args[0], args[1])
+		if err != nil {
+			return nullDatum, err
+		}
+		return boolDatum(check(cmp)), nil
+	}
+}
+
+//<=> 两边都为NULL时相等
+func builtinNullEQ(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return boolDatum(args[0].IsNull() && args[1].IsNull()), nil
+	}
+	cmp, err := compareDatum(args[0], args[1])
+	if err != nil {
+		return nullDatum, err
+	}
+	return boolDatum(cmp == 0), nil
+}
+
+//逻辑值 第二个返回值表示是否为NULL
+func toBool(d types.Datum) (bool, bool, error) {
+	if d.IsNull() {
+		return false, true, nil
+	}
+	b, err := d.ToBool(table.StmtCtx)
+	if err != nil {
+		return false, false, err
+	}
+	return b == 1, false, nil
+}
+
+//AND 有假为假 否则有NULL为NULL
+func builtinAnd(args []types.Datum) (types.Datum, error) {
+	hasNull := false
+	for _, arg := range args {
+		b, isNull, err := toBool(arg)
+		if err != nil {
+			return nullDatum, err
+		}
+		if isNull {
+			hasNull = true
+		} else if !b {
+			return falseDatum, nil
+		}
+	}
+	if hasNull {
+		return nullDatum, nil
+	}
+	return trueDatum, nil
+}
+
+//OR 有真为真 否则有NULL为NULL
+func builtinOr(args []types.Datum) (types.Datum, error) {
+	hasNull := false
+	for _, arg := range args {
+		b, isNull, err := toBool(arg)
+		if err != nil {
+			return nullDatum, err
+		}
+		if isNull {
+			hasNull = true
+		} else if b {
+			return trueDatum, nil
+		}
+	}
+	if hasNull {
+		return nullDatum, nil
+	}
+	return falseDatum, nil
+}
+
+func builtinXor(args []types.Datum) (types.Datum, error) {
+	a, aNull, err := toBool(args[0])
+	if err != nil {
+		return nullDatum, err
+	}
+	b, bNull, err := toBool(args[1])
+	if err != nil || aNull || bNull {
+		return nullDatum, err
+	}
+	return boolDatum(a != b), nil
+}
+
+func builtinNot(args []types.Datum) (types.Datum, error) {
+	b, isNull, err := toBool(args[0])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	return boolDatum(!b), nil
+}
+
+func builtinUnaryMinus(args []types.Datum) (types.Datum, error) {
+	d := args[0]
+	switch d.Kind() {
+	case types.KindNull:
+		return nullDatum, nil
+	case types.KindInt64:
+		return types.NewIntDatum(-d.GetInt64()), nil
+	case types.KindUint64:
+		dec := new(types.MyDecimal).FromUint(d.GetUint64())
+		return types.NewDecimalDatum(types.DecimalNeg(dec)), nil
+	case types.KindMysqlDecimal:
+		return types.NewDecimalDatum(types.DecimalNeg(d.GetMysqlDecimal())), nil
+	}
+	f, err := d.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewFloat64Datum(-f), nil
+}
+
+func builtinIsNull(args []types.Datum) (types.Datum, error) {
+	return boolDatum(args[0].IsNull()), nil
+}
+
+//IN 和列表中任意值相等为真 否则列表中有NULL时为NULL
+func builtinIn(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() {
+		return nullDatum, nil
+	}
+	hasNull := false
+	for _, arg := range args[1:] {
+		if arg.IsNull() {
+			hasNull = true
+			continue
+		}
+		cmp, err := compareDatum(args[0], arg)
+		if err != nil {
+			return nullDatum, err
+		}
+		if cmp == 0 {
+			return trueDatum, nil
+		}
+	}
+	if hasNull {
+		return nullDatum, nil
+	}
+	return falseDatum, nil
+}
+
+//LIKE 参数为 字符串 模式 转义字符
+func builtinLike(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return nullDatum, nil
+	}
+	str, err := args[0].ToString()
+	if err != nil {
+		return nullDatum, err
+	}
+	pattern, err := args[1].ToString()
+	if err != nil {
+		return nullDatum, err
+	}
+	escape := args[2].GetInt64()
+	if escape < 0 || escape > 255 {
+		errStr := fmt.Sprintf("invalid escape character(%d) of like", escape)
+		return nullDatum, errors.New(errStr)
+	}
+	patChars, patTypes := stringutil.CompilePattern(pattern, byte(escape))
+	return boolDatum(stringutil.DoMatch(str, patChars, patTypes)), nil
+}
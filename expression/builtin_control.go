@@ -0,0 +1,60 @@
+package expression
+
+import (
+	"github.com/pingcap/tidb/types"
+)
+
+//IF(expr1, expr2, expr3) expr1为真时为expr2 否则为expr3
+func builtinIf(args []types.Datum) (types.Datum, error) {
+	b, isNull, err := toBool(args[0])
+	if err != nil {
+		return nullDatum, err
+	}
+	if b && !isNull {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+//COALESCE和IFNULL 第一个不为NULL的参数
+func builtinCoalesce(args []types.Datum) (types.Datum, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return nullDatum, nil
+}
+
+//NULLIF(expr1, expr2) 相等时为NULL 否则为expr1
+func builtinNullif(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return args[0], nil
+	}
+	cmp, err := compareDatum(args[0], args[1])
+	if err != nil {
+		return nullDatum, err
+	}
+	if cmp == 0 {
+		return nullDatum, nil
+	}
+	return args[0], nil
+}
+
+//CASE 参数为 条件1 结果1 条件2 结果2 ... [ELSE结果]
+//CASE value WHEN ... 在构造时转换为value和每个WHEN的比较
+func builtinCase(args []types.Datum) (types.Datum, error) {
+	for i := 0; i+1 < len(args); i += 2 {
+		b, isNull, err := toBool(args[i])
+		if err != nil {
+			return nullDatum, err
+		}
+		if b && !isNull {
+			return args[i+1], nil
+		}
+	}
+	if len(args)%2 == 1 {
+		return args[len(args)-1], nil
+	}
+	return nullDatum, nil
+}
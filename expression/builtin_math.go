@@ -0,0 +1,358 @@
+package expression
+
+import (
+	"errors"
+	"math"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+var (
+	errBigintOutOfRange = errors.New("BIGINT value is out of range")
+	errDoubleOutOfRange = errors.New("DOUBLE value is out of range")
+)
+
+//是否为整数
+func isIntegerDatum(d types.Datum) bool {
+	return d.Kind() == types.KindInt64 || d.Kind() == types.KindUint64
+}
+
+//是否按浮点数计算 字符串和时间等转换为浮点数
+func isFloatDatum(d types.Datum) bool {
+	return !isIntegerDatum(d) && d.Kind() != types.KindMysqlDecimal
+}
+
+//浮点数结果 溢出时报错
+func floatDatum(f float64) (types.Datum, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nullDatum, errDoubleOutOfRange
+	}
+	return types.NewFloat64Datum(f), nil
+}
+
+//定点数转换为整数 超出int64时转换为uint64 都超出时报错
+func decimalToInteger(dec *types.MyDecimal) (types.Datum, error) {
+	if v, err := dec.ToInt(); err == nil {
+		return types.NewIntDatum(v), nil
+	}
+	if !dec.IsNegative() {
+		if v, err := dec.ToUint(); err == nil {
+			return types.NewUintDatum(v), nil
+		}
+	}
+	return nullDatum, errBigintOutOfRange
+}
+
+//定点数运算的错误 截断不是错误
+func decimalError(err error) error {
+	if err != nil && !types.ErrTruncated.Equal(err) {
+		return err
+	}
+	return nil
+}
+
+//算术运算 有浮点数时按浮点数计算 有定点数或除法时按定点数计算 否则按整数计算
+//除数为0时结果为NULL
+func arithmeticFunc(op string) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		a, b := args[0], args[1]
+		if a.IsNull() || b.IsNull() {
+			return nullDatum, nil
+		}
+		switch {
+		case isFloatDatum(a) || isFloatDatum(b):
+			return floatArithmetic(op, a, b)
+		case a.Kind() == types.KindInt64 && b.Kind() == types.KindInt64 && op != ast.Div:
+			return intArithmetic(op, a.GetInt64(), b.GetInt64())
+		}
+		return decimalArithmetic(op, a, b)
+	}
+}
+
+func intArithmetic(op string, a, b int64) (types.Datum, error) {
+	var v int64
+	var err error
+	switch op {
+	case ast.Plus:
+		v, err = types.AddInt64(a, b)
+	case ast.Minus:
+		v, err = types.SubInt64(a, b)
+	case ast.Mul:
+		v, err = types.MulInt64(a, b)
+	case ast.IntDiv:
+		if b == 0 {
+			return nullDatum, nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nullDatum, errBigintOutOfRange
+		}
+		v = a / b
+	case ast.Mod:
+		if b == 0 {
+			return nullDatum, nil
+		}
+		if b != -1 {
+			v = a % b
+		}
+	}
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewIntDatum(v), nil
+}
+
+//定点数运算 两边都为整数时结果转换回整数
+func decimalArithmetic(op string, a, b types.Datum) (types.Datum, error) {
+	x, err := a.ToDecimal(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	y, err := b.ToDecimal(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	if (op == ast.Div || op == ast.IntDiv || op == ast.Mod) && y.IsZero() {
+		return nullDatum, nil
+	}
+	to := new(types.MyDecimal)
+	switch op {
+	case ast.Plus:
+		err = types.DecimalAdd(x, y, to)
+	case ast.Minus:
+		err = types.DecimalSub(x, y, to)
+	case ast.Mul:
+		err = types.DecimalMul(x, y, to)
+	case ast.Div:
+		err = types.DecimalDiv(x, y, to, types.DivFracIncr)
+	case ast.IntDiv:
+		quo := new(types.MyDecimal)
+		if err = decimalError(types.DecimalDiv(x, y, quo, types.DivFracIncr)); err == nil {
+			err = quo.Round(to, 0, types.ModeTruncate)
+		}
+	case ast.Mod:
+		err = types.DecimalMod(x, y, to)
+	}
+	if err = decimalError(err); err != nil {
+		return nullDatum, err
+	}
+	if op == ast.IntDiv || (op != ast.Div && isIntegerDatum(a) && isIntegerDatum(b)) {
+		return decimalToInteger(to)
+	}
+	return types.NewDecimalDatum(to), nil
+}
+
+func floatArithmetic(op string, a, b types.Datum) (types.Datum, error) {
+	x, err := a.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	y, err := b.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	switch op {
+	case ast.Plus:
+		return floatDatum(x + y)
+	case ast.Minus:
+		return floatDatum(x - y)
+	case ast.Mul:
+		return floatDatum(x * y)
+	}
+	if y == 0 {
+		return nullDatum, nil
+	}
+	switch op {
+	case ast.Div:
+		return floatDatum(x / y)
+	case ast.IntDiv:
+		q := math.Trunc(x / y)
+		if q < math.MinInt64 || q >= math.MaxInt64 {
+			return nullDatum, errBigintOutOfRange
+		}
+		return types.NewIntDatum(int64(q)), nil
+	}
+	return floatDatum(math.Mod(x, y))
+}
+
+func builtinAbs(args []types.Datum) (types.Datum, error) {
+	d := args[0]
+	switch d.Kind() {
+	case types.KindNull, types.KindUint64:
+		return d, nil
+	case types.KindInt64:
+		v := d.GetInt64()
+		if v == math.MinInt64 {
+			return nullDatum, errBigintOutOfRange
+		}
+		if v < 0 {
+			v = -v
+		}
+		return types.NewIntDatum(v), nil
+	case types.KindMysqlDecimal:
+		if d.GetMysqlDecimal().IsNegative() {
+			return types.NewDecimalDatum(types.DecimalNeg(d.GetMysqlDecimal())), nil
+		}
+		return d, nil
+	}
+	f, err := d.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewFloat64Datum(math.Abs(f)), nil
+}
+
+//CEIL和FLOOR 定点数的结果在整数范围内时转换为整数
+func roundingFunc(ceil bool) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		d := args[0]
+		switch d.Kind() {
+		case types.KindNull, types.KindInt64, types.KindUint64:
+			return d, nil
+		case types.KindMysqlDecimal:
+			dec := d.GetMysqlDecimal()
+			to := new(types.MyDecimal)
+			if err := dec.Round(to, 0, types.ModeTruncate); err != nil {
+				return nullDatum, err
+			}
+			//截断向0取整 正数向上和负数向下时需要再加减1
+			if to.Compare(dec) != 0 && ceil != dec.IsNegative() {
+				one := new(types.MyDecimal).FromInt(1)
+				if !ceil {
+					one = types.DecimalNeg(one)
+				}
+				if err := decimalError(types.DecimalAdd(to, one, to)); err != nil {
+					return nullDatum, err
+				}
+			}
+			if v, err := decimalToInteger(to); err == nil {
+				return v, nil
+			}
+			return types.NewDecimalDatum(to), nil
+		}
+		f, err := d.ToFloat64(table.StmtCtx)
+		if err != nil {
+			return nullDatum, err
+		}
+		if ceil {
+			return types.NewFloat64Datum(math.Ceil(f)), nil
+		}
+		return types.NewFloat64Datum(math.Floor(f)), nil
+	}
+}
+
+//ROUND(x[, d]) 四舍五入到小数点后d位 d为负数时对整数部分取整
+func builtinRound(args []types.Datum) (types.Datum, error) {
+	return roundTo(args, types.ModeHalfEven, types.Round)
+}
+
+//TRUNCATE(x, d) 截断到小数点后d位
+func builtinTruncate(args []types.Datum) (types.Datum, error) {
+	return roundTo(args, types.ModeTruncate, types.Truncate)
+}
+
+func roundTo(args []types.Datum, mode types.RoundMode, roundFloat func(f float64, dec int) float64) (types.Datum, error) {
+	d := args[0]
+	frac := int64(0)
+	if len(args) > 1 {
+		values, isNull, err := intArgs(args[1:])
+		if err != nil || isNull {
+			return nullDatum, err
+		}
+		frac = values[0]
+	}
+	if d.IsNull() {
+		return nullDatum, nil
+	}
+	//小数位数超出定点数的范围时没有影响
+	if frac > mysql.MaxDecimalScale {
+		frac = mysql.MaxDecimalScale
+	} else if frac < -mysql.MaxDecimalWidth {
+		frac = -mysql.MaxDecimalWidth
+	}
+	if isFloatDatum(d) {
+		f, err := d.ToFloat64(table.StmtCtx)
+		if err != nil {
+			return nullDatum, err
+		}
+		return floatDatum(roundFloat(f, int(frac)))
+	}
+	if isIntegerDatum(d) && frac >= 0 {
+		return d, nil
+	}
+	dec, err := d.ToDecimal(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	to := new(types.MyDecimal)
+	if err := decimalError(dec.Round(to, int(frac), mode)); err != nil {
+		return nullDatum, err
+	}
+	if isIntegerDatum(d) {
+		return decimalToInteger(to)
+	}
+	return types.NewDecimalDatum(to), nil
+}
+
+//POW 结果为浮点数
+func builtinPow(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return nullDatum, nil
+	}
+	x, err := args[0].ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	y, err := args[1].ToFloat64(table.StmtCtx)
+	if err != nil {
+		return nullDatum, err
+	}
+	return floatDatum(math.Pow(x, y))
+}
+
+//SQRT 负数的结果为NULL
+func builtinSqrt(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() {
+		return nullDatum, nil
+	}
+	f, err := args[0].ToFloat64(table.StmtCtx)
+	if err != nil || f < 0 {
+		return nullDatum, err
+	}
+	return types.NewFloat64Datum(math.Sqrt(f)), nil
+}
+
+//SIGN 结果为-1 0 1
+func builtinSign(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() {
+		return nullDatum, nil
+	}
+	cmp, err := compareDatum(args[0], types.NewIntDatum(0))
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewIntDatum(int64(cmp)), nil
+}
+
+//GREATEST和LEAST 任意参数为NULL时结果为NULL
+func extremeFunc(greatest bool) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		result := args[0]
+		for _, arg := range args {
+			if arg.IsNull() {
+				return nullDatum, nil
+			}
+			cmp, err := compareDatum(arg, result)
+			if err != nil {
+				return nullDatum, err
+			}
+			if (greatest && cmp > 0) || (!greatest && cmp < 0) {
+				result = arg
+			}
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,340 @@
+package expression
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb/types"
+)
+
+//REPEAT LPAD RPAD结果的最大长度 超过时结果为NULL
+const maxStringLength = 1 << 24
+
+//参数转换为字符串 第二个返回值表示是否有NULL
+func stringArgs(args []types.Datum) ([]string, bool, error) {
+	strs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg.IsNull() {
+			return nil, true, nil
+		}
+		str, err := arg.ToString()
+		if err != nil {
+			return nil, false, err
+		}
+		strs = append(strs, str)
+	}
+	return strs, false, nil
+}
+
+//参数转换为整数 第二个返回值表示是否有NULL
+func intArgs(args []types.Datum) ([]int64, bool, error) {
+	values := make([]int64, 0, len(args))
+	for _, arg := range args {
+		if arg.IsNull() {
+			return nil, true, nil
+		}
+		v, err := arg.ToInt64(table.StmtCtx)
+		if err != nil {
+			return nil, false, err
+		}
+		values = append(values, v)
+	}
+	return values, false, nil
+}
+
+//只有一个字符串参数的函数
+func stringFunc(f func(str string) types.Datum) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		strs, isNull, err := stringArgs(args)
+		if err != nil || isNull {
+			return nullDatum, err
+		}
+		return f(strs[0]), nil
+	}
+}
+
+//CONCAT 任意参数为NULL时结果为NULL
+func builtinConcat(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args)
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	return types.NewStringDatum(strings.Join(strs, "")), nil
+}
+
+//CONCAT_WS 第一个参数为分隔符 跳过为NULL的参数
+func builtinConcatWS(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() {
+		return nullDatum, nil
+	}
+	var notNull []types.Datum
+	for _, arg := range args[1:] {
+		if !arg.IsNull() {
+			notNull = append(notNull, arg)
+		}
+	}
+	strs, _, err := stringArgs(append([]types.Datum{args[0]}, notNull...))
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewStringDatum(strings.Join(strs[1:], strs[0])), nil
+}
+
+var builtinUpper = stringFunc(func(str string) types.Datum {
+	return types.NewStringDatum(strings.ToUpper(str))
+})
+
+var builtinLower = stringFunc(func(str string) types.Datum {
+	return types.NewStringDatum(strings.ToLower(str))
+})
+
+//LENGTH 按字节计算
+var builtinLength = stringFunc(func(str string) types.Datum {
+	return types.NewIntDatum(int64(len(str)))
+})
+
+//CHAR_LENGTH 按字符计算
+var builtinCharLength = stringFunc(func(str string) types.Datum {
+	return types.NewIntDatum(int64(utf8.RuneCountInString(str)))
+})
+
+var builtinReverse = stringFunc(func(str string) types.Datum {
+	runes := []rune(str)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return types.NewStringDatum(string(runes))
+})
+
+var builtinLTrim = stringFunc(func(str string) types.Datum {
+	return types.NewStringDatum(strings.TrimLeft(str, " "))
+})
+
+var builtinRTrim = stringFunc(func(str string) types.Datum {
+	return types.NewStringDatum(strings.TrimRight(str, " "))
+})
+
+//SUBSTRING(str, pos[, len]) 位置从1开始按字符计算 负数表示从末尾开始
+func builtinSubstring(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args[:1])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	values, isNull, err := intArgs(args[1:])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	runes := []rune(strs[0])
+	n := int64(len(runes))
+	pos := values[0]
+	if pos < 0 {
+		pos += n
+	} else {
+		pos--
+	}
+	if pos < 0 || pos >= n || values[0] == 0 {
+		return types.NewStringDatum(""), nil
+	}
+	end := n
+	if len(values) > 1 {
+		if values[1] <= 0 {
+			return types.NewStringDatum(""), nil
+		}
+		if pos+values[1] < end {
+			end = pos + values[1]
+		}
+	}
+	return types.NewStringDatum(string(runes[pos:end])), nil
+}
+
+//LEFT 和 RIGHT 取前或后n个字符
+func builtinLeft(args []types.Datum) (types.Datum, error) {
+	return sideChars(args, true)
+}
+
+func builtinRight(args []types.Datum) (types.Datum, error) {
+	return sideChars(args, false)
+}
+
+func sideChars(args []types.Datum, left bool) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args[:1])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	values, isNull, err := intArgs(args[1:])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	runes := []rune(strs[0])
+	n := values[0]
+	if n < 0 {
+		n = 0
+	}
+	if n > int64(len(runes)) {
+		n = int64(len(runes))
+	}
+	if left {
+		return types.NewStringDatum(string(runes[:n])), nil
+	}
+	return types.NewStringDatum(string(runes[int64(len(runes))-n:])), nil
+}
+
+//TRIM([BOTH|LEADING|TRAILING] [remstr] FROM str) 参数为 字符串 要去掉的字符串 方向
+//只指定方向时要去掉的字符串为NULL 表示空格
+func builtinTrim(args []types.Datum) (types.Datum, error) {
+	if args[0].IsNull() {
+		return nullDatum, nil
+	}
+	str, err := args[0].ToString()
+	if err != nil {
+		return nullDatum, err
+	}
+	remstr := " "
+	if len(args) > 1 {
+		if args[1].IsNull() {
+			if len(args) == 2 {
+				return nullDatum, nil
+			}
+		} else if remstr, err = args[1].ToString(); err != nil {
+			return nullDatum, err
+		}
+	}
+	direction := ast.TrimBoth
+	if len(args) > 2 {
+		direction = ast.TrimDirectionType(args[2].GetInt64())
+	}
+	if remstr == "" {
+		return types.NewStringDatum(str), nil
+	}
+	if direction != ast.TrimTrailing {
+		for strings.HasPrefix(str, remstr) {
+			str = str[len(remstr):]
+		}
+	}
+	if direction != ast.TrimLeading {
+		for strings.HasSuffix(str, remstr) {
+			str = str[:len(str)-len(remstr)]
+		}
+	}
+	return types.NewStringDatum(str), nil
+}
+
+func builtinReplace(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args)
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	if strs[1] == "" {
+		return types.NewStringDatum(strs[0]), nil
+	}
+	return types.NewStringDatum(strings.Replace(strs[0], strs[1], strs[2], -1)), nil
+}
+
+func builtinRepeat(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args[:1])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	values, isNull, err := intArgs(args[1:])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	count := values[0]
+	if count <= 0 {
+		return types.NewStringDatum(""), nil
+	}
+	if count*int64(len(strs[0])) > maxStringLength {
+		return nullDatum, nil
+	}
+	return types.NewStringDatum(strings.Repeat(strs[0], int(count))), nil
+}
+
+//LPAD 和 RPAD 用padstr把str填充到len个字符 str更长时截断
+func builtinLpad(args []types.Datum) (types.Datum, error) {
+	return pad(args, true)
+}
+
+func builtinRpad(args []types.Datum) (types.Datum, error) {
+	return pad(args, false)
+}
+
+func pad(args []types.Datum, left bool) (types.Datum, error) {
+	strs, isNull, err := stringArgs([]types.Datum{args[0], args[2]})
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	values, isNull, err := intArgs(args[1:2])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	n := values[0]
+	if n < 0 || n > maxStringLength {
+		return nullDatum, nil
+	}
+	runes, padRunes := []rune(strs[0]), []rune(strs[1])
+	if int64(len(runes)) >= n {
+		return types.NewStringDatum(string(runes[:n])), nil
+	}
+	if len(padRunes) == 0 {
+		return nullDatum, nil
+	}
+	padding := make([]rune, 0, n-int64(len(runes)))
+	for int64(len(padding)) < n-int64(len(runes)) {
+		padding = append(padding, padRunes[len(padding)%len(padRunes)])
+	}
+	if left {
+		return types.NewStringDatum(string(padding) + string(runes)), nil
+	}
+	return types.NewStringDatum(string(runes) + string(padding)), nil
+}
+
+//子串第一次出现的位置 从1开始按字符计算 没有时为0 start为开始查找的位置
+func charIndex(str, substr string, start int64) int64 {
+	runes := []rune(str)
+	if start < 1 || start > int64(len(runes))+1 {
+		return 0
+	}
+	idx := strings.Index(string(runes[start-1:]), substr)
+	if idx < 0 {
+		return 0
+	}
+	return start + int64(utf8.RuneCountInString(string(runes[start-1:])[:idx]))
+}
+
+//INSTR(str, substr)
+func builtinInstr(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args)
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	return types.NewIntDatum(charIndex(strs[0], strs[1], 1)), nil
+}
+
+//LOCATE(substr, str[, pos])
+func builtinLocate(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args[:2])
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	start := int64(1)
+	if len(args) > 2 {
+		values, isNull, err := intArgs(args[2:])
+		if err != nil || isNull {
+			return nullDatum, err
+		}
+		start = values[0]
+	}
+	return types.NewIntDatum(charIndex(strs[1], strs[0], start)), nil
+}
+
+//STRCMP 按字节比较 结果为-1 0 1
+func builtinStrcmp(args []types.Datum) (types.Datum, error) {
+	strs, isNull, err := stringArgs(args)
+	if err != nil || isNull {
+		return nullDatum, err
+	}
+	return types.NewIntDatum(int64(strings.Compare(strs[0], strs[1]))), nil
+}
@@ -0,0 +1,119 @@
+package expression
+
+import (
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+//参数转换为时间 不能转换时第二个返回值为false 结果为NULL
+func toTime(d types.Datum) (types.Time, bool) {
+	if d.IsNull() {
+		return types.Time{}, false
+	}
+	if d.Kind() == types.KindMysqlTime {
+		return d.GetMysqlTime(), true
+	}
+	converted, err := d.ConvertTo(table.StmtCtx, field_types.NewFieldType(mysql.TypeDatetime))
+	if err != nil || converted.Kind() != types.KindMysqlTime {
+		return types.Time{}, false
+	}
+	return converted.GetMysqlTime(), true
+}
+
+//时间的日期部分
+func dateOf(t types.Time) types.Time {
+	return types.Time{
+		Time: types.FromDate(t.Time.Year(), t.Time.Month(), t.Time.Day(), 0, 0, 0, 0),
+		Type: mysql.TypeDate,
+	}
+}
+
+//NOW 当前时间 精确到秒
+func builtinNow(args []types.Datum) (types.Datum, error) {
+	return types.NewTimeDatum(types.CurrentTime(mysql.TypeDatetime)), nil
+}
+
+//CURDATE 当前日期
+func builtinCurdate(args []types.Datum) (types.Datum, error) {
+	return types.NewTimeDatum(dateOf(types.CurrentTime(mysql.TypeDatetime))), nil
+}
+
+func builtinDate(args []types.Datum) (types.Datum, error) {
+	t, ok := toTime(args[0])
+	if !ok {
+		return nullDatum, nil
+	}
+	return types.NewTimeDatum(dateOf(t)), nil
+}
+
+//YEAR MONTH等取时间的一部分
+func timePartFunc(part func(t types.MysqlTime) int) builtinFunc {
+	return func(args []types.Datum) (types.Datum, error) {
+		t, ok := toTime(args[0])
+		if !ok {
+			return nullDatum, nil
+		}
+		return types.NewIntDatum(int64(part(t.Time))), nil
+	}
+}
+
+//DATE_FORMAT(date, format) 格式与mysql相同
+func builtinDateFormat(args []types.Datum) (types.Datum, error) {
+	t, ok := toTime(args[0])
+	if !ok || args[1].IsNull() {
+		return nullDatum, nil
+	}
+	layout, err := args[1].ToString()
+	if err != nil {
+		return nullDatum, err
+	}
+	str, err := t.DateFormat(layout)
+	if err != nil {
+		return nullDatum, err
+	}
+	return types.NewStringDatum(str), nil
+}
+
+//DATEDIFF(expr1, expr2) 两个日期相差的天数 expr1-expr2
+func builtinDateDiff(args []types.Datum) (types.Datum, error) {
+	t1, ok1 := toTime(args[0])
+	t2, ok2 := toTime(args[1])
+	if !ok1 || !ok2 {
+		return nullDatum, nil
+	}
+	return types.NewIntDatum(int64(types.DateDiff(t1.Time, t2.Time))), nil
+}
+
+//UNIX_TIMESTAMP([date]) 时间按本地时区计算
+func builtinUnixTimestamp(args []types.Datum) (types.Datum, error) {
+	if len(args) == 0 {
+		return types.NewIntDatum(time.Now().Unix()), nil
+	}
+	t, ok := toTime(args[0])
+	if !ok {
+		return nullDatum, nil
+	}
+	goTime, err := t.Time.GoTime(time.Local)
+	if err != nil {
+		return nullDatum, nil
+	}
+	if goTime.Unix() < 0 {
+		return types.NewIntDatum(0), nil
+	}
+	return types.NewIntDatum(goTime.Unix()), nil
+}
+
+//FROM_UNIXTIME(unix_timestamp) 时间按本地时区计算
+func builtinFromUnixTime(args []types.Datum) (types.Datum, error) {
+	values, isNull, err := intArgs(args)
+	if err != nil || isNull || values[0] < 0 {
+		return nullDatum, err
+	}
+	t := types.Time{Time: types.FromGoTime(time.Unix(values[0], 0)), Type: mysql.TypeDatetime}
+	return types.NewTimeDatum(t), nil
+}
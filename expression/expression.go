@@ -0,0 +1,271 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+//表达式 在一行数据上求值
+type Expression interface {
+	//按行数据求值 row中值的顺序与构造表达式时的Schema一致
+	Eval(row []types.Datum) (types.Datum, error)
+	String() string
+}
+
+//列引用
+type Column struct {
+	Offset int           //列在行数据中的位置
+	Name   string        //列名称
+	Info   *table.Column //列信息
+}
+
+func (c *Column) Eval(row []types.Datum) (types.Datum, error) {
+	if c.Offset < 0 || c.Offset >= len(row) {
+		errStr := fmt.Sprintf("column(%s) offset(%d) out of row range", c.Name, c.Offset)
+		return types.Datum{}, errors.New(errStr)
+	}
+	return row[c.Offset], nil
+}
+
+func (c *Column) String() string {
+	return c.Name
+}
+
+//常量
+type Constant struct {
+	Value types.Datum
+}
+
+func (c *Constant) Eval(row []types.Datum) (types.Datum, error) {
+	return c.Value, nil
+}
+
+func (c *Constant) String() string {
+	if c.Value.IsNull() {
+		return "NULL"
+	}
+	str, err := c.Value.ToString()
+	if err != nil {
+		return fmt.Sprintf("%v", c.Value.GetValue())
+	}
+	if c.Value.Kind() == types.KindString || c.Value.Kind() == types.KindBytes {
+		return "'" + str + "'"
+	}
+	return str
+}
+
+//函数调用 包括比较 逻辑运算等操作符
+type ScalarFunction struct {
+	FuncName string       //函数名称 小写
+	Args     []Expression //参数
+	function builtinFunc  //函数实现
+	retType  retTypeFunc  //结果类型
+}
+
+func (sf *ScalarFunction) Eval(row []types.Datum) (types.Datum, error) {
+	args := make([]types.Datum, 0, len(sf.Args))
+	for _, arg := range sf.Args {
+		d, err := arg.Eval(row)
+		if err != nil {
+			return d, err
+		}
+		args = append(args, d)
+	}
+	return sf.function(args)
+}
+
+func (sf *ScalarFunction) String() string {
+	args := make([]string, 0, len(sf.Args))
+	for _, arg := range sf.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", sf.FuncName, strings.Join(args, ", "))
+}
+
+//构造函数调用
+func NewFunction(funcName string, args ...Expression) (Expression, error) {
+	funcName = strings.ToLower(funcName)
+	fc, ok := funcs[funcName]
+	if !ok {
+		errStr := fmt.Sprintf("function(%s) is not support", funcName)
+		return nil, errors.New(errStr)
+	}
+	if len(args) < fc.minArgs || (fc.maxArgs >= 0 && len(args) > fc.maxArgs) {
+		errStr := fmt.Sprintf("incorrect parameter count in the call to function(%s)", funcName)
+		return nil, errors.New(errStr)
+	}
+	return &ScalarFunction{FuncName: funcName, Args: args, function: fc.function, retType: fc.retType}, nil
+}
+
+//表达式结果的类型
+func RetType(expr Expression) *field_types.FieldType {
+	switch x := expr.(type) {
+	case *Column:
+		if x.Info != nil {
+			return x.Info.MysqlType
+		}
+	case *CorrelatedColumn:
+		if x.Info != nil {
+			return x.Info.MysqlType
+		}
+	case *Subquery:
+		return x.retType()
+	case *Constant:
+		return constantType(x.Value)
+	case *ScalarFunction:
+		return x.retType(x.Args)
+	}
+	return field_types.NewFieldType(mysql.TypeLonglong)
+}
+
+//条件表达式的求值结果是否为真 NULL按假处理
+func EvalBool(expr Expression, row []types.Datum) (bool, error) {
+	d, err := expr.Eval(row)
+	if err != nil || d.IsNull() {
+		return false, err
+	}
+	b, err := d.ToBool(table.StmtCtx)
+	if err != nil {
+		return false, err
+	}
+	return b == 1, nil
+}
+
+//按AND拆分条件表达式
+func SplitConjunction(expr Expression) []Expression {
+	sf, ok := expr.(*ScalarFunction)
+	if !ok || sf.FuncName != ast.LogicAnd {
+		return []Expression{expr}
+	}
+	var exprs []Expression
+	for _, arg := range sf.Args {
+		exprs = append(exprs, SplitConjunction(arg)...)
+	}
+	return exprs
+}
+
+//表达式中引用的全部列 子查询引用的外层查询的列也包括在内
+func ExtractColumns(expr Expression) []*Column {
+	switch x := expr.(type) {
+	case *Column:
+		return []*Column{x}
+	case *ScalarFunction:
+		var columns []*Column
+		for _, arg := range x.Args {
+			columns = append(columns, ExtractColumns(arg)...)
+		}
+		return columns
+	case *Subquery:
+		var columns []*Column
+		if x.Left != nil {
+			columns = ExtractColumns(x.Left)
+		}
+		for _, correlated := range x.Correlated {
+			columns = append(columns, &correlated.Column)
+		}
+		return columns
+	}
+	return nil
+}
+
+//复制表达式并把引用的列在行数据中的位置移动delta 用于把连接上的条件下推到右侧子节点
+func ShiftColumns(expr Expression, delta int) Expression {
+	switch x := expr.(type) {
+	case *Column:
+		column := *x
+		column.Offset += delta
+		return &column
+	case *ScalarFunction:
+		sf := *x
+		sf.Args = make([]Expression, 0, len(x.Args))
+		for _, arg := range x.Args {
+			sf.Args = append(sf.Args, ShiftColumns(arg, delta))
+		}
+		return &sf
+	case *Subquery:
+		//关联列复制后仍然设置子查询中使用的Data
+		subquery := *x
+		if x.Left != nil {
+			subquery.Left = ShiftColumns(x.Left, delta)
+		}
+		subquery.Correlated = make([]*CorrelatedColumn, 0, len(x.Correlated))
+		for _, correlated := range x.Correlated {
+			column := *correlated
+			column.Offset += delta
+			subquery.Correlated = append(subquery.Correlated, &column)
+		}
+		return &subquery
+	}
+	return expr
+}
+
+//表达式可以引用的列 按顺序与求值时的行数据对应
+type Schema struct {
+	Columns []*SchemaColumn
+}
+
+//Schema中的列
+type SchemaColumn struct {
+	TableName string        //所属表名称 小写
+	Name      string        //列名称 小写
+	Info      *table.Column //列信息
+	Redundant bool          //USING和NATURAL JOIN中被合并的列 只能带表名引用 *不展开
+}
+
+//表的全部列组成的Schema
+func NewTableSchema(tableInfo *table.MyTableInfo) *Schema {
+	schema := &Schema{Columns: make([]*SchemaColumn, 0, len(tableInfo.Columns))}
+	for _, column := range tableInfo.Columns {
+		schema.Columns = append(schema.Columns, &SchemaColumn{
+			TableName: strings.ToLower(tableInfo.TableName),
+			Name:      column.Name,
+			Info:      column,
+		})
+	}
+	return schema
+}
+
+//按名称查找列的位置 指定了表名时同时匹配表名
+func (s *Schema) FindColumn(name *ast.ColumnName) (int, error) {
+	offsets := s.matchColumns(name)
+	switch len(offsets) {
+	case 0:
+		errStr := fmt.Sprintf("Unknown column '%s'", name.String())
+		return -1, errors.New(errStr)
+	case 1:
+		return offsets[0], nil
+	}
+	errStr := fmt.Sprintf("Column '%s' in where clause is ambiguous", name.String())
+	return -1, errors.New(errStr)
+}
+
+//是否有按名称可以引用的列
+func (s *Schema) HasColumn(name *ast.ColumnName) bool {
+	return len(s.matchColumns(name)) > 0
+}
+
+//名称匹配的全部列的位置
+func (s *Schema) matchColumns(name *ast.ColumnName) []int {
+	var offsets []int
+	for i, column := range s.Columns {
+		if column.Name != name.Name.L {
+			continue
+		}
+		if name.Table.L != "" && column.TableName != name.Table.L {
+			continue
+		}
+		if name.Table.L == "" && column.Redundant {
+			continue
+		}
+		offsets = append(offsets, i)
+	}
+	return offsets
+}
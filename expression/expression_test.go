@@ -0,0 +1,377 @@
+package expression
+
+import (
+	"testing"
+
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+	_ "github.com/pingcap/tidb/types/parser_driver"
+)
+
+func testSchema() *Schema {
+	tableInfo := &table.MyTableInfo{
+		TableName: "t",
+		Columns: []*table.Column{
+			{Idx: 1, Name: "a", MysqlType: field_types.NewFieldType(mysql.TypeLonglong)},
+			{Idx: 2, Name: "b", MysqlType: field_types.NewFieldType(mysql.TypeLonglong)},
+			{Idx: 3, Name: "s", MysqlType: field_types.NewFieldType(mysql.TypeVarchar)},
+		},
+	}
+	return NewTableSchema(tableInfo)
+}
+
+//解析where条件并构造表达式
+func buildWhere(t *testing.T, where string) Expression {
+	stmt, err := parser.New().ParseOneStmt("select * from t where "+where, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := Build(stmt.(*ast.SelectStmt).Where, testSchema())
+	if err != nil {
+		t.Fatalf("build %s error:%s", where, err)
+	}
+	return expr
+}
+
+func TestEval(t *testing.T) {
+	row := []types.Datum{types.NewIntDatum(3), types.Datum{}, types.NewStringDatum("a_10")}
+	cases := []struct {
+		where  string
+		result interface{}
+	}{
+		{"a = 3", int64(1)},
+		{"3 < a", int64(0)},
+		{"a = b", nil},
+		{"a <=> b", int64(0)},
+		{"b <=> NULL", int64(1)},
+		{"a > 1 AND b > 1", nil},
+		{"a > 5 AND b > 1", int64(0)},
+		{"a > 1 OR b > 1", int64(1)},
+		{"a > 5 OR b > 1", nil},
+		{"NOT a = 3", int64(0)},
+		{"!(a = 4)", int64(1)},
+		{"a IN (1, 2, 3)", int64(1)},
+		{"a IN (1, NULL)", nil},
+		{"a NOT IN (1, 2)", int64(1)},
+		{"a BETWEEN 3 AND 5", int64(1)},
+		{"a NOT BETWEEN 1 AND 2", int64(1)},
+		{"s LIKE 'a\\_1%'", int64(1)},
+		{"s LIKE 'a_2%'", int64(0)},
+		{"s NOT LIKE '%0'", int64(0)},
+		{"b IS NULL", int64(1)},
+		{"s IS NOT NULL", int64(1)},
+		{"a = -(-3)", int64(1)},
+		{"(a = 3 AND s = 'a_10') XOR a = 3", int64(0)},
+	}
+	for _, ca := range cases {
+		d, err := buildWhere(t, ca.where).Eval(row)
+		if err != nil {
+			t.Fatalf("eval %s error:%s", ca.where, err)
+		}
+		if d.GetValue() != ca.result {
+			t.Fatalf("eval %s got %v, want %v", ca.where, d.GetValue(), ca.result)
+		}
+	}
+}
+
+func TestSplitConjunction(t *testing.T) {
+	exprs := SplitConjunction(buildWhere(t, "a = 1 AND (b > 2 AND s = 'x') AND (a < 3 OR b < 4)"))
+	if len(exprs) != 4 {
+		t.Fatalf("got %d conjunctions, want 4", len(exprs))
+	}
+	columns := ExtractColumns(exprs[3])
+	if len(columns) != 2 || columns[0].Name != "a" || columns[1].Offset != 1 {
+		t.Fatalf("unexpected columns %v", columns)
+	}
+}
+
+func TestUnknownColumn(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("select * from t where c = 1 and t.a = 1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Build(stmt.(*ast.SelectStmt).Where, testSchema())
+	if err == nil {
+		t.Fatal("expect unknown column error")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	rows := [][]types.Datum{
+		{types.NewIntDatum(3), types.NewIntDatum(1), types.NewStringDatum("x")},
+		{types.NewIntDatum(1), types.Datum{}, types.NewStringDatum("y")},
+		{types.NewIntDatum(3), types.NewIntDatum(2), types.Datum{}},
+		{types.NewIntDatum(8), types.NewIntDatum(2), types.NewStringDatum("x")},
+	}
+	cases := []struct {
+		field  string
+		result string
+	}{
+		{"count(*)", "4"},
+		{"count(b)", "3"},
+		{"count(distinct a)", "3"},
+		{"count(distinct a, s)", "3"},
+		{"sum(a)", "15"},
+		{"sum(distinct a)", "12"},
+		{"avg(b)", "1.6667"},
+		{"avg(s)", "0"},
+		{"max(a)", "8"},
+		{"min(b)", "1"},
+		{"max(s)", "y"},
+	}
+	for _, ca := range cases {
+		stmt, err := parser.New().ParseOneStmt("select "+ca.field+" from t", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var aggFuncs []*AggFunc
+		schema := testSchema()
+		expr, err := BuildWithAggregates(stmt.(*ast.SelectStmt).Fields.Fields[0].Expr, schema, &aggFuncs)
+		if err != nil {
+			t.Fatalf("build %s error:%s", ca.field, err)
+		}
+		if len(aggFuncs) != 1 {
+			t.Fatalf("%s: expect 1 aggregate function, got %d", ca.field, len(aggFuncs))
+		}
+		ctx := aggFuncs[0].NewContext()
+		for _, row := range rows {
+			if err := aggFuncs[0].Update(ctx, row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result, err := aggFuncs[0].Result(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//聚合结果位于表的全部列之后
+		d, err := expr.Eval(append(make([]types.Datum, len(schema.Columns)), result))
+		if err != nil {
+			t.Fatal(err)
+		}
+		str, err := d.ToString()
+		if err != nil || str != ca.result {
+			t.Fatalf("%s: got %s(%v), want %s", ca.field, str, err, ca.result)
+		}
+	}
+
+	//空输入
+	aggFunc, err := NewAggFunc("sum", false, &Column{Offset: 0, Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := aggFunc.Result(aggFunc.NewContext())
+	if err != nil || !result.IsNull() {
+		t.Fatalf("sum of empty input: got %v(%v), want NULL", result.GetValue(), err)
+	}
+	//聚合函数不能嵌套 也不能出现在where中
+	for _, sql := range []string{"select sum(count(a)) from t", "select a from t where count(a) > 1"} {
+		stmt, err := parser.New().ParseOneStmt(sql, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sel := stmt.(*ast.SelectStmt)
+		var aggFuncs []*AggFunc
+		if sel.Where != nil {
+			_, err = Build(sel.Where, testSchema())
+		} else {
+			_, err = BuildWithAggregates(sel.Fields.Fields[0].Expr, testSchema(), &aggFuncs)
+		}
+		if err == nil {
+			t.Fatalf("%s: expect error", sql)
+		}
+	}
+}
+
+func TestScalarFunctions(t *testing.T) {
+	row := []types.Datum{types.NewIntDatum(3), types.Datum{}, types.NewStringDatum("a_10")}
+	cases := []struct {
+		field  string
+		result string
+		tp     byte
+	}{
+		//算术运算
+		{"a * 2 + 1", "7", mysql.TypeLonglong},
+		{"a / 2", "1.5000", mysql.TypeNewDecimal},
+		{"a DIV 2", "1", mysql.TypeLonglong},
+		{"a % 2", "1", mysql.TypeLonglong},
+		{"a / 0", "NULL", mysql.TypeNewDecimal},
+		{"a - 0.5", "2.5", mysql.TypeNewDecimal},
+		{"a * 1e1", "30", mysql.TypeDouble},
+		{"a + b", "NULL", mysql.TypeLonglong},
+		{"-a + 1", "-2", mysql.TypeLonglong},
+		//字符串函数
+		{"concat(s, '-', a)", "a_10-3", mysql.TypeVarString},
+		{"concat(s, b)", "NULL", mysql.TypeVarString},
+		{"concat_ws(',', s, b, a)", "a_10,3", mysql.TypeVarString},
+		{"upper(s)", "A_10", mysql.TypeVarString},
+		{"lcase('AbC')", "abc", mysql.TypeVarString},
+		{"length('中文')", "6", mysql.TypeLonglong},
+		{"char_length('中文')", "2", mysql.TypeLonglong},
+		{"substring(s, 2)", "_10", mysql.TypeVarString},
+		{"substr(s, -2, 1)", "1", mysql.TypeVarString},
+		{"substring(s from 2 for 2)", "_1", mysql.TypeVarString},
+		{"left(s, 1)", "a", mysql.TypeVarString},
+		{"right(s, 2)", "10", mysql.TypeVarString},
+		{"trim('  x  ')", "x", mysql.TypeVarString},
+		{"trim(leading 'x' from 'xxyx')", "yx", mysql.TypeVarString},
+		{"trim(trailing from 'y  ')", "y", mysql.TypeVarString},
+		{"ltrim('  x ')", "x ", mysql.TypeVarString},
+		{"replace(s, '_', '-')", "a-10", mysql.TypeVarString},
+		{"reverse(s)", "01_a", mysql.TypeVarString},
+		{"repeat('ab', a)", "ababab", mysql.TypeVarString},
+		{"lpad(s, 6, '*')", "**a_10", mysql.TypeVarString},
+		{"rpad(s, 2, '*')", "a_", mysql.TypeVarString},
+		{"instr(s, '1')", "3", mysql.TypeLonglong},
+		{"locate('1', s, 4)", "0", mysql.TypeLonglong},
+		{"strcmp(s, 'a')", "1", mysql.TypeLonglong},
+		//数学函数
+		{"abs(-a)", "3", mysql.TypeLonglong},
+		{"ceil(2.1)", "3", mysql.TypeLonglong},
+		{"floor(-2.1)", "-3", mysql.TypeLonglong},
+		{"ceiling(-2.5e0)", "-2", mysql.TypeDouble},
+		{"round(2.45, 1)", "2.5", mysql.TypeNewDecimal},
+		{"round(a * 1000, -3)", "3000", mysql.TypeLonglong},
+		{"truncate(2.45, 1)", "2.4", mysql.TypeNewDecimal},
+		{"mod(a, 2)", "1", mysql.TypeLonglong},
+		{"pow(a, 2)", "9", mysql.TypeDouble},
+		{"sqrt(-a)", "NULL", mysql.TypeDouble},
+		{"sign(-a)", "-1", mysql.TypeLonglong},
+		{"greatest(a, 5, 1)", "5", mysql.TypeLonglong},
+		{"least(a, 2.5)", "2.5", mysql.TypeNewDecimal},
+		//日期和时间函数
+		{"date('2019-10-24 12:30:15')", "2019-10-24", mysql.TypeDate},
+		{"year('2019-10-24')", "2019", mysql.TypeLonglong},
+		{"month('2019-10-24')", "10", mysql.TypeLonglong},
+		{"dayofmonth('2019-10-24')", "24", mysql.TypeLonglong},
+		{"hour('2019-10-24 12:30:15')", "12", mysql.TypeLonglong},
+		{"minute('2019-10-24 12:30:15')", "30", mysql.TypeLonglong},
+		{"second('2019-10-24 12:30:15')", "15", mysql.TypeLonglong},
+		{"date_format('2019-10-24 12:30:15', '%Y/%m/%d %H')", "2019/10/24 12", mysql.TypeVarString},
+		{"datediff('2019-10-24', '2019-10-01 23:59:59')", "23", mysql.TypeLonglong},
+		{"from_unixtime(unix_timestamp('2019-10-24 12:30:15'))", "2019-10-24 12:30:15", mysql.TypeDatetime},
+		{"year(s)", "NULL", mysql.TypeLonglong},
+		//流程控制函数
+		{"if(a > 1, 'big', 'small')", "big", mysql.TypeVarString},
+		{"if(b, 1, 2)", "2", mysql.TypeLonglong},
+		{"ifnull(b, a)", "3", mysql.TypeLonglong},
+		{"coalesce(NULL, b, s)", "a_10", mysql.TypeVarString},
+		{"nullif(a, 3)", "NULL", mysql.TypeLonglong},
+		{"case when a > 5 then 'x' when a > 1 then 'y' end", "y", mysql.TypeVarString},
+		{"case a when 1 then 'one' else 'other' end", "other", mysql.TypeVarString},
+		{"case b when 1 then 1 end", "NULL", mysql.TypeLonglong},
+	}
+	for _, ca := range cases {
+		stmt, err := parser.New().ParseOneStmt("select "+ca.field+" from t", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := Build(stmt.(*ast.SelectStmt).Fields.Fields[0].Expr, testSchema())
+		if err != nil {
+			t.Fatalf("build %s error:%s", ca.field, err)
+		}
+		d, err := expr.Eval(row)
+		if err != nil {
+			t.Fatalf("eval %s error:%s", ca.field, err)
+		}
+		str := "NULL"
+		if !d.IsNull() {
+			if str, err = d.ToString(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if str != ca.result {
+			t.Fatalf("%s: got %s, want %s", ca.field, str, ca.result)
+		}
+		if tp := RetType(expr).Tp; tp != ca.tp {
+			t.Fatalf("%s: got type %d, want %d", ca.field, tp, ca.tp)
+		}
+	}
+
+	//参数个数错误和不支持的函数
+	for _, field := range []string{"upper(s, a)", "concat()", "no_such_func(a)", "a + b = 9223372036854775807 + 1"} {
+		stmt, err := parser.New().ParseOneStmt("select "+field+" from t", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Build(stmt.(*ast.SelectStmt).Fields.Fields[0].Expr, testSchema()); err == nil {
+			t.Fatalf("%s: expect error", field)
+		}
+	}
+}
+
+func TestSubquery(t *testing.T) {
+	row := []types.Datum{types.NewIntDatum(3), types.Datum{}, types.NewStringDatum("a_10")}
+	result := func(values ...interface{}) [][]types.Datum {
+		rows := make([][]types.Datum, 0, len(values))
+		for _, v := range values {
+			rows = append(rows, []types.Datum{types.NewDatum(v)})
+		}
+		return rows
+	}
+	cases := []struct {
+		kind   SubqueryKind
+		left   Expression
+		rows   [][]types.Datum
+		result interface{}
+	}{
+		{InSubquery, &Column{Offset: 0}, result(int64(1), int64(3)), int64(1)},
+		{InSubquery, &Column{Offset: 0}, result(int64(1), nil), nil},
+		{InSubquery, &Column{Offset: 1}, result(int64(1)), nil},
+		//空结果时左边为NULL也为假
+		{InSubquery, &Column{Offset: 1}, result(), int64(0)},
+		{ExistsSubquery, nil, result(nil), int64(1)},
+		{ExistsSubquery, nil, result(), int64(0)},
+		{ScalarSubquery, nil, result("x"), "x"},
+		{ScalarSubquery, nil, result(), nil},
+	}
+	for _, ca := range cases {
+		rows := ca.rows
+		s := &Subquery{Kind: ca.kind, Left: ca.left, Run: func(limit int) ([][]types.Datum, error) {
+			return rows, nil
+		}}
+		d, err := s.Eval(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.GetValue() != ca.result {
+			t.Errorf("kind %d rows %v: got %v, want %v", ca.kind, ca.rows, d.GetValue(), ca.result)
+		}
+	}
+
+	s := &Subquery{Kind: ScalarSubquery, Run: func(limit int) ([][]types.Datum, error) {
+		return result(int64(1), int64(2)), nil
+	}}
+	if _, err := s.Eval(row); err == nil {
+		t.Error("scalar subquery with 2 rows should fail")
+	}
+
+	//不关联的子查询只执行一次 关联的子查询按外层的值每次执行
+	correlated := &CorrelatedColumn{Column: Column{Offset: 0}, Data: new(types.Datum)}
+	runs := 0
+	run := func(limit int) ([][]types.Datum, error) {
+		runs++
+		return result(correlated.Data.GetValue()), nil
+	}
+	s = &Subquery{Kind: ScalarSubquery, Run: run}
+	s.Eval(row)
+	s.Eval(row)
+	if runs != 1 {
+		t.Errorf("uncorrelated subquery runs %d times", runs)
+	}
+	runs = 0
+	s = &Subquery{Kind: ScalarSubquery, Correlated: []*CorrelatedColumn{correlated}, Run: run}
+	for _, v := range []int64{4, 5} {
+		d, err := s.Eval([]types.Datum{types.NewIntDatum(v)})
+		if err != nil || d.GetInt64() != v {
+			t.Errorf("correlated subquery got %v %v, want %d", d.GetValue(), err, v)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("correlated subquery runs %d times", runs)
+	}
+}
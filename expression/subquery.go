@@ -0,0 +1,183 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+//子查询中引用的外层查询的列 Offset为列在外层行数据中的位置
+//子查询中求值时取Data 外层在执行子查询前按当前行设置
+type CorrelatedColumn struct {
+	Column
+	Data *types.Datum
+}
+
+func (c *CorrelatedColumn) Eval(row []types.Datum) (types.Datum, error) {
+	return *c.Data, nil
+}
+
+//子查询的种类
+type SubqueryKind int
+
+const (
+	ScalarSubquery SubqueryKind = iota //结果为一行一列的值
+	ExistsSubquery                     //EXISTS 是否有结果行
+	InSubquery                         //IN 左边的值是否在结果的第一列中
+)
+
+//子查询 在外层的行上求值
+//不引用外层查询的列时只执行一次 否则每一行按关联列的值执行一次
+type Subquery struct {
+	Kind            SubqueryKind
+	Left            Expression                               //IN左边的表达式
+	Plan            interface{}                              //子查询的物理计划
+	Correlated      []*CorrelatedColumn                      //引用的当前外层查询的列
+	OuterCorrelated bool                                     //引用了更外层查询的列 结果不能缓存
+	ResultType      *field_types.FieldType                   //结果第一列的类型
+	Run             func(limit int) ([][]types.Datum, error) //执行子查询 最多返回limit行 为0时返回全部行 由执行器设置
+	rows            [][]types.Datum                          //不关联时缓存的结果
+	done            bool
+}
+
+//执行子查询 关联列按外层的行设置
+func (s *Subquery) result(row []types.Datum) ([][]types.Datum, error) {
+	if s.done {
+		return s.rows, nil
+	}
+	if s.Run == nil {
+		return nil, errors.New("subquery is not prepared")
+	}
+	for _, column := range s.Correlated {
+		d, err := column.Column.Eval(row)
+		if err != nil {
+			return nil, err
+		}
+		*column.Data = d
+	}
+	//EXISTS只需要一行 标量子查询需要两行判断是否超过一行
+	limit := 0
+	switch s.Kind {
+	case ExistsSubquery:
+		limit = 1
+	case ScalarSubquery:
+		limit = 2
+	}
+	rows, err := s.Run(limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Correlated) == 0 && !s.OuterCorrelated {
+		s.rows, s.done = rows, true
+	}
+	return rows, nil
+}
+
+func (s *Subquery) Eval(row []types.Datum) (types.Datum, error) {
+	var left types.Datum
+	if s.Kind == InSubquery {
+		var err error
+		left, err = s.Left.Eval(row)
+		if err != nil {
+			return nullDatum, err
+		}
+	}
+	rows, err := s.result(row)
+	if err != nil {
+		return nullDatum, err
+	}
+	switch s.Kind {
+	case ExistsSubquery:
+		return boolDatum(len(rows) > 0), nil
+	case InSubquery:
+		//空结果时即使左边为NULL也为假
+		if len(rows) == 0 {
+			return falseDatum, nil
+		}
+		args := make([]types.Datum, 0, len(rows)+1)
+		args = append(args, left)
+		for _, r := range rows {
+			args = append(args, r[0])
+		}
+		return builtinIn(args)
+	}
+	switch len(rows) {
+	case 0:
+		return nullDatum, nil
+	case 1:
+		return rows[0][0], nil
+	}
+	return nullDatum, errors.New("Subquery returns more than 1 row")
+}
+
+func (s *Subquery) String() string {
+	switch s.Kind {
+	case ExistsSubquery:
+		return "exists(subquery)"
+	case InSubquery:
+		return fmt.Sprintf("in(%s, subquery)", s.Left.String())
+	}
+	return "subquery"
+}
+
+func (s *Subquery) retType() *field_types.FieldType {
+	if s.Kind == ScalarSubquery && s.ResultType != nil {
+		return s.ResultType
+	}
+	return field_types.NewFieldType(mysql.TypeLonglong)
+}
+
+//表达式中引用的关联列
+func ExtractCorrelatedColumns(expr Expression) []*CorrelatedColumn {
+	switch x := expr.(type) {
+	case *CorrelatedColumn:
+		return []*CorrelatedColumn{x}
+	case *ScalarFunction:
+		var columns []*CorrelatedColumn
+		for _, arg := range x.Args {
+			columns = append(columns, ExtractCorrelatedColumns(arg)...)
+		}
+		return columns
+	case *Subquery:
+		if x.Left != nil {
+			return ExtractCorrelatedColumns(x.Left)
+		}
+	}
+	return nil
+}
+
+//把子查询中的条件改写为连接上的条件 子查询的列移到外层的列之后 位置加上delta
+//correlated中的关联列替换为外层的列 其余关联列不变 包含子查询时不能改写
+func Decorrelate(expr Expression, correlated []*CorrelatedColumn, delta int) (Expression, bool) {
+	switch x := expr.(type) {
+	case *Column:
+		column := *x
+		column.Offset += delta
+		return &column, true
+	case *CorrelatedColumn:
+		for _, c := range correlated {
+			if c == x {
+				column := x.Column
+				return &column, true
+			}
+		}
+		return x, true
+	case *ScalarFunction:
+		sf := *x
+		sf.Args = make([]Expression, 0, len(x.Args))
+		for _, arg := range x.Args {
+			e, ok := Decorrelate(arg, correlated, delta)
+			if !ok {
+				return nil, false
+			}
+			sf.Args = append(sf.Args, e)
+		}
+		return &sf, true
+	case *Subquery:
+		return nil, false
+	}
+	return expr, true
+}
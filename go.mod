@@ -8,7 +8,9 @@ require (
 	github.com/json-iterator/go v1.1.7
 	github.com/juju/errors v0.0.0-20190806202954-0232dcc7464d // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/pingcap/check v0.0.0-20190102082844-67f458068fc8
 	github.com/pingcap/parser v0.0.0-20190924115157-8a4248be9c96
 	github.com/pingcap/tidb v0.0.0-20190703092821-755875aacb5a
 	github.com/pingcap/tipb v0.0.0-20190823055122-55a45ba82a79 // indirect
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/CDDSCLab/chaosdb/common/kv"
 	"github.com/CDDSCLab/chaosdb/common/tableOpt"
 	"github.com/CDDSCLab/chaosdb/executor"
 	"github.com/CDDSCLab/chaosdb/opt/levelDB"
 	"github.com/CDDSCLab/chaosdb/store/leveldb"
+	"github.com/CDDSCLab/chaosdb/store/mvcc"
 
 	"github.com/op/go-logging"
 	"github.com/pingcap/parser"
@@ -27,11 +29,16 @@ const (
 
 var octopusLogger = logging.MustGetLogger("chaosdb")
 
+//不在事务中的语句遇到事务冲突时默认的重试次数
+const DefaultRetryLimit = 10
+
 type Octopus struct {
 	storage    kv.Storage        //kv存储接口
+	mvcc       *mvcc.Store       //kv存储上的多版本存储
 	tableOpt   tableOpt.TableOpt //表操作接口
 	mu         sync.RWMutex
 	kvHandlers map[KVType]map[string]*Octopus //kv句柄缓存
+	retryLimit int                            //不在事务中的语句冲突时的重试次数
 }
 
 func NewOctopus() *Octopus {
@@ -94,14 +101,26 @@ func (octo *Octopus) CreateOctopus(kvType KVType, path, dbname string) (*Octopus
 	var storage kv.Storage
 	var err error
 	var tableOpt tableOpt.TableOpt
+	var mvccStore *mvcc.Store
 	switch kvType {
 	case LEVEL_DB:
 		storage, err = leveldb.NewLevelDB(path, dbname)
-		tableOpt = levelDB.NewLevelTableOpt(storage)
 		if err != nil {
 			octopusLogger.Errorf("chaosdb -> NewLevelDB error(%s)", err)
 			return nil, err
 		}
+		mvccStore, err = mvcc.NewStore(storage)
+		if err != nil {
+			octopusLogger.Errorf("chaosdb -> NewStore error(%s)", err)
+			storage.Close()
+			return nil, err
+		}
+		tableOpt, err = levelDB.NewLevelTableOpt(storage, mvccStore)
+		if err != nil {
+			octopusLogger.Errorf("chaosdb -> NewLevelTableOpt error(%s)", err)
+			storage.Close()
+			return nil, err
+		}
 	case TIKV_DB:
 		errStr := fmt.Sprintf("%s db no suppot", kvType)
 		return nil, errors.New(errStr)
@@ -112,11 +131,24 @@ func (octo *Octopus) CreateOctopus(kvType KVType, path, dbname string) (*Octopus
 		errStr := fmt.Sprintf("%s db no suppot", kvType)
 		return nil, errors.New(errStr)
 	}
-	octopus := &Octopus{storage: storage, tableOpt: tableOpt}
+	//后台清理旧版本
+	mvccStore.StartGC(mvcc.DefaultGCInterval)
+	octopus := &Octopus{storage: storage, mvcc: mvccStore, tableOpt: tableOpt, retryLimit: DefaultRetryLimit}
 
 	return octopus, nil
 }
 
+//设置不在事务中的语句遇到事务冲突时的重试次数 为0时不重试
+//BEGIN开始的事务冲突时由调用方重试整个事务
+func (octo *Octopus) SetRetryLimit(limit int) {
+	octo.retryLimit = limit
+}
+
+//设置SELECT ... FOR UPDATE和LOCK IN SHARE MODE等锁的超时时间
+func (octo *Octopus) SetLockWaitTimeout(timeout time.Duration) {
+	octo.mvcc.SetLockWaitTimeout(timeout)
+}
+
 func (octo *Octopus) Parser(sql string) (ast.StmtNode, error) {
 	sqlParser := parser.New()
 	return sqlParser.ParseOneStmt(sql, "utf8", "utf8_bin")
@@ -135,40 +167,15 @@ func (octo *Octopus) Exec(sql string) error {
 		return err
 	}
 	switch stmtNode.(type) {
-	case *ast.CreateTableStmt:
-		exec := executor.NewCreateTableExecutor(octo.tableOpt)
-		err = exec.Exec(stmtNode.(*ast.CreateTableStmt))
-		if err != nil {
-			//sql2kvLogger.Errorf("CreateTable exec error(%s)", err)
-			return err
-		}
-	case *ast.InsertStmt:
-		exec := executor.NewInsertExecutor(octo.tableOpt)
-		err = exec.Exec(stmtNode.(*ast.InsertStmt))
-		if err != nil {
-			//sql2kvLogger.Errorf("Insert exec error(%s)", err)
-			return err
-		}
-	case *ast.DeleteStmt:
-		exec := executor.NewDeleteExecutor(octo.tableOpt)
-		err = exec.Exec(stmtNode.(*ast.DeleteStmt))
-		if err != nil {
-			//sql2kvLogger.Error("Delete exec error(%s)", err)
-			return err
-		}
-	case *ast.UpdateStmt:
-		exec := executor.NewUpdateExecutor(octo.tableOpt)
-		err = exec.Exec(stmtNode.(*ast.UpdateStmt))
-		if err != nil {
-			//sql2kvLogger.Error("Update exec error(%s)", err)
-			return err
-		}
-	default:
-		errStr := fmt.Sprintf("sql type no support")
-		//sql2kvLogger.Errorf(errStr)
+	case *ast.BeginStmt, *ast.CommitStmt, *ast.RollbackStmt:
+		errStr := fmt.Sprintf("transaction statement needs a session, please call NewSession()")
+		return errors.New(errStr)
+	case *ast.UseStmt:
+		errStr := fmt.Sprintf("use statement needs a session, please call NewSession()")
 		return errors.New(errStr)
 	}
-	return nil
+	//不在事务中的语句单独执行
+	return octo.NewSession().exec(stmtNode)
 }
 
 func (octo *Octopus) Query(querySql string) (*executor.QueryResult, error) {
@@ -180,22 +187,11 @@ func (octo *Octopus) Query(querySql string) (*executor.QueryResult, error) {
 		errStr := fmt.Sprintf("ParseSql error sql:%s,error:%s", querySql, err)
 		return nil, errors.New(errStr)
 	}
-	switch stmtNode.(type) {
-	case *ast.SelectStmt:
-		exec := executor.NewSelectExecutor(octo.tableOpt)
-		res, err := exec.Query(stmtNode.(*ast.SelectStmt))
-		if err != nil {
-			//sql2kvLogger.Errorf("exec error(%s)", err)
-			return nil, err
-		}
-		return res, nil
-	default:
-		errStr := fmt.Sprintf("Sql not a QuerySql,please call exec()")
-		return nil, errors.New(errStr)
-	}
+	return octo.NewSession().query(stmtNode)
 }
 
 func (octo *Octopus) Free() error {
+	octo.mvcc.Close()
 	return octo.storage.Close()
 }
 
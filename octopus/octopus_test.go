@@ -1,3 +1,1855 @@
 package octopus
 
-// TODO
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/opt/levelDB"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/store/mvcc"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+	"github.com/CDDSCLab/chaosdb/util/rowcodec"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type OctopusSuite struct {
+	dir  string
+	octo *Octopus
+}
+
+var _ = Suite(&OctopusSuite{})
+
+func (s *OctopusSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "chaosdb")
+	c.Assert(err, IsNil)
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+}
+
+func (s *OctopusSuite) TearDownTest(c *C) {
+	c.Assert(s.octo.Free(), IsNil)
+	os.RemoveAll(s.dir)
+}
+
+func (s *OctopusSuite) mustExec(c *C, sql string) {
+	err := s.octo.Exec(sql)
+	c.Assert(err, IsNil, Commentf("sql:%s", sql))
+}
+
+//执行查询 返回全部结果行
+func (s *OctopusSuite) mustQuery(c *C, sql string) []table.Row {
+	res, err := s.octo.Query(sql)
+	c.Assert(err, IsNil, Commentf("sql:%s", sql))
+	var rows []table.Row
+	var row table.Row
+	for res.Next(&row) {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func rowIds(rows []table.Row) []uint64 {
+	ids := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.RowId)
+	}
+	return ids
+}
+
+func (s *OctopusSuite) createAccountTable(c *C) {
+	s.mustExec(c, `CREATE TABLE account(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  NAME varchar(64) NOT NULL,
+  CODE varchar(64) NOT NULL,
+  AMOUNT bigint(20) NOT NULL,
+  PRIMARY KEY (ID),
+  UNIQUE KEY CODE (CODE),
+  INDEX NAME (NAME)
+)`)
+	s.mustExec(c, `insert into account (NAME, CODE, AMOUNT) values
+  ('a_1', 'c_1', '10'), ('a_10', 'c_10', '-5'), ('a_2', 'c_2', '7'), ('a_1', '2', '3'),
+  ('10', 'c_3', '100'), ('9', 'c_4', '100'), ('a_1', 'c_5', '1')`)
+}
+
+func (s *OctopusSuite) TestIndexValueEncoding(c *C) {
+	s.createAccountTable(c)
+
+	//包含分隔符的索引值不会和其他值混淆
+	rows := s.mustQuery(c, "select * from account where NAME='a_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 4, 7})
+	rows = s.mustQuery(c, "select * from account where NAME='a_10'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{2})
+	//字符串类型的索引列 数字形式的值按字符串处理
+	rows = s.mustQuery(c, "select * from account where NAME='9'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{6})
+
+	rows = s.mustQuery(c, "select NAME from account where CODE='c_10'")
+	c.Assert(len(rows), Equals, 1)
+	c.Assert(rows[0].Datums, HasLen, 1)
+	c.Assert(rows[0].ValueString(0), Equals, "a_10")
+	rows = s.mustQuery(c, "select NAME from account where CODE='2'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4})
+}
+
+func (s *OctopusSuite) TestPrimaryKeyRange(c *C) {
+	s.createAccountTable(c)
+
+	rows := s.mustQuery(c, "select * from account")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 2, 3, 4, 5, 6, 7})
+	rows = s.mustQuery(c, "select * from account where ID>2")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{3, 4, 5, 6, 7})
+	rows = s.mustQuery(c, "select * from account where ID<3")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 2})
+	rows = s.mustQuery(c, "select * from account where ID>2 limit 1,2")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4, 5})
+	rows = s.mustQuery(c, "select * from account where ID=5")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{5})
+	rows = s.mustQuery(c, "select * from account where ID=50")
+	c.Assert(rows, HasLen, 0)
+}
+
+func (s *OctopusSuite) TestUpdateAndDeleteIndex(c *C) {
+	s.createAccountTable(c)
+
+	s.mustExec(c, "update account set NAME='b_1' where ID=1")
+	rows := s.mustQuery(c, "select * from account where NAME='a_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4, 7})
+	rows = s.mustQuery(c, "select * from account where NAME='b_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1})
+
+	//更新为相同的索引值 索引不能丢失
+	s.mustExec(c, "update account set NAME='b_1' where ID=1")
+	rows = s.mustQuery(c, "select * from account where NAME='b_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1})
+
+	s.mustExec(c, "delete from account where NAME='a_1'")
+	rows = s.mustQuery(c, "select * from account")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 2, 3, 5, 6})
+	rows = s.mustQuery(c, "select * from account where NAME='a_1'")
+	c.Assert(rows, HasLen, 0)
+}
+
+func (s *OctopusSuite) TestTypedRowValues(c *C) {
+	s.mustExec(c, `CREATE TABLE item(
+  ID bigint(20) unsigned NOT NULL,
+  NAME varchar(64) NOT NULL,
+  PRICE decimal(10,2),
+  QTY int(11) DEFAULT 1,
+  NOTE varchar(64),
+  PRIMARY KEY (ID)
+)`)
+	s.mustExec(c, "insert into item (ID, NAME, PRICE, QTY, NOTE) values (1, 'a', 9.5, -3, NULL)")
+	s.mustExec(c, "insert into item (ID, NAME) values (2, 'b')")
+
+	rows := s.mustQuery(c, "select * from item")
+	c.Assert(rows, HasLen, 2)
+	c.Assert(rows[0].Datums[0].GetUint64(), Equals, uint64(1))
+	c.Assert(rows[0].Datums[1].GetString(), Equals, "a")
+	c.Assert(rows[0].ValueString(2), Equals, "9.50")
+	c.Assert(rows[0].Datums[3].GetInt64(), Equals, int64(-3))
+	c.Assert(rows[0].Datums[4].IsNull(), IsTrue)
+	//省略的列取默认值或NULL
+	c.Assert(rows[1].Datums[2].IsNull(), IsTrue)
+	c.Assert(rows[1].Datums[3].GetInt64(), Equals, int64(1))
+	c.Assert(rows[1].ValueString(4), Equals, "NULL")
+
+	//非空约束
+	err := s.octo.Exec("insert into item (ID, NAME) values (3, NULL)")
+	c.Assert(err, NotNil)
+
+	s.mustExec(c, "update item set NOTE='x', QTY=-7 where ID=2")
+	rows = s.mustQuery(c, "select QTY, NOTE from item where ID=2")
+	c.Assert(rows, HasLen, 1)
+	c.Assert(rows[0].Datums[0].GetInt64(), Equals, int64(-7))
+	c.Assert(rows[0].ValueString(1), Equals, "x")
+}
+
+func (s *OctopusSuite) TestCompositeIndex(c *C) {
+	s.mustExec(c, `CREATE TABLE tx(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  HASH char(64) NOT NULL,
+  TXTIME bigint(20),
+  TXTYPE int(11) NOT NULL,
+  SEQ int(11),
+  PRIMARY KEY (ID),
+  KEY HASH (HASH,TXTIME,TXTYPE),
+  UNIQUE KEY SEQ (SEQ,HASH)
+)`)
+	s.mustExec(c, `insert into tx (HASH, TXTIME, TXTYPE, SEQ) values
+  ('h1', 10, 1, 1), ('h1', 20, 2, 2), ('h1', 30, 1, NULL), ('h2', 10, 1, NULL),
+  ('h1', NULL, 1, 3), ('h2', 5, 3, 1)`)
+
+	//一个联合索引而不是三个单列索引
+	rows := s.mustQuery(c, "select * from tx where HASH='h1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{5, 1, 2, 3})
+	rows = s.mustQuery(c, "select * from tx where HASH='h1' AND TXTIME>10")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{2, 3})
+	rows = s.mustQuery(c, "select * from tx where HASH='h1' AND TXTIME<30")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 2})
+	rows = s.mustQuery(c, "select * from tx where TXTYPE=1 AND TXTIME=10 AND HASH='h1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1})
+	//前缀之外的条件在取出行后过滤
+	rows = s.mustQuery(c, "select * from tx where HASH='h1' AND TXTYPE=1 limit 1,2")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 3})
+	rows = s.mustQuery(c, "select * from tx where ID=2 AND HASH='h2'")
+	c.Assert(rows, HasLen, 0)
+	//不满足最左前缀
+	rows = s.mustQuery(c, "select * from tx where TXTIME=10")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 4})
+
+	//唯一索引 索引值包含NULL时不受唯一约束
+	rows = s.mustQuery(c, "select * from tx where SEQ=1")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 6})
+	rows = s.mustQuery(c, "select * from tx where SEQ=1 AND HASH='h2'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{6})
+
+	s.mustExec(c, "update tx set TXTIME=40 where HASH='h1' AND TXTIME=20")
+	rows = s.mustQuery(c, "select * from tx where HASH='h1' AND TXTIME>30")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{2})
+	rows = s.mustQuery(c, "select * from tx where HASH='h1' AND TXTIME=20")
+	c.Assert(rows, HasLen, 0)
+
+	s.mustExec(c, "delete from tx where SEQ=1 AND HASH='h2'")
+	rows = s.mustQuery(c, "select * from tx where HASH='h2'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4})
+	rows = s.mustQuery(c, "select * from tx where SEQ=1")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1})
+}
+
+func (s *OctopusSuite) TestWhereExpression(c *C) {
+	s.createAccountTable(c)
+
+	cases := []struct {
+		where string
+		ids   []uint64
+	}{
+		{`ID>0 AND (AMOUNT>50 OR NAME LIKE 'a\_1%')`, []uint64{1, 2, 4, 5, 6, 7}},
+		{"NAME='a_1' AND AMOUNT NOT IN (3, 10)", []uint64{7}},
+		{"ID<10 AND AMOUNT BETWEEN 0 AND 10", []uint64{1, 3, 4, 7}},
+		{"ID>0 AND ID<4", []uint64{1, 2, 3}},
+		{"ID>0 AND NOT (AMOUNT >= 7)", []uint64{2, 4, 7}},
+		{"ID>0 AND AMOUNT > ID", []uint64{1, 3, 5, 6}},
+		{"ID>0 AND NAME IS NULL", []uint64{}},
+		{"ID>0 AND CODE IS NOT NULL AND AMOUNT<0", []uint64{2}},
+		{"5 > ID AND 'a_1' = NAME", []uint64{1, 4}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, "select * from account where "+ca.where)
+		c.Assert(rowIds(rows), DeepEquals, ca.ids, Commentf("where:%s", ca.where))
+	}
+
+	s.mustExec(c, "update account set AMOUNT=0 where NAME='a_1' AND (AMOUNT=1 OR AMOUNT=3)")
+	rows := s.mustQuery(c, "select * from account where NAME='a_1' AND AMOUNT=0")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4, 7})
+
+	s.mustExec(c, "delete from account where ID>0 AND AMOUNT IN (0, NULL)")
+	rows = s.mustQuery(c, "select * from account")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 2, 3, 5, 6})
+	rows = s.mustQuery(c, "select * from account where NAME='a_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1})
+}
+
+func (s *OctopusSuite) TestTableScanFallback(c *C) {
+	s.createAccountTable(c)
+
+	rows := s.mustQuery(c, "select * from account where AMOUNT=100")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{5, 6})
+	rows = s.mustQuery(c, "select * from account where AMOUNT>=7 OR NAME='a_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 3, 4, 5, 6, 7})
+	//偏移量和数量按过滤后的结果计算
+	rows = s.mustQuery(c, "select * from account where AMOUNT>0 limit 2,3")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{4, 5, 6})
+	rows = s.mustQuery(c, "select * from account where ID>=3 AND AMOUNT<100 limit 1")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{3})
+	rows = s.mustQuery(c, "select * from account where 1=0")
+	c.Assert(rows, HasLen, 0)
+
+	s.mustExec(c, "update account set NAME='z' where AMOUNT=100")
+	rows = s.mustQuery(c, "select * from account where NAME='z'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{5, 6})
+	s.mustExec(c, "delete from account where AMOUNT<5")
+	rows = s.mustQuery(c, "select * from account")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 3, 5, 6})
+}
+
+func (s *OctopusSuite) TestInclusiveRanges(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, `CREATE TABLE num(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  V int(11),
+  W int(11),
+  PRIMARY KEY (ID),
+  KEY V (V),
+  UNIQUE KEY W (W)
+)`)
+	s.mustExec(c, `insert into num (V, W) values (5, 50), (3, 30), (NULL, NULL), (3, 31), (8, 80), (1, 10)`)
+
+	cases := []struct {
+		sql string
+		ids []uint64
+	}{
+		//主键
+		{"select * from account where ID>=3", []uint64{3, 4, 5, 6, 7}},
+		{"select * from account where ID<=2", []uint64{1, 2}},
+		{"select * from account where ID>=2 AND ID<=4 limit 1,5", []uint64{3, 4}},
+		{"select * from account where ID!=3", []uint64{1, 2, 4, 5, 6, 7}},
+		{"select * from account where ID!=3 limit 2,2", []uint64{4, 5}},
+		{"select * from account where ID!=3 AND ID!=4", []uint64{1, 2, 5, 6, 7}},
+		{"select * from account where ID>=2.5", []uint64{3, 4, 5, 6, 7}},
+		{"select * from account where ID<=2.5", []uint64{1, 2}},
+		{"select * from account where ID>-1 AND ID<2", []uint64{1}},
+		{"select * from account where ID<0", []uint64{}},
+		{"select * from account where ID=5 limit 1", []uint64{5}},
+		{"select * from account where ID=5 limit 1,1", []uint64{}},
+		{"select * from account where ID=2.5", []uint64{}},
+		//普通索引 按索引顺序返回 NULL不在范围内
+		{"select * from num where V>=3", []uint64{2, 4, 1, 5}},
+		{"select * from num where V<=3", []uint64{6, 2, 4}},
+		{"select * from num where V!=3", []uint64{6, 1, 5}},
+		{"select * from num where V>=3 AND V<8", []uint64{2, 4, 1}},
+		{"select * from num where V>=3 limit 1,2", []uint64{4, 1}},
+		{"select * from num where V>2.5", []uint64{2, 4, 1, 5}},
+		{"select * from num where V<3.5", []uint64{6, 2, 4}},
+		//唯一索引
+		{"select * from num where W>=31", []uint64{4, 1, 5}},
+		{"select * from num where W<=30", []uint64{6, 2}},
+		{"select * from num where W!=50", []uint64{6, 2, 4, 5}},
+		{"select * from num where W!=50 limit 1,2", []uint64{2, 4}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowIds(rows), DeepEquals, ca.ids, Commentf("sql:%s", ca.sql))
+	}
+
+	s.mustExec(c, "delete from num where V<=3")
+	rows := s.mustQuery(c, "select * from num where W>=0")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 5})
+}
+
+func (s *OctopusSuite) TestStringRanges(c *C) {
+	s.createAccountTable(c)
+
+	cases := []struct {
+		sql string
+		ids []uint64
+	}{
+		//普通索引 按字节序返回
+		{"select * from account where NAME>'a_1'", []uint64{2, 3}},
+		{"select * from account where NAME>='a_1'", []uint64{1, 4, 7, 2, 3}},
+		{"select * from account where NAME<'a'", []uint64{5, 6}},
+		{"select * from account where NAME<='a_1'", []uint64{5, 6, 1, 4, 7}},
+		{"select * from account where NAME>'9' AND NAME<'a_10'", []uint64{1, 4, 7}},
+		{"select * from account where NAME!='a_1'", []uint64{5, 6, 2, 3}},
+		{"select * from account where NAME>='a_1' limit 2,2", []uint64{7, 2}},
+		{"select * from account where 'a_1'<NAME", []uint64{2, 3}},
+		//和数字比较时按数字比较 不使用索引
+		{"select * from account where NAME>9", []uint64{5}},
+		//唯一索引
+		{"select * from account where CODE>'c_2'", []uint64{5, 6, 7}},
+		{"select * from account where CODE<='c_10'", []uint64{4, 1, 2}},
+		{"select * from account where CODE>='c_1' AND CODE<'c_3'", []uint64{1, 2, 3}},
+		{"select * from account where CODE BETWEEN 'c_1' AND 'c_2'", []uint64{1, 2, 3}},
+		{"select * from account where CODE!='c_2' limit 1,3", []uint64{1, 2, 5}},
+		{"select * from account where CODE>'c_5'", []uint64{}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowIds(rows), DeepEquals, ca.ids, Commentf("sql:%s", ca.sql))
+	}
+}
+
+func (s *OctopusSuite) TestOrderBy(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, `CREATE TABLE num(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  V int(11),
+  PRIMARY KEY (ID),
+  KEY V (V)
+)`)
+	s.mustExec(c, `insert into num (V) values (5), (3), (NULL), (3), (8), (1)`)
+
+	cases := []struct {
+		sql string
+		ids []uint64
+	}{
+		//排序
+		{"select * from account order by AMOUNT", []uint64{2, 7, 4, 3, 1, 5, 6}},
+		{"select * from account order by AMOUNT desc", []uint64{5, 6, 1, 3, 4, 7, 2}},
+		{"select * from account order by AMOUNT desc, ID desc", []uint64{6, 5, 1, 3, 4, 7, 2}},
+		{"select * from account order by -AMOUNT", []uint64{5, 6, 1, 3, 4, 7, 2}},
+		{"select ID, AMOUNT from account order by 2", []uint64{2, 7, 4, 3, 1, 5, 6}},
+		{"select * from account where NAME='a_1' order by AMOUNT", []uint64{7, 4, 1}},
+		{"select * from account order by NAME", []uint64{5, 6, 1, 4, 7, 2, 3}},
+		{"select * from account order by NAME desc, ID desc", []uint64{3, 2, 7, 4, 1, 6, 5}},
+		//top-n
+		{"select * from account order by AMOUNT limit 3", []uint64{2, 7, 4}},
+		{"select * from account order by AMOUNT desc limit 1,3", []uint64{6, 1, 3}},
+		{"select * from account where AMOUNT>0 order by AMOUNT limit 10", []uint64{7, 4, 3, 1, 5, 6}},
+		//LIMIT 0返回空结果
+		{"select * from account limit 0", []uint64{}},
+		{"select * from account limit 2,0", []uint64{}},
+		{"select * from account order by AMOUNT limit 0", []uint64{}},
+		{"select * from account where NAME='a_1' limit 0", []uint64{}},
+		{"select * from account order by ID desc limit 0", []uint64{}},
+		//主键顺序
+		{"select * from account order by ID desc", []uint64{7, 6, 5, 4, 3, 2, 1}},
+		{"select * from account order by ID desc limit 2,2", []uint64{5, 4}},
+		{"select * from account where ID>=3 order by ID desc", []uint64{7, 6, 5, 4, 3}},
+		{"select * from account where ID!=3 order by ID desc", []uint64{7, 6, 5, 4, 2, 1}},
+		{"select * from account where AMOUNT=100 order by AMOUNT, ID desc", []uint64{6, 5}},
+		//索引顺序
+		{"select * from account where NAME='a_1' order by ID desc", []uint64{7, 4, 1}},
+		{"select * from account where NAME>'9' order by NAME desc", []uint64{3, 2, 7, 4, 1}},
+		{"select * from account where NAME>'9' order by NAME, ID", []uint64{1, 4, 7, 2, 3}},
+		{"select * from account order by NAME desc, ID desc limit 3", []uint64{3, 2, 7}},
+		{"select * from account order by CODE limit 1,2", []uint64{1, 2}},
+		//NULL最小
+		{"select * from num order by V", []uint64{3, 6, 2, 4, 1, 5}},
+		{"select * from num order by V desc", []uint64{5, 1, 2, 4, 6, 3}},
+		{"select * from num order by V limit 2", []uint64{3, 6}},
+		{"select * from num order by V desc, ID desc limit 10", []uint64{5, 1, 4, 2, 6, 3}},
+		{"select * from num where V>=3 order by V desc, ID", []uint64{5, 1, 2, 4}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowIds(rows), DeepEquals, ca.ids, Commentf("sql:%s", ca.sql))
+	}
+
+	_, err := s.octo.Query("select ID, AMOUNT from account order by 3")
+	c.Assert(err, NotNil)
+	_, err = s.octo.Query("select * from account order by NOPE")
+	c.Assert(err, NotNil)
+}
+
+//查询结果的全部值
+func rowValues(rows []table.Row) [][]string {
+	values := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		value := make([]string, 0, len(row.Datums))
+		for i := range row.Datums {
+			value = append(value, row.ValueString(i))
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func (s *OctopusSuite) TestAggregation(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, `CREATE TABLE num(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  V int(11),
+  PRIMARY KEY (ID),
+  KEY V (V)
+)`)
+	s.mustExec(c, `insert into num (V) values (5), (3), (NULL), (3), (8), (1)`)
+
+	cases := []struct {
+		sql    string
+		values [][]string
+	}{
+		{"select count(*) from account", [][]string{{"7"}}},
+		{"select count(*), sum(AMOUNT), min(AMOUNT), max(AMOUNT), avg(AMOUNT) from account", [][]string{{"7", "216", "-5", "100", "30.8571"}}},
+		{"select count(*) from account where AMOUNT>=10", [][]string{{"3"}}},
+		{"select count(distinct AMOUNT), count(distinct NAME) from account", [][]string{{"6", "5"}}},
+		{"select sum(AMOUNT) from account where NAME='a_1'", [][]string{{"14"}}},
+		{"select count(*) from account where ID=3", [][]string{{"1"}}},
+		{"select count(*) from account where ID=3 limit 1,1", [][]string{}},
+		//分组
+		{"select NAME, count(*), sum(AMOUNT) from account group by NAME", [][]string{
+			{"a_1", "3", "14"}, {"a_10", "1", "-5"}, {"a_2", "1", "7"}, {"10", "1", "100"}, {"9", "1", "100"}}},
+		{"select NAME, count(*), sum(AMOUNT) from account group by NAME having count(*) > 1", [][]string{{"a_1", "3", "14"}}},
+		{"select NAME, count(*) from account group by NAME order by count(*) desc, NAME limit 2", [][]string{{"a_1", "3"}, {"10", "1"}}},
+		{"select AMOUNT, count(*) from account group by 1 order by 1 desc limit 1", [][]string{{"100", "2"}}},
+		{"select max(ID) from account group by AMOUNT having AMOUNT < 5 order by 1", [][]string{{"2"}, {"4"}, {"7"}}},
+		//DISTINCT按选择列去重
+		{"select distinct NAME from account order by NAME", [][]string{{"10"}, {"9"}, {"a_1"}, {"a_10"}, {"a_2"}}},
+		{"select distinct AMOUNT from account where AMOUNT>=10 order by 1 desc", [][]string{{"100"}, {"10"}}},
+		{"select distinct NAME, AMOUNT>0 from account where NAME='a_1' order by 2", [][]string{{"a_1", "1"}}},
+		{"select distinct NAME from account order by NAME limit 1,2", [][]string{{"9"}, {"a_1"}}},
+		{"select distinct count(*) from account group by NAME order by 1", [][]string{{"1"}, {"3"}}},
+		{"select distinct V from num where V=3", [][]string{{"3"}}},
+		//空输入
+		{"select count(*), sum(AMOUNT), max(AMOUNT) from account where AMOUNT>1000", [][]string{{"0", "NULL", "NULL"}}},
+		{"select NAME, count(*) from account where AMOUNT>1000 group by NAME", [][]string{}},
+		{"select max(AMOUNT) from account having max(AMOUNT) > 1000", [][]string{}},
+		//主键和索引两端
+		{"select min(ID), max(ID) from account", [][]string{{"1", "7"}}},
+		{"select min(NAME), max(NAME), max(CODE) from account", [][]string{{"10", "a_2", "c_5"}}},
+		//NULL不参与聚合
+		{"select min(V), max(V) from num", [][]string{{"1", "8"}}},
+		{"select count(V), count(*), min(V), max(V), sum(V), avg(V) from num", [][]string{{"5", "6", "1", "8", "20", "4.0000"}}},
+		{"select V, count(*) from num group by V order by V", [][]string{{"NULL", "1"}, {"1", "1"}, {"3", "2"}, {"5", "1"}, {"8", "1"}}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowValues(rows), DeepEquals, ca.values, Commentf("sql:%s", ca.sql))
+	}
+
+	res, err := s.octo.Query("select count(*) as cnt, max(AMOUNT) from account")
+	c.Assert(err, IsNil)
+	c.Assert(res.Fields()[0].Name, Equals, "cnt")
+	c.Assert(res.Fields()[1].Name, Equals, "max(amount)")
+	res.Close()
+
+	for _, sql := range []string{
+		"select count(*) from account where count(*) > 1",
+		"select sum(count(AMOUNT)) from account",
+		"select NAME from account group by count(*)",
+		"select count(*) from account group by 3",
+		"select std(AMOUNT) from account",
+	} {
+		_, err := s.octo.Query(sql)
+		c.Assert(err, NotNil, Commentf("sql:%s", sql))
+	}
+
+	//删除后行数随之更新
+	s.mustExec(c, "delete from num where V=3")
+	rows := s.mustQuery(c, "select count(*), min(V), max(V) from num")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"4", "1", "8"}})
+	s.mustExec(c, "delete from num where ID>0")
+	rows = s.mustQuery(c, "select count(*), min(V), max(V) from num")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"0", "NULL", "NULL"}})
+}
+
+func (s *OctopusSuite) TestDeleteWithoutPrimaryKey(c *C) {
+	s.mustExec(c, `CREATE TABLE nopk(A int(11), B varchar(10))`)
+	s.mustExec(c, `insert into nopk (A, B) values (1, 'x'), (2, 'y'), (3, 'z')`)
+	s.mustExec(c, "delete from nopk where A=2")
+	rows := s.mustQuery(c, "select * from nopk")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"1", "x"}, {"3", "z"}})
+	rows = s.mustQuery(c, "select count(*) from nopk")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"2"}})
+}
+
+//A列分布倾斜 B和C的值各不相同
+func (s *OctopusSuite) createSkewTable(c *C) {
+	s.mustExec(c, `CREATE TABLE skew(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  A int(11) NOT NULL,
+  B int(11) NOT NULL,
+  C varchar(20) NOT NULL,
+  D varchar(20),
+  PRIMARY KEY (ID),
+  KEY A (A),
+  KEY B (B),
+  KEY C (C)
+)`)
+	values := make([]string, 0, 100)
+	for i := 1; i <= 100; i++ {
+		a := 1
+		if i == 100 {
+			a = 2
+		}
+		values = append(values, fmt.Sprintf("(%d, %d, 'c_%03d', 'd')", a, i, i))
+	}
+	s.mustExec(c, "insert into skew (A, B, C, D) values "+strings.Join(values, ", "))
+}
+
+//生成查询的物理计划
+func (s *OctopusSuite) mustPlan(c *C, sql string) planner.PhysicalPlan {
+	stmt, err := s.octo.Parser(sql)
+	c.Assert(err, IsNil, Commentf("sql:%s", sql))
+	plan, err := planner.Optimize(s.octo.tableOpt, stmt)
+	c.Assert(err, IsNil, Commentf("sql:%s", sql))
+	return plan.(planner.PhysicalPlan)
+}
+
+//计划树中从根到叶子的节点
+func planPath(plan planner.PhysicalPlan) []planner.PhysicalPlan {
+	path := []planner.PhysicalPlan{plan}
+	for len(plan.Children()) > 0 {
+		plan = plan.Children()[0]
+		path = append(path, plan)
+	}
+	return path
+}
+
+//叶子节点扫描的索引 不使用索引时为空
+func scanIndex(plan planner.PhysicalPlan) string {
+	path := planPath(plan)
+	if scan, ok := path[len(path)-1].(*planner.PhysicalIndexScan); ok {
+		return scan.Index.Columns[0]
+	}
+	return ""
+}
+
+func (s *OctopusSuite) TestPlanner(c *C) {
+	s.createSkewTable(c)
+
+	//条件下推到扫描 不需要单独的过滤
+	path := planPath(s.mustPlan(c, "select * from skew where A=1 and D='d'"))
+	c.Assert(path, HasLen, 2)
+	c.Assert(path[1].(*planner.PhysicalIndexScan).Conditions, HasLen, 2)
+
+	//HAVING中分组列上的条件下推到数据源
+	c.Assert(scanIndex(s.mustPlan(c, "select B, count(*) from skew group by B having B > 98")), Equals, "b")
+
+	//limit和排序合并 索引顺序满足排序时只需要limit
+	path = planPath(s.mustPlan(c, "select * from skew order by B desc limit 3"))
+	c.Assert(path[1], FitsTypeOf, &planner.PhysicalLimit{})
+	c.Assert(path[2].(*planner.PhysicalIndexScan).Desc, Equals, true)
+	path = planPath(s.mustPlan(c, "select * from skew where A=1 order by D limit 3"))
+	c.Assert(path[1], FitsTypeOf, &planner.PhysicalTopN{})
+
+	//索引和主键包含全部用到的列时不回表
+	cases := []struct {
+		sql      string
+		covering bool
+	}{
+		{"select ID, B from skew where B > 97", true},
+		{"select count(*) from skew where B > 97", true},
+		{"select C from skew where C >= 'c_098'", true},
+		{"select D from skew where B > 97", false},
+		{"select * from skew where C >= 'c_098'", false},
+	}
+	for _, ca := range cases {
+		path := planPath(s.mustPlan(c, ca.sql))
+		scan, ok := path[len(path)-1].(*planner.PhysicalIndexScan)
+		c.Assert(ok, IsTrue, Commentf("sql:%s", ca.sql))
+		c.Assert(scan.Covering, Equals, ca.covering, Commentf("sql:%s", ca.sql))
+	}
+	rows := s.mustQuery(c, "select ID, B, C from skew where B > 97 order by B desc")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"100", "100", "c_100"}, {"99", "99", "c_099"}, {"98", "98", "c_098"}})
+	rows = s.mustQuery(c, "select C, ID from skew where C >= 'c_098'")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"c_098", "98"}, {"c_099", "99"}, {"c_100", "100"}})
+}
+
+func (s *OctopusSuite) TestAnalyze(c *C) {
+	s.createSkewTable(c)
+
+	//没有统计信息时按规则选择第一个可用的索引
+	sql := "select * from skew where A=1 and B=50"
+	c.Assert(scanIndex(s.mustPlan(c, sql)), Equals, "a")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from skew where A=1")), Equals, "a")
+
+	s.mustExec(c, "analyze table skew")
+	//A=1几乎是全表 选择更精确的B
+	c.Assert(scanIndex(s.mustPlan(c, sql)), Equals, "b")
+	//回表读取大部分行不如全表扫描
+	c.Assert(scanIndex(s.mustPlan(c, "select * from skew where A=1")), Equals, "")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from skew where A=2")), Equals, "a")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from skew where A=1 and C<'c_003'")), Equals, "c")
+
+	rows := s.mustQuery(c, sql)
+	c.Assert(rowIds(rows), DeepEquals, []uint64{50})
+	rows = s.mustQuery(c, "select count(*) from skew where A=1")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"99"}})
+	rows = s.mustQuery(c, "select ID from skew where A=2")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"100"}})
+
+	c.Assert(s.octo.Exec("analyze table not_exists"), NotNil)
+}
+
+func (s *OctopusSuite) TestExplain(c *C) {
+	s.createSkewTable(c)
+
+	cases := []struct {
+		sql  string
+		ids  []string
+		info []string //每个算子说明中包含的内容
+	}{
+		{"explain select * from skew where ID=5", []string{"Projection", "└─PointGet"},
+			[]string{"id, a, b, c, d", "handle:[5]"}},
+		{"explain select * from skew where ID>3 and ID<10", []string{"Projection", "└─TableScan"},
+			[]string{"", "range:[4,9]"}},
+		{"explain select C from skew where C>='c_098' and C<'c_100'", []string{"Projection", "└─IndexScan"},
+			[]string{"", "index:c(c), range:['c_098','c_100'), covering"}},
+		{"explain select * from skew where A=1 order by D limit 1, 2", []string{"Projection", "└─TopN", "  └─IndexScan"},
+			[]string{"", "d, offset:1, count:2", "range:[1,1], lookup, cond:[eq(a, 1)]"}},
+		{"explain select count(*) from skew", []string{"Projection", "└─MetaAgg"},
+			[]string{"count(1)", "funcs:count(1)"}},
+		{"explain update skew set D='e' where B<5", []string{"Update", "└─IndexScan"},
+			[]string{"table:skew, set:d='e'", "index:b(b), range:(-inf,5)"}},
+		{"explain delete from skew where D='e'", []string{"Delete", "└─TableScan"},
+			[]string{"table:skew", "range:[-inf,+inf], lock:for update, cond:[eq(d, 'e')]"}},
+	}
+	for _, ca := range cases {
+		res, err := s.octo.Query(ca.sql)
+		c.Assert(err, IsNil, Commentf("sql:%s", ca.sql))
+		c.Assert(res.Fields(), HasLen, 3)
+		var rows []table.Row
+		var row table.Row
+		for res.Next(&row) {
+			rows = append(rows, row)
+		}
+		values := rowValues(rows)
+		c.Assert(values, HasLen, len(ca.ids), Commentf("sql:%s", ca.sql))
+		for i, value := range values {
+			c.Assert(value[0], Equals, ca.ids[i], Commentf("sql:%s", ca.sql))
+			c.Assert(strings.Contains(value[2], ca.info[i]), IsTrue, Commentf("sql:%s info:%s", ca.sql, value[2]))
+		}
+	}
+	//EXPLAIN不执行语句
+	rows := s.mustQuery(c, "select count(*) from skew where D='e'")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"0"}})
+
+	//EXPLAIN ANALYZE记录实际行数
+	res, err := s.octo.Query("explain analyze select B, count(*) from skew where A=1 and C>'c_090' group by B order by B desc limit 2")
+	c.Assert(err, IsNil)
+	c.Assert(res.Fields()[2].Name, Equals, "actRows")
+	c.Assert(res.Fields()[3].Name, Equals, "time")
+	var rows2 []table.Row
+	var row table.Row
+	for res.Next(&row) {
+		rows2 = append(rows2, row)
+	}
+	values := rowValues(rows2)
+	c.Assert(values, HasLen, 4)
+	actRows := make([]string, 0, len(values))
+	for _, value := range values {
+		actRows = append(actRows, value[2])
+	}
+	c.Assert(actRows, DeepEquals, []string{"2", "2", "9", "9"})
+
+	//EXPLAIN ANALYZE执行更新和删除
+	rows = s.mustQuery(c, "explain analyze update skew set D='e' where B<5")
+	c.Assert(rowValues(rows)[0][2], Equals, "4")
+	s.mustExec(c, "explain analyze delete from skew where D='e' and B>2")
+	rows = s.mustQuery(c, "select ID from skew where D='e'")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"1"}, {"2"}})
+
+	_, err = s.octo.Query("explain insert into skew (A, B, C) values (1, 1, 'x')")
+	c.Assert(err, NotNil)
+}
+
+func (s *OctopusSuite) TestTransaction(c *C) {
+	s.createAccountTable(c)
+	se := s.octo.NewSession()
+	defer se.Close()
+	sessionQuery := func(sql string) [][]string {
+		res, err := se.Query(sql)
+		c.Assert(err, IsNil, Commentf("sql:%s", sql))
+		var rows []table.Row
+		var row table.Row
+		for res.Next(&row) {
+			rows = append(rows, row)
+		}
+		return rowValues(rows)
+	}
+	mustSessionExec := func(sql string) {
+		c.Assert(se.Exec(sql), IsNil, Commentf("sql:%s", sql))
+	}
+
+	mustSessionExec("begin")
+	c.Assert(se.InTxn(), IsTrue)
+	mustSessionExec("insert into account (NAME, CODE, AMOUNT) values ('b_1', 'd_1', '1'), ('b_2', 'd_2', '2')")
+	mustSessionExec("update account set AMOUNT=1010, NAME='b_0' where CODE='c_1'")
+	mustSessionExec("delete from account where NAME='9'")
+	//事务中读到自己的写入 索引也一样
+	c.Assert(sessionQuery("select ID, AMOUNT from account where NAME='b_0'"), DeepEquals, [][]string{{"1", "1010"}})
+	c.Assert(sessionQuery("select count(*) from account"), DeepEquals, [][]string{{"8"}})
+	c.Assert(sessionQuery("select ID from account where NAME>='b' order by NAME desc"), DeepEquals,
+		[][]string{{"9"}, {"8"}, {"1"}})
+	//提交前其他会话看不到
+	rows := s.mustQuery(c, "select count(*) from account")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"7"}})
+	rows = s.mustQuery(c, "select ID from account where NAME='a_1'")
+	c.Assert(rowIds(rows), DeepEquals, []uint64{1, 4, 7})
+
+	mustSessionExec("rollback")
+	c.Assert(se.InTxn(), IsFalse)
+	c.Assert(sessionQuery("select count(*) from account"), DeepEquals, [][]string{{"7"}})
+	c.Assert(sessionQuery("select ID from account where NAME='b_0'"), HasLen, 0)
+
+	mustSessionExec("start transaction")
+	mustSessionExec("insert into account (NAME, CODE, AMOUNT) values ('b_1', 'd_1', '1')")
+	mustSessionExec("update account set AMOUNT=0 where ID>=6")
+	mustSessionExec("commit")
+	rows = s.mustQuery(c, "select ID, AMOUNT from account where ID>=6")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"6", "0"}, {"7", "0"}, {"8", "0"}})
+	rows = s.mustQuery(c, "select count(*) from account")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"8"}})
+
+	//DDL隐式提交事务
+	mustSessionExec("begin")
+	mustSessionExec("delete from account where ID=8")
+	mustSessionExec("create table t1 (A int)")
+	c.Assert(se.InTxn(), IsFalse)
+	rows = s.mustQuery(c, "select count(*) from account")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"7"}})
+
+	//事务语句只能在会话中执行
+	c.Assert(s.octo.Exec("begin"), NotNil)
+}
+
+func (s *OctopusSuite) TestSnapshotRead(c *C) {
+	s.createAccountTable(c)
+	//结果集读取打开时的快照 之后的修改不可见
+	res, err := s.octo.Query("select ID, AMOUNT from account where NAME>='a' order by NAME")
+	c.Assert(err, IsNil)
+	var row table.Row
+	c.Assert(res.Next(&row), IsTrue)
+	s.mustExec(c, "update account set AMOUNT=0 where NAME='a_2'")
+	s.mustExec(c, "delete from account where NAME='a_10'")
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_3', 'd_1', '1')")
+	rows := []table.Row{row}
+	for res.Next(&row) {
+		rows = append(rows, row)
+	}
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"1", "10"}, {"4", "3"}, {"7", "1"}, {"2", "-5"}, {"3", "7"}})
+
+	rows = s.mustQuery(c, "select ID, AMOUNT from account where NAME>='a' order by NAME")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"1", "10"}, {"4", "3"}, {"7", "1"}, {"3", "0"}, {"8", "1"}})
+}
+
+func (s *OctopusSuite) TestConflict(c *C) {
+	s.createAccountTable(c)
+	se1, se2 := s.octo.NewSession(), s.octo.NewSession()
+	defer se1.Close()
+	defer se2.Close()
+	mustSessionExec := func(se *Session, sql string) {
+		c.Assert(se.Exec(sql), IsNil, Commentf("sql:%s", sql))
+	}
+
+	//写写冲突 读过的行被其他事务修改后更新时失败
+	mustSessionExec(se1, "begin")
+	mustSessionExec(se2, "begin")
+	res, err := se2.Query("select AMOUNT from account where ID=1")
+	c.Assert(err, IsNil)
+	_, err = res.GetRow()
+	c.Assert(err, IsNil)
+	mustSessionExec(se1, "update account set AMOUNT=11 where ID=1")
+	mustSessionExec(se1, "commit")
+	err = se2.Exec("update account set AMOUNT=12 where ID=1")
+	c.Assert(kv.IsRetryable(err), IsTrue, Commentf("err:%v", err))
+	mustSessionExec(se2, "rollback")
+	c.Assert(se2.InTxn(), IsFalse)
+	rows := s.mustQuery(c, "select AMOUNT from account where ID=1")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"11"}})
+
+	//读到的行被其他事务修改 有写入的事务提交失败
+	mustSessionExec(se1, "begin")
+	res, err = se1.Query("select AMOUNT from account where ID=2")
+	c.Assert(err, IsNil)
+	_, err = res.GetRow()
+	c.Assert(err, IsNil)
+	s.mustExec(c, "update account set AMOUNT=0 where ID=2")
+	mustSessionExec(se1, "update account set AMOUNT=-5 where ID=3")
+	err = se1.Exec("commit")
+	c.Assert(kv.IsRetryable(err), IsTrue, Commentf("err:%v", err))
+	rows = s.mustQuery(c, "select AMOUNT from account where ID=3")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"7"}})
+
+	//只读事务不检查冲突
+	mustSessionExec(se1, "begin")
+	res, err = se1.Query("select AMOUNT from account where ID=2")
+	c.Assert(err, IsNil)
+	res.Close()
+	s.mustExec(c, "update account set AMOUNT=1 where ID=2")
+	mustSessionExec(se1, "commit")
+}
+
+func (s *OctopusSuite) TestAutoCommitRetry(c *C) {
+	s.mustExec(c, "create table counter (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	const workers, inserts = 8, 20
+	insertAll := func() []error {
+		errs := make(chan error, workers*inserts)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				for j := 0; j < inserts; j++ {
+					errs <- s.octo.Exec(fmt.Sprintf("insert into counter (N) values (%d)", i*inserts+j))
+				}
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		var failed []error
+		for err := range errs {
+			if err != nil {
+				failed = append(failed, err)
+			}
+		}
+		return failed
+	}
+	//并发插入都会修改表的自增id 冲突的语句自动重试
+	s.octo.SetRetryLimit(1000)
+	c.Assert(insertAll(), HasLen, 0)
+	rows := s.mustQuery(c, "select count(*), count(distinct ID) from counter")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"160", "160"}})
+	rows = s.mustQuery(c, "select ID from counter")
+	c.Assert(rows, HasLen, workers*inserts)
+
+	//不重试时冲突的语句返回错误 没有执行
+	s.octo.SetRetryLimit(0)
+	failed := insertAll()
+	for _, err := range failed {
+		c.Assert(kv.IsRetryable(err), IsTrue, Commentf("err:%v", err))
+	}
+	rows = s.mustQuery(c, "select ID from counter")
+	c.Assert(rows, HasLen, 2*workers*inserts-len(failed))
+	rows = s.mustQuery(c, "select count(*) from counter")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{fmt.Sprint(2*workers*inserts - len(failed))}})
+}
+
+func (s *OctopusSuite) TestLockLostUpdate(c *C) {
+	s.createAccountTable(c)
+	se1, se2 := s.octo.NewSession(), s.octo.NewSession()
+	defer se1.Close()
+	defer se2.Close()
+	mustSessionExec := func(se *Session, sql string) {
+		c.Assert(se.Exec(sql), IsNil, Commentf("sql:%s", sql))
+	}
+	s.mustExec(c, "update account set AMOUNT=10 where ID=1")
+
+	//se1加锁后se2的更新等待se1提交 读到se1提交后的值 两次更新都不会丢失
+	mustSessionExec(se1, "begin")
+	mustSessionExec(se2, "begin")
+	res, err := se1.Query("select AMOUNT from account where ID=1 for update")
+	c.Assert(err, IsNil)
+	_, err = res.GetRow()
+	c.Assert(err, IsNil)
+	done := make(chan error)
+	go func() {
+		done <- se2.Exec("update account set AMOUNT=AMOUNT+100 where ID=1")
+	}()
+	select {
+	case err := <-done:
+		c.Fatalf("update not blocked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	mustSessionExec(se1, "update account set AMOUNT=AMOUNT+1 where ID=1")
+	mustSessionExec(se1, "commit")
+	c.Assert(<-done, IsNil)
+	res, err = se2.Query("select AMOUNT from account where ID=1 for update")
+	c.Assert(err, IsNil)
+	_, err = res.GetRow()
+	c.Assert(err, IsNil)
+	mustSessionExec(se2, "commit")
+	rows := s.mustQuery(c, "select AMOUNT from account where ID=1")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"111"}})
+}
+
+func (s *OctopusSuite) TestSelectForUpdate(c *C) {
+	s.createAccountTable(c)
+	se1, se2 := s.octo.NewSession(), s.octo.NewSession()
+	defer se1.Close()
+	defer se2.Close()
+	mustSessionExec := func(se *Session, sql string) {
+		c.Assert(se.Exec(sql), IsNil, Commentf("sql:%s", sql))
+	}
+	lockRow := func(se *Session, sql string) ([]string, error) {
+		res, err := se.Query(sql)
+		c.Assert(err, IsNil, Commentf("sql:%s", sql))
+		row, err := res.GetRow()
+		if err != nil {
+			return nil, err
+		}
+		return rowValues([]table.Row{*row})[0], nil
+	}
+
+	rows := s.mustQuery(c, "explain select * from account where ID=1 for update")
+	c.Assert(rowValues(rows)[1][2], Matches, ".*lock:for update.*")
+	rows = s.mustQuery(c, "explain select * from account where NAME='a_1' lock in share mode")
+	c.Assert(rowValues(rows)[1][2], Matches, ".*lock:in share mode.*")
+
+	//加锁的行上其他事务的提交等待锁释放 读到的是加锁时的最新数据
+	mustSessionExec(se1, "begin")
+	s.mustExec(c, "update account set AMOUNT=11 where ID=1")
+	values, err := lockRow(se1, "select AMOUNT from account where ID=1 for update")
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, []string{"11"})
+	done := make(chan error)
+	go func() {
+		done <- s.octo.Exec("update account set AMOUNT=20 where ID=1")
+	}()
+	select {
+	case err = <-done:
+		c.Fatalf("update finished while row is locked, err:%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	mustSessionExec(se1, "update account set AMOUNT=12 where ID=1")
+	mustSessionExec(se1, "commit")
+	c.Assert(<-done, IsNil)
+	rows = s.mustQuery(c, "select AMOUNT from account where ID=1")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"20"}})
+
+	//共享锁互相兼容 和排他锁等锁超时
+	s.octo.SetLockWaitTimeout(100 * time.Millisecond)
+	mustSessionExec(se1, "begin")
+	mustSessionExec(se2, "begin")
+	res, err := se1.Query("select ID from account where NAME='a_1' lock in share mode")
+	c.Assert(err, IsNil)
+	var ids []table.Row
+	var row table.Row
+	for res.Next(&row) {
+		ids = append(ids, row)
+	}
+	c.Assert(res.Err(), IsNil)
+	c.Assert(rowIds(ids), DeepEquals, []uint64{1, 4, 7})
+	_, err = lockRow(se2, "select * from account where ID=4 lock in share mode")
+	c.Assert(err, IsNil)
+	_, err = lockRow(se2, "select * from account where ID=7 for update")
+	c.Assert(err, Equals, kv.ErrLockWaitTimeout)
+	c.Assert(se2.InTxn(), IsTrue)
+	mustSessionExec(se1, "commit")
+	_, err = lockRow(se2, "select * from account where ID=7 for update")
+	c.Assert(err, IsNil)
+	mustSessionExec(se2, "rollback")
+
+	//互相等待时一个事务作为牺牲者回滚 另一个拿到锁
+	s.octo.SetLockWaitTimeout(mvcc.DefaultLockWaitTimeout)
+	mustSessionExec(se1, "begin")
+	mustSessionExec(se2, "begin")
+	_, err = lockRow(se1, "select * from account where ID=1 for update")
+	c.Assert(err, IsNil)
+	_, err = lockRow(se2, "select * from account where ID=2 for update")
+	c.Assert(err, IsNil)
+	errs := make(chan error, 2)
+	go func() {
+		_, err := lockRow(se1, "select * from account where ID=2 for update")
+		errs <- err
+	}()
+	go func() {
+		_, err := lockRow(se2, "select * from account where ID=1 for update")
+		errs <- err
+	}()
+	err1, err2 := <-errs, <-errs
+	if err1 != nil {
+		err1, err2 = err2, err1
+	}
+	c.Assert(err1, IsNil)
+	c.Assert(err2, Equals, kv.ErrDeadlock)
+	c.Assert(se1.InTxn() != se2.InTxn(), IsTrue)
+	mustSessionExec(se1, "commit")
+	mustSessionExec(se2, "commit")
+}
+
+func (s *OctopusSuite) TestReopen(c *C) {
+	s.mustExec(c, "create table t1 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	s.mustExec(c, "create table t2 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	s.mustExec(c, "insert into t1 (N) values (1), (2)")
+	s.mustExec(c, "insert into t2 (N) values (3)")
+
+	//表id列表和表信息一起写入 重新打开后新建的表不会复用已有的表id
+	c.Assert(s.octo.Free(), IsNil)
+	var err error
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	s.mustExec(c, "create table t3 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	c.Assert(s.mustQuery(c, "select * from t3"), HasLen, 0)
+	s.mustExec(c, "insert into t3 (N) values (4)")
+	s.mustExec(c, "insert into t1 (N) values (5)")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, N from t1")), DeepEquals, [][]string{{"1", "1"}, {"2", "2"}, {"3", "5"}})
+	c.Assert(rowValues(s.mustQuery(c, "select ID, N from t2")), DeepEquals, [][]string{{"1", "3"}})
+	c.Assert(rowValues(s.mustQuery(c, "select ID, N from t3")), DeepEquals, [][]string{{"1", "4"}})
+}
+
+func (s *OctopusSuite) TestDropTable(c *C) {
+	rawKeys := func() int {
+		return len(s.octo.storage.Scan([]byte{}, []byte{}, 1<<20))
+	}
+	s.mustExec(c, "create table t1 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	s.mustExec(c, "insert into t1 (N) values (1)")
+	s.createAccountTable(c)
+	s.mustExec(c, "analyze table account")
+
+	//DDL隐式提交进行中的事务
+	se := s.octo.NewSession()
+	defer se.Close()
+	c.Assert(se.Exec("begin"), IsNil)
+	c.Assert(se.Exec("insert into t1 (N) values (2)"), IsNil)
+	c.Assert(se.Exec("commit"), IsNil)
+	c.Assert(se.Exec("begin"), IsNil)
+	c.Assert(se.Exec("insert into t1 (N) values (3)"), IsNil)
+	c.Assert(se.Exec("rollback"), IsNil)
+	created := rawKeys()
+	c.Assert(se.Exec("begin"), IsNil)
+	c.Assert(se.Exec("drop table account"), IsNil)
+	c.Assert(se.InTxn(), IsFalse)
+	c.Assert(rowValues(s.mustQuery(c, "select N from t1")), DeepEquals, [][]string{{"1"}, {"2"}})
+
+	//行数据和索引的版本都被清理 只留下表信息的删除标记
+	c.Assert(rawKeys() < created, IsTrue, Commentf("created:%d, dropped:%d", created, rawKeys()))
+	_, err := s.octo.Query("select * from account")
+	c.Assert(err, NotNil)
+	c.Assert(s.octo.Exec("drop table account"), NotNil)
+	s.mustExec(c, "drop table if exists account")
+
+	//重新创建的表没有旧数据
+	s.createAccountTable(c)
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where NAME='a_1'")), DeepEquals, []uint64{1, 4, 7})
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account")), DeepEquals, [][]string{{"7"}})
+
+	//删除的表重新打开后仍然不存在
+	s.mustExec(c, "drop table account, t1")
+	c.Assert(s.octo.Free(), IsNil)
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	c.Assert(s.octo.Exec("insert into t1 (N) values (3)"), NotNil)
+	s.mustExec(c, "create table t2 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID), INDEX N (N))")
+	c.Assert(s.mustQuery(c, "select * from t2"), HasLen, 0)
+
+	//删除最新的表时数据只删除了一部分 新建的表使用新的表id 看不到剩下的数据
+	s.mustExec(c, "insert into t2 (N) values (1), (2)")
+	tableInfo, err := s.octo.tableOpt.GetTableInfo("t2")
+	c.Assert(err, IsNil)
+	prefix := codekey.EncodeTablePrefix(tableInfo.TableId)
+	leftover := s.octo.mvcc.Scan(prefix, codekey.PrefixNext(prefix), 1<<20)
+	c.Assert(leftover, HasLen, 4)
+	s.mustExec(c, "drop table t2")
+	for _, pair := range leftover[1:] {
+		c.Assert(s.octo.mvcc.Put(pair.Key, pair.Value), IsNil)
+	}
+	s.mustExec(c, "create table t3 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID), INDEX N (N))")
+	c.Assert(s.mustQuery(c, "select * from t3"), HasLen, 0)
+	c.Assert(s.mustQuery(c, "select * from t3 where N=2"), HasLen, 0)
+	recreated, err := s.octo.tableOpt.GetTableInfo("t3")
+	c.Assert(err, IsNil)
+	c.Assert(recreated.TableId > tableInfo.TableId, IsTrue)
+
+	//重新打开后同样不会分配删除的表id
+	s.mustExec(c, "drop table t3")
+	c.Assert(s.octo.Free(), IsNil)
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	s.mustExec(c, "create table t4 (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID), INDEX N (N))")
+	c.Assert(s.mustQuery(c, "select * from t4"), HasLen, 0)
+	reopened, err := s.octo.tableOpt.GetTableInfo("t4")
+	c.Assert(err, IsNil)
+	c.Assert(reopened.TableId > recreated.TableId, IsTrue)
+}
+
+func (s *OctopusSuite) TestTruncateTable(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "analyze table account")
+
+	//清空之前开始的事务读过旧的表信息 提交冲突
+	se := s.octo.NewSession()
+	defer se.Close()
+	c.Assert(se.Exec("begin"), IsNil)
+	c.Assert(se.Exec("insert into account (NAME, CODE, AMOUNT) values ('a_8', 'c_8', '8')"), IsNil)
+	s.mustExec(c, "truncate table account")
+	c.Assert(se.Exec("commit"), NotNil)
+	c.Assert(s.mustQuery(c, "select * from account"), HasLen, 0)
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account")), DeepEquals, [][]string{{"0"}})
+
+	//自增id重新开始 唯一索引中没有旧的键
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_1', 'c_1', '1'), ('a_2', 'c_2', '2')")
+	rows := s.mustQuery(c, "select ID, AMOUNT from account where CODE='c_2'")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"2", "2"}})
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where NAME='a_1'")), DeepEquals, []uint64{1})
+	c.Assert(s.octo.Exec("truncate table nothing"), NotNil)
+
+	//行数据和索引键超过一批时分批删除
+	values := make([]string, 0, levelDB.DeleteRangeBatchSize)
+	for i := 0; i < levelDB.DeleteRangeBatchSize; i++ {
+		values = append(values, fmt.Sprintf("('n_%d', 'code_%d', %d)", i%3, i, i))
+	}
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values "+strings.Join(values, ", "))
+	tableInfo, err := s.octo.tableOpt.GetTableInfo("account")
+	c.Assert(err, IsNil)
+	s.mustExec(c, "truncate table account")
+	c.Assert(s.mustQuery(c, "select * from account"), HasLen, 0)
+	c.Assert(s.mustQuery(c, "select * from account where NAME='n_1'"), HasLen, 0)
+
+	//清空后的表使用新的表id 旧表id下的数据被删除
+	truncated, err := s.octo.tableOpt.GetTableInfo("account")
+	c.Assert(err, IsNil)
+	c.Assert(truncated.TableId > tableInfo.TableId, IsTrue)
+	prefix := codekey.EncodeTablePrefix(tableInfo.TableId)
+	c.Assert(s.octo.mvcc.Scan(prefix, codekey.PrefixNext(prefix), 1), HasLen, 0)
+}
+
+func (s *OctopusSuite) TestUniqueKey(c *C) {
+	s.createAccountTable(c)
+
+	//插入重复的唯一索引值失败 同一语句中的其他行也不写入
+	err := s.octo.Exec("insert into account (NAME, CODE, AMOUNT) values ('a_3', 'c_2', '1')")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Duplicate entry 'c_2' for key 'code'")
+	err = s.octo.Exec("insert into account (NAME, CODE, AMOUNT) values ('a_3', 'c_6', '1'), ('a_4', 'c_6', '2')")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Duplicate entry 'c_6' for key 'code'")
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account")), DeepEquals, [][]string{{"7"}})
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where CODE='c_2'")), DeepEquals, []uint64{3})
+
+	//更新为其他行的值失败 原来的索引键仍然有效
+	err = s.octo.Exec("update account set CODE='c_1' where ID=3")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Duplicate entry 'c_1' for key 'code'")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where CODE='c_1'")), DeepEquals, []uint64{1})
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where CODE='c_2'")), DeepEquals, []uint64{3})
+	s.mustExec(c, "update account set CODE='c_2', AMOUNT=8 where ID=3")
+	s.mustExec(c, "update account set CODE='c_6' where ID=3")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where CODE='c_6'")), DeepEquals, []uint64{3})
+	c.Assert(s.mustQuery(c, "select * from account where CODE='c_2'"), HasLen, 0)
+
+	//联合主键同样是唯一索引
+	s.mustExec(c, "create table pair (A int NOT NULL, B int NOT NULL, C int, PRIMARY KEY (A, B))")
+	s.mustExec(c, "insert into pair values (1, 1, 1), (1, 2, 2)")
+	err = s.octo.Exec("insert into pair values (1, 2, 3)")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Duplicate entry '1-2' for key 'primary'")
+	c.Assert(s.octo.Exec("update pair set B=1 where C=2"), NotNil)
+	c.Assert(rowValues(s.mustQuery(c, "select C from pair where A=1 and B=2")), DeepEquals, [][]string{{"2"}})
+}
+
+func (s *OctopusSuite) TestCreateIndex(c *C) {
+	s.createAccountTable(c)
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account where AMOUNT=100")), Equals, "")
+
+	//已有数据回填到新建的索引
+	s.mustExec(c, "create index AMOUNT_IDX on account (AMOUNT)")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account where AMOUNT=100")), Equals, "amount")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where AMOUNT=100")), DeepEquals, []uint64{5, 6})
+	c.Assert(s.octo.Exec("create index AMOUNT_IDX on account (NAME)"), NotNil)
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_3', 'c_6', '100')")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where AMOUNT=100")), DeepEquals, []uint64{5, 6, 8})
+
+	//已有数据重复时唯一索引创建失败 索引被删除
+	err := s.octo.Exec("create unique index U_AMOUNT on account (AMOUNT)")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Duplicate entry '100' for key 'u_amount'")
+	tableInfo, err := s.octo.tableOpt.GetTableInfo("account")
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Indices["u_amount"], IsNil)
+	s.mustExec(c, "create unique index U_AMOUNT on account (AMOUNT, CODE)")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where AMOUNT=100 and CODE='c_4'")), DeepEquals, []uint64{6})
+
+	//ALTER TABLE添加和删除索引
+	s.mustExec(c, "alter table account add index (AMOUNT, NAME), add unique key U_ID (ID, NAME)")
+	tableInfo, err = s.octo.tableOpt.GetTableInfo("account")
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Indices["amount"], NotNil)
+	c.Assert(tableInfo.Indices["u_id"].Unique, IsTrue)
+	s.mustExec(c, "alter table account drop index amount, drop index U_ID")
+	c.Assert(s.octo.Exec("alter table account drop index amount"), NotNil)
+
+	//删除索引后查询不再使用索引 重新创建的索引没有旧的索引键
+	s.mustExec(c, "drop index U_AMOUNT on account")
+	s.mustExec(c, "drop index AMOUNT_IDX on account")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account where AMOUNT=100")), Equals, "")
+	c.Assert(s.octo.Exec("drop index AMOUNT_IDX on account"), NotNil)
+	s.mustExec(c, "delete from account where ID=5")
+	s.mustExec(c, "create index AMOUNT_IDX on account (AMOUNT)")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where AMOUNT=100")), DeepEquals, []uint64{6, 8})
+	c.Assert(s.octo.Exec("create index N on nothing (N)"), NotNil)
+}
+
+func (s *OctopusSuite) TestCreateIndexConcurrentWrite(c *C) {
+	s.mustExec(c, "create table big (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, M int, PRIMARY KEY (ID))")
+	for i := 0; i < 5; i++ {
+		values := make([]string, 0, 500)
+		for j := 0; j < 500; j++ {
+			values = append(values, fmt.Sprintf("(%d, %d)", (i*500+j)%97, j))
+		}
+		s.mustExec(c, "insert into big (N, M) values "+strings.Join(values, ", "))
+	}
+
+	//回填过程中同时插入 修改和删除行
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			sqls := []string{
+				fmt.Sprintf("insert into big (N, M) values (%d, 0)", i%13),
+				fmt.Sprintf("update big set N = %d where ID = %d", 1000+i, i*7%2500+1),
+				fmt.Sprintf("delete from big where ID = %d", i*11%2500+1),
+			}
+			for _, sql := range sqls {
+				if err := s.octo.Exec(sql); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+	s.mustExec(c, "create index N on big (N)")
+	close(done)
+	c.Assert(<-errs, IsNil)
+
+	//索引中的数据和行数据一致
+	c.Assert(scanIndex(s.mustPlan(c, "select ID, N from big where N >= 0")), Equals, "n")
+	c.Assert(scanIndex(s.mustPlan(c, "select ID, N, M from big")), Equals, "")
+	var expected [][]string
+	for _, row := range rowValues(s.mustQuery(c, "select ID, N, M from big")) {
+		expected = append(expected, row[:2])
+	}
+	indexed := rowValues(s.mustQuery(c, "select ID, N from big where N >= 0"))
+	sort.Slice(indexed, func(i, j int) bool {
+		a, _ := strconv.Atoi(indexed[i][0])
+		b, _ := strconv.Atoi(indexed[j][0])
+		return a < b
+	})
+	c.Assert(indexed, DeepEquals, expected)
+}
+
+func (s *OctopusSuite) TestAlterTableColumns(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "update account set AMOUNT=11 where ID=1")
+
+	//已有的行取添加列时的默认值 修改默认值不影响已有的行
+	s.mustExec(c, "alter table account add column AGE int NOT NULL DEFAULT 18 after NAME, add column NOTE varchar(10)")
+	c.Assert(rowValues(s.mustQuery(c, "select * from account where ID=1")), DeepEquals, [][]string{{"1", "a_1", "18", "c_1", "11", "NULL"}})
+	s.mustExec(c, "alter table account alter column AGE set default 20")
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_8', 'c_8', '8')")
+	s.mustExec(c, "insert into account values (9, 'a_9', 9, 'c_9', 9, 'n_9')")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, AGE, NOTE from account where ID >= 7")), DeepEquals,
+		[][]string{{"7", "18", "NULL"}, {"8", "20", "NULL"}, {"9", "9", "n_9"}})
+	c.Assert(s.octo.Exec("alter table account add column AGE int"), NotNil)
+	s.mustExec(c, "alter table account add column if not exists AGE int")
+
+	//删除的列的值不会出现在同名的新列中
+	s.mustExec(c, "update account set NOTE='n_1' where ID=1")
+	s.mustExec(c, "alter table account drop column NOTE")
+	s.mustExec(c, "alter table account add column NOTE int DEFAULT 5 first")
+	c.Assert(rowValues(s.mustQuery(c, "select * from account where ID=1")), DeepEquals, [][]string{{"5", "1", "a_1", "18", "c_1", "11"}})
+	c.Assert(rowValues(s.mustQuery(c, "select NOTE from account where ID=9")), DeepEquals, [][]string{{"5"}})
+	s.mustExec(c, "alter table account drop column NOTE")
+	s.mustExec(c, "alter table account drop column if exists NOTE")
+	c.Assert(s.octo.Exec("alter table account drop column CODE"), NotNil)
+	c.Assert(s.octo.Exec("alter table account drop column ID"), NotNil)
+
+	//类型只能加宽 改名后索引仍然可用
+	c.Assert(s.octo.Exec("alter table account modify column AMOUNT int NOT NULL"), NotNil)
+	c.Assert(s.octo.Exec("alter table account modify column NAME varchar(10) NOT NULL"), NotNil)
+	c.Assert(s.octo.Exec("alter table account modify column NAME bigint NOT NULL"), NotNil)
+	s.mustExec(c, "alter table account modify column NAME varchar(128) NOT NULL")
+	s.mustExec(c, "alter table account change column CODE ACCOUNT_CODE varchar(64) NOT NULL")
+	s.mustExec(c, "alter table account rename column AGE to YEARS")
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account where ACCOUNT_CODE='c_2'")), Equals, "account_code")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, YEARS from account where ACCOUNT_CODE='c_2'")), DeepEquals, [][]string{{"3", "18"}})
+	c.Assert(rowIds(s.mustQuery(c, "select * from account where NAME='a_1'")), DeepEquals, []uint64{1, 4, 7})
+
+	//一条语句中任何一个修改失败时表结构不变
+	c.Assert(s.octo.Exec("alter table account add column NOTE int, drop column MISSING"), NotNil)
+	c.Assert(s.octo.Exec("alter table account rename column YEARS to AGE, modify column AMOUNT int NOT NULL"), NotNil)
+	c.Assert(s.octo.Exec("alter table account drop index NAME, add column NOTE int, drop index MISSING"), NotNil)
+	_, err := s.octo.Query("select NOTE from account")
+	c.Assert(err, NotNil)
+	c.Assert(rowValues(s.mustQuery(c, "select YEARS from account where ID=2")), DeepEquals, [][]string{{"18"}})
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account where NAME='a_1'")), Equals, "name")
+
+	s.mustExec(c, "create table small (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N tinyint, PRIMARY KEY (ID))")
+	s.mustExec(c, "insert into small (N) values (100)")
+	c.Assert(s.octo.Exec("alter table small modify column N int NOT NULL"), NotNil)
+	s.mustExec(c, "alter table small modify column N int")
+	s.mustExec(c, "insert into small (N) values (1000)")
+	c.Assert(rowValues(s.mustQuery(c, "select N from small")), DeepEquals, [][]string{{"100"}, {"1000"}})
+	//同一语句中删除索引后可以删除索引中的列
+	s.mustExec(c, "create index N on small (N)")
+	s.mustExec(c, "alter table small drop index N, drop column N")
+	c.Assert(rowValues(s.mustQuery(c, "select * from small")), DeepEquals, [][]string{{"1"}, {"2"}})
+
+	//表结构重新打开后仍然有效
+	c.Assert(s.octo.Free(), IsNil)
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	c.Assert(rowValues(s.mustQuery(c, "select * from account where ID=1")), DeepEquals, [][]string{{"1", "a_1", "18", "c_1", "11"}})
+}
+
+func (s *OctopusSuite) TestAlterTableRewrite(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "alter table account drop column AMOUNT, add column AGE int DEFAULT 18")
+
+	//行中的列和表结构不一致
+	rowColumns := func() []int {
+		tableInfo, err := s.octo.tableOpt.GetTableInfo("account")
+		c.Assert(err, IsNil)
+		prefix := codekey.EncodeRowPrefix(tableInfo.TableId)
+		iter, err := s.octo.tableOpt.GetRows("account", prefix, codekey.PrefixNext(prefix))
+		c.Assert(err, IsNil)
+		defer iter.Close()
+		var counts []int
+		for ; iter.Valid(); iter.Next() {
+			values, err := rowcodec.DecodeRow(iter.Value())
+			c.Assert(err, IsNil)
+			for _, column := range tableInfo.Columns {
+				if _, ok := values[column.Idx]; !ok {
+					counts = append(counts, -1)
+				}
+			}
+			counts = append(counts, len(values))
+		}
+		return counts
+	}
+	c.Assert(rowColumns()[:2], DeepEquals, []int{-1, 4})
+
+	//ALGORITHM=COPY按新的表结构重写已有的行
+	s.mustExec(c, "alter table account algorithm=copy")
+	counts := rowColumns()
+	c.Assert(counts, HasLen, 7)
+	for _, count := range counts {
+		c.Assert(count, Equals, 4)
+	}
+	c.Assert(rowValues(s.mustQuery(c, "select * from account where ID=3")), DeepEquals, [][]string{{"3", "a_2", "c_2", "18"}})
+	s.mustExec(c, "alter table account alter column AGE set default 20, algorithm=copy")
+	c.Assert(rowValues(s.mustQuery(c, "select AGE from account where ID=3")), DeepEquals, [][]string{{"18"}})
+}
+
+func (s *OctopusSuite) TestRenameTable(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "analyze table account")
+	tableInfo, err := s.octo.tableOpt.GetTableInfo("account")
+	c.Assert(err, IsNil)
+
+	//修改表名之前开始的事务提交冲突
+	se := s.octo.NewSession()
+	defer se.Close()
+	c.Assert(se.Exec("begin"), IsNil)
+	c.Assert(se.Exec("insert into account (NAME, CODE, AMOUNT) values ('a_8', 'c_8', '8')"), IsNil)
+
+	//行数据 索引 自增id和统计信息都在新表名下
+	s.mustExec(c, "rename table account to account_archive")
+	c.Assert(se.Exec("commit"), NotNil)
+	_, err = s.octo.Query("select * from account")
+	c.Assert(err, NotNil)
+	renamed, err := s.octo.tableOpt.GetTableInfo("account_archive")
+	c.Assert(err, IsNil)
+	c.Assert(renamed.TableId, Equals, tableInfo.TableId)
+	stats, err := s.octo.tableOpt.GetTableStats("account_archive")
+	c.Assert(err, IsNil)
+	c.Assert(stats, NotNil)
+	c.Assert(scanIndex(s.mustPlan(c, "select * from account_archive where CODE='c_2'")), Equals, "code")
+	c.Assert(rowIds(s.mustQuery(c, "select * from account_archive where NAME='a_1'")), DeepEquals, []uint64{1, 4, 7})
+	s.mustExec(c, "insert into account_archive (NAME, CODE, AMOUNT) values ('a_8', 'c_8', '8')")
+	c.Assert(rowValues(s.mustQuery(c, "select ID from account_archive where CODE='c_8'")), DeepEquals, [][]string{{"8"}})
+
+	//新表名已经存在时失败 通过中间表名交换两个表
+	s.createAccountTable(c)
+	c.Assert(s.octo.Exec("rename table account to account_archive"), NotNil)
+	c.Assert(s.octo.Exec("rename table nothing to account_1"), NotNil)
+	s.mustExec(c, "rename table account to tmp, account_archive to account, tmp to account_archive")
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account")), DeepEquals, [][]string{{"8"}})
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account_archive")), DeepEquals, [][]string{{"7"}})
+
+	//ALTER TABLE中之后的修改作用在新表名上
+	s.mustExec(c, "alter table account rename to account_2019, add column AGE int DEFAULT 18")
+	c.Assert(rowValues(s.mustQuery(c, "select AGE from account_2019 where ID=8")), DeepEquals, [][]string{{"18"}})
+
+	c.Assert(s.octo.Free(), IsNil)
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account_2019")), DeepEquals, [][]string{{"8"}})
+	_, err = s.octo.Query("select * from account")
+	c.Assert(err, NotNil)
+	s.mustExec(c, "create table account (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, PRIMARY KEY (ID))")
+	c.Assert(s.mustQuery(c, "select * from account"), HasLen, 0)
+}
+
+func (s *OctopusSuite) TestTableNameCase(c *C) {
+	//表名不区分大小写 按小写保存
+	s.mustExec(c, "create table Foo (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, N int, PRIMARY KEY (ID))")
+	c.Assert(s.octo.Exec("create table FOO (ID int)"), NotNil)
+	s.mustExec(c, "insert into Foo (N) values (1), (2)")
+	s.mustExec(c, "insert into FOO (N) values (3)")
+	s.mustExec(c, "update foo set N=4 where ID=3")
+	s.mustExec(c, "delete from fOO where ID=1")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, N from Foo")), DeepEquals, [][]string{{"2", "2"}, {"3", "4"}})
+	tableInfo, err := s.octo.tableOpt.GetTableInfo("foo")
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.TableName, Equals, "foo")
+
+	s.mustExec(c, "rename table FOO to Bar")
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from bar")), DeepEquals, [][]string{{"2"}})
+	s.mustExec(c, "alter table BAR add column M int DEFAULT 5")
+	s.mustExec(c, "truncate table Bar")
+	s.mustExec(c, "insert into bAR (N) values (6)")
+	c.Assert(rowValues(s.mustQuery(c, "select N, M from BAR")), DeepEquals, [][]string{{"6", "5"}})
+	s.mustExec(c, "drop table Bar")
+	_, err = s.octo.Query("select * from bar")
+	c.Assert(err, NotNil)
+}
+
+func (s *OctopusSuite) TestShow(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "create table t1 (A int, B varchar(10) DEFAULT 'b', C decimal(10,2) NOT NULL, PRIMARY KEY (A, B), INDEX (C, A))")
+
+	c.Assert(rowValues(s.mustQuery(c, "show tables")), DeepEquals, [][]string{{"account"}, {"t1"}})
+	c.Assert(rowValues(s.mustQuery(c, "show full tables like 'acc%'")), DeepEquals, [][]string{{"account", "BASE TABLE"}})
+	c.Assert(rowValues(s.mustQuery(c, "show tables where Tables = 't1'")), DeepEquals, [][]string{{"t1"}})
+
+	res, err := s.octo.Query("describe account")
+	c.Assert(err, IsNil)
+	res.Close()
+	var names []string
+	for _, field := range res.Fields() {
+		names = append(names, field.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"Field", "Type", "Null", "Key", "Default", "Extra"})
+	c.Assert(rowValues(s.mustQuery(c, "describe account")), DeepEquals, [][]string{
+		{"id", "bigint(20) unsigned", "NO", "PRI", "NULL", "auto_increment"},
+		{"name", "varchar(64)", "NO", "MUL", "NULL", ""},
+		{"code", "varchar(64)", "NO", "UNI", "NULL", ""},
+		{"amount", "bigint(20)", "NO", "", "NULL", ""},
+	})
+	c.Assert(rowValues(s.mustQuery(c, "desc t1 b")), DeepEquals, [][]string{{"b", "varchar(10)", "NO", "PRI", "b", ""}})
+	c.Assert(rowValues(s.mustQuery(c, "show columns from t1 where `Key` = 'MUL'")), DeepEquals, [][]string{{"c", "decimal(10,2)", "NO", "MUL", "NULL", ""}})
+
+	c.Assert(rowValues(s.mustQuery(c, "show index from t1")), DeepEquals, [][]string{
+		{"t1", "0", "PRIMARY", "1", "a", "", "BTREE", "YES"},
+		{"t1", "0", "PRIMARY", "2", "b", "", "BTREE", "YES"},
+		{"t1", "1", "c", "1", "c", "", "BTREE", "YES"},
+		{"t1", "1", "c", "2", "a", "", "BTREE", "YES"},
+	})
+	c.Assert(rowValues(s.mustQuery(c, "show index from account where Key_name = 'PRIMARY'")), DeepEquals, [][]string{
+		{"account", "0", "PRIMARY", "1", "id", "", "BTREE", "YES"},
+	})
+
+	//生成的建表语句可以重新建表
+	rows := rowValues(s.mustQuery(c, "show create table account"))
+	c.Assert(rows[0][1], Equals, "CREATE TABLE `account` (\n"+
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n"+
+		"  `name` varchar(64) NOT NULL,\n"+
+		"  `code` varchar(64) NOT NULL,\n"+
+		"  `amount` bigint(20) NOT NULL,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  UNIQUE KEY `code` (`code`),\n"+
+		"  KEY `name` (`name`)\n"+
+		")")
+	for _, tableName := range []string{"account", "t1"} {
+		s.mustExec(c, "alter table "+tableName+" add column NOTE varchar(16) DEFAULT 'it''s'")
+		created := rowValues(s.mustQuery(c, "show create table "+tableName))[0][1]
+		s.mustExec(c, "drop table "+tableName)
+		s.mustExec(c, created)
+		c.Assert(rowValues(s.mustQuery(c, "show create table "+tableName))[0][1], Equals, created)
+	}
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_1', 'c_1', 1)")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, NOTE from account")), DeepEquals, [][]string{{"1", "it's"}})
+
+	s.mustExec(c, "show tables")
+	_, err = s.octo.Query("show create table nothing")
+	c.Assert(err, NotNil)
+	_, err = s.octo.Query("show variables")
+	c.Assert(err, NotNil)
+}
+
+func (s *OctopusSuite) TestDatabases(c *C) {
+	s.createAccountTable(c)
+	s.mustExec(c, "insert into account (NAME, CODE, AMOUNT) values ('a_8', 'c_8', 8)")
+	se := s.octo.NewSession()
+	defer se.Close()
+	sessionQuery := func(sql string) [][]string {
+		res, err := se.Query(sql)
+		c.Assert(err, IsNil, Commentf("sql:%s", sql))
+		var rows []table.Row
+		var row table.Row
+		for res.Next(&row) {
+			rows = append(rows, row)
+		}
+		return rowValues(rows)
+	}
+	mustSessionExec := func(sql string) {
+		c.Assert(se.Exec(sql), IsNil, Commentf("sql:%s", sql))
+	}
+
+	//每个数据库中的表名互不影响 没有指定数据库的表在当前数据库中
+	c.Assert(se.Exec("use chain_a"), NotNil)
+	mustSessionExec("create database chain_a")
+	c.Assert(se.Exec("create database chain_a"), NotNil)
+	mustSessionExec("create database if not exists chain_a")
+	mustSessionExec("create database chain_b")
+	c.Assert(sessionQuery("show databases"), DeepEquals, [][]string{{"chain_a"}, {"chain_b"}, {"test"}})
+	mustSessionExec("use chain_a")
+	c.Assert(se.CurrentDB(), Equals, "chain_a")
+	c.Assert(sessionQuery("show tables"), HasLen, 0)
+	mustSessionExec("create table account (ID bigint(20) unsigned NOT NULL AUTO_INCREMENT, NAME varchar(64), PRIMARY KEY (ID), UNIQUE KEY NAME (NAME))")
+	mustSessionExec("insert into account (NAME) values ('x'), ('y')")
+	c.Assert(sessionQuery("select ID, NAME from account where NAME = 'y'"), DeepEquals, [][]string{{"2", "y"}})
+	c.Assert(sessionQuery("select count(*) from test.account"), DeepEquals, [][]string{{"8"}})
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from chain_a.account")), DeepEquals, [][]string{{"2"}})
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from account")), DeepEquals, [][]string{{"8"}})
+	c.Assert(rowValues(s.mustQuery(c, "show tables")), DeepEquals, [][]string{{"account"}})
+	c.Assert(sessionQuery("show tables from chain_a"), DeepEquals, [][]string{{"account"}})
+	c.Assert(se.Exec("create table bad.t (A int)"), NotNil)
+
+	//修改语句 索引 统计信息和修改表结构都按数据库区分
+	mustSessionExec("update account set NAME = 'z' where ID = 1")
+	c.Assert(se.Exec("delete from chain_b.account where ID = 1"), NotNil)
+	mustSessionExec("create table chain_b.t (A int, B int)")
+	mustSessionExec("insert into chain_b.t values (1, 2)")
+	mustSessionExec("create index a on chain_b.t (A)")
+	mustSessionExec("alter table chain_b.t add column C int DEFAULT 3")
+	mustSessionExec("analyze table chain_b.t")
+	c.Assert(sessionQuery("select A, B, C from chain_b.t where A = 1"), DeepEquals, [][]string{{"1", "2", "3"}})
+	c.Assert(sessionQuery("show index from t from chain_b"), HasLen, 1)
+	c.Assert(se.Exec("describe t"), NotNil)
+
+	//表可以改名到其他数据库中
+	mustSessionExec("rename table chain_b.t to t")
+	c.Assert(sessionQuery("select A, B, C from t"), DeepEquals, [][]string{{"1", "2", "3"}})
+	c.Assert(sessionQuery("show tables from chain_b"), HasLen, 0)
+	mustSessionExec("truncate table chain_a.t")
+	c.Assert(sessionQuery("select * from t"), HasLen, 0)
+
+	//删除数据库时删除其中的全部表 当前数据库回到默认数据库
+	c.Assert(se.Exec("drop database test"), NotNil)
+	mustSessionExec("drop database chain_a")
+	c.Assert(se.Exec("drop database chain_a"), NotNil)
+	mustSessionExec("drop database if exists chain_a")
+	c.Assert(se.CurrentDB(), Equals, table.DefaultDatabase)
+	c.Assert(sessionQuery("select count(*) from account"), DeepEquals, [][]string{{"8"}})
+	mustSessionExec("create database chain_a")
+	mustSessionExec("create table chain_a.account (ID int, PRIMARY KEY (ID))")
+	c.Assert(sessionQuery("select * from chain_a.account"), HasLen, 0)
+
+	//重新打开后数据库和其中的表仍然存在
+	se.Close()
+	c.Assert(s.octo.Free(), IsNil)
+	var err error
+	s.octo, err = NewOctopus().Open(LEVEL_DB, s.dir, "octopus_test")
+	c.Assert(err, IsNil)
+	c.Assert(rowValues(s.mustQuery(c, "show databases")), DeepEquals, [][]string{{"chain_a"}, {"chain_b"}, {"test"}})
+	c.Assert(rowValues(s.mustQuery(c, "show tables from chain_a")), DeepEquals, [][]string{{"account"}})
+	c.Assert(rowValues(s.mustQuery(c, "select count(*) from test.account")), DeepEquals, [][]string{{"8"}})
+}
+
+func (s *OctopusSuite) createOrdersTable(c *C) {
+	s.mustExec(c, `CREATE TABLE orders(
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  ACCOUNT_ID bigint(20),
+  CODE varchar(64) NOT NULL,
+  QTY bigint(20) NOT NULL,
+  PRIMARY KEY (ID),
+  INDEX ACCOUNT_ID (ACCOUNT_ID)
+)`)
+	s.mustExec(c, `insert into orders (ACCOUNT_ID, CODE, QTY) values
+  (1, 'c_1', 1), (1, 'c_1', 2), (2, 'c_10', 3), (3, 'c_2', 4), (9, 'x', 5), (NULL, 'c_5', 6)`)
+}
+
+func (s *OctopusSuite) TestJoin(c *C) {
+	s.createAccountTable(c)
+	s.createOrdersTable(c)
+
+	cases := []struct {
+		sql    string
+		values [][]string
+	}{
+		{"select a.NAME, o.QTY from account a join orders o on a.ID = o.ACCOUNT_ID order by o.QTY",
+			[][]string{{"a_1", "1"}, {"a_1", "2"}, {"a_10", "3"}, {"a_2", "4"}}},
+		{"select a.ID, o.QTY from account a left join orders o on a.ID = o.ACCOUNT_ID order by a.ID, o.QTY",
+			[][]string{{"1", "1"}, {"1", "2"}, {"2", "3"}, {"3", "4"}, {"4", "NULL"}, {"5", "NULL"}, {"6", "NULL"}, {"7", "NULL"}}},
+		{"select o.ID, a.NAME from account a right join orders o on a.ID = o.ACCOUNT_ID order by o.ID",
+			[][]string{{"1", "a_1"}, {"2", "a_1"}, {"3", "a_10"}, {"4", "a_2"}, {"5", "NULL"}, {"6", "NULL"}}},
+		//外连接ON中的条件不过滤保留一侧的行
+		{"select a.ID, o.QTY from account a left join orders o on a.ID = o.ACCOUNT_ID and o.QTY > 1 where a.ID < 3 order by a.ID",
+			[][]string{{"1", "2"}, {"2", "3"}}},
+		{"select a.ID, o.QTY from account a left join orders o on a.ID = o.ACCOUNT_ID and a.ID = 2 where a.ID <= 3 order by a.ID",
+			[][]string{{"1", "NULL"}, {"2", "3"}, {"3", "NULL"}}},
+		//WHERE中另一侧的条件在连接之后过滤
+		{"select a.ID from account a left join orders o on a.ID = o.ACCOUNT_ID where o.ID is null order by a.ID",
+			[][]string{{"4"}, {"5"}, {"6"}, {"7"}}},
+		{"select count(*) from account a, orders o where a.ID = o.ACCOUNT_ID", [][]string{{"4"}}},
+		{"select count(*) from account a join orders o on a.ID = o.ACCOUNT_ID join account b on b.CODE = o.CODE", [][]string{{"4"}}},
+		{"select count(*) from account a join orders o on a.ID > o.QTY", [][]string{{"21"}}},
+		{"select count(*) from account a join account b on a.NAME = b.NAME", [][]string{{"13"}}},
+		//USING和NATURAL JOIN中的同名列合并为一列
+		{"select CODE, account.ID from account join orders using (CODE) where QTY = 3", [][]string{{"c_10", "2"}}},
+		{"select count(*) from account join orders using (CODE)", [][]string{{"5"}}},
+		{"select count(*) from account natural join orders", [][]string{{"1"}}},
+		{"select CODE, QTY from account right join orders using (CODE) where ACCOUNT_ID is null", [][]string{{"c_5", "6"}}},
+		{"select o.* from account a join orders o on a.ID = o.ACCOUNT_ID where a.ID = 2", [][]string{{"3", "2", "c_10", "3"}}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowValues(rows), DeepEquals, ca.values, Commentf("sql:%s", ca.sql))
+	}
+	res, err := s.octo.Query("select * from account join orders using (CODE)")
+	c.Assert(err, IsNil)
+	c.Assert(res.Fields(), HasLen, 7)
+	res.Close()
+
+	//按代价选择连接方式
+	plans := []struct {
+		sql  string
+		join planner.PhysicalPlan
+	}{
+		{"select * from account a join orders o on a.ID = o.ACCOUNT_ID", &planner.PhysicalHashJoin{}},
+		{"select * from account a join orders o on a.ID = o.ACCOUNT_ID where o.ID = 3", &planner.PhysicalIndexJoin{}},
+		{"select * from account a join orders o on a.ID = o.ACCOUNT_ID where a.ID = 2", &planner.PhysicalIndexJoin{}},
+		{"select * from orders o right join account a on a.ID = o.ACCOUNT_ID where a.ID = 2", &planner.PhysicalIndexJoin{}},
+		{"select * from account a join orders o on a.ID > o.QTY", &planner.PhysicalNestedLoopJoin{}},
+		{"select * from account a join orders o on a.NAME = o.QTY", &planner.PhysicalNestedLoopJoin{}},
+	}
+	for _, p := range plans {
+		path := planPath(s.mustPlan(c, p.sql))
+		c.Assert(path[1], FitsTypeOf, p.join, Commentf("sql:%s", p.sql))
+	}
+	rows := s.mustQuery(c, "select o.ID, a.NAME from orders o right join account a on a.ID = o.ACCOUNT_ID where a.ID = 2")
+	c.Assert(rowValues(rows), DeepEquals, [][]string{{"3", "a_10"}})
+
+	//索引连接的内侧按外侧的值查找
+	rows = s.mustQuery(c, "explain analyze select * from account a join orders o on a.ID = o.ACCOUNT_ID where o.ID = 3")
+	values := rowValues(rows)
+	c.Assert(values, HasLen, 4)
+	c.Assert(values[1][0], Equals, "└─IndexJoin")
+	c.Assert(strings.Contains(values[1][4], "inner join, inner:left, equal:[eq(id, account_id)]"), IsTrue, Commentf("info:%s", values[1][4]))
+	c.Assert(values[2][0], Equals, "  ├─TableScan")
+	c.Assert(values[2][4], Equals, "table:account, range:decided by [o.account_id]")
+	c.Assert(values[3][0], Equals, "  └─PointGet")
+	for _, value := range values {
+		c.Assert(value[2], Equals, "1")
+	}
+
+	for _, sql := range []string{
+		"select * from account join account",
+		"select ID from account a join orders o on a.ID = o.ACCOUNT_ID",
+		"select ID from account join orders using (CODE)",
+		"select x.* from account a join orders o on a.ID = o.ACCOUNT_ID",
+		"select * from account join orders using (NOTHING)",
+		"select * from account a join orders o on a.ID > o.QTY join account b using (CODE)",
+		"select * from account a join orders o on a.ID = o.NOTHING",
+	} {
+		_, err := s.octo.Query(sql)
+		c.Assert(err, NotNil, Commentf("sql:%s", sql))
+	}
+}
+
+func (s *OctopusSuite) TestSelectExpressions(c *C) {
+	s.createAccountTable(c)
+	s.createOrdersTable(c)
+
+	cases := []struct {
+		sql    string
+		values [][]string
+	}{
+		{"select AMOUNT*2 as doubled, AMOUNT/4, -AMOUNT+1 from account where ID<=2", [][]string{{"20", "2.5000", "-9"}, {"-10", "-1.2500", "6"}}},
+		{"select concat(NAME, '/', CODE), upper(NAME), length(CODE) from account where ID=2", [][]string{{"a_10/c_10", "A_10", "4"}}},
+		{"select ID from account where upper(NAME)='A_1' and ID*2>2 order by ID", [][]string{{"4"}, {"7"}}},
+		{"select if(AMOUNT>10, 'big', 'small') as size, count(*) from account group by size order by size", [][]string{{"big", "2"}, {"small", "5"}}},
+		{"select case when AMOUNT<0 then 'neg' when AMOUNT<10 then 'low' else 'high' end as level from account where ID<=3", [][]string{{"high"}, {"neg"}, {"low"}}},
+		{"select coalesce(ACCOUNT_ID, 0), ifnull(ACCOUNT_ID, -1) from orders where ID>=5", [][]string{{"9", "9"}, {"0", "-1"}}},
+		{"select round(avg(AMOUNT), 1), abs(min(AMOUNT)) from account", [][]string{{"30.9", "5"}}},
+		//别名
+		{"select ID, AMOUNT*2 as doubled from account order by doubled desc, ID limit 3", [][]string{{"5", "200"}, {"6", "200"}, {"1", "20"}}},
+		{"select NAME as n, sum(AMOUNT) as total from account group by n having total > 50 order by total, n", [][]string{{"10", "100"}, {"9", "100"}}},
+		{"select ID as AMOUNT from account where ID<3 order by AMOUNT desc", [][]string{{"2"}, {"1"}}},
+		{"select ID, AMOUNT as ID from account group by ID having ID > 6", [][]string{{"7", "1"}}},
+		//连接中的表达式
+		{"select a.NAME, o.QTY*a.AMOUNT as total from account a join orders o on a.ID = o.ACCOUNT_ID order by total", [][]string{{"a_10", "-15"}, {"a_1", "10"}, {"a_1", "20"}, {"a_2", "28"}}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowValues(rows), DeepEquals, ca.values, Commentf("sql:%s", ca.sql))
+	}
+
+	//结果列的名称和类型
+	res, err := s.octo.Query("select AMOUNT*2 as doubled, concat(NAME, CODE), AMOUNT/2, now() from account")
+	c.Assert(err, IsNil)
+	fields := res.Fields()
+	c.Assert(fields[0].Name, Equals, "doubled")
+	c.Assert(fields[0].MysqlType.Tp, Equals, mysql.TypeLonglong)
+	c.Assert(fields[1].Name, Equals, "concat(name, code)")
+	c.Assert(fields[1].MysqlType.Tp, Equals, mysql.TypeVarString)
+	c.Assert(fields[2].MysqlType.Tp, Equals, mysql.TypeNewDecimal)
+	c.Assert(fields[3].MysqlType.Tp, Equals, mysql.TypeDatetime)
+	res.Close()
+
+	for _, sql := range []string{
+		"select upper(NAME, CODE) from account",
+		"select nothing(NAME) from account",
+		"select ID as x, AMOUNT as x from account order by x",
+		"select ID from account where doubled > 1",
+	} {
+		_, err := s.octo.Query(sql)
+		c.Assert(err, NotNil, Commentf("sql:%s", sql))
+	}
+}
+
+func (s *OctopusSuite) TestSubquery(c *C) {
+	s.createAccountTable(c)
+	s.createOrdersTable(c)
+
+	cases := []struct {
+		sql    string
+		values [][]string
+	}{
+		{"select ID from account where ID in (select ACCOUNT_ID from orders) order by ID", [][]string{{"1"}, {"2"}, {"3"}}},
+		{"select ID from account where CODE in (select CODE from orders where QTY >= 3) order by ID", [][]string{{"2"}, {"3"}, {"7"}}},
+		//子查询结果中有NULL时NOT IN不为真
+		{"select ID from account where ID not in (select ACCOUNT_ID from orders)", [][]string{}},
+		{"select ID from account where ID not in (select ACCOUNT_ID from orders where ACCOUNT_ID is not null) order by ID", [][]string{{"4"}, {"5"}, {"6"}, {"7"}}},
+		{"select ID from orders where ACCOUNT_ID not in (select ID from account where ID > 1) order by ID", [][]string{{"1"}, {"2"}, {"5"}}},
+		{"select ID from account a where exists (select * from orders o where o.ACCOUNT_ID = a.ID and o.QTY > 1) order by ID", [][]string{{"1"}, {"2"}, {"3"}}},
+		{"select ID from account a where not exists (select * from orders o where o.ACCOUNT_ID = a.ID) order by ID", [][]string{{"4"}, {"5"}, {"6"}, {"7"}}},
+		{"select ID from account where ID in (select ACCOUNT_ID from orders where CODE in (select CODE from account where AMOUNT < 0))", [][]string{{"2"}}},
+		//最内层引用最外层的列
+		{"select ID from account a where exists (select * from orders o where o.ACCOUNT_ID = a.ID and o.QTY in (select QTY from orders p where p.QTY > a.AMOUNT))", [][]string{{"2"}}},
+		//标量子查询
+		{"select ID from account where AMOUNT = (select max(AMOUNT) from account) order by ID", [][]string{{"5"}, {"6"}}},
+		{"select ID, (select count(*) from orders o where o.ACCOUNT_ID = a.ID) as n from account a where ID <= 4 order by ID", [][]string{{"1", "2"}, {"2", "1"}, {"3", "1"}, {"4", "0"}}},
+		{"select ID from account a where AMOUNT > (select sum(QTY) from orders o where o.ACCOUNT_ID = a.ID) order by ID", [][]string{{"1"}, {"3"}}},
+		{"select (select QTY from orders where ID = 100) from account where ID = 1", [][]string{{"NULL"}}},
+		{"select ID from account a where 2 in (select count(*) from orders o where o.ACCOUNT_ID = a.ID)", [][]string{{"1"}}},
+		//选择列中的IN和EXISTS
+		{"select ID, ID in (select ACCOUNT_ID from orders), exists (select * from orders where ACCOUNT_ID = account.ID) from account where ID in (3, 4) order by ID", [][]string{{"3", "1", "1"}, {"4", "NULL", "0"}}},
+	}
+	for _, ca := range cases {
+		rows := s.mustQuery(c, ca.sql)
+		c.Assert(rowValues(rows), DeepEquals, ca.values, Commentf("sql:%s", ca.sql))
+	}
+
+	//能改写的子查询转换为半连接
+	plans := []struct {
+		sql      string
+		joinType planner.JoinType
+	}{
+		{"select * from account where ID in (select ACCOUNT_ID from orders)", planner.SemiJoin},
+		{"select * from account a where not exists (select * from orders o where o.ACCOUNT_ID = a.ID)", planner.AntiSemiJoin},
+		{"select * from account where CODE not in (select CODE from orders)", planner.AntiSemiJoin},
+	}
+	for _, p := range plans {
+		path := planPath(s.mustPlan(c, p.sql))
+		join, ok := path[1].(*planner.PhysicalHashJoin)
+		c.Assert(ok, IsTrue, Commentf("sql:%s", p.sql))
+		c.Assert(join.JoinType, Equals, p.joinType, Commentf("sql:%s", p.sql))
+	}
+	//NOT IN两边可能为NULL时比较结果为NULL的行同样匹配
+	rows := s.mustQuery(c, "explain select ID from account where ID not in (select ACCOUNT_ID from orders)")
+	values := rowValues(rows)
+	c.Assert(values[1], DeepEquals, []string{"└─NestedLoopJoin", "5.60", "anti semi join, inner:right, other cond:[or(eq(id, account_id), isnull(eq(id, account_id)))]"})
+
+	//更新和删除的条件中使用子查询
+	s.mustExec(c, "delete from orders where ACCOUNT_ID in (select ID from account where NAME = 'a_1')")
+	c.Assert(rowValues(s.mustQuery(c, "select ID from orders")), DeepEquals, [][]string{{"3"}, {"4"}, {"5"}, {"6"}})
+	s.mustExec(c, "update account set AMOUNT = (select sum(QTY) from orders o where o.ACCOUNT_ID = account.ID) where ID in (select ACCOUNT_ID from orders)")
+	c.Assert(rowValues(s.mustQuery(c, "select ID, AMOUNT from account where ID <= 4")), DeepEquals, [][]string{{"1", "10"}, {"2", "3"}, {"3", "4"}, {"4", "3"}})
+
+	//删除的表不能在子查询中读取
+	err := s.octo.Exec("delete from account where ID in (select ID from account where AMOUNT > 50)")
+	c.Assert(err, ErrorMatches, "You can't specify target table 'account' for update in FROM clause")
+	//标量子查询的结果超过一行时在执行中报错
+	res, err := s.octo.Query("select (select ID from orders) from account")
+	c.Assert(err, IsNil)
+	var row table.Row
+	c.Assert(res.Next(&row), IsFalse)
+	c.Assert(res.Err(), ErrorMatches, "Subquery returns more than 1 row")
+
+	for _, sql := range []string{
+		"select ID from account where ID in (select ID, QTY from orders)",
+		"select ID from account where ID = (select ID, QTY from orders where ID = 3)",
+		"select ID from account where ID in (select NOTHING from orders)",
+	} {
+		_, err := s.octo.Query(sql)
+		c.Assert(err, NotNil, Commentf("sql:%s", sql))
+	}
+}
@@ -0,0 +1,338 @@
+package octopus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/executor"
+	"github.com/CDDSCLab/chaosdb/planner"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+)
+
+//会话 BEGIN之后的语句都在会话的事务中执行 直到COMMIT或ROLLBACK
+//会话不能被多个线程同时使用
+type Session struct {
+	octo *Octopus
+	txn  tableOpt.Txn //没有进行中的事务时为nil
+	db   string       //当前数据库 语句中没有指定数据库的表都在当前数据库中
+}
+
+func (octo *Octopus) NewSession() *Session {
+	return &Session{octo: octo, db: table.DefaultDatabase}
+}
+
+//会话的当前数据库
+func (s *Session) CurrentDB() string {
+	return s.db
+}
+
+//没有指定数据库的表名补全为会话的当前数据库
+type schemaFiller struct {
+	db string
+}
+
+func (f *schemaFiller) Enter(n ast.Node) (ast.Node, bool) {
+	switch x := n.(type) {
+	case *ast.TableName:
+		if x.Schema.L == "" {
+			x.Schema = model.NewCIStr(f.db)
+		}
+	case *ast.ShowStmt:
+		//SHOW COLUMNS FROM t FROM db中的数据库
+		if x.Table != nil && x.Table.Schema.L == "" && x.DBName != "" {
+			x.Table.Schema = model.NewCIStr(x.DBName)
+		}
+		if x.DBName == "" {
+			x.DBName = f.db
+		}
+	}
+	return n, false
+}
+
+func (f *schemaFiller) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+//切换当前数据库 不影响进行中的事务
+func (s *Session) use(dbName string) error {
+	dbInfo, err := s.octo.tableOpt.GetDatabase(strings.ToLower(dbName))
+	if err != nil {
+		return err
+	}
+	if dbInfo == nil {
+		errStr := fmt.Sprintf("Unknown database '%s'", dbName)
+		return errors.New(errStr)
+	}
+	s.db = dbInfo.Name
+	return nil
+}
+
+//是否有进行中的事务
+func (s *Session) InTxn() bool {
+	return s.txn != nil
+}
+
+//提交进行中的事务 没有事务时什么都不做
+func (s *Session) commit() error {
+	if s.txn == nil {
+		return nil
+	}
+	txn := s.txn
+	s.txn = nil
+	return txn.Commit()
+}
+
+func (s *Session) rollback() {
+	if s.txn == nil {
+		return
+	}
+	s.txn.Rollback()
+	s.txn = nil
+}
+
+//关闭会话 回滚没有提交的事务
+func (s *Session) Close() {
+	s.rollback()
+}
+
+func (s *Session) Exec(sql string) error {
+	sqlParser := parser.New()
+	stmtNode, err := sqlParser.ParseOneStmt(sql, "utf8", "utf8_bin")
+	if err != nil {
+		return err
+	}
+	return s.exec(stmtNode)
+}
+
+func (s *Session) Query(querySql string) (*executor.QueryResult, error) {
+	sqlParser := parser.New()
+	stmtNode, err := sqlParser.ParseOneStmt(querySql, "utf8", "utf8_bin")
+	if err != nil {
+		errStr := fmt.Sprintf("ParseSql error sql:%s,error:%s", querySql, err)
+		return nil, errors.New(errStr)
+	}
+	return s.query(stmtNode)
+}
+
+func (s *Session) exec(stmtNode ast.StmtNode) error {
+	stmtNode.Accept(&schemaFiller{db: s.db})
+	switch x := stmtNode.(type) {
+	case *ast.BeginStmt:
+		//和MySQL一样 BEGIN先提交进行中的事务
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		s.txn = s.octo.tableOpt.Begin()
+		return nil
+	case *ast.CommitStmt:
+		//冲突时事务已经回滚 由调用方重试整个事务
+		return s.commit()
+	case *ast.RollbackStmt:
+		s.rollback()
+		return nil
+	case *ast.UseStmt:
+		return s.use(x.DBName)
+	case *ast.CreateDatabaseStmt:
+		//DDL隐式提交进行中的事务
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewCreateDatabaseExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.DropDatabaseStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewDropDatabaseExecutor(s.octo.tableOpt)
+		err = exec.Exec(x)
+		if err != nil {
+			return err
+		}
+		//删除当前数据库后回到默认数据库
+		if strings.ToLower(x.Name) == s.db {
+			s.db = table.DefaultDatabase
+		}
+		return nil
+	case *ast.CreateTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewCreateTableExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.DropTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewDropTableExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.TruncateTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewTruncateTableExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.RenameTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewRenameTableExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.CreateIndexStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewCreateIndexExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.DropIndexStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewDropIndexExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.AlterTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+		exec := executor.NewAlterTableExecutor(s.octo.tableOpt)
+		return exec.Exec(x)
+	case *ast.AnalyzeTableStmt:
+		err := s.commit()
+		if err != nil {
+			return err
+		}
+	case *ast.ExplainStmt, *ast.ShowStmt:
+		//EXPLAIN ANALYZE会执行语句 结果直接丢弃
+		res, err := s.query(x)
+		if err != nil {
+			return err
+		}
+		res.Close()
+		return nil
+	case *ast.InsertStmt, *ast.DeleteStmt, *ast.UpdateStmt:
+	default:
+		errStr := fmt.Sprintf("sql type no support")
+		return errors.New(errStr)
+	}
+	if s.txn != nil {
+		return s.execStmt(s.txn, stmtNode)
+	}
+	//不在事务中时 语句在单独的事务中执行 执行成功后提交 冲突时重新执行
+	var err error
+	for i := 0; i <= s.octo.retryLimit; i++ {
+		txn := s.octo.tableOpt.Begin()
+		err = s.execStmt(txn, stmtNode)
+		if err != nil {
+			txn.Rollback()
+		} else {
+			err = txn.Commit()
+		}
+		if !kv.IsRetryable(err) {
+			return err
+		}
+		octopusLogger.Warningf("statement conflict(%d) error(%s)", i+1, err)
+	}
+	return err
+}
+
+//生成执行计划并执行
+func (s *Session) execStmt(tableOpt tableOpt.TableOpt, stmtNode ast.StmtNode) error {
+	plan, err := planner.Optimize(tableOpt, stmtNode)
+	if err != nil {
+		return err
+	}
+	switch x := plan.(type) {
+	case *planner.Insert:
+		exec := executor.NewInsertExecutor(tableOpt)
+		err = exec.Exec(x)
+	case *planner.Delete:
+		exec := executor.NewDeleteExecutor(tableOpt)
+		err = exec.Exec(x)
+	case *planner.Update:
+		exec := executor.NewUpdateExecutor(tableOpt)
+		err = exec.Exec(x)
+	case *planner.Analyze:
+		exec := executor.NewAnalyzeExecutor(tableOpt)
+		err = exec.Exec(x)
+	}
+	return err
+}
+
+func (s *Session) query(stmtNode ast.StmtNode) (*executor.QueryResult, error) {
+	stmtNode.Accept(&schemaFiller{db: s.db})
+	switch stmtNode.(type) {
+	case *ast.SelectStmt, *ast.ExplainStmt, *ast.ShowStmt:
+	default:
+		errStr := fmt.Sprintf("Sql not a QuerySql,please call exec()")
+		return nil, errors.New(errStr)
+	}
+	if s.txn != nil {
+		txn := s.txn
+		res, err := s.queryStmt(txn, stmtNode)
+		if err != nil {
+			return nil, err
+		}
+		//加锁时发生死锁 回滚整个事务释放持有的锁
+		res.OnClose(func() {
+			if res.Err() == kv.ErrDeadlock && s.txn == txn {
+				s.rollback()
+			}
+		})
+		return res, nil
+	}
+	//不在事务中时 整个查询读取同一个快照 结果集关闭时释放
+	txn := s.octo.tableOpt.Begin()
+	res, err := s.queryStmt(txn, stmtNode)
+	if err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+	//EXPLAIN的结果已经全部生成 EXPLAIN ANALYZE执行的修改在这里提交
+	if _, ok := stmtNode.(*ast.ExplainStmt); ok {
+		err = txn.Commit()
+		if err != nil {
+			res.Close()
+			return nil, err
+		}
+		return res, nil
+	}
+	res.OnClose(txn.Rollback)
+	return res, nil
+}
+
+//生成执行计划 执行返回结果集的计划
+func (s *Session) queryStmt(tableOpt tableOpt.TableOpt, stmtNode ast.StmtNode) (*executor.QueryResult, error) {
+	plan, err := planner.Optimize(tableOpt, stmtNode)
+	if err != nil {
+		return nil, err
+	}
+	switch x := plan.(type) {
+	case *planner.Explain:
+		exec := executor.NewExplainExecutor(tableOpt)
+		return exec.Query(x)
+	case *planner.Show:
+		exec := executor.NewShowExecutor(tableOpt)
+		return exec.Query(x)
+	case planner.PhysicalPlan:
+		exec := executor.NewSelectExecutor(tableOpt)
+		return exec.Query(x)
+	}
+	errStr := fmt.Sprintf("plan(%T) has no result", plan)
+	return nil, errors.New(errStr)
+}
@@ -1,9 +1,15 @@
 package common
 
+const DatabaseInfoPrefix = "db"
+
 const TableInfoPrefix = "ti"
 
 const TableInfoIdsPrefix = "tiids"
 
+const TableStatsPrefix = "tistats"
+
+const TableBackfillPrefix = "tibackfill"
+
 const TablePrefix = "tb"
 
 const RowPrefix = "r"
@@ -1,18 +1,23 @@
 package levelDB
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/CDDSCLab/chaosdb/common/kv"
 	"github.com/CDDSCLab/chaosdb/common/tableOpt"
 	"github.com/CDDSCLab/chaosdb/opt/common"
+	"github.com/CDDSCLab/chaosdb/statistics"
 	common2	"github.com/CDDSCLab/chaosdb/store/common"
 	"github.com/CDDSCLab/chaosdb/store/leveldb"
+	"github.com/CDDSCLab/chaosdb/store/mvcc"
 	"github.com/CDDSCLab/chaosdb/table"
 	"github.com/CDDSCLab/chaosdb/util/codekey"
+	"github.com/CDDSCLab/chaosdb/util/stringutil"
 
-	"strconv"
 	"sync"
 
 	jsoniter "github.com/json-iterator/go"
@@ -22,20 +27,114 @@ import (
 type LevelTableOpt struct {
 	mu      sync.RWMutex
 	leveldb *leveldb.LevelDB
+	mvcc    *mvcc.Store //表信息和数据都以多版本存储
+	storage kv.Storage  //读写数据使用的存储 事务中为事务本身
 }
 
 var leveldbLogger = logging.MustGetLogger("leveldbOpt")
 
-func NewLevelTableOpt(storage kv.Storage) tableOpt.TableOpt {
-	levelTableOpt := &LevelTableOpt{leveldb: storage.(*leveldb.LevelDB)}
-	return levelTableOpt
+//删除表数据和索引时每次写入删除的键数
+const DeleteRangeBatchSize = 1024
+
+func NewLevelTableOpt(storage kv.Storage, store *mvcc.Store) (tableOpt.TableOpt, error) {
+	levelTableOpt := &LevelTableOpt{leveldb: storage.(*leveldb.LevelDB), mvcc: store, storage: store}
+	err := levelTableOpt.loadTableIds()
+	if err != nil {
+		return nil, err
+	}
+	return levelTableOpt, nil
+}
+
+//表id列表和表信息在同一次写入中多版本存储
+//没有多版本的列表时使用打开LevelDB时直接读取的列表
+func (l *LevelTableOpt) loadTableIds() error {
+	tableIdsValue, err := l.mvcc.Get([]byte(common2.TableIdsKey))
+	if err != nil {
+		return err
+	}
+	if tableIdsValue != nil {
+		var tableIds []uint64
+		err = jsoniter.Unmarshal(tableIdsValue, &tableIds)
+		if err != nil {
+			errStr := fmt.Sprintf("unmarshal tableIds error(%s)", err)
+			return errors.New(errStr)
+		}
+		l.leveldb.TableIds = tableIds
+	}
+	return l.loadMaxTableId()
+}
+
+//没有保存最大表id的旧数据 从现有的表id中取最大值
+func (l *LevelTableOpt) loadMaxTableId() error {
+	maxTableIdValue, err := l.mvcc.Get([]byte(common2.MaxTableIdKey))
+	if err != nil {
+		return err
+	}
+	var maxTableId uint64
+	if maxTableIdValue != nil {
+		err = jsoniter.Unmarshal(maxTableIdValue, &maxTableId)
+		if err != nil {
+			errStr := fmt.Sprintf("unmarshal maxTableId error(%s)", err)
+			return errors.New(errStr)
+		}
+	}
+	for _, tableId := range l.leveldb.TableIds {
+		if tableId > maxTableId {
+			maxTableId = tableId
+		}
+	}
+	l.leveldb.MaxTableId = maxTableId
+	return nil
+}
+
+//分配过的最大表id加入batch 和使用新id的表信息一起写入
+func (l *LevelTableOpt) putMaxTableId(batch *kv.Batch, tableId uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tableId > l.leveldb.MaxTableId {
+		l.leveldb.MaxTableId = tableId
+	}
+	maxTableIdValue, err := jsoniter.Marshal(l.leveldb.MaxTableId)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(common2.MaxTableIdKey), maxTableIdValue)
+	return nil
+}
+
+//事务中的表操作 表信息的缓存仍然使用LevelDB上的缓存
+type levelTableTxn struct {
+	*LevelTableOpt
+	txn *mvcc.Txn
+}
+
+func (l *LevelTableOpt) Begin() tableOpt.Txn {
+	txn := l.mvcc.Begin()
+	return &levelTableTxn{LevelTableOpt: &LevelTableOpt{leveldb: l.leveldb, mvcc: l.mvcc, storage: txn}, txn: txn}
+}
+
+func (t *levelTableTxn) Commit() error {
+	return t.txn.Commit()
+}
+
+func (t *levelTableTxn) Rollback() {
+	t.txn.Rollback()
+}
+
+//不在事务中时语句结束后没有需要保持的锁
+func (l *LevelTableOpt) LockKeys(keys [][]byte, exclusive bool) error {
+	return nil
+}
+
+func (t *levelTableTxn) LockKeys(keys [][]byte, exclusive bool) error {
+	return t.txn.LockKeys(exclusive, keys...)
 }
 
 func (l *LevelTableOpt) TableExists(tableName string) (bool, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableName)
-	tableInfo, err := l.leveldb.Get(tableInfoKey.Bytes())
+	tableInfo, err := l.storage.Get(tableInfoKey.Bytes())
 	if err != nil {
 		return false, err
 	}
@@ -46,22 +145,162 @@ func (l *LevelTableOpt) TableExists(tableName string) (bool, error) {
 	return true, nil
 }
 
+//按表信息的键列出数据库中的全部表 键按表名排序
+//默认数据库的表名没有前缀 跳过其他数据库中带前缀的表
+func (l *LevelTableOpt) ListTables(db *table.DBInfo) ([]string, error) {
+	prefix := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, db.TablePrefix()).Bytes()
+	iter := l.storage.NewScanIterator(prefix, codekey.PrefixNext(prefix))
+	defer iter.Close()
+	var tableNames []string
+	for ; iter.Valid(); iter.Next() {
+		tableName := string(iter.Key()[len(prefix):])
+		if db.Id == 0 && strings.Contains(tableName, ".") {
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	return tableNames, nil
+}
+
+//按名称获取数据库信息 数据库不存在时返回nil
+func (l *LevelTableOpt) GetDatabase(dbName string) (*table.DBInfo, error) {
+	if dbName == "" || dbName == table.DefaultDatabase {
+		return table.DefaultDBInfo(), nil
+	}
+	dbInfoKey := codekey.EncodeKey(common.Separator, common.DatabaseInfoPrefix, dbName)
+	dbInfoValue, err := l.storage.Get(dbInfoKey.Bytes())
+	if err != nil || dbInfoValue == nil {
+		return nil, err
+	}
+	var dbInfo table.DBInfo
+	err = jsoniter.Unmarshal(dbInfoValue, &dbInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &dbInfo, nil
+}
+
+//按名称排序的全部数据库 包括默认数据库
+func (l *LevelTableOpt) ListDatabases() ([]*table.DBInfo, error) {
+	prefix := codekey.EncodeKey(common.Separator, common.DatabaseInfoPrefix, "").Bytes()
+	iter := l.storage.NewScanIterator(prefix, codekey.PrefixNext(prefix))
+	defer iter.Close()
+	dbInfos := []*table.DBInfo{table.DefaultDBInfo()}
+	for ; iter.Valid(); iter.Next() {
+		var dbInfo table.DBInfo
+		err := jsoniter.Unmarshal(iter.Value(), &dbInfo)
+		if err != nil {
+			return nil, err
+		}
+		dbInfos = append(dbInfos, &dbInfo)
+	}
+	sort.Slice(dbInfos, func(i, j int) bool {
+		return dbInfos[i].Name < dbInfos[j].Name
+	})
+	return dbInfos, nil
+}
+
+//创建数据库 数据库id取已有的最大id加1
+func (l *LevelTableOpt) CreateDatabase(dbName string) (*table.DBInfo, error) {
+	dbInfos, err := l.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+	dbInfo := &table.DBInfo{Name: dbName}
+	for _, db := range dbInfos {
+		if db.Name == dbName {
+			errStr := fmt.Sprintf("Can't create database '%s'; database exists", dbName)
+			return nil, errors.New(errStr)
+		}
+		if db.Id > dbInfo.Id {
+			dbInfo.Id = db.Id
+		}
+	}
+	dbInfo.Id++
+	dbInfoValue, err := jsoniter.Marshal(dbInfo)
+	if err != nil {
+		return nil, err
+	}
+	dbInfoKey := codekey.EncodeKey(common.Separator, common.DatabaseInfoPrefix, dbName)
+	err = l.storage.Put(dbInfoKey.Bytes(), dbInfoValue)
+	if err != nil {
+		return nil, err
+	}
+	return dbInfo, nil
+}
+
+//依次删除数据库中的表 最后删除数据库信息
+//中途失败时数据库和剩下的表仍然存在 可以再次删除
+func (l *LevelTableOpt) DropDatabase(dbName string) error {
+	dbInfo, err := l.GetDatabase(dbName)
+	if err != nil {
+		return err
+	}
+	if dbInfo == nil {
+		errStr := fmt.Sprintf("Can't drop database '%s'; database doesn't exist", dbName)
+		return errors.New(errStr)
+	}
+	if dbInfo.Id == 0 {
+		errStr := fmt.Sprintf("Can't drop default database '%s'", dbName)
+		return errors.New(errStr)
+	}
+	tableNames, err := l.ListTables(dbInfo)
+	if err != nil {
+		return err
+	}
+	//全部表的信息和数据库信息在一次写入中删除 表中的数据之后分批删除
+	batch := kv.NewBatch()
+	tableIds := l.leveldb.TableIds
+	fullNames := make([]string, 0, len(tableNames))
+	droppedIds := make([]uint64, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		fullName := dbInfo.FullTableName(tableName)
+		var tableInfo *table.MyTableInfo
+		tableInfo, tableIds, err = l.dropTableBatch(batch, fullName, tableIds)
+		if err != nil {
+			return err
+		}
+		fullNames = append(fullNames, fullName)
+		droppedIds = append(droppedIds, tableInfo.TableId)
+	}
+	if len(tableNames) > 0 {
+		tableIdsValue, err := jsoniter.Marshal(tableIds)
+		if err != nil {
+			return err
+		}
+		batch.Put([]byte(common2.TableIdsKey), tableIdsValue)
+	}
+	batch.Delete(codekey.EncodeKey(common.Separator, common.DatabaseInfoPrefix, dbName).Bytes())
+
+	err = l.storage.Write(batch)
+	if err != nil {
+		return err
+	}
+	for _, fullName := range fullNames {
+		l.leveldb.CacheTableInfo(fullName, nil)
+	}
+	l.leveldb.TableIds = tableIds
+	for _, tableId := range droppedIds {
+		err = l.dropTableData(tableId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//分配新的表id 只增不减 删除的表的id不会再分配 删除到一半的数据不会出现在新表中
 func (l *LevelTableOpt) GetUniqTableId() uint64 {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if len(l.leveldb.TableIds) == 0 {
-		return 1
-	} else {
-		lastId := l.leveldb.TableIds[len(l.leveldb.TableIds)-1]
-		lastId++
-		return uint64(lastId)
-	}
+	l.leveldb.MaxTableId++
+	return l.leveldb.MaxTableId
 }
 
 func (l *LevelTableOpt) GetTableInfo(tableName string) (*table.MyTableInfo, error) {
 
 	//先从缓存获取
-	if tableInfo, ok := l.leveldb.TableInfos[tableName]; ok {
+	if tableInfo, ok := l.leveldb.CachedTableInfo(tableName); ok {
 		leveldbLogger.Infof("duyong--[GetTableInfo]缓存获取")
 		return tableInfo, nil
 	}
@@ -69,7 +308,7 @@ func (l *LevelTableOpt) GetTableInfo(tableName string) (*table.MyTableInfo, erro
 	//从数据库获取
 	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableName)
 	//leveldbLogger.Infof("getTableInfo by name:%s", tableInfoKey.String())
-	tableInfoValue, err := l.leveldb.Get(tableInfoKey.Bytes())
+	tableInfoValue, err := l.storage.Get(tableInfoKey.Bytes())
 	if err != nil || tableInfoValue == nil {
 		leveldbLogger.Errorf("leveldb get tableInfo error:%s", err)
 		return nil, err
@@ -80,7 +319,7 @@ func (l *LevelTableOpt) GetTableInfo(tableName string) (*table.MyTableInfo, erro
 		return nil, err
 	}
 	//存入缓存
-	l.leveldb.TableInfos[tableName] = &tableInfo
+	l.leveldb.CacheTableInfo(tableName, &tableInfo)
 	leveldbLogger.Infof("duyong--[GetTableInfo]数据库获取")
 	return &tableInfo, nil
 }
@@ -88,7 +327,7 @@ func (l *LevelTableOpt) GetTableInfo(tableName string) (*table.MyTableInfo, erro
 //func (l *LevelTableOpt) SetTableInfo(tableInfo *table.MyTableInfo) error {
 //
 //	//切换表 修改tableInfo
-//	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.TableName)
+//	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.FullName())
 //	tableInfoValue, err := jsoniter.Marshal(tableInfo)
 //	if err != nil {
 //		return err
@@ -106,7 +345,7 @@ func (l *LevelTableOpt) GetTableInfo(tableName string) (*table.MyTableInfo, erro
 //获取表中自增id和行号
 func (l *LevelTableOpt) GetTableInfoIds(tableName string) (*table.MyTableInfoIds, error) {
 	tableInfoIdsKey := codekey.EncodeKey(common.Separator, common.TableInfoIdsPrefix, tableName)
-	tableInfoIdsValue, err := l.leveldb.Get(tableInfoIdsKey.Bytes())
+	tableInfoIdsValue, err := l.storage.Get(tableInfoIdsKey.Bytes())
 	if err != nil && tableInfoIdsValue == nil {
 		leveldbLogger.Errorf("leveldb get tableInfoIds error:%s", err)
 		return nil, err
@@ -126,106 +365,494 @@ func (l *LevelTableOpt) SetTableInfoIds(tableName string, tableInfoIds *table.My
 	if err != nil {
 		return err
 	}
-	err = l.leveldb.Put(tableInfoIdsKey.Bytes(), tableInfoIdsValue)
+	err = l.storage.Put(tableInfoIdsKey.Bytes(), tableInfoIdsValue)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+//获取表的统计信息
+func (l *LevelTableOpt) GetTableStats(tableName string) (*statistics.Table, error) {
+	tableStatsKey := codekey.EncodeKey(common.Separator, common.TableStatsPrefix, tableName)
+	tableStatsValue, err := l.storage.Get(tableStatsKey.Bytes())
+	if err != nil || tableStatsValue == nil {
+		return nil, err
+	}
+	var stats statistics.Table
+	err = jsoniter.Unmarshal(tableStatsValue, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+//保存表的统计信息
+func (l *LevelTableOpt) SetTableStats(tableName string, stats *statistics.Table) error {
+	tableStatsKey := codekey.EncodeKey(common.Separator, common.TableStatsPrefix, tableName)
+	tableStatsValue, err := jsoniter.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return l.storage.Put(tableStatsKey.Bytes(), tableStatsValue)
+}
+
+//表名不区分大小写 统一按小写保存
 func (l *LevelTableOpt) CreateTable(tableInfo *table.MyTableInfo) error {
 	jsoniter := jsoniter.ConfigCompatibleWithStandardLibrary
+	batch := kv.NewBatch()
+	tableInfo.TableName = strings.ToLower(tableInfo.TableName)
 
-	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.TableName)
+	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.FullName())
 	//leveldbLogger.Infof("create table key:%s,value:%v", tableInfoKey.String(), tableInfo)
 	tableInfoValue, err := jsoniter.Marshal(tableInfo)
 	if err != nil {
 		return err
 	}
-	err = l.leveldb.Put(tableInfoKey.Bytes(), tableInfoValue)
+	batch.Put(tableInfoKey.Bytes(), tableInfoValue)
+
+	//table自增id和行数
+	tableInfoIdsKey := codekey.EncodeKey(common.Separator, common.TableInfoIdsPrefix, tableInfo.FullName())
+	tableInfoIds := &table.MyTableInfoIds{AutoIncId: 1, RowsCount: 0}
+	tableInfoIdsValue, err := jsoniter.Marshal(tableInfoIds)
 	if err != nil {
 		return err
 	}
+	batch.Put(tableInfoIdsKey.Bytes(), tableInfoIdsValue)
 
-	//缓存tableInfo
-	l.leveldb.TableInfos[tableInfo.TableName] = tableInfo
+	//表id列表 包含新建的表
+	tableIds := append(append([]uint64{}, l.leveldb.TableIds...), tableInfo.TableId)
+	tableIdsValue, err := jsoniter.Marshal(tableIds)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(common2.TableIdsKey), tableIdsValue)
+	err = l.putMaxTableId(batch, tableInfo.TableId)
+	if err != nil {
+		return err
+	}
 
-	//写入table自增id和行数
-	tableInfoIdsKey := codekey.EncodeKey(common.Separator, common.TableInfoIdsPrefix, tableInfo.TableName)
-	tableInfoIds := &table.MyTableInfoIds{AutoIncId: 1, RowsCount: 0}
-	tableInfoIdsValue, err := jsoniter.Marshal(tableInfoIds)
+	//一次写入 写入成功后再更新缓存
+	err = l.storage.Write(batch)
 	if err != nil {
 		return err
 	}
-	err = l.leveldb.Put(tableInfoIdsKey.Bytes(), tableInfoIdsValue)
+	l.leveldb.CacheTableInfo(tableInfo.FullName(), tableInfo)
+	l.leveldb.TableIds = tableIds
+	return nil
+}
+
+//删除表 表信息 自增id 统计信息 行数据 索引和表id列表的修改一次写入
+func (l *LevelTableOpt) DropTable(tableName string) error {
+	batch := kv.NewBatch()
+	tableInfo, tableIds, err := l.dropTableBatch(batch, tableName, l.leveldb.TableIds)
 	if err != nil {
 		return err
 	}
+	tableIdsValue, err := jsoniter.Marshal(tableIds)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(common2.TableIdsKey), tableIdsValue)
 
-	//缓存tableids
-	tableIdsKey := common2.TableIdsKey
+	err = l.storage.Write(batch)
+	if err != nil {
+		return err
+	}
+	l.leveldb.CacheTableInfo(tableName, nil)
+	l.leveldb.TableIds = tableIds
+	return l.dropTableData(tableInfo.TableId)
+}
+
+//删除表信息和元数据的修改加入batch 返回表信息和去掉这张表之后的表id列表
+//表中的数据在写入batch之后由dropTableData删除
+func (l *LevelTableOpt) dropTableBatch(batch *kv.Batch, tableName string, tableIds []uint64) (*table.MyTableInfo, []uint64, error) {
+	tableInfo, err := l.GetTableInfo(tableName)
+	if err != nil || tableInfo == nil {
+		errStr := fmt.Sprintf("DropTable get tableInfo(%s) error %v", tableName, err)
+		return nil, nil, errors.New(errStr)
+	}
+	batch.Delete(codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableName).Bytes())
+	for _, prefix := range tableMetaPrefixes {
+		batch.Delete(codekey.EncodeKey(common.Separator, prefix, tableName).Bytes())
+	}
 
-	tableIdsValue, err := jsoniter.Marshal(l.leveldb.TableIds)
+	rest := make([]uint64, 0, len(tableIds))
+	for _, tableId := range tableIds {
+		if tableId != tableInfo.TableId {
+			rest = append(rest, tableId)
+		}
+	}
+	return tableInfo, rest, nil
+}
+
+//表信息之外按表名存储的元数据
+var tableMetaPrefixes = []string{common.TableInfoIdsPrefix, common.TableStatsPrefix, common.TableBackfillPrefix}
+
+//表信息和元数据的键一次移动到新表名下 新表名可以在其他数据库中 行数据和索引键按表id编码 不需要修改
+//之前开始的事务读过旧表名的表信息 有修改时提交冲突
+func (l *LevelTableOpt) RenameTable(oldName string, dbId uint64, newTableName string) error {
+	tableInfo, err := l.GetTableInfo(oldName)
+	if err != nil || tableInfo == nil {
+		errStr := fmt.Sprintf("RenameTable get tableInfo(%s) error %v", oldName, err)
+		return errors.New(errStr)
+	}
+	newTableName = strings.ToLower(newTableName)
+	newName := table.FullTableName(dbId, newTableName)
+	ok, _ := l.TableExists(newName)
+	if ok {
+		errStr := fmt.Sprintf("Table '%s' already exists", newTableName)
+		return errors.New(errStr)
+	}
+	tableInfo = tableInfo.Clone()
+	tableInfo.DBId = dbId
+	tableInfo.TableName = newTableName
+	tableInfoValue, err := jsoniter.Marshal(tableInfo)
 	if err != nil {
 		return err
 	}
-	err = l.leveldb.Put([]byte(tableIdsKey), tableIdsValue)
+	batch := kv.NewBatch()
+	batch.Delete(codekey.EncodeKey(common.Separator, common.TableInfoPrefix, oldName).Bytes())
+	batch.Put(codekey.EncodeKey(common.Separator, common.TableInfoPrefix, newName).Bytes(), tableInfoValue)
+	for _, prefix := range tableMetaPrefixes {
+		oldKey := codekey.EncodeKey(common.Separator, prefix, oldName).Bytes()
+		value, err := l.storage.Get(oldKey)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			continue
+		}
+		batch.Delete(oldKey)
+		batch.Put(codekey.EncodeKey(common.Separator, prefix, newName).Bytes(), value)
+	}
+
+	err = l.storage.Write(batch)
+	if err != nil {
+		return err
+	}
+	l.leveldb.CacheTableInfo(oldName, nil)
+	l.leveldb.CacheTableInfo(newName, tableInfo)
+	return nil
+}
+
+//清空表 表使用新的表id 和重置的自增id、行数以及删除的统计信息在一次写入中生效
+//之后再删除旧表id下的全部数据 和删除表一样
+func (l *LevelTableOpt) TruncateTable(tableName string) error {
+	tableInfo, err := l.GetTableInfo(tableName)
+	if err != nil || tableInfo == nil {
+		errStr := fmt.Sprintf("TruncateTable get tableInfo(%s) error %v", tableName, err)
+		return errors.New(errStr)
+	}
+	oldTableId := tableInfo.TableId
+	tableInfo = tableInfo.Clone()
+	tableInfo.TableId = l.GetUniqTableId()
+	tableInfoValue, err := jsoniter.Marshal(tableInfo)
 	if err != nil {
 		return err
 	}
-	l.leveldb.TableIds = append(l.leveldb.TableIds, tableInfo.TableId)
+	batch := kv.NewBatch()
+	batch.Put(codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableName).Bytes(), tableInfoValue)
+	tableInfoIdsValue, err := jsoniter.Marshal(&table.MyTableInfoIds{AutoIncId: 1, RowsCount: 0})
+	if err != nil {
+		return err
+	}
+	batch.Put(codekey.EncodeKey(common.Separator, common.TableInfoIdsPrefix, tableName).Bytes(), tableInfoIdsValue)
+	//回填进度中的行键属于旧的表id 没有完成的索引从头回填
+	batch.Delete(codekey.EncodeKey(common.Separator, common.TableStatsPrefix, tableName).Bytes())
+	batch.Delete(codekey.EncodeKey(common.Separator, common.TableBackfillPrefix, tableName).Bytes())
+
+	tableIds := make([]uint64, 0, len(l.leveldb.TableIds))
+	for _, tableId := range l.leveldb.TableIds {
+		if tableId == oldTableId {
+			tableId = tableInfo.TableId
+		}
+		tableIds = append(tableIds, tableId)
+	}
+	tableIdsValue, err := jsoniter.Marshal(tableIds)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(common2.TableIdsKey), tableIdsValue)
+	err = l.putMaxTableId(batch, tableInfo.TableId)
+	if err != nil {
+		return err
+	}
+
+	err = l.storage.Write(batch)
+	if err != nil {
+		return err
+	}
+	l.leveldb.CacheTableInfo(tableName, tableInfo)
+	l.leveldb.TableIds = tableIds
+	return l.dropTableData(oldTableId)
+}
+
+//表信息删除或表id改变之后 分批删除旧表id下的全部行数据和索引键 再回收空间
+//表id不会再分配 删除到一半失败时剩下的数据不会再被读到
+func (l *LevelTableOpt) dropTableData(tableId uint64) error {
+	prefix := codekey.EncodeTablePrefix(tableId)
+	err := l.deleteRange(prefix, codekey.PrefixNext(prefix))
+	if err != nil {
+		return err
+	}
+	l.reclaim(prefix, codekey.PrefixNext(prefix))
+	return nil
+}
+
+//分批删除范围内的全部键 每批最多DeleteRangeBatchSize个键 单独写入
+func (l *LevelTableOpt) deleteRange(startKey, endKey []byte) error {
+	for {
+		keys := make([][]byte, 0, DeleteRangeBatchSize)
+		iter := l.storage.NewScanIterator(startKey, endKey)
+		for ; iter.Valid() && len(keys) < DeleteRangeBatchSize; iter.Next() {
+			keys = append(keys, stringutil.MakeCopy(iter.Key()))
+		}
+		iter.Close()
+		if len(keys) == 0 {
+			return nil
+		}
+		err := l.storage.BatchDelete(keys)
+		if err != nil {
+			return err
+		}
+		if len(keys) < DeleteRangeBatchSize {
+			return nil
+		}
+		//下一批从最后一个键之后开始
+		startKey = append(keys[len(keys)-1], 0)
+	}
+}
+
+//清理范围内删除的数据的旧版本并压缩
+//事务中删除的数据在提交前不能清理 由后台GC处理
+func (l *LevelTableOpt) reclaim(startKey, endKey []byte) {
+	if _, ok := l.storage.(*mvcc.Store); !ok {
+		return
+	}
+	deleted, err := l.mvcc.Reclaim(startKey, endKey)
+	if err != nil {
+		leveldbLogger.Warningf("reclaim range(%x, %x) error(%s)", startKey, endKey, err)
+		return
+	}
+	leveldbLogger.Infof("reclaim range(%x, %x), %d versions deleted", startKey, endKey, deleted)
+}
 
+//写入新的表信息 先替换缓存再写入 之后开始的语句都使用新的表信息
+//之前开始的事务读过旧的表信息 有修改时提交冲突 不会按旧的表结构写入数据
+func (l *LevelTableOpt) SetTableInfo(tableInfo *table.MyTableInfo) error {
+	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.FullName())
+	tableInfoValue, err := jsoniter.Marshal(tableInfo)
+	if err != nil {
+		return err
+	}
+	old, _ := l.leveldb.CachedTableInfo(tableInfo.FullName())
+	l.leveldb.CacheTableInfo(tableInfo.FullName(), tableInfo)
+	err = l.storage.Put(tableInfoKey.Bytes(), tableInfoValue)
+	if err != nil {
+		l.leveldb.CacheTableInfo(tableInfo.FullName(), old)
+		return err
+	}
 	return nil
 }
 
+//按行键顺序回填一批索引键 唯一索引中已有其他行的相同值时返回错误
+//索引键和进度一起写入 全部回填完成后删除进度
+func (l *LevelTableOpt) BackfillIndex(tableInfo *table.MyTableInfo, index *table.Index, progress *table.BackfillProgress, limit int) error {
+	rowPrefix := codekey.EncodeRowPrefix(tableInfo.TableId)
+	startKey := progress.NextKey
+	if len(startKey) == 0 {
+		startKey = rowPrefix
+	}
+	iter := l.storage.NewScanIterator(startKey, codekey.PrefixNext(rowPrefix))
+	defer iter.Close()
+	rows := 0
+	for ; iter.Valid() && rows < limit; iter.Next() {
+		_, rowId, err := codekey.DecodeRowKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		row, err := tableInfo.DecodeRow(rowId, iter.Value())
+		if err != nil {
+			return err
+		}
+		key, err := tableInfo.IndexKey(index, row)
+		if err != nil {
+			return err
+		}
+		if index.Unique {
+			err = l.checkUniqueKey(tableInfo, index, row, key)
+			if err != nil {
+				return err
+			}
+		}
+		err = l.storage.Put(key, codekey.EncodeIndexValue(rowId))
+		if err != nil {
+			return err
+		}
+		//下一批从当前行之后开始
+		progress.NextKey = append(stringutil.MakeCopy(iter.Key()), 0)
+		rows++
+	}
+	progress.Rows += uint64(rows)
+	progress.Done = !iter.Valid()
+
+	backfillKey := codekey.EncodeKey(common.Separator, common.TableBackfillPrefix, tableInfo.FullName())
+	if progress.Done {
+		return l.storage.Delete(backfillKey.Bytes())
+	}
+	progressValue, err := jsoniter.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return l.storage.Put(backfillKey.Bytes(), progressValue)
+}
+
+//唯一索引键已经属于其他行时返回重复错误
+func (l *LevelTableOpt) checkUniqueKey(tableInfo *table.MyTableInfo, index *table.Index, row *table.Row, key []byte) error {
+	value, err := l.storage.Get(key)
+	if err != nil || value == nil {
+		return err
+	}
+	rowId, err := codekey.DecodeIndexValue(value)
+	if err != nil || rowId == row.RowId {
+		return err
+	}
+	return duplicateEntryError(tableInfo, index, row)
+}
+
+func duplicateEntryError(tableInfo *table.MyTableInfo, index *table.Index, row *table.Row) error {
+	values, err := tableInfo.IndexValues(index, row)
+	if err != nil {
+		return err
+	}
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		str, err := value.ToString()
+		if err != nil {
+			return err
+		}
+		strs = append(strs, str)
+	}
+	errStr := fmt.Sprintf("Duplicate entry '%s' for key '%s'", strings.Join(strs, "-"), index.Name)
+	return errors.New(errStr)
+}
+
+func (l *LevelTableOpt) GetBackfillProgress(tableName string) (*table.BackfillProgress, error) {
+	backfillKey := codekey.EncodeKey(common.Separator, common.TableBackfillPrefix, tableName)
+	progressValue, err := l.storage.Get(backfillKey.Bytes())
+	if err != nil || progressValue == nil {
+		return nil, err
+	}
+	var progress table.BackfillProgress
+	err = jsoniter.Unmarshal(progressValue, &progress)
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+//分批删除索引键 再删除索引的回填进度 最后回收空间
+func (l *LevelTableOpt) DeleteIndex(tableInfo *table.MyTableInfo, index *table.Index) error {
+	prefix := codekey.EncodeIndexPrefix(tableInfo.TableId, index.Id)
+	err := l.deleteRange(prefix, codekey.PrefixNext(prefix))
+	if err != nil {
+		return err
+	}
+	progress, err := l.GetBackfillProgress(tableInfo.FullName())
+	if err != nil {
+		return err
+	}
+	if progress != nil && progress.IndexId == index.Id {
+		err = l.storage.Delete(codekey.EncodeKey(common.Separator, common.TableBackfillPrefix, tableInfo.FullName()).Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	l.reclaim(prefix, codekey.PrefixNext(prefix))
+	return nil
+}
+
+//重新编码行数据 去掉已删除列的值 补全添加的列 转换修改过类型的列
+//编码不变的行不写入
+func (l *LevelTableOpt) RewriteRows(tableInfo *table.MyTableInfo, startKey []byte, limit int) ([]byte, error) {
+	rowPrefix := codekey.EncodeRowPrefix(tableInfo.TableId)
+	if len(startKey) == 0 {
+		startKey = rowPrefix
+	}
+	iter := l.storage.NewScanIterator(startKey, codekey.PrefixNext(rowPrefix))
+	defer iter.Close()
+	var nextKey []byte
+	for rows := 0; iter.Valid() && rows < limit; iter.Next() {
+		_, rowId, err := codekey.DecodeRowKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		row, err := tableInfo.DecodeRow(rowId, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		value, err := tableInfo.EncodeRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(value, iter.Value()) {
+			err = l.storage.Put(stringutil.MakeCopy(iter.Key()), value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		nextKey = append(stringutil.MakeCopy(iter.Key()), 0)
+		rows++
+	}
+	if !iter.Valid() {
+		return nil, nil
+	}
+	return nextKey, nil
+}
+
 func (l *LevelTableOpt) AddRecords(tableInfo *table.MyTableInfo, batchRows []table.Rows) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	jsoniter := jsoniter.ConfigCompatibleWithStandardLibrary
 	//构造key 批量插入
 	var keys, values [][]byte
+	//同一批中已经使用的唯一索引键
+	pending := make(map[string]uint64)
 	for _, rows := range batchRows {
 		for _, row := range rows {
-			b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.RowPrefix,
-				strconv.FormatUint(tableInfo.TableId, 10), strconv.FormatUint(row.RowId, 10))
-			rowValue, err := jsoniter.Marshal(row)
+			rowValue, err := tableInfo.EncodeRow(row)
 			if err != nil {
-				errStr := fmt.Sprintf("marshal rowValue error(%s)", err)
+				errStr := fmt.Sprintf("encode rowValue error(%s)", err)
 				return errors.New(errStr)
 			}
-			keys = append(keys, b.Bytes())
+			keys = append(keys, codekey.EncodeRowKey(tableInfo.TableId, row.RowId))
 			values = append(values, rowValue)
-			//唯一索引数据
-			for indexName, indexColumn := range tableInfo.UniqIndices {
-				b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(tableInfo.TableId, 10),
-					strconv.FormatUint(indexColumn.Idx, 10), row.ColumnValue[indexName])
-				keys = append(keys, b.Bytes())
-				values = append(values, []byte(strconv.FormatUint(row.RowId, 10)))
-
-			}
-			//普通索引数据
-			for indexName, indexColumn := range tableInfo.Indices {
-				b := codekey.EncodeKey(common.Separator, common.TablePrefix, common.IndexPrefix, strconv.FormatUint(tableInfo.TableId, 10),
-					strconv.FormatUint(indexColumn.Idx, 10), row.ColumnValue[indexName], strconv.FormatUint(row.RowId, 10))
-				keys = append(keys, b.Bytes())
-				values = append(values, []byte(strconv.FormatUint(row.RowId, 10)))
+			//索引数据 值均为行号 唯一索引键属于其他行时不写入任何数据
+			for _, index := range tableInfo.IndexList() {
+				key, err := tableInfo.IndexKey(index, row)
+				if err != nil {
+					return err
+				}
+				if index.Unique {
+					if rowId, ok := pending[string(key)]; ok && rowId != row.RowId {
+						return duplicateEntryError(tableInfo, index, row)
+					}
+					err = l.checkUniqueKey(tableInfo, index, row, key)
+					if err != nil {
+						return err
+					}
+					pending[string(key)] = row.RowId
+				}
+				keys = append(keys, key)
+				values = append(values, codekey.EncodeIndexValue(row.RowId))
 			}
 			//tableInfo.RowsCount++
 		}
 	}
 
-	tableInfoKey := codekey.EncodeKey(common.Separator, common.TableInfoPrefix, tableInfo.TableName)
-	tableInfoValue, err := jsoniter.Marshal(tableInfo)
-	if err != nil {
-		return err
-	}
-	err = l.leveldb.Put(tableInfoKey.Bytes(), tableInfoValue)
-	if err != nil {
-		return err
-	}
-
-	err = l.leveldb.BatchPut(keys, values)
+	//表信息在写入数据时不变 不重新写入 避免所有修改同一张表的事务互相冲突
+	err := l.storage.BatchPut(keys, values)
 	if err != nil {
 		return err
 	}
@@ -235,47 +862,69 @@ func (l *LevelTableOpt) AddRecords(tableInfo *table.MyTableInfo, batchRows []tab
 }
 
 func (l *LevelTableOpt) GetRowByPrimaryField(tableName string, primaryKey []byte) (*table.Row, error) {
+	tableInfo, err := l.GetTableInfo(tableName)
+	if err != nil || tableInfo == nil {
+		errStr := fmt.Sprintf("GetRowByPrimaryField get tableInfo(%s) error %s", tableName, err)
+		return nil, errors.New(errStr)
+	}
+	_, rowId, err := codekey.DecodeRowKey(primaryKey)
+	if err != nil {
+		return nil, err
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	jsoniter := jsoniter.ConfigCompatibleWithStandardLibrary
-
-	var row table.Row
-	value, err := l.leveldb.Get([]byte(primaryKey))
+	value, err := l.storage.Get(primaryKey)
 	if err != nil {
-		leveldbLogger.Errorf("GetRowByPrimaryField error:%s", string(value))
+		leveldbLogger.Errorf("GetRowByPrimaryField error:%s", err)
+		return nil, err
 	}
-	err = jsoniter.Unmarshal(value, &row)
+	//行不存在
+	if value == nil {
+		return nil, nil
+	}
+	row, err := tableInfo.DecodeRow(rowId, value)
 	if err != nil {
 		errStr := fmt.Sprintf("GetRowByPrimaryField error %s", err)
 		return nil, errors.New(errStr)
 	}
-	return &row, nil
+	return row, nil
 }
 
-func (l *LevelTableOpt) GetRowIdByUniqueField(tableName string, uniqueKey []byte) (string, error) {
+func (l *LevelTableOpt) GetRowIdByUniqueField(tableName string, uniqueKey []byte) (uint64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	rowIdByte, err := l.leveldb.Get([]byte(uniqueKey))
+	rowIdByte, err := l.storage.Get(uniqueKey)
+	if err != nil {
+		return 0, err
+	}
 	if rowIdByte == nil {
-		return "", errors.New(string(uniqueKey) + "is not found")
+		return 0, errors.New(fmt.Sprintf("unique key(%x) is not found", uniqueKey))
 	}
-	return string(rowIdByte), err
+	return codekey.DecodeIndexValue(rowIdByte)
 }
 
 func (l *LevelTableOpt) GetRows(tableName string, startKey, endKey []byte) (kv.RowsIterator, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	rowsIter := l.leveldb.NewScanIterator([]byte(startKey), []byte(endKey))
+	rowsIter := l.storage.NewScanIterator(startKey, endKey)
 	return rowsIter, nil
 
 }
 
+func (l *LevelTableOpt) GetRowsReverse(tableName string, startKey, endKey []byte) (kv.RowsIterator, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rowsIter := l.storage.NewReverseScanIterator(startKey, endKey)
+	return rowsIter, nil
+}
+
 func (l *LevelTableOpt) DeleteRecords(tableName string, delKeys [][]byte) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.leveldb.BatchDelete(delKeys)
+	return l.storage.BatchDelete(delKeys)
 }
 
 func (l *LevelTableOpt) ScanLimit(tableName string, limit int) []kv.Pair {
-	return l.leveldb.Scan([]byte{}, []byte{}, limit)
+	return l.storage.Scan([]byte{}, []byte{}, limit)
 }
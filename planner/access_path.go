@@ -0,0 +1,384 @@
+package planner
+
+import (
+	"math"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+//数据源的一种访问方式
+type accessPath struct {
+	index     *table.Index //为nil时读取行数据
+	point     bool         //主键点查
+	rowIds    []uint64     //点查的行号
+	priKey    bool         //行数据的扫描范围由主键条件得到
+	priRanges []rowIdRange //主键条件对应的行号区间
+	idxRange  *indexRange  //索引上的访问条件
+	ranges    []KeyRange   //扫描范围
+	rangeInfo []string     //扫描范围的说明
+	orderCols []string     //扫描结果的有序列
+	covering  bool         //索引包含全部需要的列
+	estRows   float64      //估算扫描的键数
+}
+
+//是否使用了索引上的条件
+func (path *accessPath) indexUsable() bool {
+	return path.index != nil && path.idxRange.usable()
+}
+
+//读取一个键的代价
+func (path *accessPath) rowFactor() float64 {
+	switch {
+	case path.point:
+		return lookupFactor
+	case path.index == nil:
+		return scanFactor
+	case path.covering:
+		return indexFactor
+	}
+	return indexFactor + lookupFactor
+}
+
+//按行号扫描时结果的有序列 只有数字主键的值和行号一致
+func priKeyOrder(tableInfo *table.MyTableInfo) []string {
+	priKey := tableInfo.PriKey
+	if priKey == nil || !types.IsTypeNumeric(priKey.MysqlType.Tp) {
+		return nil
+	}
+	return []string{priKey.Name}
+}
+
+//扫描索引时结果的有序列 跳过等值前缀 索引值相同时按行号排序
+func indexOrder(tableInfo *table.MyTableInfo, index *table.Index, eqCount int) []string {
+	names := make([]string, 0, len(index.Columns)-eqCount+1)
+	names = append(names, index.Columns[eqCount:]...)
+	return append(names, priKeyOrder(tableInfo)...)
+}
+
+//扫描顺序能否满足排序要求 columns为扫描结果的有序列 fixed中的列在结果中只有一个值可以忽略
+//第二个返回值表示是否需要逆序扫描
+func orderMatched(items []*ByItem, columns []string, fixed map[string]bool) (bool, bool) {
+	matched, desc, first := 0, false, true
+	for _, item := range items {
+		column, ok := item.Expr.(*expression.Column)
+		if !ok {
+			return false, false
+		}
+		if fixed[column.Name] {
+			continue
+		}
+		if matched >= len(columns) || columns[matched] != column.Name {
+			return false, false
+		}
+		if first {
+			desc, first = item.Desc, false
+		} else if item.Desc != desc {
+			return false, false
+		}
+		matched++
+	}
+	return true, desc
+}
+
+//列的值能否由索引键还原 由索引键得到的值和行数据中的值相同
+func coverable(column *table.Column) bool {
+	tp := column.MysqlType.Tp
+	return types.IsString(tp) || (types.IsTypeNumeric(tp) && tp != mysql.TypeBit)
+}
+
+//索引和主键是否包含全部需要读出的列
+//加锁时需要回表读取加锁后的最新行
+func (ds *DataSource) coveredBy(index *table.Index) bool {
+	if ds.UsedColumns == nil || ds.Lock != ast.SelectLockNone {
+		return false
+	}
+	covered := make(map[string]bool)
+	for _, name := range append(append([]string{}, index.Columns...), priKeyOrder(ds.Table)...) {
+		covered[name] = true
+	}
+	for i, used := range ds.UsedColumns {
+		column := ds.Table.Columns[i]
+		if used && (!covered[column.Name] || !coverable(column)) {
+			return false
+		}
+	}
+	return true
+}
+
+//全部候选访问路径 依次为主键 索引和全表扫描
+func (ds *DataSource) accessPaths(wheres []*table.Where) ([]*accessPath, error) {
+	tableId := ds.Table.TableId
+	var paths []*accessPath
+	priRanges, usePriKey, err := priKeyRanges(ds.Table, wheres)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case usePriKey && isPointRanges(priRanges):
+		path := &accessPath{point: true, priKey: true}
+		for _, r := range priRanges {
+			path.rowIds = append(path.rowIds, r.low)
+		}
+		paths = append(paths, path)
+	case usePriKey:
+		paths = append(paths, &accessPath{
+			priKey:    true,
+			priRanges: priRanges,
+			ranges:    rowKeyRanges(tableId, priRanges),
+			rangeInfo: rowIdRangeInfo(priRanges),
+			orderCols: priKeyOrder(ds.Table),
+		})
+	}
+	for _, index := range ds.Table.PublicIndexList() {
+		idxRange, err := buildIndexRange(ds.Table, index, wheres)
+		if err != nil {
+			return nil, err
+		}
+		path := &accessPath{
+			index:     index,
+			idxRange:  idxRange,
+			orderCols: indexOrder(ds.Table, index, len(idxRange.eqValues)),
+			covering:  ds.coveredBy(index),
+		}
+		if idxRange.usable() {
+			path.ranges, err = idxRange.keyRanges(tableId, index.Id)
+			if err != nil {
+				return nil, err
+			}
+			path.rangeInfo = idxRange.descriptions()
+		} else {
+			path.ranges = fullIndexRange(tableId, index.Id)
+			path.rangeInfo = []string{"[NULL,+inf]"}
+		}
+		paths = append(paths, path)
+	}
+	paths = append(paths, &accessPath{ranges: fullTableRange(tableId), rangeInfo: []string{"[-inf,+inf]"}, orderCols: priKeyOrder(ds.Table)})
+	for _, path := range paths {
+		path.estRows = ds.estimateRows(path)
+	}
+	return paths, nil
+}
+
+//数据源的物理计划 有统计信息时按代价选择访问路径 否则按规则选择
+func (ds *DataSource) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	wheres := accessConditions(ds.Conditions)
+	//有等值条件的列在结果中只有一个值 排序时可以忽略
+	fixed := fixedColumns(wheres, ds.Table)
+	paths, err := ds.accessPaths(wheres)
+	if err != nil {
+		return nil, false, err
+	}
+	//过滤后的行数不超过任何一条路径扫描的行数
+	outRows := float64(ds.RowsCount)
+	for _, path := range paths {
+		outRows = math.Min(outRows, path.estRows)
+	}
+	var best *accessPath
+	if ds.Stats == nil {
+		best = ds.ruleBasedPath(paths, prop, fixed)
+	} else {
+		best = ds.costBasedPath(paths, prop, fixed, outRows)
+	}
+	ordered, desc := orderMatched(prop.ByItems, best.orderCols, fixed)
+	return ds.pathPlan(best, desc, outRows, ds.scanCost(best, prop, ordered, outRows)), ordered, nil
+}
+
+//没有统计信息时的规则
+//主键单点 -> 有等值前缀的索引(没有主键条件时也可以只有范围条件) -> 主键范围 -> 全表扫描
+//全表扫描不满足排序要求且有limit时 按排序顺序扫描整个索引 取到足够的行即可结束
+func (ds *DataSource) ruleBasedPath(paths []*accessPath, prop *requiredProp, fixed map[string]bool) *accessPath {
+	var priKeyPath, indexPath, tablePath *accessPath
+	for _, path := range paths {
+		switch {
+		case path.point:
+			return path
+		case path.priKey:
+			priKeyPath = path
+		case path.indexUsable():
+			//等值前缀越长越好 相同时有范围条件的优先 再相同时唯一索引优先
+			if indexPath == nil {
+				indexPath = path
+				break
+			}
+			cmp := path.idxRange.compare(indexPath.idxRange)
+			if cmp > 0 || (cmp == 0 && path.index.Unique && !indexPath.index.Unique) {
+				indexPath = path
+			}
+		case path.index == nil:
+			tablePath = path
+		}
+	}
+	if indexPath != nil && (len(indexPath.idxRange.eqValues) > 0 || priKeyPath == nil) {
+		return indexPath
+	}
+	if priKeyPath != nil {
+		return priKeyPath
+	}
+	if ordered, _ := orderMatched(prop.ByItems, tablePath.orderCols, fixed); !ordered && len(prop.ByItems) > 0 && prop.Limit > 0 {
+		for _, path := range paths {
+			if path.index == nil {
+				continue
+			}
+			if ordered, _ := orderMatched(prop.ByItems, path.orderCols, fixed); ordered {
+				return path
+			}
+		}
+	}
+	return tablePath
+}
+
+//选择代价最小的访问路径 代价相同时按候选顺序选择
+func (ds *DataSource) costBasedPath(paths []*accessPath, prop *requiredProp, fixed map[string]bool, outRows float64) *accessPath {
+	var best *accessPath
+	bestCost := math.MaxFloat64
+	for _, path := range paths {
+		ordered, _ := orderMatched(prop.ByItems, path.orderCols, fixed)
+		cost := ds.scanCost(path, prop, ordered, outRows)
+		if len(prop.ByItems) > 0 && !ordered {
+			cost += sortCost(outRows, prop.Limit)
+		}
+		if cost < bestCost {
+			best, bestCost = path, cost
+		}
+	}
+	return best
+}
+
+//扫描的代价 结果顺序满足要求且有limit时 取到足够的行即可结束
+func (ds *DataSource) scanCost(path *accessPath, prop *requiredProp, ordered bool, outRows float64) float64 {
+	scanned := path.estRows
+	if prop.Limit > 0 && ordered && outRows > 0 {
+		scanned = math.Min(scanned, float64(prop.Limit)*path.estRows/outRows)
+	}
+	return scanned * path.rowFactor()
+}
+
+//访问路径对应的物理计划
+func (ds *DataSource) pathPlan(path *accessPath, desc bool, rows, cost float64) PhysicalPlan {
+	base := newBasePhysicalPlan(ds.schema, nil, rows, cost)
+	switch {
+	case path.point:
+		plan := &PhysicalPointGet{Table: ds.Table, RowIds: path.rowIds, Conditions: ds.Conditions, Lock: ds.Lock}
+		plan.basePhysicalPlan = base
+		return plan
+	case path.index == nil:
+		plan := &PhysicalTableScan{Table: ds.Table, Ranges: path.ranges, RangeInfo: path.rangeInfo, Desc: desc, Conditions: ds.Conditions, Lock: ds.Lock}
+		plan.basePhysicalPlan = base
+		return plan
+	}
+	plan := &PhysicalIndexScan{
+		Table:      ds.Table,
+		Index:      path.index,
+		Ranges:     path.ranges,
+		RangeInfo:  path.rangeInfo,
+		Desc:       desc,
+		Covering:   path.covering,
+		Conditions: ds.Conditions,
+		Lock:       ds.Lock,
+	}
+	plan.basePhysicalPlan = base
+	return plan
+}
+
+//行号区间的说明
+func rowIdRangeInfo(ranges []rowIdRange) []string {
+	descs := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		descs = append(descs, r.String())
+	}
+	return descs
+}
+
+//聚合函数的结果能否由表的行数或主键和索引的一端得到
+func (ds *DataSource) metaSource(aggFunc *expression.AggFunc) (*MetaSource, bool) {
+	if len(aggFunc.Args) != 1 {
+		return nil, false
+	}
+	switch aggFunc.Name {
+	case ast.AggFuncCount:
+		constant, ok := aggFunc.Args[0].(*expression.Constant)
+		if !ok || constant.Value.IsNull() || aggFunc.Distinct {
+			return nil, false
+		}
+		return &MetaSource{}, true
+	case ast.AggFuncMin, ast.AggFuncMax:
+		column, ok := aggFunc.Args[0].(*expression.Column)
+		if !ok || column.Info == nil {
+			return nil, false
+		}
+		source := &MetaSource{Column: column.Info, Max: aggFunc.Name == ast.AggFuncMax}
+		if priKey := priKeyOrder(ds.Table); len(priKey) > 0 && priKey[0] == column.Name {
+			return source, true
+		}
+		for _, index := range ds.Table.PublicIndexList() {
+			if index.Columns[0] == column.Name {
+				source.Index = index
+				return source, true
+			}
+		}
+	}
+	return nil, false
+}
+
+//索引中NULL最小 MIN和MAX从第一个非NULL值开始扫描
+func MetaSourceRange(tableInfo *table.MyTableInfo, source *MetaSource) (KeyRange, error) {
+	if source.Index == nil {
+		return fullTableRange(tableInfo.TableId)[0], nil
+	}
+	startKey, err := codekey.EncodeIndexSeekKey(tableInfo.TableId, source.Index.Id, types.MinNotNullDatum())
+	if err != nil {
+		return KeyRange{}, err
+	}
+	return KeyRange{StartKey: startKey, EndKey: codekey.PrefixNext(codekey.EncodeIndexPrefix(tableInfo.TableId, source.Index.Id))}, nil
+}
+
+//估算访问路径扫描的键数 有直方图时按扫描范围估算 否则使用默认选择率
+func (ds *DataSource) estimateRows(path *accessPath) float64 {
+	if path.point {
+		return float64(len(path.rowIds))
+	}
+	rows := float64(ds.RowsCount)
+	if ds.Stats != nil {
+		hist := ds.Stats.Rows
+		if path.index != nil {
+			hist = ds.Stats.Indices[path.index.Id]
+		}
+		if hist != nil && hist.TotalCount() > 0 {
+			count := 0.0
+			for _, r := range path.ranges {
+				count += hist.RangeCount(r.StartKey, r.EndKey)
+			}
+			return math.Min(ds.Stats.Scale(count, ds.RowsCount), rows)
+		}
+	}
+	return ds.pseudoRows(path)
+}
+
+//没有统计信息时的估算 每个等值条件保留1/pseudoEqualRate 每个范围保留1/pseudoRangeRate
+func (ds *DataSource) pseudoRows(path *accessPath) float64 {
+	rows := float64(ds.RowsCount)
+	switch {
+	case path.priKey:
+		count := 0.0
+		for _, r := range path.priRanges {
+			count += math.Min(float64(r.high-r.low)+1, rows/pseudoRangeRate)
+		}
+		return math.Min(count, rows)
+	case path.index == nil || !path.idxRange.usable():
+		return rows
+	}
+	count := rows / math.Pow(pseudoEqualRate, float64(len(path.idxRange.eqValues)))
+	if len(path.idxRange.ranges) > 0 {
+		count = count * float64(len(path.idxRange.ranges)) / pseudoRangeRate
+	}
+	if path.index.Unique && len(path.idxRange.eqValues) == len(path.index.Columns) {
+		count = math.Min(count, 1)
+	}
+	return math.Min(count, rows)
+}
@@ -0,0 +1,49 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+)
+
+//不返回结果集的计划
+type baseCommandPlan struct{}
+
+func (p *baseCommandPlan) Schema() *expression.Schema {
+	return &expression.Schema{}
+}
+
+//插入 值均为常量表达式
+type Insert struct {
+	baseCommandPlan
+	Table   *table.MyTableInfo
+	Columns []int //插入列在表中的位置
+	Lists   [][]expression.Expression
+}
+
+//更新的列和新值 新值在旧的整行数据上求值
+type Assignment struct {
+	Column *table.Column
+	Offset int //列在表中的位置
+	Expr   expression.Expression
+}
+
+//更新 SelectPlan输出需要更新的整行数据
+type Update struct {
+	baseCommandPlan
+	Table       *table.MyTableInfo
+	Assignments []*Assignment
+	SelectPlan  PhysicalPlan
+}
+
+//删除 SelectPlan输出需要删除的整行数据
+type Delete struct {
+	baseCommandPlan
+	Table      *table.MyTableInfo
+	SelectPlan PhysicalPlan
+}
+
+//收集表的统计信息
+type Analyze struct {
+	baseCommandPlan
+	Tables []*table.MyTableInfo
+}
@@ -0,0 +1,274 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+)
+
+//EXPLAIN 计划树按先序展开 每个算子一行
+type Explain struct {
+	TargetPlan Plan //查询 更新或删除的计划
+	Analyze    bool //执行语句并记录每个算子的实际行数和耗时
+	Rows       []*ExplainRow
+	schema     *expression.Schema
+}
+
+//EXPLAIN结果中的一行
+type ExplainRow struct {
+	ID      string       //带树形缩进的算子名称
+	Plan    PhysicalPlan //为nil时为更新或删除本身
+	EstRows float64      //估算的输出行数
+	Info    string       //扫描范围 使用的索引 条件等
+}
+
+func (e *Explain) Schema() *expression.Schema {
+	return e.schema
+}
+
+func (b *planBuilder) buildExplain(stmt *ast.ExplainStmt) (Plan, error) {
+	switch x := stmt.Stmt.(type) {
+	case *ast.ShowStmt:
+		//DESCRIBE
+		return b.buildShow(x)
+	case *ast.SelectStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+	default:
+		errStr := fmt.Sprintf("explain sql type(%T) no support", stmt.Stmt)
+		return nil, errors.New(errStr)
+	}
+	target, err := Optimize(b.tableOpt, stmt.Stmt)
+	if err != nil {
+		return nil, err
+	}
+	e := &Explain{TargetPlan: target, Analyze: stmt.Analyze}
+	names := []string{"id", "estRows"}
+	if stmt.Analyze {
+		names = append(names, "actRows", "time")
+	}
+	names = append(names, "operator info")
+	e.schema = &expression.Schema{Columns: make([]*expression.SchemaColumn, 0, len(names))}
+	for _, name := range names {
+		e.schema.Columns = append(e.schema.Columns, &expression.SchemaColumn{
+			Name: name,
+			Info: &table.Column{Name: name, MysqlType: field_types.NewFieldType(mysql.TypeVarchar)},
+		})
+	}
+
+	switch x := target.(type) {
+	case *Update:
+		assignments := make([]string, 0, len(x.Assignments))
+		for _, assignment := range x.Assignments {
+			assignments = append(assignments, assignment.Column.Name+"="+assignment.Expr.String())
+		}
+		info := fmt.Sprintf("table:%s, set:%s", x.Table.TableName, strings.Join(assignments, ", "))
+		e.Rows = append(e.Rows, &ExplainRow{ID: "Update", EstRows: x.SelectPlan.StatsCount(), Info: info})
+		e.explainPlan(x.SelectPlan, "", true, false)
+	case *Delete:
+		info := fmt.Sprintf("table:%s", x.Table.TableName)
+		e.Rows = append(e.Rows, &ExplainRow{ID: "Delete", EstRows: x.SelectPlan.StatsCount(), Info: info})
+		e.explainPlan(x.SelectPlan, "", true, false)
+	case PhysicalPlan:
+		e.explainPlan(x, "", true, true)
+	}
+	return e, nil
+}
+
+//展开计划树 indent为上层的缩进 last表示是否为父节点的最后一个子节点
+func (e *Explain) explainPlan(p PhysicalPlan, indent string, last, root bool) {
+	id, childIndent := explainName(p), indent
+	if !root {
+		if last {
+			id, childIndent = indent+"└─"+id, indent+"  "
+		} else {
+			id, childIndent = indent+"├─"+id, indent+"│ "
+		}
+	}
+	e.Rows = append(e.Rows, &ExplainRow{ID: id, Plan: p, EstRows: p.StatsCount(), Info: p.ExplainInfo()})
+	children := p.Children()
+	for i, child := range children {
+		e.explainPlan(child, childIndent, i == len(children)-1, false)
+	}
+}
+
+//算子名称
+func explainName(p PhysicalPlan) string {
+	switch p.(type) {
+	case *PhysicalPointGet:
+		return "PointGet"
+	case *PhysicalTableScan:
+		return "TableScan"
+	case *PhysicalIndexScan:
+		return "IndexScan"
+	case *PhysicalNestedLoopJoin:
+		return "NestedLoopJoin"
+	case *PhysicalHashJoin:
+		return "HashJoin"
+	case *PhysicalIndexJoin:
+		return "IndexJoin"
+	case *PhysicalSelection:
+		return "Selection"
+	case *PhysicalHashAgg:
+		return "HashAgg"
+	case *PhysicalMetaAgg:
+		return "MetaAgg"
+	case *PhysicalSort:
+		return "Sort"
+	case *PhysicalTopN:
+		return "TopN"
+	case *PhysicalLimit:
+		return "Limit"
+	case *PhysicalProjection:
+		return "Projection"
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+func exprsString(exprs []expression.Expression) string {
+	strs := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		strs = append(strs, expr.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+func byItemsString(byItems []*ByItem) string {
+	strs := make([]string, 0, len(byItems))
+	for _, item := range byItems {
+		if item.Desc {
+			strs = append(strs, item.Expr.String()+" desc")
+		} else {
+			strs = append(strs, item.Expr.String())
+		}
+	}
+	return strings.Join(strs, ", ")
+}
+
+func aggFuncsString(aggFuncs []*expression.AggFunc) string {
+	strs := make([]string, 0, len(aggFuncs))
+	for _, aggFunc := range aggFuncs {
+		strs = append(strs, aggFunc.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+//扫描的说明 下推的过滤条件放在最后
+func scanInfo(infos []string, conds []expression.Expression) string {
+	if len(conds) > 0 {
+		infos = append(infos, "cond:["+exprsString(conds)+"]")
+	}
+	return strings.Join(infos, ", ")
+}
+
+//读取时加锁的说明
+func lockInfo(infos []string, lock ast.SelectLockType) []string {
+	if lock == ast.SelectLockNone {
+		return infos
+	}
+	return append(infos, "lock:"+lock.String())
+}
+
+func (p *PhysicalPointGet) ExplainInfo() string {
+	handles := make([]string, 0, len(p.RowIds))
+	for _, rowId := range p.RowIds {
+		handles = append(handles, fmt.Sprint(rowId))
+	}
+	infos := []string{"table:" + p.Table.TableName, "handle:[" + strings.Join(handles, ", ") + "]"}
+	return scanInfo(lockInfo(infos, p.Lock), p.Conditions)
+}
+
+func (p *PhysicalTableScan) ExplainInfo() string {
+	infos := []string{"table:" + p.Table.TableName, "range:" + strings.Join(p.RangeInfo, ", ")}
+	if p.Desc {
+		infos = append(infos, "desc")
+	}
+	return scanInfo(lockInfo(infos, p.Lock), p.Conditions)
+}
+
+func (p *PhysicalIndexScan) ExplainInfo() string {
+	infos := []string{
+		"table:" + p.Table.TableName,
+		fmt.Sprintf("index:%s(%s)", p.Index.Name, strings.Join(p.Index.Columns, ", ")),
+		"range:" + strings.Join(p.RangeInfo, ", "),
+	}
+	if p.Desc {
+		infos = append(infos, "desc")
+	}
+	//覆盖索引不需要按行号回表
+	if p.Covering {
+		infos = append(infos, "covering")
+	} else {
+		infos = append(infos, "lookup")
+	}
+	return scanInfo(lockInfo(infos, p.Lock), p.Conditions)
+}
+
+//连接的说明 内侧为查找匹配行的一侧
+func (p *basePhysicalJoin) joinInfo() string {
+	infos := []string{p.JoinType.String()}
+	if p.InnerIdx == 0 {
+		infos = append(infos, "inner:left")
+	} else {
+		infos = append(infos, "inner:right")
+	}
+	if len(p.EqualConditions) > 0 {
+		exprs := make([]expression.Expression, 0, len(p.EqualConditions))
+		for _, eq := range p.EqualConditions {
+			exprs = append(exprs, eq)
+		}
+		infos = append(infos, "equal:["+exprsString(exprs)+"]")
+	}
+	if len(p.OtherConditions) > 0 {
+		infos = append(infos, "other cond:["+exprsString(p.OtherConditions)+"]")
+	}
+	return strings.Join(infos, ", ")
+}
+
+func (p *PhysicalNestedLoopJoin) ExplainInfo() string {
+	return p.joinInfo()
+}
+
+func (p *PhysicalHashJoin) ExplainInfo() string {
+	return p.joinInfo()
+}
+
+func (p *PhysicalIndexJoin) ExplainInfo() string {
+	return p.joinInfo()
+}
+
+func (p *PhysicalSelection) ExplainInfo() string {
+	return exprsString(p.Conditions)
+}
+
+func (p *PhysicalHashAgg) ExplainInfo() string {
+	if len(p.GroupBy) == 0 {
+		return "funcs:" + aggFuncsString(p.AggFuncs)
+	}
+	return fmt.Sprintf("group by:%s, funcs:%s", exprsString(p.GroupBy), aggFuncsString(p.AggFuncs))
+}
+
+func (p *PhysicalMetaAgg) ExplainInfo() string {
+	return fmt.Sprintf("table:%s, funcs:%s", p.Table.TableName, aggFuncsString(p.AggFuncs))
+}
+
+func (p *PhysicalSort) ExplainInfo() string {
+	return byItemsString(p.ByItems)
+}
+
+func (p *PhysicalTopN) ExplainInfo() string {
+	return fmt.Sprintf("%s, offset:%d, count:%d", byItemsString(p.ByItems), p.Offset, p.Count)
+}
+
+func (p *PhysicalLimit) ExplainInfo() string {
+	return fmt.Sprintf("offset:%d, count:%d", p.Offset, p.Count)
+}
+
+func (p *PhysicalProjection) ExplainInfo() string {
+	return exprsString(p.Exprs)
+}
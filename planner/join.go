@@ -0,0 +1,276 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+)
+
+//两个子节点的物理计划 代价包括两侧子节点的代价
+func newJoinBasePhysicalPlan(schema *expression.Schema, left, right PhysicalPlan, statsCount, cost float64) basePhysicalPlan {
+	return basePhysicalPlan{
+		schema:     schema,
+		children:   []PhysicalPlan{left, right},
+		statsCount: statsCount,
+		cost:       cost + left.Cost() + right.Cost(),
+	}
+}
+
+//等值条件两侧的列能否按值查找 数字之间和字符串之间比较时 相等的值转换后相同
+func keyComparable(l, r *expression.Column) bool {
+	if l.Info == nil || r.Info == nil {
+		return false
+	}
+	ltp, rtp := l.Info.MysqlType.Tp, r.Info.MysqlType.Tp
+	if types.IsString(ltp) && types.IsString(rtp) {
+		return true
+	}
+	numeric := func(tp byte) bool {
+		return types.IsTypeNumeric(tp) && tp != mysql.TypeBit
+	}
+	return numeric(ltp) && numeric(rtp)
+}
+
+//可以用于查找的等值条件 返回两侧的列 位置按各自子节点的行计算
+func (p *LogicalJoin) joinKeys() ([]*expression.Column, []*expression.Column) {
+	nLeft := len(p.children[0].Schema().Columns)
+	var leftKeys, rightKeys []*expression.Column
+	for _, eq := range p.EqualConditions {
+		l, r := eq.Args[0].(*expression.Column), eq.Args[1].(*expression.Column)
+		if !keyComparable(l, r) {
+			continue
+		}
+		leftKeys = append(leftKeys, l)
+		rightKeys = append(rightKeys, expression.ShiftColumns(r, -nLeft).(*expression.Column))
+	}
+	return leftKeys, rightKeys
+}
+
+//估算连接的行数 有等值条件时按行数多的一侧每一行最多匹配另一侧的一行估算
+//外连接的行数不少于保留一侧的行数 半连接按过滤左侧的行估算
+func (p *LogicalJoin) estimateRows(leftRows, rightRows float64) float64 {
+	if p.JoinType.isSemi() {
+		return leftRows * selectionFactor
+	}
+	rows := leftRows * rightRows
+	if len(p.EqualConditions) > 0 {
+		rows /= math.Max(math.Max(leftRows, rightRows), 1)
+	}
+	if len(p.OtherConditions) > 0 {
+		rows *= selectionFactor
+	}
+	switch p.JoinType {
+	case LeftOuterJoin:
+		rows = math.Max(rows, leftRows)
+	case RightOuterJoin:
+		rows = math.Max(rows, rightRows)
+	}
+	return rows
+}
+
+//可以作为内侧的子节点 外连接中只有不保留的一侧可以作为内侧 半连接的内侧为子查询
+func (p *LogicalJoin) innerCandidates() []int {
+	switch p.JoinType {
+	case LeftOuterJoin, SemiJoin, AntiSemiJoin:
+		return []int{1}
+	case RightOuterJoin:
+		return []int{0}
+	}
+	return []int{0, 1}
+}
+
+//连接的物理计划 候选为嵌套循环连接 哈希连接和索引连接 选择代价最小的
+//连接不保证结果的顺序
+func (p *LogicalJoin) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	left, _, err := p.children[0].toPhysical(&requiredProp{})
+	if err != nil {
+		return nil, false, err
+	}
+	right, _, err := p.children[1].toPhysical(&requiredProp{})
+	if err != nil {
+		return nil, false, err
+	}
+	leftKeys, rightKeys := p.joinKeys()
+	rows := p.estimateRows(left.StatsCount(), right.StatsCount())
+	children := []PhysicalPlan{left, right}
+	var best PhysicalPlan
+	for _, innerIdx := range p.innerCandidates() {
+		base := basePhysicalJoin{
+			JoinType:        p.JoinType,
+			InnerIdx:        innerIdx,
+			LeftKeys:        leftKeys,
+			RightKeys:       rightKeys,
+			EqualConditions: p.EqualConditions,
+			OtherConditions: p.OtherConditions,
+		}
+		outer, inner := children[1-innerIdx], children[innerIdx]
+		var candidates []PhysicalPlan
+		if len(leftKeys) > 0 {
+			//建哈希表的代价高于查找
+			hashJoin := &PhysicalHashJoin{basePhysicalJoin: base}
+			hashJoin.basePhysicalPlan = newJoinBasePhysicalPlan(p.schema, left, right, rows, (2*inner.StatsCount()+outer.StatsCount())*cpuFactor)
+			candidates = append(candidates, hashJoin)
+			if indexJoin := p.indexJoin(base, outer, rows); indexJoin != nil {
+				candidates = append(candidates, indexJoin)
+			}
+		}
+		nestedLoopJoin := &PhysicalNestedLoopJoin{basePhysicalJoin: base}
+		nestedLoopJoin.basePhysicalPlan = newJoinBasePhysicalPlan(p.schema, left, right, rows, outer.StatsCount()*inner.StatsCount()*cpuFactor)
+		candidates = append(candidates, nestedLoopJoin)
+		for _, plan := range candidates {
+			if best == nil || plan.Cost() < best.Cost() {
+				best = plan
+			}
+		}
+	}
+	return best, len(prop.ByItems) == 0, nil
+}
+
+//内侧为数据源且等值条件中的列为数字主键或者索引的前缀时 可以使用索引连接
+//外侧的每一行查找一次 内侧子节点替换为查找使用的扫描
+func (p *LogicalJoin) indexJoin(base basePhysicalJoin, outer PhysicalPlan, rows float64) *PhysicalIndexJoin {
+	ds, ok := p.children[base.InnerIdx].(*DataSource)
+	if !ok {
+		return nil
+	}
+	index, positions := ds.lookupPath(base.InnerKeys())
+	if positions == nil {
+		return nil
+	}
+	//只保留用于查找的列 按主键或索引列的顺序排列
+	leftKeys := make([]*expression.Column, 0, len(positions))
+	rightKeys := make([]*expression.Column, 0, len(positions))
+	for _, pos := range positions {
+		leftKeys = append(leftKeys, base.LeftKeys[pos])
+		rightKeys = append(rightKeys, base.RightKeys[pos])
+	}
+	base.LeftKeys, base.RightKeys = leftKeys, rightKeys
+
+	//外侧列在输出行中的名称
+	outerOffset := 0
+	if base.InnerIdx == 0 {
+		outerOffset = len(p.children[0].Schema().Columns)
+	}
+	names := make([]string, 0, len(positions))
+	for _, key := range base.OuterKeys() {
+		column := p.schema.Columns[key.Offset+outerOffset]
+		names = append(names, column.TableName+"."+column.Name)
+	}
+	rangeInfo := []string{"decided by [" + strings.Join(names, ", ") + "]"}
+
+	rowsPerKey := ds.lookupRows(index, len(positions))
+	var inner PhysicalPlan
+	if index == nil {
+		plan := &PhysicalTableScan{Table: ds.Table, RangeInfo: rangeInfo, Conditions: ds.Conditions, Lock: ds.Lock}
+		plan.basePhysicalPlan = newBasePhysicalPlan(ds.schema, nil, rowsPerKey, lookupFactor)
+		inner = plan
+	} else {
+		plan := &PhysicalIndexScan{Table: ds.Table, Index: index, RangeInfo: rangeInfo, Conditions: ds.Conditions, Lock: ds.Lock}
+		plan.basePhysicalPlan = newBasePhysicalPlan(ds.schema, nil, rowsPerKey, math.Max(rowsPerKey, 1)*(indexFactor+lookupFactor))
+		inner = plan
+	}
+	children := []PhysicalPlan{outer, inner}
+	if base.InnerIdx == 0 {
+		children = []PhysicalPlan{inner, outer}
+	}
+	plan := &PhysicalIndexJoin{basePhysicalJoin: base}
+	//内侧的扫描代价为一次查找的代价 外侧的每一行查找一次
+	plan.basePhysicalPlan = basePhysicalPlan{
+		schema:     p.schema,
+		children:   children,
+		statsCount: rows,
+		cost:       outer.Cost() + outer.StatsCount()*inner.Cost(),
+	}
+	return plan
+}
+
+//按keys中的列查找时使用的主键或索引 返回nil的索引表示使用数字主键
+//第二个返回值为用于查找的列在keys中的位置 没有可用的主键和索引时为nil
+//主键优先 其次为匹配前缀最长的索引 相同时唯一索引优先
+func (ds *DataSource) lookupPath(keys []*expression.Column) (*table.Index, []int) {
+	position := func(name string) int {
+		for i, key := range keys {
+			if key.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	if priKey := priKeyOrder(ds.Table); len(priKey) > 0 {
+		if pos := position(priKey[0]); pos >= 0 {
+			return nil, []int{pos}
+		}
+	}
+	var best *table.Index
+	var bestPositions []int
+	for _, index := range ds.Table.PublicIndexList() {
+		var positions []int
+		for _, name := range index.Columns {
+			pos := position(name)
+			if pos < 0 {
+				break
+			}
+			positions = append(positions, pos)
+		}
+		if len(positions) == 0 {
+			continue
+		}
+		if len(positions) > len(bestPositions) || (len(positions) == len(bestPositions) && index.Unique && !best.Unique) {
+			best, bestPositions = index, positions
+		}
+	}
+	return best, bestPositions
+}
+
+//每次查找估算得到的行数 n为使用的索引列数
+func (ds *DataSource) lookupRows(index *table.Index, n int) float64 {
+	rows := float64(ds.RowsCount)
+	if index == nil || (index.Unique && n == len(index.Columns)) {
+		return math.Min(rows, 1)
+	}
+	if ds.Stats != nil && n == len(index.Columns) {
+		if hist := ds.Stats.Indices[index.Id]; hist != nil && hist.TotalCount() > 0 {
+			return math.Min(ds.Stats.Scale(hist.AvgCount(), ds.RowsCount), rows)
+		}
+	}
+	return rows / math.Pow(pseudoEqualRate, float64(n))
+}
+
+//外侧一行的查找范围 values为外侧用于查找的列的值 有NULL时没有匹配的行
+//值转换为内侧列的类型 有损失时得到的行不满足等值条件 由执行器过滤
+func (p *PhysicalIndexJoin) LookupRanges(values []types.Datum) ([]KeyRange, error) {
+	for _, value := range values {
+		if value.IsNull() {
+			return nil, nil
+		}
+	}
+	innerKeys := p.InnerKeys()
+	wheres := make([]*table.Where, 0, len(values))
+	for i := range values {
+		wheres = append(wheres, &table.Where{Opt: opcode.EQ, LeftColumn: innerKeys[i].Name, RightValue: &values[i]})
+	}
+	switch inner := p.children[p.InnerIdx].(type) {
+	case *PhysicalTableScan:
+		priRanges, ok, err := priKeyRanges(inner.Table, wheres)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return rowKeyRanges(inner.Table.TableId, priRanges), nil
+	case *PhysicalIndexScan:
+		idxRange, err := buildIndexRange(inner.Table, inner.Index, wheres)
+		if err != nil {
+			return nil, err
+		}
+		return idxRange.keyRanges(inner.Table.TableId, inner.Index.Id)
+	}
+	errStr := fmt.Sprintf("index join inner plan(%T) no support", p.children[p.InnerIdx])
+	return nil, errors.New(errStr)
+}
@@ -0,0 +1,162 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/statistics"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+//数据源 对应一张表 下推的过滤条件在读取数据时求值
+type DataSource struct {
+	baseLogicalPlan
+	Table       *table.MyTableInfo
+	RowsCount   uint64                  //表的当前行数
+	Stats       *statistics.Table       //没有收集统计信息时为nil
+	Conditions  []expression.Expression //下推到数据源的过滤条件
+	UsedColumns []bool                  //列裁剪后需要读出的列 按表中列的位置标记
+	Lock        ast.SelectLockType      //读取的行需要加的锁
+}
+
+//连接类型
+type JoinType int
+
+const (
+	InnerJoin      JoinType = iota
+	LeftOuterJoin           //左侧的行都保留 没有匹配时右侧的列为NULL
+	RightOuterJoin          //右侧的行都保留 没有匹配时左侧的列为NULL
+	SemiJoin                //左侧有匹配的行只输出一次 只输出左侧的列 由IN和EXISTS子查询改写得到
+	AntiSemiJoin            //左侧没有匹配的行 只输出左侧的列 由NOT IN和NOT EXISTS子查询改写得到
+)
+
+func (tp JoinType) String() string {
+	switch tp {
+	case LeftOuterJoin:
+		return "left outer join"
+	case RightOuterJoin:
+		return "right outer join"
+	case SemiJoin:
+		return "semi join"
+	case AntiSemiJoin:
+		return "anti semi join"
+	}
+	return "inner join"
+}
+
+//连接 输出行为左侧子节点的列之后接右侧子节点的列 条件中列的位置按输出行计算
+//半连接只输出左侧的列 条件中右侧列的位置同样在左侧的列之后
+//ON和USING中的条件在谓词下推时拆分 只引用一侧的条件尽量下推到子节点
+type LogicalJoin struct {
+	baseLogicalPlan
+	JoinType        JoinType
+	OnConditions    []expression.Expression      //还没有拆分的连接条件
+	EqualConditions []*expression.ScalarFunction //左右两侧列之间的等值条件 第一个参数为左侧的列
+	OtherConditions []expression.Expression      //其余在连接时求值的条件
+}
+
+//过滤
+type LogicalSelection struct {
+	baseLogicalPlan
+	Conditions []expression.Expression
+}
+
+//聚合 输出行为组内第一行的全部列加上聚合函数的结果
+type LogicalAggregation struct {
+	baseLogicalPlan
+	GroupBy      []expression.Expression
+	AggFuncs     []*expression.AggFunc
+	firstRowUsed bool //父节点是否用到组内第一行的列
+}
+
+//排序
+type LogicalSort struct {
+	baseLogicalPlan
+	ByItems []*ByItem
+}
+
+//排序后取前Count行 由LIMIT下推到排序得到
+type LogicalTopN struct {
+	baseLogicalPlan
+	ByItems []*ByItem
+	Offset  uint64
+	Count   uint64
+}
+
+//跳过Offset行后取Count行
+type LogicalLimit struct {
+	baseLogicalPlan
+	Offset uint64
+	Count  uint64
+}
+
+//投影 Schema中为选择列的名称和列信息
+type LogicalProjection struct {
+	baseLogicalPlan
+	Exprs []expression.Expression
+}
+
+func newDataSource(tableInfo *table.MyTableInfo, rowsCount uint64, stats *statistics.Table) *DataSource {
+	ds := &DataSource{Table: tableInfo, RowsCount: rowsCount, Stats: stats}
+	ds.schema = expression.NewTableSchema(tableInfo)
+	return ds
+}
+
+func newLogicalJoin(joinType JoinType, left, right LogicalPlan) *LogicalJoin {
+	p := &LogicalJoin{JoinType: joinType}
+	columns := append([]*expression.SchemaColumn{}, left.Schema().Columns...)
+	if !joinType.isSemi() {
+		columns = append(columns, right.Schema().Columns...)
+	}
+	p.schema = &expression.Schema{Columns: columns}
+	p.SetChildren(left, right)
+	return p
+}
+
+//是否为半连接
+func (tp JoinType) isSemi() bool {
+	return tp == SemiJoin || tp == AntiSemiJoin
+}
+
+func newLogicalSelection(child LogicalPlan, conds []expression.Expression) *LogicalSelection {
+	p := &LogicalSelection{Conditions: conds}
+	p.schema = child.Schema()
+	p.SetChildren(child)
+	return p
+}
+
+//聚合结果的Schema 子节点的列之后为聚合函数的结果
+func newLogicalAggregation(child LogicalPlan, groupBy []expression.Expression, aggFuncs []*expression.AggFunc) *LogicalAggregation {
+	p := &LogicalAggregation{GroupBy: groupBy, AggFuncs: aggFuncs, firstRowUsed: true}
+	schema := &expression.Schema{Columns: append([]*expression.SchemaColumn{}, child.Schema().Columns...)}
+	for _, aggFunc := range aggFuncs {
+		schema.Columns = append(schema.Columns, &expression.SchemaColumn{
+			Name: aggFunc.String(),
+			Info: &table.Column{Name: aggFunc.String(), MysqlType: aggFunc.RetType()},
+		})
+	}
+	p.schema = schema
+	p.SetChildren(child)
+	return p
+}
+
+func newLogicalSort(child LogicalPlan, byItems []*ByItem) *LogicalSort {
+	p := &LogicalSort{ByItems: byItems}
+	p.schema = child.Schema()
+	p.SetChildren(child)
+	return p
+}
+
+func newLogicalLimit(child LogicalPlan, offset, count uint64) *LogicalLimit {
+	p := &LogicalLimit{Offset: offset, Count: count}
+	p.schema = child.Schema()
+	p.SetChildren(child)
+	return p
+}
+
+func newLogicalProjection(child LogicalPlan, exprs []expression.Expression, schema *expression.Schema) *LogicalProjection {
+	p := &LogicalProjection{Exprs: exprs}
+	p.schema = schema
+	p.SetChildren(child)
+	return p
+}
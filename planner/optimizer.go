@@ -0,0 +1,193 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+
+	"github.com/pingcap/parser/ast"
+)
+
+//代价模型中的系数 以顺序读取一行数据为单位
+const (
+	scanFactor   = 1.0 //顺序读取并解码一行数据
+	indexFactor  = 0.5 //顺序读取一个索引项
+	lookupFactor = 4.0 //按行号回表读取一行数据
+	cpuFactor    = 0.1 //过滤 聚合或排序时处理一行数据
+)
+
+//没有统计信息时的默认选择率
+const (
+	pseudoEqualRate = 10  //每个等值条件保留1/10的行
+	pseudoRangeRate = 3   //每个范围保留1/3的行
+	selectionFactor = 0.8 //不能用于索引的过滤条件保留的行
+)
+
+//逻辑优化规则 按顺序作用在逻辑计划上
+var optRules = []func(LogicalPlan) (LogicalPlan, error){
+	predicatePushDown,
+	limitPushDown,
+	columnPruning,
+}
+
+//物理计划需要满足的要求
+type requiredProp struct {
+	ByItems []*ByItem //结果的顺序
+	Limit   uint64    //只需要前Limit行 为0时需要全部结果
+}
+
+//由语法树生成执行计划
+//查询经过逻辑优化后按代价选择物理计划 更新和删除中读取数据的部分同样经过优化
+func Optimize(tableOpt tableOpt.TableOpt, stmt ast.StmtNode) (Plan, error) {
+	builder := &planBuilder{tableOpt: tableOpt}
+	switch x := stmt.(type) {
+	case *ast.SelectStmt:
+		p, err := builder.buildSelect(x)
+		if err != nil {
+			return nil, err
+		}
+		return optimizeLogicalPlan(p)
+	case *ast.UpdateStmt:
+		return builder.buildUpdate(x)
+	case *ast.DeleteStmt:
+		return builder.buildDelete(x)
+	case *ast.InsertStmt:
+		return builder.buildInsert(x)
+	case *ast.AnalyzeTableStmt:
+		return builder.buildAnalyze(x)
+	case *ast.ExplainStmt:
+		return builder.buildExplain(x)
+	case *ast.ShowStmt:
+		return builder.buildShow(x)
+	}
+	errStr := fmt.Sprintf("sql type(%T) no support", stmt)
+	return nil, errors.New(errStr)
+}
+
+func optimizeLogicalPlan(p LogicalPlan) (PhysicalPlan, error) {
+	var err error
+	for _, rule := range optRules {
+		p, err = rule(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	plan, _, err := p.toPhysical(&requiredProp{})
+	return plan, err
+}
+
+//limit需要的行数 跳过的offset行同样需要读取
+func limitRows(offset, count uint64) uint64 {
+	return offset + count
+}
+
+//排序的代价 有limit时只保留前limit行
+func sortCost(rows float64, limit uint64) float64 {
+	n := rows
+	if limit > 0 && float64(limit) < n {
+		n = float64(limit)
+	}
+	return rows * math.Log2(math.Max(n, 2)) * cpuFactor
+}
+
+func (p *LogicalSelection) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	//过滤不改变顺序 但limit不能穿过过滤
+	child, ordered, err := p.children[0].toPhysical(&requiredProp{ByItems: prop.ByItems})
+	if err != nil {
+		return nil, false, err
+	}
+	plan := &PhysicalSelection{Conditions: p.Conditions}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, child.StatsCount()*selectionFactor, child.StatsCount()*cpuFactor)
+	return plan, ordered, nil
+}
+
+func (p *LogicalAggregation) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	ordered := len(prop.ByItems) == 0
+	if plan := p.metaAgg(); plan != nil {
+		return plan, ordered, nil
+	}
+	child, _, err := p.children[0].toPhysical(&requiredProp{})
+	if err != nil {
+		return nil, false, err
+	}
+	rows := child.StatsCount()
+	if len(p.GroupBy) == 0 {
+		rows = 1
+	}
+	plan := &PhysicalHashAgg{GroupBy: p.GroupBy, AggFuncs: p.AggFuncs}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, rows, child.StatsCount()*cpuFactor)
+	return plan, ordered, nil
+}
+
+//没有条件和分组 结果只依赖聚合函数时不扫描数据
+//COUNT(*)使用表的行数 MIN和MAX使用主键或索引的两端 加锁时需要读出每一行
+func (p *LogicalAggregation) metaAgg() *PhysicalMetaAgg {
+	ds, ok := p.children[0].(*DataSource)
+	if !ok || ds.Lock != ast.SelectLockNone || len(ds.Conditions) > 0 || len(p.GroupBy) > 0 || len(p.AggFuncs) == 0 || p.firstRowUsed {
+		return nil
+	}
+	sources := make([]*MetaSource, 0, len(p.AggFuncs))
+	for _, aggFunc := range p.AggFuncs {
+		source, ok := ds.metaSource(aggFunc)
+		if !ok {
+			return nil
+		}
+		sources = append(sources, source)
+	}
+	plan := &PhysicalMetaAgg{Table: ds.Table, AggFuncs: p.AggFuncs, Sources: sources}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, nil, 1, float64(len(sources))*lookupFactor)
+	return plan
+}
+
+func (p *LogicalSort) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	child, ordered, err := p.children[0].toPhysical(&requiredProp{ByItems: p.ByItems})
+	if err != nil {
+		return nil, false, err
+	}
+	//扫描顺序满足排序要求时不需要排序
+	if ordered {
+		return child, len(prop.ByItems) == 0, nil
+	}
+	plan := &PhysicalSort{ByItems: p.ByItems}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, child.StatsCount(), sortCost(child.StatsCount(), 0))
+	return plan, len(prop.ByItems) == 0, nil
+}
+
+func (p *LogicalTopN) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	child, ordered, err := p.children[0].toPhysical(&requiredProp{ByItems: p.ByItems, Limit: limitRows(p.Offset, p.Count)})
+	if err != nil {
+		return nil, false, err
+	}
+	rows := math.Min(child.StatsCount(), float64(p.Count))
+	if ordered {
+		plan := &PhysicalLimit{Offset: p.Offset, Count: p.Count}
+		plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, rows, 0)
+		return plan, len(prop.ByItems) == 0, nil
+	}
+	plan := &PhysicalTopN{ByItems: p.ByItems, Offset: p.Offset, Count: p.Count}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, rows, sortCost(child.StatsCount(), limitRows(p.Offset, p.Count)))
+	return plan, len(prop.ByItems) == 0, nil
+}
+
+func (p *LogicalLimit) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	child, _, err := p.children[0].toPhysical(&requiredProp{Limit: limitRows(p.Offset, p.Count)})
+	if err != nil {
+		return nil, false, err
+	}
+	rows := math.Min(child.StatsCount(), float64(p.Count))
+	plan := &PhysicalLimit{Offset: p.Offset, Count: p.Count}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, rows, 0)
+	return plan, len(prop.ByItems) == 0, nil
+}
+
+func (p *LogicalProjection) toPhysical(prop *requiredProp) (PhysicalPlan, bool, error) {
+	child, _, err := p.children[0].toPhysical(&requiredProp{Limit: prop.Limit})
+	if err != nil {
+		return nil, false, err
+	}
+	plan := &PhysicalProjection{Exprs: p.Exprs}
+	plan.basePhysicalPlan = newBasePhysicalPlan(p.schema, child, child.StatsCount(), child.StatsCount()*cpuFactor)
+	return plan, len(prop.ByItems) == 0, nil
+}
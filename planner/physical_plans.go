@@ -0,0 +1,142 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+)
+
+//按主键点查 RowIds为空表示条件不可能满足
+type PhysicalPointGet struct {
+	basePhysicalPlan
+	Table      *table.MyTableInfo
+	RowIds     []uint64
+	Conditions []expression.Expression //取出整行后的过滤条件
+	Lock       ast.SelectLockType      //读取前给行加锁
+}
+
+//按行键范围扫描表数据
+type PhysicalTableScan struct {
+	basePhysicalPlan
+	Table      *table.MyTableInfo
+	Ranges     []KeyRange
+	RangeInfo  []string //扫描范围的说明 用于EXPLAIN
+	Desc       bool     //从后向前扫描
+	Conditions []expression.Expression
+	Lock       ast.SelectLockType
+}
+
+//扫描索引 不覆盖需要的列时按行号回表读取整行
+type PhysicalIndexScan struct {
+	basePhysicalPlan
+	Table      *table.MyTableInfo
+	Index      *table.Index
+	Ranges     []KeyRange
+	RangeInfo  []string
+	Desc       bool
+	Covering   bool //索引列和主键包含全部需要的列 由索引键得到行数据 其余列为NULL
+	Conditions []expression.Expression
+	Lock       ast.SelectLockType
+}
+
+//连接的公共部分 条件中列的位置按输出行计算 输出行为左侧子节点的列之后接右侧子节点的列
+//外侧的每一行在内侧查找匹配的行 外连接中保留的一侧为外侧
+type basePhysicalJoin struct {
+	JoinType        JoinType
+	InnerIdx        int                          //内侧子节点的位置
+	LeftKeys        []*expression.Column         //用于查找的等值条件中左侧的列 位置按左侧子节点的行计算
+	RightKeys       []*expression.Column         //与LeftKeys一一对应 位置按右侧子节点的行计算
+	EqualConditions []*expression.ScalarFunction //全部等值条件 查找得到的行仍然需要满足
+	OtherConditions []expression.Expression
+}
+
+//外侧用于查找的列
+func (p *basePhysicalJoin) OuterKeys() []*expression.Column {
+	if p.InnerIdx == 0 {
+		return p.RightKeys
+	}
+	return p.LeftKeys
+}
+
+//内侧用于查找的列
+func (p *basePhysicalJoin) InnerKeys() []*expression.Column {
+	if p.InnerIdx == 0 {
+		return p.LeftKeys
+	}
+	return p.RightKeys
+}
+
+//嵌套循环连接 内侧的行读到内存中 和外侧的每一行逐一匹配
+type PhysicalNestedLoopJoin struct {
+	basePhysicalPlan
+	basePhysicalJoin
+}
+
+//哈希连接 内侧的行按等值条件中的列建哈希表 外侧的行按相同的列查找
+type PhysicalHashJoin struct {
+	basePhysicalPlan
+	basePhysicalJoin
+}
+
+//索引连接 外侧的每一行按等值条件的值在内侧表的主键或索引上查找
+//内侧子节点为查找使用的扫描 没有固定的扫描范围 Keys按主键或索引列的顺序排列
+type PhysicalIndexJoin struct {
+	basePhysicalPlan
+	basePhysicalJoin
+}
+
+//过滤
+type PhysicalSelection struct {
+	basePhysicalPlan
+	Conditions []expression.Expression
+}
+
+//哈希聚合
+type PhysicalHashAgg struct {
+	basePhysicalPlan
+	GroupBy  []expression.Expression
+	AggFuncs []*expression.AggFunc
+}
+
+//不扫描数据直接由表的行数和主键或索引的两端得到聚合结果
+type PhysicalMetaAgg struct {
+	basePhysicalPlan
+	Table    *table.MyTableInfo
+	AggFuncs []*expression.AggFunc
+	Sources  []*MetaSource //与聚合函数一一对应
+}
+
+//聚合结果的来源 Column为nil时为表的行数 否则为列在主键或索引一端的非NULL值
+type MetaSource struct {
+	Column *table.Column
+	Index  *table.Index //为nil时使用主键
+	Max    bool
+}
+
+//排序
+type PhysicalSort struct {
+	basePhysicalPlan
+	ByItems []*ByItem
+}
+
+//排序后只保留前Offset+Count行 跳过Offset行后输出
+type PhysicalTopN struct {
+	basePhysicalPlan
+	ByItems []*ByItem
+	Offset  uint64
+	Count   uint64
+}
+
+//跳过Offset行后取Count行
+type PhysicalLimit struct {
+	basePhysicalPlan
+	Offset uint64
+	Count  uint64
+}
+
+//投影 Schema中的列信息即为结果集的列信息
+type PhysicalProjection struct {
+	basePhysicalPlan
+	Exprs []expression.Expression
+}
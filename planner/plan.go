@@ -0,0 +1,104 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+)
+
+//执行计划 行中的值按顺序与Schema中的列一一对应
+type Plan interface {
+	Schema() *expression.Schema
+}
+
+//逻辑计划 描述查询要做什么 由优化规则改写后转换为物理计划
+type LogicalPlan interface {
+	Plan
+	Children() []LogicalPlan
+	SetChildren(children ...LogicalPlan)
+
+	//下推过滤条件 返回留在当前节点之上的条件和改写后的计划
+	PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan)
+	//列裁剪 used为父节点用到的列 按当前节点Schema中的位置标记
+	PruneColumns(used []bool)
+	//转换为满足要求的物理计划 第二个返回值表示结果是否已经按prop排好序
+	toPhysical(prop *requiredProp) (PhysicalPlan, bool, error)
+}
+
+//物理计划 描述查询怎么执行 由执行器按计划树执行
+type PhysicalPlan interface {
+	Plan
+	Children() []PhysicalPlan
+	SetChildren(children ...PhysicalPlan)
+
+	//估算的输出行数
+	StatsCount() float64
+	//估算的执行代价 包括子节点的代价
+	Cost() float64
+	//EXPLAIN中的算子说明
+	ExplainInfo() string
+}
+
+//排序项
+type ByItem struct {
+	Expr expression.Expression
+	Desc bool
+}
+
+//扫描范围[StartKey, EndKey)
+type KeyRange struct {
+	StartKey []byte
+	EndKey   []byte
+}
+
+type baseLogicalPlan struct {
+	schema   *expression.Schema
+	children []LogicalPlan
+}
+
+func (p *baseLogicalPlan) Schema() *expression.Schema {
+	return p.schema
+}
+
+func (p *baseLogicalPlan) Children() []LogicalPlan {
+	return p.children
+}
+
+func (p *baseLogicalPlan) SetChildren(children ...LogicalPlan) {
+	p.children = children
+}
+
+type basePhysicalPlan struct {
+	schema     *expression.Schema
+	children   []PhysicalPlan
+	statsCount float64
+	cost       float64
+}
+
+func (p *basePhysicalPlan) Schema() *expression.Schema {
+	return p.schema
+}
+
+func (p *basePhysicalPlan) Children() []PhysicalPlan {
+	return p.children
+}
+
+func (p *basePhysicalPlan) SetChildren(children ...PhysicalPlan) {
+	p.children = children
+}
+
+func (p *basePhysicalPlan) StatsCount() float64 {
+	return p.statsCount
+}
+
+func (p *basePhysicalPlan) Cost() float64 {
+	return p.cost
+}
+
+//单个子节点的物理计划 输出行数不超过子节点 代价在子节点之上累加
+func newBasePhysicalPlan(schema *expression.Schema, child PhysicalPlan, statsCount, cost float64) basePhysicalPlan {
+	p := basePhysicalPlan{schema: schema, statsCount: statsCount, cost: cost}
+	if child != nil {
+		p.children = []PhysicalPlan{child}
+		p.cost += child.Cost()
+	}
+	return p
+}
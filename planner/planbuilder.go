@@ -0,0 +1,844 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/common/tableOpt"
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/types/parser_driver"
+)
+
+//由语法树构造逻辑计划 表信息和统计信息从tableOpt中读取
+type planBuilder struct {
+	tableOpt tableOpt.TableOpt
+	scopes   []*subqueryScope   //正在构造的各层子查询 外层在前
+	target   *table.MyTableInfo //更新和删除的表 子查询中不能读取
+}
+
+//单表语句中的表名
+func tableNameOf(refs *ast.Join) (*ast.TableName, error) {
+	if refs == nil || refs.Right != nil {
+		return nil, errors.New("only single table is supported")
+	}
+	tableSource, ok := refs.Left.(*ast.TableSource)
+	if !ok {
+		return nil, errors.New("only single table is supported")
+	}
+	tableName, ok := tableSource.Source.(*ast.TableName)
+	if !ok {
+		return nil, errors.New("only single table is supported")
+	}
+	return tableName, nil
+}
+
+//读取表信息 没有指定数据库时为默认数据库
+func (b *planBuilder) tableInfo(name *ast.TableName) (*table.MyTableInfo, error) {
+	if name.Name.L == "" {
+		errStr := fmt.Sprint("parse error:tableName is nil")
+		return nil, errors.New(errStr)
+	}
+	tableName, err := tableOpt.FullTableName(b.tableOpt, name.Schema.L, name.Name.L)
+	if err != nil {
+		return nil, err
+	}
+	//表是否存在
+	ok, err := b.tableOpt.TableExists(tableName)
+	if !ok {
+		return nil, err
+	}
+	tableInfo, err := b.tableOpt.GetTableInfo(tableName)
+	if err != nil {
+		errStr := fmt.Sprintf("get tableinfo error(%s)", err)
+		return nil, errors.New(errStr)
+	}
+	return tableInfo, nil
+}
+
+//单表语句的数据源
+func (b *planBuilder) buildDataSource(refs *ast.Join) (*DataSource, error) {
+	tableName, err := tableNameOf(refs)
+	if err != nil {
+		return nil, err
+	}
+	return b.dataSource(tableName)
+}
+
+//表对应的数据源 同时读取行数和统计信息用于估算代价
+func (b *planBuilder) dataSource(tableName *ast.TableName) (*DataSource, error) {
+	tableInfo, err := b.tableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	//与mysql相同 更新和删除的同时不能在子查询中读取这张表
+	if len(b.scopes) > 0 && b.target != nil && b.target.FullName() == tableInfo.FullName() {
+		errStr := fmt.Sprintf("You can't specify target table '%s' for update in FROM clause", tableName.Name.O)
+		return nil, errors.New(errStr)
+	}
+	tableInfoIds, err := b.tableOpt.GetTableInfoIds(tableInfo.FullName())
+	if err != nil {
+		errStr := fmt.Sprintf("get tableinfoIds error(%s)", err)
+		return nil, errors.New(errStr)
+	}
+	stats, err := b.tableOpt.GetTableStats(tableInfo.FullName())
+	if err != nil {
+		return nil, err
+	}
+	return newDataSource(tableInfo, tableInfoIds.RowsCount, stats), nil
+}
+
+//FROM子句 单表为数据源 多表按连接树构造
+func (b *planBuilder) buildResultSet(node ast.ResultSetNode) (LogicalPlan, error) {
+	switch x := node.(type) {
+	case *ast.Join:
+		if x.Right == nil {
+			return b.buildResultSet(x.Left)
+		}
+		return b.buildJoin(x)
+	case *ast.TableSource:
+		tableName, ok := x.Source.(*ast.TableName)
+		if !ok {
+			errStr := fmt.Sprintf("table source(%T) no support", x.Source)
+			return nil, errors.New(errStr)
+		}
+		ds, err := b.dataSource(tableName)
+		if err != nil {
+			return nil, err
+		}
+		//有别名时只能通过别名引用表中的列
+		if x.AsName.L != "" {
+			for _, column := range ds.schema.Columns {
+				column.TableName = x.AsName.L
+			}
+		}
+		return ds, nil
+	}
+	errStr := fmt.Sprintf("table source(%T) no support", node)
+	return nil, errors.New(errStr)
+}
+
+//连接 右外连接同样保持左右两侧的顺序 由物理计划决定驱动的一侧
+func (b *planBuilder) buildJoin(join *ast.Join) (LogicalPlan, error) {
+	left, err := b.buildResultSet(join.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := b.buildResultSet(join.Right)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool)
+	for _, column := range left.Schema().Columns {
+		tables[column.TableName] = true
+	}
+	for _, column := range right.Schema().Columns {
+		if tables[column.TableName] {
+			errStr := fmt.Sprintf("Not unique table/alias: '%s'", column.TableName)
+			return nil, errors.New(errStr)
+		}
+	}
+	joinType := InnerJoin
+	switch join.Tp {
+	case ast.LeftJoin:
+		joinType = LeftOuterJoin
+	case ast.RightJoin:
+		joinType = RightOuterJoin
+	}
+	p := newLogicalJoin(joinType, left, right)
+	switch {
+	case join.NaturalJoin:
+		err = p.buildUsing(commonColumns(left.Schema(), right.Schema()))
+	case len(join.Using) > 0:
+		names := make([]string, 0, len(join.Using))
+		for _, name := range join.Using {
+			names = append(names, name.Name.L)
+		}
+		err = p.buildUsing(names)
+	case join.On != nil:
+		var cond expression.Expression
+		cond, err = b.buildExpr(join.On.Expr, p.schema, nil)
+		if err == nil {
+			p.OnConditions = expression.SplitConjunction(cond)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+//两侧都有的列 NATURAL JOIN按这些列连接
+func commonColumns(left, right *expression.Schema) []string {
+	rightNames := make(map[string]bool)
+	for _, column := range right.Columns {
+		if !column.Redundant {
+			rightNames[column.Name] = true
+		}
+	}
+	var names []string
+	for _, column := range left.Columns {
+		if !column.Redundant && rightNames[column.Name] {
+			names = append(names, column.Name)
+			delete(rightNames, column.Name)
+		}
+	}
+	return names
+}
+
+//USING中的列转换为两侧列的等值条件 结果中只保留一列
+//内连接和左外连接保留左侧的列 右外连接保留右侧的列
+func (p *LogicalJoin) buildUsing(names []string) error {
+	left, right := p.children[0].Schema(), p.children[1].Schema()
+	for _, name := range names {
+		l, err := usingColumn(left, name)
+		if err != nil {
+			return err
+		}
+		r, err := usingColumn(right, name)
+		if err != nil {
+			return err
+		}
+		r += len(left.Columns)
+		leftColumn, rightColumn := p.schema.Columns[l], p.schema.Columns[r]
+		eq, err := expression.NewFunction(ast.EQ,
+			&expression.Column{Offset: l, Name: leftColumn.Name, Info: leftColumn.Info},
+			&expression.Column{Offset: r, Name: rightColumn.Name, Info: rightColumn.Info})
+		if err != nil {
+			return err
+		}
+		p.OnConditions = append(p.OnConditions, eq)
+		merged := r
+		if p.JoinType == RightOuterJoin {
+			merged = l
+		}
+		column := *p.schema.Columns[merged]
+		column.Redundant = true
+		p.schema.Columns[merged] = &column
+	}
+	return nil
+}
+
+//USING中的列在一侧的位置 这一侧必须恰好有一个同名的列
+func usingColumn(schema *expression.Schema, name string) (int, error) {
+	offset := -1
+	for i, column := range schema.Columns {
+		if column.Redundant || column.Name != name {
+			continue
+		}
+		if offset >= 0 {
+			errStr := fmt.Sprintf("Column '%s' in from clause is ambiguous", name)
+			return -1, errors.New(errStr)
+		}
+		offset = i
+	}
+	if offset < 0 {
+		errStr := fmt.Sprintf("Unknown column '%s' in 'from clause'", name)
+		return -1, errors.New(errStr)
+	}
+	return offset, nil
+}
+
+//读取的行需要加的锁 连接时每张表都加锁
+func setLock(p LogicalPlan, lock ast.SelectLockType) {
+	if ds, ok := p.(*DataSource); ok {
+		ds.Lock = lock
+	}
+	for _, child := range p.Children() {
+		setLock(child, lock)
+	}
+}
+
+//查询 数据源->过滤->聚合->HAVING->DISTINCT->排序->limit->投影
+func (b *planBuilder) buildSelect(stmt *ast.SelectStmt) (LogicalPlan, error) {
+	if stmt.From == nil {
+		return nil, errors.New("No tables used")
+	}
+	p, err := b.buildResultSet(stmt.From.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+	setLock(p, stmt.LockTp)
+	p, err = b.buildWhere(p, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	fieldExprs, err := selectFieldExprs(stmt.Fields, p.Schema())
+	if err != nil {
+		return nil, err
+	}
+	names := selectFieldNames(stmt.Fields, p.Schema())
+	var exprs []expression.Expression
+	var byItems []*ByItem
+	if isAggregation(stmt) {
+		p, exprs, byItems, err = b.buildAggregation(p, stmt, fieldExprs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		schema := p.Schema()
+		build := func(expr ast.ExprNode) (expression.Expression, error) {
+			return b.buildExpr(expr, schema, nil)
+		}
+		for _, fieldExpr := range fieldExprs {
+			expr, err := build(fieldExpr)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		byItems, err = buildOrderBy(stmt.OrderBy, fieldExprs, newAliasResolver(stmt.Fields, schema, true, "order clause"), build)
+		if err != nil {
+			return nil, err
+		}
+	}
+	//DISTINCT按选择列分组 每组保留第一行
+	if stmt.Distinct {
+		p = newLogicalAggregation(p, exprs, nil)
+	}
+	if len(byItems) > 0 {
+		p = newLogicalSort(p, byItems)
+	}
+	p, err = buildLimit(p, stmt.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return newLogicalProjection(p, exprs, projectionSchema(names, exprs, p.Schema())), nil
+}
+
+//where条件 按AND拆分后由谓词下推放到数据源
+//IN和EXISTS子查询能改写时转换为半连接 其余条件在半连接之上过滤
+func (b *planBuilder) buildWhere(p LogicalPlan, where ast.ExprNode) (LogicalPlan, error) {
+	if where == nil {
+		return p, nil
+	}
+	var conds []expression.Expression
+	for _, expr := range splitWhere(where) {
+		join, err := b.buildSemiJoin(p, expr)
+		if err != nil {
+			return nil, err
+		}
+		if join != nil {
+			p = join
+			continue
+		}
+		cond, err := b.buildExpr(expr, p.Schema(), nil)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, expression.SplitConjunction(cond)...)
+	}
+	if len(conds) == 0 {
+		return p, nil
+	}
+	return newLogicalSelection(p, conds), nil
+}
+
+//聚合 返回选择列表达式和排序项 聚合函数的结果按出现顺序追加在行数据之后
+func (b *planBuilder) buildAggregation(p LogicalPlan, stmt *ast.SelectStmt, fieldExprs []ast.ExprNode) (LogicalPlan, []expression.Expression, []*ByItem, error) {
+	schema := p.Schema()
+	var aggFuncs []*expression.AggFunc
+	build := func(expr ast.ExprNode) (expression.Expression, error) {
+		return b.buildExpr(expr, schema, &aggFuncs)
+	}
+
+	//选择列
+	exprs := make([]expression.Expression, 0, len(fieldExprs))
+	for _, fieldExpr := range fieldExprs {
+		expr, err := build(fieldExpr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	//分组列 不能包含聚合函数
+	var groupBy []expression.Expression
+	if stmt.GroupBy != nil {
+		resolver := newAliasResolver(stmt.Fields, schema, false, "group statement")
+		for _, item := range stmt.GroupBy.Items {
+			expr := item.Expr
+			var err error
+			if pos, ok := expr.(*ast.PositionExpr); ok {
+				expr, err = positionField(pos, fieldExprs, "group statement")
+			} else {
+				expr, err = resolver.resolve(expr)
+			}
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			e, err := b.buildExpr(expr, schema, nil)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			groupBy = append(groupBy, e)
+		}
+	}
+	var having expression.Expression
+	if stmt.Having != nil {
+		expr, err := newAliasResolver(stmt.Fields, schema, false, "having clause").resolve(stmt.Having.Expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		having, err = build(expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	byItems, err := buildOrderBy(stmt.OrderBy, fieldExprs, newAliasResolver(stmt.Fields, schema, true, "order clause"), build)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p = newLogicalAggregation(p, groupBy, aggFuncs)
+	if having != nil {
+		p = newLogicalSelection(p, expression.SplitConjunction(having))
+	}
+	return p, exprs, byItems, nil
+}
+
+//查找聚合函数
+type aggregateFinder struct {
+	found bool
+}
+
+func (f *aggregateFinder) Enter(n ast.Node) (ast.Node, bool) {
+	switch n.(type) {
+	case *ast.AggregateFuncExpr:
+		f.found = true
+		return n, true
+	case *ast.SubqueryExpr:
+		//子查询中的聚合函数属于子查询
+		return n, true
+	}
+	return n, f.found
+}
+
+func (f *aggregateFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+//是否为聚合查询 有GROUP BY HAVING或者选择列中有聚合函数
+func isAggregation(stmt *ast.SelectStmt) bool {
+	if stmt.GroupBy != nil || stmt.Having != nil {
+		return true
+	}
+	finder := &aggregateFinder{}
+	for _, field := range stmt.Fields.Fields {
+		if field.Expr != nil {
+			field.Expr.Accept(finder)
+		}
+	}
+	return finder.found
+}
+
+//*展开的列 t.*只展开表t的列 USING中合并的列只出现一次
+func wildCardColumns(wildCard *ast.WildCardField, schema *expression.Schema) []*expression.SchemaColumn {
+	var columns []*expression.SchemaColumn
+	for _, column := range schema.Columns {
+		if column.Redundant || (wildCard.Table.L != "" && column.TableName != wildCard.Table.L) {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+//选择列对应的表达式 *展开为全部列
+func selectFieldExprs(fields *ast.FieldList, schema *expression.Schema) ([]ast.ExprNode, error) {
+	exprs := make([]ast.ExprNode, 0, len(fields.Fields))
+	for _, field := range fields.Fields {
+		if field.WildCard == nil {
+			exprs = append(exprs, field.Expr)
+			continue
+		}
+		columns := wildCardColumns(field.WildCard, schema)
+		if len(columns) == 0 && field.WildCard.Table.L != "" {
+			errStr := fmt.Sprintf("Unknown table '%s'", field.WildCard.Table.O)
+			return nil, errors.New(errStr)
+		}
+		for _, column := range columns {
+			name := &ast.ColumnName{Table: model.NewCIStr(column.TableName), Name: model.NewCIStr(column.Name)}
+			exprs = append(exprs, &ast.ColumnNameExpr{Name: name})
+		}
+	}
+	return exprs, nil
+}
+
+//选择列的名称 有别名时使用别名
+func selectFieldNames(fields *ast.FieldList, schema *expression.Schema) []string {
+	names := make([]string, 0, len(fields.Fields))
+	for _, field := range fields.Fields {
+		switch {
+		case field.WildCard != nil:
+			for _, column := range wildCardColumns(field.WildCard, schema) {
+				names = append(names, column.Name)
+			}
+		case field.AsName.L != "":
+			names = append(names, field.AsName.L)
+		default:
+			names = append(names, strings.ToLower(field.Text()))
+		}
+	}
+	return names
+}
+
+//投影结果的Schema 选择列为表的列且没有别名时直接使用表的列信息
+func projectionSchema(names []string, exprs []expression.Expression, child *expression.Schema) *expression.Schema {
+	schema := &expression.Schema{Columns: make([]*expression.SchemaColumn, 0, len(exprs))}
+	for i, expr := range exprs {
+		column := &expression.SchemaColumn{Name: names[i]}
+		if c, ok := expr.(*expression.Column); ok {
+			childColumn := child.Columns[c.Offset]
+			column.TableName = childColumn.TableName
+			column.Info = childColumn.Info
+			if column.Info.Name != names[i] {
+				column.Info = &table.Column{Name: names[i], Idx: childColumn.Info.Idx, MysqlType: childColumn.Info.MysqlType}
+			}
+		} else {
+			column.Info = &table.Column{Name: names[i], MysqlType: expression.RetType(expr)}
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	return schema
+}
+
+//解析ORDER BY 支持列 表达式 选择列的别名和按选择列位置排序
+//fieldExprs为选择列对应的表达式 build用来构造排序项的表达式
+func buildOrderBy(orderBy *ast.OrderByClause, fieldExprs []ast.ExprNode, resolver *aliasResolver, build func(ast.ExprNode) (expression.Expression, error)) ([]*ByItem, error) {
+	if orderBy == nil {
+		return nil, nil
+	}
+	items := make([]*ByItem, 0, len(orderBy.Items))
+	for _, byItem := range orderBy.Items {
+		expr := byItem.Expr
+		var err error
+		if pos, ok := expr.(*ast.PositionExpr); ok {
+			expr, err = positionField(pos, fieldExprs, "order clause")
+		} else {
+			expr, err = resolver.resolve(expr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		e, err := build(expr)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &ByItem{Expr: e, Desc: byItem.Desc})
+	}
+	return items, nil
+}
+
+//把表达式中引用的选择列别名替换为选择列的表达式
+//ORDER BY中先查找别名 GROUP BY和HAVING中先查找表的列 与mysql相同 为nil时不替换
+type aliasResolver struct {
+	aliases     map[string]ast.ExprNode //别名对应的选择列 同一个别名对应多个选择列时为nil
+	schema      *expression.Schema
+	preferAlias bool
+	clause      string
+	err         error
+}
+
+func newAliasResolver(fields *ast.FieldList, schema *expression.Schema, preferAlias bool, clause string) *aliasResolver {
+	aliases := make(map[string]ast.ExprNode)
+	for _, field := range fields.Fields {
+		if field.AsName.L == "" {
+			continue
+		}
+		if _, ok := aliases[field.AsName.L]; ok {
+			aliases[field.AsName.L] = nil
+			continue
+		}
+		aliases[field.AsName.L] = field.Expr
+	}
+	return &aliasResolver{aliases: aliases, schema: schema, preferAlias: preferAlias, clause: clause}
+}
+
+func (r *aliasResolver) resolve(expr ast.ExprNode) (ast.ExprNode, error) {
+	if r == nil || len(r.aliases) == 0 {
+		return expr, nil
+	}
+	node, _ := expr.Accept(r)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return node.(ast.ExprNode), nil
+}
+
+func (r *aliasResolver) Enter(n ast.Node) (ast.Node, bool) {
+	//子查询中的列属于子查询
+	_, skip := n.(*ast.SubqueryExpr)
+	return n, skip || r.err != nil
+}
+
+func (r *aliasResolver) Leave(n ast.Node) (ast.Node, bool) {
+	column, ok := n.(*ast.ColumnNameExpr)
+	if !ok || column.Name.Table.L != "" {
+		return n, true
+	}
+	expr, ok := r.aliases[column.Name.Name.L]
+	if !ok || (!r.preferAlias && hasColumn(r.schema, column.Name.Name.L)) {
+		return n, true
+	}
+	if expr == nil {
+		errStr := fmt.Sprintf("Column '%s' in %s is ambiguous", column.Name.Name.O, r.clause)
+		r.err = errors.New(errStr)
+		return n, false
+	}
+	return expr, true
+}
+
+//schema中是否有不带表名可以引用的列
+func hasColumn(schema *expression.Schema, name string) bool {
+	for _, column := range schema.Columns {
+		if column.Name == name && !column.Redundant {
+			return true
+		}
+	}
+	return false
+}
+
+//ORDER BY 1 对应的选择列
+func positionField(pos *ast.PositionExpr, fieldExprs []ast.ExprNode, clause string) (ast.ExprNode, error) {
+	n := pos.N
+	if pos.P != nil {
+		value, ok := pos.P.(*driver.ValueExpr)
+		if !ok {
+			return nil, errors.New("position must be a constant")
+		}
+		n = int(value.GetInt64())
+	}
+	if n < 1 || n > len(fieldExprs) {
+		errStr := fmt.Sprintf("Unknown column '%d' in '%s'", n, clause)
+		return nil, errors.New(errStr)
+	}
+	return fieldExprs[n-1], nil
+}
+
+//解析limit 省略偏移量时从0开始
+func buildLimit(p LogicalPlan, limitNode *ast.Limit) (LogicalPlan, error) {
+	if limitNode == nil {
+		return p, nil
+	}
+	var offset uint64
+	if limitNode.Offset != nil {
+		value, err := constantValue(limitNode.Offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = value.GetUint64()
+	}
+	count, err := constantValue(limitNode.Count)
+	if err != nil {
+		return nil, err
+	}
+	return newLogicalLimit(p, offset, count.GetUint64()), nil
+}
+
+//取出常量表达式的值 支持字面量和带正负号的数字
+func constantValue(expr ast.ExprNode) (types.Datum, error) {
+	switch x := expr.(type) {
+	case *driver.ValueExpr:
+		return x.Datum, nil
+	case *ast.UnaryOperationExpr:
+		value, err := constantValue(x.V)
+		if err != nil {
+			return value, err
+		}
+		switch x.Op {
+		case opcode.Plus:
+			return value, nil
+		case opcode.Minus:
+			switch value.Kind() {
+			case types.KindInt64:
+				return types.NewIntDatum(-value.GetInt64()), nil
+			case types.KindUint64:
+				if value.GetUint64() <= math.MaxInt64+1 {
+					return types.NewIntDatum(int64(-value.GetUint64())), nil
+				}
+			case types.KindFloat32, types.KindFloat64:
+				return types.NewFloat64Datum(-value.GetFloat64()), nil
+			case types.KindMysqlDecimal:
+				return types.NewDecimalDatum(types.DecimalNeg(value.GetMysqlDecimal())), nil
+			}
+		}
+	}
+	errStr := fmt.Sprintf("value(%T) must be a constant", expr)
+	return types.Datum{}, errors.New(errStr)
+}
+
+//更新和删除时读取数据的计划 输出整行数据
+func (b *planBuilder) buildRowsPlan(ds *DataSource, where ast.ExprNode, orderBy *ast.OrderByClause, limit *ast.Limit) (PhysicalPlan, error) {
+	p, err := b.buildWhere(ds, where)
+	if err != nil {
+		return nil, err
+	}
+	schema := ds.Schema()
+	fieldExprs := make([]ast.ExprNode, 0, len(ds.Table.Columns))
+	for _, column := range ds.Table.Columns {
+		fieldExprs = append(fieldExprs, &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: model.NewCIStr(column.Name)}})
+	}
+	byItems, err := buildOrderBy(orderBy, fieldExprs, nil, func(expr ast.ExprNode) (expression.Expression, error) {
+		return b.buildExpr(expr, schema, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(byItems) > 0 {
+		p = newLogicalSort(p, byItems)
+	}
+	p, err = buildLimit(p, limit)
+	if err != nil {
+		return nil, err
+	}
+	return optimizeLogicalPlan(p)
+}
+
+func (b *planBuilder) buildUpdate(stmt *ast.UpdateStmt) (Plan, error) {
+	ds, err := b.buildDataSource(stmt.TableRefs.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+	b.target = ds.Table
+	//要修改的行加排他锁 等待其他事务持有的锁
+	ds.Lock = ast.SelectLockForUpdate
+	//update 必须有条件，避免全表更新
+	if stmt.Where == nil {
+		errStr := fmt.Sprintf("delete must hava a where condition")
+		return nil, errors.New(errStr)
+	}
+
+	//获取更新字段
+	tableInfo := ds.Table
+	assignments := make([]*Assignment, 0, len(stmt.List))
+	for _, assignment := range stmt.List {
+		//不可更新主键字段
+		if tableInfo.PriKey != nil && assignment.Column.Name.L == tableInfo.PriKey.Name {
+			errStr := fmt.Sprintf("Primary field can not update")
+			return nil, errors.New(errStr)
+		}
+		column, err := tableInfo.FindCol(tableInfo.Columns, assignment.Column.Name.L)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := b.buildExpr(assignment.Expr, ds.Schema(), nil)
+		if err != nil {
+			return nil, err
+		}
+		//常量在生成计划时转换为列类型
+		if constant, ok := expr.(*expression.Constant); ok {
+			value, err := column.CheckedValue(constant.Value)
+			if err != nil {
+				return nil, err
+			}
+			expr = &expression.Constant{Value: value}
+		}
+		assignments = append(assignments, &Assignment{
+			Column: column,
+			Offset: tableInfo.ColumnOffset(column.Idx),
+			Expr:   expr,
+		})
+	}
+
+	selectPlan, err := b.buildRowsPlan(ds, stmt.Where, stmt.Order, stmt.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Update{Table: tableInfo, Assignments: assignments, SelectPlan: selectPlan}, nil
+}
+
+func (b *planBuilder) buildDelete(stmt *ast.DeleteStmt) (Plan, error) {
+	ds, err := b.buildDataSource(stmt.TableRefs.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+	b.target = ds.Table
+	//要修改的行加排他锁 等待其他事务持有的锁
+	ds.Lock = ast.SelectLockForUpdate
+	//delete必须有条件
+	if stmt.Where == nil {
+		errStr := fmt.Sprintf("delete must hava a where condition")
+		return nil, errors.New(errStr)
+	}
+	selectPlan, err := b.buildRowsPlan(ds, stmt.Where, stmt.Order, stmt.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Delete{Table: ds.Table, SelectPlan: selectPlan}, nil
+}
+
+//insert into `raw_utxo_index` VALUES('autoid',2,'index');
+//以上省略插入字段的情况，后面的值必须按照顺序给出全部列  不管字段是有默认值还是主键自增，都不可省略--mysql
+//insert into `raw_utxo_index` (`raw_utxo_index`.`BLOCKNUM`) VALUES(2);
+//指定插入字段的情况  默认字段可省略 主键自增可省略 但是键值还是对应的
+func (b *planBuilder) buildInsert(stmt *ast.InsertStmt) (Plan, error) {
+	tableName, err := tableNameOf(stmt.Table.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+	tableInfo, err := b.tableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := insertColumnOffsets(tableInfo, stmt.Columns)
+	if err != nil {
+		return nil, err
+	}
+	//插入的值不能引用列
+	schema := &expression.Schema{}
+	lists := make([][]expression.Expression, 0, len(stmt.Lists))
+	for _, list := range stmt.Lists {
+		if len(list) != len(columns) {
+			errStr := fmt.Sprintf("Insert value and column does not match")
+			return nil, errors.New(errStr)
+		}
+		exprs := make([]expression.Expression, 0, len(list))
+		for _, expr := range list {
+			e, err := expression.Build(expr, schema)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, e)
+		}
+		lists = append(lists, exprs)
+	}
+	return &Insert{Table: tableInfo, Columns: columns, Lists: lists}, nil
+}
+
+//插入字段在表中的位置 省略插入字段时为全部列
+func insertColumnOffsets(tableInfo *table.MyTableInfo, columns []*ast.ColumnName) ([]int, error) {
+	offsets := make([]int, 0, len(tableInfo.Columns))
+	if columns == nil {
+		for i := range tableInfo.Columns {
+			offsets = append(offsets, i)
+		}
+		return offsets, nil
+	}
+	for _, columnName := range columns {
+		column, err := tableInfo.FindCol(tableInfo.Columns, columnName.Name.L)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, tableInfo.ColumnOffset(column.Idx))
+	}
+	return offsets, nil
+}
+
+func (b *planBuilder) buildAnalyze(stmt *ast.AnalyzeTableStmt) (Plan, error) {
+	plan := &Analyze{}
+	for _, tableName := range stmt.TableNames {
+		tableInfo, err := b.tableInfo(tableName)
+		if err != nil {
+			return nil, err
+		}
+		plan.Tables = append(plan.Tables, tableInfo)
+	}
+	return plan, nil
+}
@@ -0,0 +1,530 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+)
+
+//比较函数对应的操作符
+var compareOpts = map[string]opcode.Op{
+	ast.EQ: opcode.EQ,
+	ast.NE: opcode.NE,
+	ast.LT: opcode.LT,
+	ast.LE: opcode.LE,
+	ast.GT: opcode.GT,
+	ast.GE: opcode.GE,
+}
+
+//常量在左边时交换两边后的操作符
+var swappedOpts = map[opcode.Op]opcode.Op{
+	opcode.EQ: opcode.EQ,
+	opcode.NE: opcode.NE,
+	opcode.LT: opcode.GT,
+	opcode.LE: opcode.GE,
+	opcode.GT: opcode.LT,
+	opcode.GE: opcode.LE,
+}
+
+//从过滤条件中取出可以用于主键和索引的条件
+//只有 列 操作符 常量 形式的条件可以使用 其余条件只用于过滤
+func accessConditions(conds []expression.Expression) []*table.Where {
+	var wheres []*table.Where
+	for _, cond := range conds {
+		sf, ok := cond.(*expression.ScalarFunction)
+		if !ok {
+			continue
+		}
+		opt, ok := compareOpts[sf.FuncName]
+		if !ok {
+			continue
+		}
+		column, isColumn := sf.Args[0].(*expression.Column)
+		constant, isConstant := sf.Args[1].(*expression.Constant)
+		if !isColumn || !isConstant {
+			column, isColumn = sf.Args[1].(*expression.Column)
+			constant, isConstant = sf.Args[0].(*expression.Constant)
+			opt = swappedOpts[opt]
+		}
+		if !isColumn || !isConstant {
+			continue
+		}
+		value := constant.Value
+		wheres = append(wheres, &table.Where{
+			Opt:        opt,
+			LeftColumn: column.Name,
+			RightValue: &value,
+		})
+	}
+	return wheres
+}
+
+//右值是否为数字
+func isNumericDatum(d *types.Datum) bool {
+	switch d.Kind() {
+	case types.KindInt64, types.KindUint64, types.KindFloat32, types.KindFloat64, types.KindMysqlDecimal:
+		return true
+	}
+	return false
+}
+
+//列上的取值区间 边界为nil表示无界
+//区间只用来缩小扫描范围 可以比条件的实际范围大 结果由过滤条件保证
+type valueRange struct {
+	low      *types.Datum
+	lowIncl  bool
+	high     *types.Datum
+	highIncl bool
+}
+
+//收紧下界
+func (r *valueRange) setLow(v types.Datum, incl bool) error {
+	if r.low != nil {
+		cmp, err := v.CompareDatum(table.StmtCtx, r.low)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 || (cmp == 0 && incl) {
+			return nil
+		}
+	}
+	r.low, r.lowIncl = &v, incl
+	return nil
+}
+
+//收紧上界
+func (r *valueRange) setHigh(v types.Datum, incl bool) error {
+	if r.high != nil {
+		cmp, err := v.CompareDatum(table.StmtCtx, r.high)
+		if err != nil {
+			return err
+		}
+		if cmp > 0 || (cmp == 0 && incl) {
+			return nil
+		}
+	}
+	r.high, r.highIncl = &v, incl
+	return nil
+}
+
+//条件的右值能否用于索引列上的等值查找
+//字符串列和数字比较时按数字比较 '9'和'09'都等于9 不能按编码后的字节查找
+func indexable(column *table.Column, d *types.Datum) bool {
+	if d.IsNull() {
+		return false
+	}
+	if types.IsString(column.MysqlType.Tp) {
+		return d.Kind() == types.KindString || d.Kind() == types.KindBytes
+	}
+	return true
+}
+
+//条件的右值能否用于索引列上的范围查找
+//字符串列按字节序比较 编码后的顺序和值的顺序一致 数字列要求右值也是数字
+func rangeable(column *table.Column, d *types.Datum) bool {
+	if !indexable(column, d) {
+		return false
+	}
+	return types.IsString(column.MysqlType.Tp) || isNumericDatum(d)
+}
+
+//将条件右值转换为列类型 转换有损失时(如整数列和小数比较)返回lossy
+//有损失的边界按闭区间处理 保证扫描范围不会漏掉数据
+func castBound(column *table.Column, d types.Datum) (types.Datum, bool, error) {
+	value, err := column.CastValue(d)
+	if err != nil {
+		return value, false, err
+	}
+	cmp, err := value.CompareDatum(table.StmtCtx, &d)
+	if err != nil || cmp != 0 {
+		return value, true, nil
+	}
+	return value, false, nil
+}
+
+//由列上的范围条件得到取值区间
+//cast为true时边界转换为列类型 不等于条件在没有其他范围条件时拆成两个区间
+func columnRanges(column *table.Column, wheres []*table.Where, cast bool) ([]valueRange, error) {
+	var r valueRange
+	used := false
+	var ne *types.Datum
+	for _, where := range wheres {
+		if where.LeftColumn != column.Name || !rangeable(column, where.RightValue) {
+			continue
+		}
+		value, lossy := *where.RightValue, false
+		if cast {
+			var err error
+			value, lossy, err = castBound(column, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		switch where.Opt {
+		case opcode.GT, opcode.GE:
+			err = r.setLow(value, where.Opt == opcode.GE || lossy)
+			used = true
+		case opcode.LT, opcode.LE:
+			err = r.setHigh(value, where.Opt == opcode.LE || lossy)
+			used = true
+		case opcode.NE:
+			//转换有损失时列上的值都不等于右值 不能缩小范围
+			if !lossy && ne == nil {
+				ne = &value
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if used {
+		return []valueRange{r}, nil
+	}
+	if ne != nil {
+		//不等于：(-inf, v) 和 (v, +inf)
+		return []valueRange{{high: ne}, {low: ne}}, nil
+	}
+	return nil, nil
+}
+
+//有等值条件的列 这些列在结果中只有一个值
+func fixedColumns(wheres []*table.Where, tableInfo *table.MyTableInfo) map[string]bool {
+	fixed := make(map[string]bool)
+	for _, where := range wheres {
+		if where.Opt != opcode.EQ {
+			continue
+		}
+		column, err := tableInfo.FindCol(tableInfo.Columns, where.LeftColumn)
+		if err == nil && indexable(column, where.RightValue) {
+			fixed[where.LeftColumn] = true
+		}
+	}
+	return fixed
+}
+
+//索引上的访问条件 索引前缀列上的等值条件加上紧随其后一列上的范围条件
+type indexRange struct {
+	eqValues []types.Datum //前缀列的值 已转换为列类型
+	ranges   []valueRange  //等值前缀之后一列上的取值区间 为空表示只使用等值前缀
+}
+
+//按最左前缀匹配规则取出索引上的访问条件
+func buildIndexRange(tableInfo *table.MyTableInfo, index *table.Index, wheres []*table.Where) (*indexRange, error) {
+	columns, err := tableInfo.IndexColumns(index)
+	if err != nil {
+		return nil, err
+	}
+	r := &indexRange{}
+	for _, column := range columns {
+		var where *table.Where
+		for _, w := range wheres {
+			if w.LeftColumn == column.Name && w.Opt == opcode.EQ && indexable(column, w.RightValue) {
+				where = w
+				break
+			}
+		}
+		if where == nil {
+			break
+		}
+		value, err := column.CastValue(*where.RightValue)
+		if err != nil {
+			return nil, err
+		}
+		r.eqValues = append(r.eqValues, value)
+	}
+	if len(r.eqValues) < len(columns) {
+		r.ranges, err = columnRanges(columns[len(r.eqValues)], wheres, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//是否有可用的条件
+func (r *indexRange) usable() bool {
+	return len(r.eqValues) > 0 || len(r.ranges) > 0
+}
+
+//等值前缀越长越好 相同时有范围条件的优先
+func (r *indexRange) compare(other *indexRange) int {
+	if len(r.eqValues) != len(other.eqValues) {
+		if len(r.eqValues) > len(other.eqValues) {
+			return 1
+		}
+		return -1
+	}
+	if (len(r.ranges) > 0) != (len(other.ranges) > 0) {
+		if len(r.ranges) > 0 {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+//索引扫描的范围
+func (r *indexRange) keyRanges(tableId, indexId uint64) ([]KeyRange, error) {
+	prefix, err := codekey.EncodeIndexSeekKey(tableId, indexId, r.eqValues...)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.ranges) == 0 {
+		//索引值编码后不会互为前缀 所以[prefix, PrefixNext(prefix))恰好是前缀值对应的全部索引键
+		return []KeyRange{{StartKey: prefix, EndKey: codekey.PrefixNext(prefix)}}, nil
+	}
+	seekKey := func(v types.Datum) ([]byte, error) {
+		return codekey.EncodeDatums(append([]byte{}, prefix...), v)
+	}
+	ranges := make([]KeyRange, 0, len(r.ranges))
+	for _, vr := range r.ranges {
+		var kr KeyRange
+		var err error
+		switch {
+		case vr.low == nil:
+			//范围条件不包含NULL 从第一个非NULL值开始
+			kr.StartKey, err = seekKey(types.MinNotNullDatum())
+		case vr.lowIncl:
+			kr.StartKey, err = seekKey(*vr.low)
+		default:
+			//大于：跳过等于下界的全部键
+			kr.StartKey, err = seekKey(*vr.low)
+			kr.StartKey = codekey.PrefixNext(kr.StartKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case vr.high == nil:
+			kr.EndKey = codekey.PrefixNext(prefix)
+		case vr.highIncl:
+			kr.EndKey, err = seekKey(*vr.high)
+			kr.EndKey = codekey.PrefixNext(kr.EndKey)
+		default:
+			//小于：扫描到上界之前
+			kr.EndKey, err = seekKey(*vr.high)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, kr)
+	}
+	return ranges, nil
+}
+
+//扫描范围的说明 用于EXPLAIN 等值前缀和范围列的值以空格分隔
+func (r *indexRange) descriptions() []string {
+	prefix := make([]string, 0, len(r.eqValues)+1)
+	for _, v := range r.eqValues {
+		prefix = append(prefix, datumString(v))
+	}
+	if len(r.ranges) == 0 {
+		values := strings.Join(prefix, " ")
+		return []string{fmt.Sprintf("[%s,%s]", values, values)}
+	}
+	descs := make([]string, 0, len(r.ranges))
+	for _, vr := range r.ranges {
+		low, lowBracket := "-inf", "("
+		if vr.low != nil {
+			low = datumString(*vr.low)
+			if vr.lowIncl {
+				lowBracket = "["
+			}
+		}
+		high, highBracket := "+inf", ")"
+		if vr.high != nil {
+			high = datumString(*vr.high)
+			if vr.highIncl {
+				highBracket = "]"
+			}
+		}
+		lows := strings.Join(append(append([]string{}, prefix...), low), " ")
+		highs := strings.Join(append(append([]string{}, prefix...), high), " ")
+		descs = append(descs, lowBracket+lows+","+highs+highBracket)
+	}
+	return descs
+}
+
+//值的说明 字符串加引号
+func datumString(d types.Datum) string {
+	return (&expression.Constant{Value: d}).String()
+}
+
+//整个索引的扫描范围 包括NULL
+func fullIndexRange(tableId, indexId uint64) []KeyRange {
+	prefix := codekey.EncodeIndexPrefix(tableId, indexId)
+	return []KeyRange{{StartKey: prefix, EndKey: codekey.PrefixNext(prefix)}}
+}
+
+//全表扫描的范围
+func fullTableRange(tableId uint64) []KeyRange {
+	prefix := codekey.EncodeRowPrefix(tableId)
+	return []KeyRange{{StartKey: prefix, EndKey: codekey.PrefixNext(prefix)}}
+}
+
+//主键上的行号区间 闭区间
+type rowIdRange struct {
+	low  uint64
+	high uint64
+}
+
+func (r rowIdRange) String() string {
+	if r.high == math.MaxUint64 {
+		return fmt.Sprintf("[%d,+inf]", r.low)
+	}
+	return fmt.Sprintf("[%d,%d]", r.low, r.high)
+}
+
+//是否为单点
+func isPointRanges(ranges []rowIdRange) bool {
+	return len(ranges) == 0 || (len(ranges) == 1 && ranges[0].low == ranges[0].high)
+}
+
+//主键条件对应的行号区间 第二个返回值表示是否有可用的主键条件
+//等值条件优先 区间为空时返回空切片
+func priKeyRanges(tableInfo *table.MyTableInfo, wheres []*table.Where) ([]rowIdRange, bool, error) {
+	priKey := tableInfo.PriKey
+	//非数字类型的主键按字符串比较 和行号的顺序不一致
+	if priKey == nil || !types.IsTypeNumeric(priKey.MysqlType.Tp) {
+		return nil, false, nil
+	}
+	var ranges []valueRange
+	for _, where := range wheres {
+		if where.LeftColumn == priKey.Name && where.Opt == opcode.EQ && rangeable(priKey, where.RightValue) {
+			value := *where.RightValue
+			ranges = []valueRange{{low: &value, lowIncl: true, high: &value, highIncl: true}}
+			break
+		}
+	}
+	if ranges == nil {
+		var err error
+		ranges, err = columnRanges(priKey, wheres, false)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, false, nil
+	}
+	rowIdRanges := make([]rowIdRange, 0, len(ranges))
+	for _, r := range ranges {
+		rr, ok, err := toRowIdRange(r)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			rowIdRanges = append(rowIdRanges, rr)
+		}
+	}
+	return rowIdRanges, true, nil
+}
+
+//取值区间转换为行号区间 行号都是非负整数
+func toRowIdRange(r valueRange) (rowIdRange, bool, error) {
+	rr := rowIdRange{low: 0, high: math.MaxUint64}
+	if r.low != nil {
+		low, ok, err := rowIdLowBound(*r.low, r.lowIncl)
+		if err != nil || !ok {
+			return rr, false, err
+		}
+		rr.low = low
+	}
+	if r.high != nil {
+		high, ok, err := rowIdHighBound(*r.high, r.highIncl)
+		if err != nil || !ok {
+			return rr, false, err
+		}
+		rr.high = high
+	}
+	return rr, rr.low <= rr.high, nil
+}
+
+//满足下界的最小行号
+func rowIdLowBound(d types.Datum, incl bool) (uint64, bool, error) {
+	switch d.Kind() {
+	case types.KindInt64:
+		if d.GetInt64() < 0 {
+			return 0, true, nil
+		}
+		d = types.NewUintDatum(uint64(d.GetInt64()))
+		fallthrough
+	case types.KindUint64:
+		u := d.GetUint64()
+		if incl {
+			return u, true, nil
+		}
+		return u + 1, u != math.MaxUint64, nil
+	}
+	f, err := d.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return 0, false, err
+	}
+	if f < 0 {
+		return 0, true, nil
+	}
+	c := math.Ceil(f)
+	if !incl && c == f {
+		c++
+	}
+	if c >= math.MaxUint64 {
+		return 0, false, nil
+	}
+	return uint64(c), true, nil
+}
+
+//满足上界的最大行号
+func rowIdHighBound(d types.Datum, incl bool) (uint64, bool, error) {
+	switch d.Kind() {
+	case types.KindInt64:
+		if d.GetInt64() < 0 {
+			return 0, false, nil
+		}
+		d = types.NewUintDatum(uint64(d.GetInt64()))
+		fallthrough
+	case types.KindUint64:
+		u := d.GetUint64()
+		if incl {
+			return u, true, nil
+		}
+		return u - 1, u != 0, nil
+	}
+	f, err := d.ToFloat64(table.StmtCtx)
+	if err != nil {
+		return 0, false, err
+	}
+	if f >= math.MaxUint64 {
+		return math.MaxUint64, true, nil
+	}
+	fl := math.Floor(f)
+	if !incl && fl == f {
+		fl--
+	}
+	if fl < 0 {
+		return 0, false, nil
+	}
+	return uint64(fl), true, nil
+}
+
+//行号区间对应的行数据扫描范围
+func rowKeyRanges(tableId uint64, ranges []rowIdRange) []KeyRange {
+	keyRanges := make([]KeyRange, 0, len(ranges))
+	for _, r := range ranges {
+		kr := KeyRange{StartKey: codekey.EncodeRowKey(tableId, r.low)}
+		if r.high == math.MaxUint64 {
+			kr.EndKey = codekey.PrefixNext(codekey.EncodeRowPrefix(tableId))
+		} else {
+			kr.EndKey = codekey.EncodeRowKey(tableId, r.high+1)
+		}
+		keyRanges = append(keyRanges, kr)
+	}
+	return keyRanges
+}
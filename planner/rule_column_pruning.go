@@ -0,0 +1,102 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+)
+
+//列裁剪 标记数据源需要读出的列 索引包含全部需要的列时不需要回表
+func columnPruning(p LogicalPlan) (LogicalPlan, error) {
+	used := make([]bool, len(p.Schema().Columns))
+	for i := range used {
+		used[i] = true
+	}
+	p.PruneColumns(used)
+	return p, nil
+}
+
+//标记表达式中引用的列
+func markColumns(used []bool, exprs ...expression.Expression) {
+	for _, expr := range exprs {
+		for _, column := range expression.ExtractColumns(expr) {
+			if column.Offset >= 0 && column.Offset < len(used) {
+				used[column.Offset] = true
+			}
+		}
+	}
+}
+
+func byItemExprs(byItems []*ByItem) []expression.Expression {
+	exprs := make([]expression.Expression, 0, len(byItems))
+	for _, item := range byItems {
+		exprs = append(exprs, item.Expr)
+	}
+	return exprs
+}
+
+func (ds *DataSource) PruneColumns(used []bool) {
+	ds.UsedColumns = append([]bool{}, used...)
+	markColumns(ds.UsedColumns, ds.Conditions...)
+}
+
+//连接条件引用的列也需要读出 按位置分给左右两侧 半连接的输出中没有右侧的列
+func (p *LogicalJoin) PruneColumns(used []bool) {
+	used = append([]bool{}, used...)
+	if p.JoinType.isSemi() {
+		used = append(used, make([]bool, len(p.children[1].Schema().Columns))...)
+	}
+	for _, eq := range p.EqualConditions {
+		markColumns(used, eq)
+	}
+	markColumns(used, p.OtherConditions...)
+	markColumns(used, p.OnConditions...)
+	nLeft := len(p.children[0].Schema().Columns)
+	p.children[0].PruneColumns(used[:nLeft])
+	p.children[1].PruneColumns(used[nLeft:])
+}
+
+func (p *LogicalSelection) PruneColumns(used []bool) {
+	used = append([]bool{}, used...)
+	markColumns(used, p.Conditions...)
+	p.children[0].PruneColumns(used)
+}
+
+//聚合的结果行中前面为子节点的列 父节点没有用到时组内第一行可以不读出
+func (p *LogicalAggregation) PruneColumns(used []bool) {
+	n := len(p.children[0].Schema().Columns)
+	childUsed := append([]bool{}, used[:n]...)
+	p.firstRowUsed = false
+	for _, u := range childUsed {
+		if u {
+			p.firstRowUsed = true
+			break
+		}
+	}
+	markColumns(childUsed, p.GroupBy...)
+	for _, aggFunc := range p.AggFuncs {
+		markColumns(childUsed, aggFunc.Args...)
+	}
+	p.children[0].PruneColumns(childUsed)
+}
+
+func (p *LogicalSort) PruneColumns(used []bool) {
+	used = append([]bool{}, used...)
+	markColumns(used, byItemExprs(p.ByItems)...)
+	p.children[0].PruneColumns(used)
+}
+
+func (p *LogicalTopN) PruneColumns(used []bool) {
+	used = append([]bool{}, used...)
+	markColumns(used, byItemExprs(p.ByItems)...)
+	p.children[0].PruneColumns(used)
+}
+
+func (p *LogicalLimit) PruneColumns(used []bool) {
+	p.children[0].PruneColumns(used)
+}
+
+//只需要选择列表达式中引用的列
+func (p *LogicalProjection) PruneColumns(used []bool) {
+	childUsed := make([]bool, len(p.children[0].Schema().Columns))
+	markColumns(childUsed, p.Exprs...)
+	p.children[0].PruneColumns(childUsed)
+}
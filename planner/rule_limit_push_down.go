@@ -0,0 +1,37 @@
+package planner
+
+//limit下推 排序之上的limit合并为TopN 投影之上的limit移到投影之下
+//数据源之上的limit在生成物理计划时用来估算需要扫描的行数
+func limitPushDown(p LogicalPlan) (LogicalPlan, error) {
+	children := p.Children()
+	for i, child := range children {
+		newChild, err := limitPushDown(child)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = newChild
+	}
+	p.SetChildren(children...)
+	limit, ok := p.(*LogicalLimit)
+	if !ok {
+		return p, nil
+	}
+	switch child := limit.children[0].(type) {
+	case *LogicalSort:
+		topN := &LogicalTopN{ByItems: child.ByItems, Offset: limit.Offset, Count: limit.Count}
+		topN.schema = child.schema
+		topN.SetChildren(child.children[0])
+		return topN, nil
+	case *LogicalProjection:
+		//投影只需要计算返回的行
+		limit.schema = child.children[0].Schema()
+		limit.SetChildren(child.children[0])
+		newLimit, err := limitPushDown(limit)
+		if err != nil {
+			return nil, err
+		}
+		child.SetChildren(newLimit)
+		return child, nil
+	}
+	return p, nil
+}
@@ -0,0 +1,189 @@
+package planner
+
+import (
+	"github.com/CDDSCLab/chaosdb/expression"
+
+	"github.com/pingcap/parser/ast"
+)
+
+//谓词下推 过滤条件尽量放到数据源 读取数据时就过滤掉不需要的行 并用于选择主键和索引
+func predicatePushDown(p LogicalPlan) (LogicalPlan, error) {
+	ret, p := p.PredicatePushDown(nil)
+	if len(ret) > 0 {
+		p = newLogicalSelection(p, ret)
+	}
+	return p, nil
+}
+
+//条件不能穿过当前节点 子节点留下的条件放在子节点之上
+func pushDownToChild(p LogicalPlan, conds []expression.Expression) {
+	p.SetChildren(pushDownTo(p.Children()[0], conds))
+}
+
+//条件下推到p 留下的条件放在p之上
+func pushDownTo(p LogicalPlan, conds []expression.Expression) LogicalPlan {
+	ret, p := p.PredicatePushDown(conds)
+	if len(ret) > 0 {
+		p = newLogicalSelection(p, ret)
+	}
+	return p
+}
+
+func (ds *DataSource) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	ds.Conditions = append(ds.Conditions, conds...)
+	return nil, ds
+}
+
+func (p *LogicalSelection) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	conds = append(append([]expression.Expression{}, p.Conditions...), conds...)
+	ret, child := p.children[0].PredicatePushDown(conds)
+	if len(ret) == 0 {
+		return nil, child
+	}
+	p.Conditions = ret
+	p.SetChildren(child)
+	return nil, p
+}
+
+//只引用分组列的条件在聚合前后的结果相同 可以在聚合之前过滤
+func (p *LogicalAggregation) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	groupColumns := make(map[int]bool)
+	for _, expr := range p.GroupBy {
+		if column, ok := expr.(*expression.Column); ok {
+			groupColumns[column.Offset] = true
+		}
+	}
+	var pushed, ret []expression.Expression
+	for _, cond := range conds {
+		//没有分组时空输入也有一行结果 条件不能下推
+		canPush := len(p.GroupBy) > 0
+		for _, column := range expression.ExtractColumns(cond) {
+			if !groupColumns[column.Offset] {
+				canPush = false
+				break
+			}
+		}
+		if canPush {
+			pushed = append(pushed, cond)
+		} else {
+			ret = append(ret, cond)
+		}
+	}
+	pushDownToChild(p, pushed)
+	return ret, p
+}
+
+//条件引用的列在哪一侧 0为左侧(包括不引用列的条件) 1为右侧 -1为两侧都有
+func (p *LogicalJoin) conditionSide(cond expression.Expression) int {
+	nLeft := len(p.children[0].Schema().Columns)
+	left, right := false, false
+	for _, column := range expression.ExtractColumns(cond) {
+		if column.Offset < nLeft {
+			left = true
+		} else {
+			right = true
+		}
+	}
+	switch {
+	case left && right:
+		return -1
+	case right:
+		return 1
+	}
+	return 0
+}
+
+//引用两侧的条件在连接时求值 两侧列之间的等值条件用于哈希连接和索引连接
+func (p *LogicalJoin) addJoinCondition(cond expression.Expression) {
+	if sf, ok := cond.(*expression.ScalarFunction); ok && sf.FuncName == ast.EQ && len(sf.Args) == 2 {
+		l, lok := sf.Args[0].(*expression.Column)
+		r, rok := sf.Args[1].(*expression.Column)
+		if lok && rok && p.conditionSide(l) != p.conditionSide(r) {
+			if p.conditionSide(l) == 1 {
+				l, r = r, l
+			}
+			eq, err := expression.NewFunction(ast.EQ, l, r)
+			if err == nil {
+				p.EqualConditions = append(p.EqualConditions, eq.(*expression.ScalarFunction))
+				return
+			}
+		}
+	}
+	p.OtherConditions = append(p.OtherConditions, cond)
+}
+
+//内连接的ON条件和WHERE条件等价 只引用一侧的条件都可以下推
+//外连接中WHERE条件只有引用保留一侧的可以下推 ON条件不会过滤掉保留一侧的行 只有引用另一侧的可以下推
+//半连接的WHERE条件只引用左侧 反半连接中只引用左侧的ON条件决定是否输出 不能下推
+func (p *LogicalJoin) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	var pushed [2][]expression.Expression
+	var ret []expression.Expression
+	switch {
+	case p.JoinType.isSemi():
+		pushed[0] = append(pushed[0], conds...)
+		for _, cond := range p.OnConditions {
+			if side := p.conditionSide(cond); side == 1 || (side == 0 && p.JoinType == SemiJoin) {
+				pushed[side] = append(pushed[side], cond)
+			} else {
+				p.addJoinCondition(cond)
+			}
+		}
+	case p.JoinType == InnerJoin:
+		for _, cond := range append(append([]expression.Expression{}, p.OnConditions...), conds...) {
+			if side := p.conditionSide(cond); side >= 0 {
+				pushed[side] = append(pushed[side], cond)
+			} else {
+				p.addJoinCondition(cond)
+			}
+		}
+	default:
+		outer := 0
+		if p.JoinType == RightOuterJoin {
+			outer = 1
+		}
+		for _, cond := range conds {
+			if p.conditionSide(cond) == outer {
+				pushed[outer] = append(pushed[outer], cond)
+			} else {
+				ret = append(ret, cond)
+			}
+		}
+		for _, cond := range p.OnConditions {
+			if side := p.conditionSide(cond); side == 1-outer {
+				pushed[side] = append(pushed[side], cond)
+			} else {
+				p.addJoinCondition(cond)
+			}
+		}
+	}
+	p.OnConditions = nil
+	//右侧子节点中列的位置从0开始
+	nLeft := len(p.children[0].Schema().Columns)
+	for i, cond := range pushed[1] {
+		pushed[1][i] = expression.ShiftColumns(cond, -nLeft)
+	}
+	p.SetChildren(pushDownTo(p.children[0], pushed[0]), pushDownTo(p.children[1], pushed[1]))
+	return ret, p
+}
+
+//排序不改变行 条件可以穿过排序
+func (p *LogicalSort) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	ret, child := p.children[0].PredicatePushDown(conds)
+	p.SetChildren(child)
+	return ret, p
+}
+
+func (p *LogicalTopN) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	pushDownToChild(p, nil)
+	return conds, p
+}
+
+func (p *LogicalLimit) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	pushDownToChild(p, nil)
+	return conds, p
+}
+
+func (p *LogicalProjection) PredicatePushDown(conds []expression.Expression) ([]expression.Expression, LogicalPlan) {
+	pushDownToChild(p, nil)
+	return conds, p
+}
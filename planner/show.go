@@ -0,0 +1,111 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+	"github.com/CDDSCLab/chaosdb/table"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+)
+
+//SHOW语句 结果行由执行器按表信息生成
+type Show struct {
+	Tp         ast.ShowStmtType
+	Full       bool
+	DB         *table.DBInfo           //SHOW TABLES的数据库
+	Table      *table.MyTableInfo      //SHOW TABLES和SHOW DATABASES时为nil
+	Column     string                  //DESCRIBE指定的列 为空时返回全部列
+	Conditions []expression.Expression //LIKE和WHERE条件 在结果行上求值
+	schema     *expression.Schema
+}
+
+func (s *Show) Schema() *expression.Schema {
+	return s.schema
+}
+
+//结果集的列
+type showColumn struct {
+	name string
+	tp   byte
+}
+
+func (b *planBuilder) buildShow(stmt *ast.ShowStmt) (Plan, error) {
+	p := &Show{Tp: stmt.Tp, Full: stmt.Full}
+	var columns []showColumn
+	switch stmt.Tp {
+	case ast.ShowDatabases:
+		columns = []showColumn{{"Database", mysql.TypeVarchar}}
+	case ast.ShowTables:
+		columns = []showColumn{{"Tables", mysql.TypeVarchar}}
+		if stmt.Full {
+			columns = append(columns, showColumn{"Table_type", mysql.TypeVarchar})
+		}
+		dbInfo, err := b.tableOpt.GetDatabase(stmt.DBName)
+		if err != nil {
+			return nil, err
+		}
+		if dbInfo == nil {
+			errStr := fmt.Sprintf("Unknown database '%s'", stmt.DBName)
+			return nil, errors.New(errStr)
+		}
+		p.DB = dbInfo
+	case ast.ShowColumns:
+		columns = []showColumn{
+			{"Field", mysql.TypeVarchar}, {"Type", mysql.TypeVarchar}, {"Null", mysql.TypeVarchar},
+			{"Key", mysql.TypeVarchar}, {"Default", mysql.TypeVarchar}, {"Extra", mysql.TypeVarchar},
+		}
+		if stmt.Column != nil {
+			p.Column = stmt.Column.Name.L
+		}
+	case ast.ShowIndex:
+		columns = []showColumn{
+			{"Table", mysql.TypeVarchar}, {"Non_unique", mysql.TypeLonglong}, {"Key_name", mysql.TypeVarchar},
+			{"Seq_in_index", mysql.TypeLonglong}, {"Column_name", mysql.TypeVarchar}, {"Null", mysql.TypeVarchar},
+			{"Index_type", mysql.TypeVarchar}, {"Visible", mysql.TypeVarchar},
+		}
+	case ast.ShowCreateTable:
+		columns = []showColumn{{"Table", mysql.TypeVarchar}, {"Create Table", mysql.TypeVarchar}}
+	default:
+		errStr := fmt.Sprintf("show type(%d) no support", stmt.Tp)
+		return nil, errors.New(errStr)
+	}
+	if stmt.Table != nil {
+		tableInfo, err := b.tableInfo(stmt.Table)
+		if err != nil || tableInfo == nil {
+			errStr := fmt.Sprintf("Table '%s' doesn't exist", stmt.Table.Name.O)
+			return nil, errors.New(errStr)
+		}
+		p.Table = tableInfo
+	}
+
+	p.schema = &expression.Schema{Columns: make([]*expression.SchemaColumn, 0, len(columns))}
+	for _, column := range columns {
+		p.schema.Columns = append(p.schema.Columns, &expression.SchemaColumn{
+			Name: strings.ToLower(column.name),
+			Info: &table.Column{Name: column.name, MysqlType: field_types.NewFieldType(column.tp)},
+		})
+	}
+	//LIKE匹配结果的第一列
+	if stmt.Pattern != nil {
+		stmt.Pattern.Expr = &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: model.NewCIStr(columns[0].name)}}
+		cond, err := expression.Build(stmt.Pattern, p.schema)
+		if err != nil {
+			return nil, err
+		}
+		p.Conditions = append(p.Conditions, cond)
+	}
+	if stmt.Where != nil {
+		cond, err := expression.Build(stmt.Where, p.schema)
+		if err != nil {
+			return nil, err
+		}
+		p.Conditions = append(p.Conditions, expression.SplitConjunction(cond)...)
+	}
+	return p, nil
+}
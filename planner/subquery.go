@@ -0,0 +1,309 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/expression"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+)
+
+//正在构造的子查询所在的外层查询 每进入一层子查询压入一个
+type subqueryScope struct {
+	schema          *expression.Schema             //外层查询的列
+	correlated      []*expression.CorrelatedColumn //子查询中引用的这一层的列
+	outerCorrelated bool                           //子查询引用了更外层查询的列
+}
+
+func (b *planBuilder) pushScope(schema *expression.Schema) *subqueryScope {
+	scope := &subqueryScope{schema: schema}
+	b.scopes = append(b.scopes, scope)
+	return scope
+}
+
+func (b *planBuilder) popScope() {
+	b.scopes = b.scopes[:len(b.scopes)-1]
+}
+
+//构造表达式 表达式中可以有子查询 aggFuncs为nil时不允许使用聚合函数
+func (b *planBuilder) buildExpr(expr ast.ExprNode, schema *expression.Schema, aggFuncs *[]*expression.AggFunc) (expression.Expression, error) {
+	return expression.BuildInContext(expr, schema, aggFuncs, b)
+}
+
+//在外层查询中查找列 从最近的一层开始 没有找到时返回nil
+func (b *planBuilder) OuterColumn(name *ast.ColumnName) (*expression.CorrelatedColumn, error) {
+	for i := len(b.scopes) - 1; i >= 0; i-- {
+		scope := b.scopes[i]
+		if !scope.schema.HasColumn(name) {
+			continue
+		}
+		offset, err := scope.schema.FindColumn(name)
+		if err != nil {
+			return nil, err
+		}
+		column := scope.schema.Columns[offset]
+		correlated := &expression.CorrelatedColumn{
+			Column: expression.Column{Offset: offset, Name: column.Name, Info: column.Info},
+			Data:   new(types.Datum),
+		}
+		scope.correlated = append(scope.correlated, correlated)
+		//中间各层子查询的结果随更外层的行变化
+		for _, inner := range b.scopes[i+1:] {
+			inner.outerCorrelated = true
+		}
+		return correlated, nil
+	}
+	return nil, nil
+}
+
+//构造子查询的物理计划 schema为子查询所在查询的列
+func (b *planBuilder) BuildSubquery(query *ast.SubqueryExpr, schema *expression.Schema) (*expression.Subquery, int, error) {
+	sel, ok := query.Query.(*ast.SelectStmt)
+	if !ok {
+		errStr := fmt.Sprintf("subquery(%T) no support", query.Query)
+		return nil, 0, errors.New(errStr)
+	}
+	scope := b.pushScope(schema)
+	p, err := b.buildSelect(sel)
+	b.popScope()
+	if err != nil {
+		return nil, 0, err
+	}
+	plan, err := optimizeLogicalPlan(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	columns := p.Schema().Columns
+	subquery := &expression.Subquery{
+		Plan:            plan,
+		Correlated:      scope.correlated,
+		OuterCorrelated: scope.outerCorrelated,
+		ResultType:      columns[0].Info.MysqlType,
+	}
+	return subquery, len(columns), nil
+}
+
+//按AND拆分where条件 去掉外层的括号
+func splitWhere(expr ast.ExprNode) []ast.ExprNode {
+	switch x := expr.(type) {
+	case *ast.BinaryOperationExpr:
+		if x.Op == opcode.LogicAnd {
+			return append(splitWhere(x.L), splitWhere(x.R)...)
+		}
+	case *ast.ParenthesesExpr:
+		return splitWhere(x.Expr)
+	}
+	return []ast.ExprNode{expr}
+}
+
+//去掉外层的NOT和括号 第二个返回值表示是否取反
+func unwrapNot(expr ast.ExprNode) (ast.ExprNode, bool) {
+	switch x := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return unwrapNot(x.Expr)
+	case *ast.UnaryOperationExpr:
+		if x.Op == opcode.Not {
+			e, not := unwrapNot(x.V)
+			return e, !not
+		}
+	}
+	return expr, false
+}
+
+//能否改写为半连接 子查询的结果不能依赖分组和行数
+func canSemiJoin(sel *ast.SelectStmt, in bool) bool {
+	if sel.From == nil || sel.Limit != nil || isAggregation(sel) {
+		return false
+	}
+	if in && (len(sel.Fields.Fields) != 1 || sel.Fields.Fields[0].WildCard != nil) {
+		return false
+	}
+	return true
+}
+
+//记录各层已经引用的列 改写失败时恢复
+type scopesSnapshot struct {
+	correlated      []int
+	outerCorrelated []bool
+}
+
+func (b *planBuilder) saveScopes() *scopesSnapshot {
+	snapshot := &scopesSnapshot{}
+	for _, scope := range b.scopes {
+		snapshot.correlated = append(snapshot.correlated, len(scope.correlated))
+		snapshot.outerCorrelated = append(snapshot.outerCorrelated, scope.outerCorrelated)
+	}
+	return snapshot
+}
+
+func (b *planBuilder) restoreScopes(snapshot *scopesSnapshot) {
+	for i, scope := range b.scopes {
+		scope.correlated = scope.correlated[:snapshot.correlated[i]]
+		scope.outerCorrelated = snapshot.outerCorrelated[i]
+	}
+}
+
+//把WHERE中的[NOT] IN和[NOT] EXISTS子查询改写为p和子查询的半连接 不能改写时返回nil
+//子查询WHERE中引用外层列的条件移到连接条件中 其余位置引用外层列时不能改写
+func (b *planBuilder) buildSemiJoin(p LogicalPlan, expr ast.ExprNode) (LogicalPlan, error) {
+	expr, not := unwrapNot(expr)
+	var query *ast.SubqueryExpr
+	var left ast.ExprNode
+	switch x := expr.(type) {
+	case *ast.ExistsSubqueryExpr:
+		query, _ = x.Sel.(*ast.SubqueryExpr)
+		not = not != x.Not
+	case *ast.PatternInExpr:
+		query, _ = x.Sel.(*ast.SubqueryExpr)
+		left = x.Expr
+		not = not != x.Not
+	}
+	if query == nil {
+		return nil, nil
+	}
+	sel, ok := query.Query.(*ast.SelectStmt)
+	if !ok || !canSemiJoin(sel, left != nil) {
+		return nil, nil
+	}
+	snapshot := b.saveScopes()
+	join, err := b.decorrelate(p, sel, left, not)
+	if err == nil && join == nil {
+		b.restoreScopes(snapshot)
+	}
+	return join, err
+}
+
+func (b *planBuilder) decorrelate(p LogicalPlan, sel *ast.SelectStmt, left ast.ExprNode, not bool) (LogicalPlan, error) {
+	var leftExpr expression.Expression
+	if left != nil {
+		var err error
+		leftExpr, err = b.buildExpr(left, p.Schema(), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scope := b.pushScope(p.Schema())
+	inner, field, err := b.buildSemiJoinInner(sel, left != nil)
+	b.popScope()
+	if err != nil {
+		return nil, err
+	}
+
+	//取出引用外层列的过滤条件
+	var pulled []expression.Expression
+	if selection, ok := inner.(*LogicalSelection); ok {
+		var rest []expression.Expression
+		for _, cond := range selection.Conditions {
+			if len(expression.ExtractCorrelatedColumns(cond)) > 0 {
+				pulled = append(pulled, cond)
+			} else {
+				rest = append(rest, cond)
+			}
+		}
+		if len(rest) == 0 {
+			inner = selection.children[0]
+		} else {
+			selection.Conditions = rest
+		}
+	}
+	//引用外层列的位置都在取出的条件和选择列中才能改写
+	found := make(map[*expression.CorrelatedColumn]bool)
+	for _, expr := range append(append([]expression.Expression{}, pulled...), field) {
+		if expr == nil {
+			continue
+		}
+		for _, column := range expression.ExtractCorrelatedColumns(expr) {
+			found[column] = true
+		}
+	}
+	for _, column := range scope.correlated {
+		if !found[column] {
+			return nil, nil
+		}
+	}
+
+	//子查询的列移到外层的列之后
+	nLeft := len(p.Schema().Columns)
+	conds := make([]expression.Expression, 0, len(pulled)+1)
+	for _, cond := range pulled {
+		e, ok := expression.Decorrelate(cond, scope.correlated, nLeft)
+		if !ok {
+			return nil, nil
+		}
+		conds = append(conds, e)
+	}
+	if left != nil {
+		nullable := !notNullColumn(leftExpr, p) || !notNullColumn(field, inner)
+		e, ok := expression.Decorrelate(field, scope.correlated, nLeft)
+		if !ok {
+			return nil, nil
+		}
+		cond, err := inCondition(leftExpr, e, not && nullable)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	joinType := SemiJoin
+	if not {
+		joinType = AntiSemiJoin
+	}
+	join := newLogicalJoin(joinType, p, inner)
+	join.OnConditions = conds
+	return join, nil
+}
+
+//半连接的右侧 IN时同时返回选择列
+func (b *planBuilder) buildSemiJoinInner(sel *ast.SelectStmt, in bool) (LogicalPlan, expression.Expression, error) {
+	p, err := b.buildResultSet(sel.From.TableRefs)
+	if err != nil {
+		return nil, nil, err
+	}
+	setLock(p, sel.LockTp)
+	p, err = b.buildWhere(p, sel.Where)
+	if err != nil || !in {
+		return p, nil, err
+	}
+	field, err := b.buildExpr(sel.Fields.Fields[0].Expr, p.Schema(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, field, nil
+}
+
+//IN改写后的连接条件 NOT IN中任意一边为NULL时比较结果为NULL 同样不能输出
+func inCondition(left, right expression.Expression, nullAware bool) (expression.Expression, error) {
+	eq, err := expression.NewFunction(ast.EQ, left, right)
+	if err != nil || !nullAware {
+		return eq, err
+	}
+	isNull, err := expression.NewFunction(ast.IsNull, eq)
+	if err != nil {
+		return nil, err
+	}
+	return expression.NewFunction(ast.LogicOr, eq, isNull)
+}
+
+//表达式是否为不会为NULL的列 外连接中的列可能为NULL
+func notNullColumn(expr expression.Expression, p LogicalPlan) bool {
+	column, ok := expr.(*expression.Column)
+	if !ok || column.Info == nil || !column.Info.NotNull() {
+		return false
+	}
+	return !hasOuterJoin(p)
+}
+
+func hasOuterJoin(p LogicalPlan) bool {
+	if join, ok := p.(*LogicalJoin); ok && (join.JoinType == LeftOuterJoin || join.JoinType == RightOuterJoin) {
+		return true
+	}
+	for _, child := range p.Children() {
+		if hasOuterJoin(child) {
+			return true
+		}
+	}
+	return false
+}
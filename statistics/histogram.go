@@ -0,0 +1,142 @@
+package statistics
+
+import (
+	"bytes"
+	"sort"
+)
+
+//直方图默认的桶数
+const DefaultBucketCount = 64
+
+//直方图的桶 桶内的键都在[Lower, Upper]内
+type Bucket struct {
+	Lower   []byte `json:"lower"`   //桶内最小的键
+	Upper   []byte `json:"upper"`   //桶内最大的键
+	Count   int64  `json:"count"`   //到这个桶为止的累计行数
+	Repeats int64  `json:"repeats"` //上界重复的次数
+}
+
+//等深直方图 建在编码后的键上 键按字节序排列
+//相同的键只出现在一个桶内
+type Histogram struct {
+	NDV     int64    `json:"ndv"`     //不同键的个数
+	Buckets []Bucket `json:"buckets"` //按上界从小到大排列
+}
+
+//直方图中的总行数
+func (h *Histogram) TotalCount() int64 {
+	if len(h.Buckets) == 0 {
+		return 0
+	}
+	return h.Buckets[len(h.Buckets)-1].Count
+}
+
+//小于key的行数估计 key落在桶内时按桶内行数的一半估计
+func (h *Histogram) lessCount(key []byte) float64 {
+	i := sort.Search(len(h.Buckets), func(i int) bool {
+		return bytes.Compare(h.Buckets[i].Upper, key) >= 0
+	})
+	if i == len(h.Buckets) {
+		return float64(h.TotalCount())
+	}
+	var prev int64
+	if i > 0 {
+		prev = h.Buckets[i-1].Count
+	}
+	bucket := h.Buckets[i]
+	if bytes.Compare(key, bucket.Lower) <= 0 {
+		return float64(prev)
+	}
+	if bytes.Equal(bucket.Upper, key) {
+		return float64(bucket.Count - bucket.Repeats)
+	}
+	return float64(prev) + float64(bucket.Count-bucket.Repeats-prev)/2
+}
+
+//范围[startKey, endKey)内的行数估计 endKey为空表示没有上界
+//范围内没有键时估计为1行 不会估计为0行
+func (h *Histogram) RangeCount(startKey, endKey []byte) float64 {
+	total := float64(h.TotalCount())
+	if total == 0 {
+		return 0
+	}
+	high := total
+	if len(endKey) > 0 {
+		if bytes.Compare(startKey, endKey) >= 0 {
+			return 0
+		}
+		high = h.lessCount(endKey)
+	}
+	count := high - h.lessCount(startKey)
+	if count < 1 {
+		count = 1
+	}
+	if count > total {
+		count = total
+	}
+	return count
+}
+
+//平均每个键的行数
+func (h *Histogram) AvgCount() float64 {
+	if h.NDV == 0 {
+		return 0
+	}
+	return float64(h.TotalCount()) / float64(h.NDV)
+}
+
+//按顺序加入键构造直方图
+type HistogramBuilder struct {
+	bucketSize int64 //每个桶的行数
+	inBucket   int64 //最后一个桶中的行数
+	hist       *Histogram
+}
+
+//rows为将要加入的行数 用来确定每个桶的大小
+func NewHistogramBuilder(rows int64, buckets int) *HistogramBuilder {
+	if buckets <= 0 {
+		buckets = DefaultBucketCount
+	}
+	size := (rows + int64(buckets) - 1) / int64(buckets)
+	if size < 1 {
+		size = 1
+	}
+	return &HistogramBuilder{bucketSize: size, hist: &Histogram{}}
+}
+
+//加入一个键 键必须按从小到大的顺序加入
+func (b *HistogramBuilder) Add(key []byte) {
+	h := b.hist
+	n := len(h.Buckets)
+	if n > 0 && bytes.Equal(h.Buckets[n-1].Upper, key) {
+		//相同的键放在同一个桶中
+		h.Buckets[n-1].Count++
+		h.Buckets[n-1].Repeats++
+		b.inBucket++
+		return
+	}
+	h.NDV++
+	if n == 0 || b.inBucket >= b.bucketSize {
+		var count int64
+		if n > 0 {
+			count = h.Buckets[n-1].Count
+		}
+		h.Buckets = append(h.Buckets, Bucket{
+			Lower:   append([]byte{}, key...),
+			Upper:   append([]byte{}, key...),
+			Count:   count + 1,
+			Repeats: 1,
+		})
+		b.inBucket = 1
+		return
+	}
+	bucket := &h.Buckets[n-1]
+	bucket.Upper = append(bucket.Upper[:0], key...)
+	bucket.Count++
+	bucket.Repeats = 1
+	b.inBucket++
+}
+
+func (b *HistogramBuilder) Histogram() *Histogram {
+	return b.hist
+}
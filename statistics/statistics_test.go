@@ -0,0 +1,61 @@
+package statistics
+
+import (
+	"testing"
+
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+)
+
+func key(v uint64) []byte {
+	return codekey.EncodeUint(nil, v)
+}
+
+func TestHistogram(t *testing.T) {
+	//1..100各一行 50重复50次
+	builder := NewHistogramBuilder(150, 10)
+	for i := uint64(1); i <= 100; i++ {
+		builder.Add(key(i))
+		if i == 50 {
+			for j := 0; j < 50; j++ {
+				builder.Add(key(i))
+			}
+		}
+	}
+	h := builder.Histogram()
+	if h.TotalCount() != 150 || h.NDV != 100 {
+		t.Fatalf("got count %d ndv %d", h.TotalCount(), h.NDV)
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i].Count <= h.Buckets[i-1].Count {
+			t.Fatalf("bucket %d count is not increasing", i)
+		}
+	}
+	cases := []struct {
+		start, end []byte
+		min, max   float64
+	}{
+		{key(0), nil, 150, 150},
+		{key(1), key(11), 5, 20},
+		{key(50), key(51), 40, 60},
+		{key(60), key(101), 30, 50},
+		{key(200), nil, 0, 2},
+		{key(10), key(10), 0, 0},
+	}
+	for i, ca := range cases {
+		count := h.RangeCount(ca.start, ca.end)
+		if count < ca.min || count > ca.max {
+			t.Fatalf("case %d: got %v, want [%v, %v]", i, count, ca.min, ca.max)
+		}
+	}
+}
+
+func TestEmptyHistogram(t *testing.T) {
+	h := NewHistogramBuilder(0, 0).Histogram()
+	if h.RangeCount(key(0), nil) != 0 || h.AvgCount() != 0 {
+		t.Fatal("empty histogram should estimate no rows")
+	}
+	stats := NewTable(10)
+	if stats.Scale(5, 20) != 10 {
+		t.Fatal("estimation should scale with the row count")
+	}
+}
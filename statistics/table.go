@@ -0,0 +1,20 @@
+package statistics
+
+//表的统计信息 由ANALYZE TABLE收集
+type Table struct {
+	Count   int64                 `json:"count"`   //收集时的行数
+	Rows    *Histogram            `json:"rows"`    //行键上的直方图 数字主键的范围按行键估算
+	Indices map[uint64]*Histogram `json:"indices"` //索引上的直方图 键为索引id 建在去掉行号的索引键上
+}
+
+func NewTable(count int64) *Table {
+	return &Table{Count: count, Indices: make(map[uint64]*Histogram)}
+}
+
+//按当前行数修正估计值 收集之后表的行数可能已经变化
+func (t *Table) Scale(count float64, rows uint64) float64 {
+	if t.Count <= 0 {
+		return count
+	}
+	return count * float64(rows) / float64(t.Count)
+}
@@ -4,6 +4,9 @@ import "os"
 
 const TableIdsKey = "tableIds"
 
+//分配过的最大表id 只增不减 删除的表的id不会再分配
+const MaxTableIdKey = "maxTableId"
+
 //目录是否存在--rocksdb使用
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
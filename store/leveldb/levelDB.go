@@ -7,7 +7,6 @@ import (
 	"sync"
 
 	"github.com/CDDSCLab/chaosdb/common/kv"
-	"github.com/CDDSCLab/chaosdb/comparator"
 	"github.com/CDDSCLab/chaosdb/store/common"
 	"github.com/CDDSCLab/chaosdb/table"
 	"github.com/CDDSCLab/chaosdb/util/stringutil"
@@ -26,6 +25,7 @@ var leveldbLogger = logging.MustGetLogger("levelDB")
 type LevelIter struct {
 	iterator iterator.Iterator
 	valid    bool
+	reverse  bool //逆序迭代 Next移动到前一个键
 }
 
 func (iter *LevelIter) Close() {
@@ -43,6 +43,10 @@ func (iter *LevelIter) Value() []byte {
 }
 
 func (iter *LevelIter) Next() {
+	if iter.reverse {
+		iter.valid = iter.iterator.Prev()
+		return
+	}
 	iter.valid = iter.iterator.Next()
 }
 
@@ -55,15 +59,44 @@ func (iter *LevelIter) ValidForPrefix(prefix []byte) bool {
 }
 
 func (iter *LevelIter) Seek(key []byte) kv.RowsIterator {
-	iter.iterator.Seek(key)
+	iter.valid = iter.iterator.Seek(key)
+	if iter.reverse {
+		//逆序时移动到不大于key的最后一个键
+		if !iter.valid {
+			iter.valid = iter.iterator.Last()
+		} else if bytes.Compare(iter.iterator.Key(), key) > 0 {
+			iter.valid = iter.iterator.Prev()
+		}
+	}
 	return iter
 }
 
 type LevelDB struct {
 	db         *leveldb.DB
 	TableIds   []uint64
+	MaxTableId uint64 //分配过的最大表id
 	TableInfos map[string]*table.MyTableInfo
 	mu         sync.RWMutex
+	cacheMu    sync.RWMutex //修改表结构时其他语句同时读取表信息缓存
+}
+
+//从缓存获取表信息
+func (ld *LevelDB) CachedTableInfo(tableName string) (*table.MyTableInfo, bool) {
+	ld.cacheMu.RLock()
+	defer ld.cacheMu.RUnlock()
+	tableInfo, ok := ld.TableInfos[tableName]
+	return tableInfo, ok
+}
+
+//存入缓存 tableInfo为nil时从缓存删除
+func (ld *LevelDB) CacheTableInfo(tableName string, tableInfo *table.MyTableInfo) {
+	ld.cacheMu.Lock()
+	defer ld.cacheMu.Unlock()
+	if tableInfo == nil {
+		delete(ld.TableInfos, tableName)
+		return
+	}
+	ld.TableInfos[tableName] = tableInfo
 }
 
 func (ld *LevelDB) Get(key []byte) ([]byte, error) {
@@ -128,6 +161,21 @@ func (ld *LevelDB) NewScanIterator(startKey, endKey []byte) kv.RowsIterator {
 	return iter
 }
 
+func (ld *LevelDB) NewReverseScanIterator(startKey, endKey []byte) kv.RowsIterator {
+
+	ld.mu.RLock()
+	defer ld.mu.RUnlock()
+
+	rangeKey := &util.Range{Start: startKey, Limit: endKey}
+
+	ro := &opt.ReadOptions{}
+	ro.GetDontFillCache()
+	it := ld.db.NewIterator(rangeKey, ro)
+	iter := &LevelIter{iterator: it, valid: it.Last(), reverse: true}
+
+	return iter
+}
+
 func (ld *LevelDB) Put(key, value []byte) error {
 	ld.mu.Lock()
 	defer ld.mu.Unlock()
@@ -189,6 +237,35 @@ func (ld *LevelDB) BatchDelete(keys [][]byte) error {
 	return nil
 }
 
+//所有修改写入同一个leveldb.Batch
+func (ld *LevelDB) Write(b *kv.Batch) error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	batch := &leveldb.Batch{}
+	for _, pair := range b.Pairs() {
+		if pair.Value == nil {
+			batch.Delete(pair.Key)
+		} else {
+			batch.Put(pair.Key, pair.Value)
+		}
+	}
+	err := ld.db.Write(batch, nil)
+	if err != nil {
+		leveldbLogger.Errorf("[levelDB][Write] error(%s)", err)
+		return err
+	}
+	return nil
+}
+
+//压缩范围内的数据 回收已删除的键占用的空间
+func (ld *LevelDB) CompactRange(startKey, endKey []byte) error {
+	err := ld.db.CompactRange(util.Range{Start: startKey, Limit: endKey})
+	if err != nil {
+		leveldbLogger.Errorf("[levelDB][CompactRange] error(%s)", err)
+	}
+	return err
+}
+
 func (ld *LevelDB) Close() error {
 	return ld.db.Close()
 }
@@ -211,10 +288,9 @@ func NewLevelDB(path, dbName string) (*LevelDB, error) {
 		return nil, err
 	}
 
-	comparator := &comparator.StringAndNumberComparator{}
+	//键使用codekey的memcomparable编码 直接使用leveldb默认的字节序比较器
 	opt := &opt.Options{}
 	//opt.BlockCacheCapacity = 600 * 1024 * 1024
-	opt.Comparer = comparator
 
 	if path == "" {
 		d, err = leveldb.Open(storage.NewMemStorage(), opt)
@@ -2,13 +2,15 @@ package leveldb
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/CDDSCLab/chaosdb/common/kv"
 	"github.com/CDDSCLab/chaosdb/store/common"
 
 	jsoniter "github.com/json-iterator/go"
-	"github.com/pingcap/tidb/model"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
 )
 
 func TestT(t *testing.T) {
@@ -29,6 +31,11 @@ func (s *LevelDBSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *LevelDBSuite) TearDownTest(c *C) {
+	c.Assert(s.storage.Close(), IsNil)
+	os.RemoveAll("./leveldb_data")
+}
+
 func (s *LevelDBSuite) TestKit(c *C) {
 	s.mustPutOK(c)
 	s.mustBatchPutOk(c)
@@ -91,8 +98,9 @@ func (s *LevelDBSuite) mustDeleteOK(c *C) {
 	key := []byte(common.TableIdsKey)
 	err := s.storage.Delete(key)
 	c.Assert(err, IsNil)
-	s.storage.Get(key)
-	c.Assert(err, NotNil)
+	value, err := s.storage.Get(key)
+	c.Assert(err, IsNil)
+	c.Assert(value, IsNil)
 }
 
 func (s *LevelDBSuite) mustBatchDeleteOK(c *C) {
@@ -103,8 +111,9 @@ func (s *LevelDBSuite) mustBatchDeleteOK(c *C) {
 	keys = append(keys, []byte(key1), []byte(key2), []byte(key3))
 	err := s.storage.BatchDelete(keys)
 	c.Assert(err, IsNil)
-	s.storage.Get([]byte(key1))
-	c.Assert(err, NotNil)
+	value, err := s.storage.Get([]byte(key1))
+	c.Assert(err, IsNil)
+	c.Assert(value, IsNil)
 }
 
 func (s *LevelDBSuite) mustScanOK(c *C) {
@@ -195,3 +204,44 @@ func (s *LevelDBSuite) scanIter(c *C) {
 	}
 	s.storage.BatchDelete(keys)
 }
+
+func (s *LevelDBSuite) TestReverseScan(c *C) {
+	keys := [][]byte{[]byte("k1"), []byte("k2"), []byte("k3"), []byte("k4"), []byte("k5")}
+	values := [][]byte{[]byte("v1"), []byte("v2"), []byte("v3"), []byte("v4"), []byte("v5")}
+	c.Assert(s.storage.BatchPut(keys, values), IsNil)
+	defer s.storage.BatchDelete(keys)
+
+	collect := func(iter kv.RowsIterator) []string {
+		var got []string
+		for ; iter.Valid(); iter.Next() {
+			got = append(got, string(iter.Key()))
+		}
+		iter.Close()
+		return got
+	}
+	c.Assert(collect(s.storage.NewReverseScanIterator([]byte("k2"), []byte("k5"))), DeepEquals, []string{"k4", "k3", "k2"})
+	c.Assert(collect(s.storage.NewReverseScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k5", "k4", "k3", "k2", "k1"})
+	c.Assert(collect(s.storage.NewReverseScanIterator([]byte("k6"), []byte("k7"))), IsNil)
+
+	iter := s.storage.NewReverseScanIterator([]byte("k1"), []byte("k5"))
+	c.Assert(collect(iter.Seek([]byte("k3"))), DeepEquals, []string{"k3", "k2", "k1"})
+	iter = s.storage.NewReverseScanIterator([]byte("k1"), []byte("k5"))
+	c.Assert(collect(iter.Seek([]byte("k25"))), DeepEquals, []string{"k2", "k1"})
+}
+
+func (s *LevelDBSuite) TestWrite(c *C) {
+	c.Assert(s.storage.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v2")}), IsNil)
+	batch := kv.NewBatch()
+	batch.Put([]byte("k3"), []byte("v3"))
+	batch.Delete([]byte("k1"))
+	batch.Put([]byte("k2"), []byte("x2"))
+	batch.Put([]byte("k2"), []byte("y2"))
+	c.Assert(batch.Len(), Equals, 4)
+	c.Assert(s.storage.Write(batch), IsNil)
+	pairs := s.storage.Scan([]byte("k"), []byte("l"), 10)
+	var got []string
+	for _, pair := range pairs {
+		got = append(got, string(pair.Key)+"="+string(pair.Value))
+	}
+	c.Assert(got, DeepEquals, []string{"k2=y2", "k3=v3"})
+}
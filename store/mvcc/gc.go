@@ -0,0 +1,111 @@
+package mvcc
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+)
+
+//后台GC的默认间隔
+const DefaultGCInterval = 10 * time.Minute
+
+//每批删除的旧版本数
+const gcBatchSize = 1024
+
+//启动后台GC 每隔interval清理一次旧版本 Close时停止
+func (s *Store) StartGC(interval time.Duration) {
+	s.gcStop = make(chan struct{})
+	s.gcDone = make(chan struct{})
+	go func() {
+		defer close(s.gcDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, err := s.GC()
+				if err != nil {
+					mvccLogger.Errorf("[mvcc][GC] error(%s)", err)
+				}
+			case <-s.gcStop:
+				return
+			}
+		}
+	}()
+}
+
+//支持压缩指定范围的底层存储
+type compactor interface {
+	CompactRange(startKey, endKey []byte) error
+}
+
+//清理安全点之前的旧版本 返回删除的版本数
+//每个键只保留安全点时可见的版本和之后的版本 安全点时可见的版本为删除标记时也一起删除
+func (s *Store) GC() (int, error) {
+	start, end := versionRange(nil, nil)
+	return s.gc(start, end)
+}
+
+//清理原始键范围内的旧版本 再压缩底层存储中的这个范围 用于删除大量数据后回收空间
+//有活跃快照能看到的版本暂时保留 由之后的GC清理
+func (s *Store) Reclaim(startKey, endKey []byte) (int, error) {
+	start, end := versionRange(startKey, endKey)
+	deleted, err := s.gc(start, end)
+	if err != nil {
+		return deleted, err
+	}
+	if c, ok := s.db.(compactor); ok {
+		err = c.CompactRange(start, end)
+	}
+	return deleted, err
+}
+
+//清理版本键范围内的旧版本
+func (s *Store) gc(start, end []byte) (int, error) {
+	safePoint := s.safePoint()
+	iter := s.db.NewScanIterator(start, end)
+	defer iter.Close()
+	var deleteKeys [][]byte
+	deleted := 0
+	var userKey []byte
+	visible := false //当前键已经找到安全点时可见的版本
+	for ; iter.Valid(); iter.Next() {
+		rawKey := iter.Key()
+		if !bytes.Equal(rawKey[:len(rawKey)-tsLen], userKey) {
+			userKey, visible = rawKey[:len(rawKey)-tsLen], false
+		}
+		_, ts, err := codekey.DecodeUintDesc(rawKey[len(rawKey)-tsLen:])
+		if err != nil {
+			return deleted, err
+		}
+		if ts > safePoint {
+			continue
+		}
+		if visible {
+			deleteKeys = append(deleteKeys, rawKey)
+		} else {
+			visible = true
+			value := iter.Value()
+			if len(value) == 0 || value[0] == flagDelete {
+				deleteKeys = append(deleteKeys, rawKey)
+			}
+		}
+		if len(deleteKeys) >= gcBatchSize {
+			err = s.db.BatchDelete(deleteKeys)
+			if err != nil {
+				return deleted, err
+			}
+			deleted += len(deleteKeys)
+			deleteKeys = deleteKeys[:0]
+		}
+	}
+	if len(deleteKeys) > 0 {
+		err := s.db.BatchDelete(deleteKeys)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(deleteKeys)
+	}
+	return deleted, nil
+}
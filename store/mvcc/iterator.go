@@ -0,0 +1,106 @@
+package mvcc
+
+import (
+	"bytes"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+)
+
+//快照上的迭代器 每个键只返回快照时间戳之前最新的版本 跳过已删除的键
+type mvccIterator struct {
+	iter    kv.RowsIterator //底层存储上版本键的迭代器
+	ts      uint64
+	reverse bool
+	key     []byte
+	value   []byte
+	valid   bool
+	release func()              //关闭时释放快照
+	reads   map[string]struct{} //不为nil时记录读到的键
+}
+
+func (s *Store) newIterator(startKey, endKey []byte, ts uint64, reverse bool, release func(), reads map[string]struct{}) *mvccIterator {
+	start, end := versionRange(startKey, endKey)
+	it := &mvccIterator{ts: ts, reverse: reverse, release: release, reads: reads}
+	if reverse {
+		it.iter = s.db.NewReverseScanIterator(start, end)
+	} else {
+		it.iter = s.db.NewScanIterator(start, end)
+	}
+	it.next()
+	return it
+}
+
+//读完一个键的全部版本 选出快照可见的版本
+//正序时新版本在前 取第一个可见的版本 逆序时旧版本在前 取最后一个可见的版本
+func (it *mvccIterator) next() {
+	for it.iter.Valid() {
+		rawKey := it.iter.Key()
+		userKey := rawKey[:len(rawKey)-tsLen]
+		var value []byte
+		found := false
+		for ; it.iter.Valid(); it.iter.Next() {
+			rawKey = it.iter.Key()
+			if !bytes.Equal(rawKey[:len(rawKey)-tsLen], userKey) {
+				break
+			}
+			_, ts, _ := codekey.DecodeUintDesc(rawKey[len(rawKey)-tsLen:])
+			if ts <= it.ts && (it.reverse || !found) {
+				value, found = it.iter.Value(), true
+			}
+		}
+		if !found || len(value) == 0 || value[0] == flagDelete {
+			continue
+		}
+		_, key, err := decodeUserKey(userKey)
+		if err != nil {
+			mvccLogger.Errorf("[mvcc][next] decode key error(%s)", err)
+			continue
+		}
+		it.key, it.value, it.valid = key, value[1:], true
+		if it.reads != nil {
+			it.reads[string(key)] = struct{}{}
+		}
+		return
+	}
+	it.key, it.value, it.valid = nil, nil, false
+}
+
+func (it *mvccIterator) Key() []byte {
+	return it.key
+}
+
+func (it *mvccIterator) Value() []byte {
+	return it.value
+}
+
+func (it *mvccIterator) Next() {
+	it.next()
+}
+
+func (it *mvccIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *mvccIterator) ValidForPrefix(prefix []byte) bool {
+	return it.valid && bytes.HasPrefix(it.key, prefix)
+}
+
+func (it *mvccIterator) Close() {
+	it.iter.Close()
+	if it.release != nil {
+		it.release()
+		it.release = nil
+	}
+}
+
+//逆序时移动到键的最后一个版本 才能读到这个键的全部版本
+func (it *mvccIterator) Seek(key []byte) kv.RowsIterator {
+	if it.reverse {
+		it.iter.Seek(encodeKey(key, 0))
+	} else {
+		it.iter.Seek(encodeUserKey(key))
+	}
+	it.next()
+	return it
+}
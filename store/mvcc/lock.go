@@ -0,0 +1,163 @@
+package mvcc
+
+import (
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+)
+
+//默认的等锁超时时间
+const DefaultLockWaitTimeout = 50 * time.Second
+
+//一个键上的锁 可以有多个共享锁或一个排他锁
+type keyLock struct {
+	holders map[uint64]bool //持有锁的事务 值为是否为排他锁
+	wake    chan struct{}   //释放锁时关闭 唤醒等待的事务
+}
+
+//键的锁表 事务用开始时间戳标识 等锁时记录等待图检测死锁
+type lockTable struct {
+	locks   map[string]*keyLock
+	owned   map[uint64][]string            //事务持有锁的键
+	waitFor map[uint64]map[uint64]struct{} //等锁的事务和它等待的事务
+	timeout time.Duration
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{
+		locks:   make(map[string]*keyLock),
+		owned:   make(map[uint64][]string),
+		waitFor: make(map[uint64]map[uint64]struct{}),
+		timeout: DefaultLockWaitTimeout,
+	}
+}
+
+//设置等锁超时时间
+func (s *Store) SetLockWaitTimeout(timeout time.Duration) {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	s.lockTable.timeout = timeout
+}
+
+//锁是否可以授予txnId 只有自己持有时共享锁可以升级为排他锁
+func (l *keyLock) grantable(txnId uint64, exclusive bool) bool {
+	for holder, x := range l.holders {
+		if holder == txnId {
+			continue
+		}
+		if exclusive || x {
+			return false
+		}
+	}
+	return true
+}
+
+//给一组键加锁 全部可以授予时一起授予 否则不持有新锁等待
+//等待的事务不会拿着一部分锁阻塞其他事务 提交时的加锁不会因为键的顺序形成死锁
+//等待会形成环时返回kv.ErrDeadlock 超时返回kv.ErrLockWaitTimeout
+func (s *Store) lock(txnId uint64, keys [][]byte, exclusive bool) error {
+	s.lockMu.Lock()
+	deadline := time.Now().Add(s.lockTable.timeout)
+	for {
+		lt := s.lockTable
+		blocker := lt.blocker(txnId, keys, exclusive)
+		if blocker == nil {
+			lt.grant(txnId, keys, exclusive)
+			delete(lt.waitFor, txnId)
+			s.lockMu.Unlock()
+			return nil
+		}
+		waits := make(map[uint64]struct{}, len(blocker.holders))
+		for holder := range blocker.holders {
+			if holder != txnId {
+				waits[holder] = struct{}{}
+			}
+		}
+		lt.waitFor[txnId] = waits
+		//请求锁的事务是形成环的最后一个 作为牺牲者
+		if lt.deadlocked(txnId) {
+			delete(lt.waitFor, txnId)
+			s.lockMu.Unlock()
+			return kv.ErrDeadlock
+		}
+		wake := blocker.wake
+		s.lockMu.Unlock()
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-wake:
+			timer.Stop()
+			s.lockMu.Lock()
+		case <-timer.C:
+			s.lockMu.Lock()
+			delete(s.lockTable.waitFor, txnId)
+			s.lockMu.Unlock()
+			return kv.ErrLockWaitTimeout
+		}
+	}
+}
+
+//第一个不能授予的锁 全部可以授予时返回nil
+func (lt *lockTable) blocker(txnId uint64, keys [][]byte, exclusive bool) *keyLock {
+	for _, key := range keys {
+		if l, ok := lt.locks[string(key)]; ok && !l.grantable(txnId, exclusive) {
+			return l
+		}
+	}
+	return nil
+}
+
+func (lt *lockTable) grant(txnId uint64, keys [][]byte, exclusive bool) {
+	for _, key := range keys {
+		k := string(key)
+		l, ok := lt.locks[k]
+		if !ok {
+			l = &keyLock{holders: make(map[uint64]bool), wake: make(chan struct{})}
+			lt.locks[k] = l
+		}
+		if x, held := l.holders[txnId]; held {
+			l.holders[txnId] = x || exclusive
+			continue
+		}
+		l.holders[txnId] = exclusive
+		lt.owned[txnId] = append(lt.owned[txnId], k)
+	}
+}
+
+//等待图中从txnId出发能否回到txnId
+func (lt *lockTable) deadlocked(txnId uint64) bool {
+	visited := make(map[uint64]bool)
+	stack := []uint64{txnId}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for next := range lt.waitFor[cur] {
+			if next == txnId {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return false
+}
+
+//释放事务持有的全部锁
+func (s *Store) unlockAll(txnId uint64) {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	lt := s.lockTable
+	for _, k := range lt.owned[txnId] {
+		l := lt.locks[k]
+		delete(l.holders, txnId)
+		close(l.wake)
+		l.wake = make(chan struct{})
+		if len(l.holders) == 0 {
+			delete(lt.locks, k)
+		}
+	}
+	delete(lt.owned, txnId)
+	delete(lt.waitFor, txnId)
+}
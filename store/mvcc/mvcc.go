@@ -0,0 +1,325 @@
+package mvcc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/op/go-logging"
+)
+
+var mvccLogger = logging.MustGetLogger("mvcc")
+
+//多版本键的前缀 和底层存储中的其他键分开
+var versionPrefix = []byte("v")
+
+//版本值的第一个字节
+const (
+	flagPut    byte = 'p'
+	flagDelete byte = 'd'
+)
+
+//版本键为前缀 加memcomparable编码的原始键 加8字节逆序的提交时间戳
+//同一个键的版本相邻 新版本在前
+const tsLen = 8
+
+//多版本存储 每次提交写入带提交时间戳的新版本 读取时读快照时间戳之前最新的版本
+//Store本身也实现kv.Storage 每次读取使用最新的快照 每次写入单独提交
+type Store struct {
+	db     kv.Storage
+	mu     sync.Mutex     //分配时间戳和提交互斥 保证分配的读时间戳之前的提交都已写入
+	lastTs uint64         //最后分配的时间戳
+	active map[uint64]int //正在读取的快照时间戳 GC不清理它们能看到的版本
+
+	lockMu    sync.Mutex //保护锁表
+	lockTable *lockTable
+
+	gcStop chan struct{}
+	gcDone chan struct{}
+	once   sync.Once
+}
+
+//最大的提交时间戳 和提交的版本在同一次写入中保存 不在版本键的范围内
+var lastTsKey = []byte("mvcc_last_ts")
+
+//打开多版本存储 之后分配的时间戳都大于已经提交的时间戳 不依赖系统时间
+func NewStore(db kv.Storage) (*Store, error) {
+	s := &Store{db: db, active: make(map[uint64]int), lockTable: newLockTable()}
+	value, err := db.Get(lastTsKey)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		//没有保存时间戳的旧数据 从全部版本中找出最大的提交时间戳
+		s.lastTs, err = s.maxVersionTs()
+	} else {
+		_, s.lastTs, err = codekey.DecodeUint(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) maxVersionTs() (uint64, error) {
+	start, end := versionRange(nil, nil)
+	iter := s.db.NewScanIterator(start, end)
+	defer iter.Close()
+	var maxTs uint64
+	for ; iter.Valid(); iter.Next() {
+		rawKey := iter.Key()
+		_, ts, err := codekey.DecodeUintDesc(rawKey[len(rawKey)-tsLen:])
+		if err != nil {
+			return 0, err
+		}
+		if ts > maxTs {
+			maxTs = ts
+		}
+	}
+	return maxTs, nil
+}
+
+//分配新的时间戳 使用纳秒时间 保证单调递增 重启后仍然大于之前提交的时间戳
+func (s *Store) nextTs() uint64 {
+	ts := uint64(time.Now().UnixNano())
+	if ts <= s.lastTs {
+		ts = s.lastTs + 1
+	}
+	s.lastTs = ts
+	return ts
+}
+
+//分配读时间戳并登记为活跃快照 读完后调用release
+func (s *Store) acquire() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := s.nextTs()
+	s.active[ts]++
+	return ts
+}
+
+func (s *Store) release(ts uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[ts]--
+	if s.active[ts] <= 0 {
+		delete(s.active, ts)
+	}
+}
+
+//分配当前读使用的时间戳 不登记为活跃快照
+//加锁的事务开始时间戳一直是活跃快照 GC不会清理这个时间戳能看到的最新版本
+func (s *Store) currentTs() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextTs()
+}
+
+//GC的安全点 没有活跃快照时为最后分配的时间戳
+func (s *Store) safePoint() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	safePoint := s.lastTs
+	for ts := range s.active {
+		if ts < safePoint {
+			safePoint = ts
+		}
+	}
+	return safePoint
+}
+
+//提交前的冲突检查 键在ts之后有新的提交时冲突
+type conflictCheck struct {
+	key []byte
+	ts  uint64
+}
+
+//用新的提交时间戳写入一组修改 值为nil时写入删除标记
+//先检查checks中的键 有冲突时返回kv.ConflictError
+//所有版本和新的最大提交时间戳在一次BatchPut中写入
+func (s *Store) commit(pairs []kv.Pair, checks []conflictCheck) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, check := range checks {
+		ts, err := s.latestTs(check.key)
+		if err != nil {
+			return err
+		}
+		if ts > check.ts {
+			return &kv.ConflictError{Key: check.key, StartTs: check.ts, ConflictTs: ts}
+		}
+	}
+	commitTs := s.nextTs()
+	keys := make([][]byte, 0, len(pairs)+1)
+	values := make([][]byte, 0, len(pairs)+1)
+	for _, pair := range pairs {
+		keys = append(keys, encodeKey(pair.Key, commitTs))
+		values = append(values, encodeValue(pair.Value))
+	}
+	keys = append(keys, lastTsKey)
+	values = append(values, codekey.EncodeUint(nil, commitTs))
+	return s.db.BatchPut(keys, values)
+}
+
+//键最新版本的提交时间戳 没有版本时为0
+func (s *Store) latestTs(key []byte) (uint64, error) {
+	prefix := encodeUserKey(key)
+	iter := s.db.NewScanIterator(prefix, codekey.PrefixNext(prefix))
+	defer iter.Close()
+	if !iter.Valid() {
+		return 0, nil
+	}
+	rawKey := iter.Key()
+	_, ts, err := codekey.DecodeUintDesc(rawKey[len(rawKey)-tsLen:])
+	return ts, err
+}
+
+//键的全部版本共同的前缀
+func encodeUserKey(key []byte) []byte {
+	b := make([]byte, 0, len(versionPrefix)+len(key)+len(key)/8+9+tsLen)
+	b = append(b, versionPrefix...)
+	return codekey.EncodeBytes(b, key)
+}
+
+func encodeKey(key []byte, ts uint64) []byte {
+	return codekey.EncodeUintDesc(encodeUserKey(key), ts)
+}
+
+//解码版本键中的原始键 返回剩余的时间戳部分
+func decodeUserKey(b []byte) ([]byte, []byte, error) {
+	if !bytes.HasPrefix(b, versionPrefix) {
+		errStr := fmt.Sprintf("invalid mvcc key(%x)", b)
+		return nil, nil, errors.New(errStr)
+	}
+	return codekey.DecodeBytes(b[len(versionPrefix):])
+}
+
+func encodeValue(value []byte) []byte {
+	if value == nil {
+		return []byte{flagDelete}
+	}
+	b := make([]byte, 0, len(value)+1)
+	b = append(b, flagPut)
+	return append(b, value...)
+}
+
+//原始键的范围对应的版本键范围 endKey为空时不限制上界
+func versionRange(startKey, endKey []byte) ([]byte, []byte) {
+	start := encodeUserKey(startKey)
+	if len(endKey) == 0 {
+		return start, codekey.PrefixNext(versionPrefix)
+	}
+	return start, encodeUserKey(endKey)
+}
+
+//最新快照上读取
+func (s *Store) Get(key []byte) ([]byte, error) {
+	ts := s.acquire()
+	defer s.release(ts)
+	return s.get(key, ts)
+}
+
+//读取ts时可见的值 键不存在或已删除时返回nil
+func (s *Store) get(key []byte, ts uint64) ([]byte, error) {
+	prefix := encodeUserKey(key)
+	iter := s.db.NewScanIterator(encodeKey(key, ts), codekey.PrefixNext(prefix))
+	defer iter.Close()
+	if !iter.Valid() {
+		return nil, nil
+	}
+	value := iter.Value()
+	if len(value) == 0 || value[0] == flagDelete {
+		return nil, nil
+	}
+	return value[1:], nil
+}
+
+func (s *Store) BatchGet(keys [][]byte) ([][]byte, error) {
+	ts := s.acquire()
+	defer s.release(ts)
+	var values [][]byte
+	for _, key := range keys {
+		value, err := s.get(key, ts)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (s *Store) Scan(startKey, endKey []byte, limit int) []kv.Pair {
+	return scan(s.NewScanIterator(startKey, endKey), limit)
+}
+
+func scan(iter kv.RowsIterator, limit int) []kv.Pair {
+	defer iter.Close()
+	var pairs []kv.Pair
+	for ; iter.Valid() && len(pairs) < limit; iter.Next() {
+		pairs = append(pairs, kv.Pair{Key: iter.Key(), Value: iter.Value()})
+	}
+	return pairs
+}
+
+//迭代器使用创建时的快照 关闭迭代器后释放快照
+func (s *Store) NewScanIterator(startKey, endKey []byte) kv.RowsIterator {
+	ts := s.acquire()
+	return s.newIterator(startKey, endKey, ts, false, func() { s.release(ts) }, nil)
+}
+
+func (s *Store) NewReverseScanIterator(startKey, endKey []byte) kv.RowsIterator {
+	ts := s.acquire()
+	return s.newIterator(startKey, endKey, ts, true, func() { s.release(ts) }, nil)
+}
+
+func (s *Store) Put(key, value []byte) error {
+	return s.BatchPut([][]byte{key}, [][]byte{value})
+}
+
+func (s *Store) BatchPut(keys, values [][]byte) error {
+	pairs := make([]kv.Pair, 0, len(keys))
+	for i, key := range keys {
+		if values[i] == nil {
+			err := errors.New("value is can not be nil")
+			return err
+		}
+		pairs = append(pairs, kv.Pair{Key: key, Value: values[i]})
+	}
+	return s.commit(pairs, nil)
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.BatchDelete([][]byte{key})
+}
+
+func (s *Store) BatchDelete(keys [][]byte) error {
+	pairs := make([]kv.Pair, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, kv.Pair{Key: key})
+	}
+	return s.commit(pairs, nil)
+}
+
+//一组修改在同一个提交时间戳写入
+func (s *Store) Write(batch *kv.Batch) error {
+	return s.commit(batch.Pairs(), nil)
+}
+
+//停止后台GC 底层存储由创建者关闭
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		if s.gcStop != nil {
+			close(s.gcStop)
+			<-s.gcDone
+		}
+	})
+	return nil
+}
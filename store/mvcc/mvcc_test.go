@@ -0,0 +1,329 @@
+package mvcc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/store/leveldb"
+
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type MvccSuite struct {
+	dir   string
+	db    *leveldb.LevelDB
+	store *Store
+}
+
+var _ = Suite(&MvccSuite{})
+
+func (s *MvccSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "mvcc")
+	c.Assert(err, IsNil)
+	s.db, err = leveldb.NewLevelDB(s.dir, "mvcc_test")
+	c.Assert(err, IsNil)
+	s.store, err = NewStore(s.db)
+	c.Assert(err, IsNil)
+}
+
+func (s *MvccSuite) TearDownTest(c *C) {
+	c.Assert(s.store.Close(), IsNil)
+	c.Assert(s.db.Close(), IsNil)
+	os.RemoveAll(s.dir)
+}
+
+func collect(iter kv.RowsIterator) []string {
+	var got []string
+	for ; iter.Valid(); iter.Next() {
+		got = append(got, string(iter.Key())+"="+string(iter.Value()))
+	}
+	iter.Close()
+	return got
+}
+
+//底层存储中版本的个数
+func (s *MvccSuite) versions() int {
+	start, end := versionRange(nil, nil)
+	return len(s.db.Scan(start, end, 1<<20))
+}
+
+func (s *MvccSuite) TestSnapshot(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2"), []byte("k3")},
+		[][]byte{[]byte("v1"), []byte("v2"), []byte("v3")}), IsNil)
+	txn := s.store.Begin()
+	iter := s.store.NewScanIterator([]byte("k"), []byte("l"))
+	reverse := s.store.NewReverseScanIterator([]byte("k"), []byte("l"))
+
+	//快照之后的提交不可见
+	c.Assert(s.store.Put([]byte("k2"), []byte("x2")), IsNil)
+	c.Assert(s.store.Delete([]byte("k3")), IsNil)
+	c.Assert(s.store.Put([]byte("k4"), []byte("x4")), IsNil)
+	c.Assert(collect(iter), DeepEquals, []string{"k1=v1", "k2=v2", "k3=v3"})
+	c.Assert(collect(reverse), DeepEquals, []string{"k3=v3", "k2=v2", "k1=v1"})
+	value, err := txn.Get([]byte("k3"))
+	c.Assert(err, IsNil)
+	c.Assert(string(value), Equals, "v3")
+	c.Assert(collect(txn.NewReverseScanIterator([]byte("k"), []byte("l")).Seek([]byte("k2"))), DeepEquals,
+		[]string{"k2=v2", "k1=v1"})
+	txn.Rollback()
+
+	//新的读取看到最新的版本
+	value, err = s.store.Get([]byte("k3"))
+	c.Assert(err, IsNil)
+	c.Assert(value, IsNil)
+	c.Assert(collect(s.store.NewScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k1=v1", "k2=x2", "k4=x4"})
+	c.Assert(collect(s.store.NewReverseScanIterator([]byte("k"), nil)), DeepEquals, []string{"k4=x4", "k2=x2", "k1=v1"})
+	c.Assert(collect(s.store.NewScanIterator([]byte("k"), nil).Seek([]byte("k3"))), DeepEquals, []string{"k4=x4"})
+}
+
+func (s *MvccSuite) TestTxn(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v2")}), IsNil)
+	txn := s.store.Begin()
+	c.Assert(txn.Put([]byte("k1"), []byte("x1")), IsNil)
+	c.Assert(txn.Delete([]byte("k2")), IsNil)
+	c.Assert(txn.Put([]byte("k3"), []byte("x3")), IsNil)
+	c.Assert(collect(txn.NewScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k1=x1", "k3=x3"})
+
+	//提交前其他读取看不到 提交后一起可见
+	other := s.store.Begin()
+	c.Assert(collect(s.store.NewScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k1=v1", "k2=v2"})
+	c.Assert(txn.Commit(), IsNil)
+	c.Assert(collect(s.store.NewScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k1=x1", "k3=x3"})
+	c.Assert(collect(other.NewScanIterator([]byte("k"), []byte("l"))), DeepEquals, []string{"k1=v1", "k2=v2"})
+	other.Rollback()
+}
+
+func (s *MvccSuite) TestGC(c *C) {
+	for _, value := range []string{"a", "b", "c"} {
+		c.Assert(s.store.Put([]byte("k1"), []byte(value)), IsNil)
+	}
+	c.Assert(s.store.Put([]byte("k2"), []byte("a")), IsNil)
+	c.Assert(s.store.Delete([]byte("k2")), IsNil)
+	c.Assert(s.versions(), Equals, 5)
+
+	//活跃的快照能看到的版本不会被清理
+	txn := s.store.Begin()
+	c.Assert(s.store.Put([]byte("k1"), []byte("d")), IsNil)
+	deleted, err := s.store.GC()
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, 4)
+	value, err := txn.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(string(value), Equals, "c")
+	txn.Rollback()
+
+	deleted, err = s.store.GC()
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, 1)
+	c.Assert(s.versions(), Equals, 1)
+	c.Assert(collect(s.store.NewScanIterator(nil, nil)), DeepEquals, []string{"k1=d"})
+}
+
+func (s *MvccSuite) TestConflict(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v2")}), IsNil)
+
+	//写写冲突
+	txn1, txn2 := s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.Put([]byte("k1"), []byte("x1")), IsNil)
+	c.Assert(txn2.Delete([]byte("k1")), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	err := txn2.Commit()
+	c.Assert(kv.IsRetryable(err), IsTrue)
+	c.Assert(err.(*kv.ConflictError).Key, DeepEquals, []byte("k1"))
+
+	//迭代器读到的键被修改
+	txn1 = s.store.Begin()
+	c.Assert(collect(txn1.NewScanIterator([]byte("k2"), nil)), DeepEquals, []string{"k2=v2"})
+	c.Assert(txn1.Put([]byte("k3"), []byte("x3")), IsNil)
+	c.Assert(s.store.Put([]byte("k2"), []byte("y2")), IsNil)
+	c.Assert(kv.IsRetryable(txn1.Commit()), IsTrue)
+
+	//只读事务和没有交集的事务都能提交
+	txn1, txn2 = s.store.Begin(), s.store.Begin()
+	_, err = txn1.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(txn2.Put([]byte("k1"), []byte("z1")), IsNil)
+	c.Assert(txn2.Commit(), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	txn1, txn2 = s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.Put([]byte("k1"), []byte("w1")), IsNil)
+	c.Assert(txn2.Put([]byte("k2"), []byte("w2")), IsNil)
+	c.Assert(txn2.Commit(), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	c.Assert(collect(s.store.NewScanIterator(nil, nil)), DeepEquals, []string{"k1=w1", "k2=w2"})
+}
+
+//等待txn在锁上等待
+func (s *MvccSuite) waitBlocked(txn *Txn) {
+	for {
+		s.store.lockMu.Lock()
+		_, ok := s.store.lockTable.waitFor[txn.startTs]
+		s.store.lockMu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *MvccSuite) TestLock(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v2")}), IsNil)
+	s.store.SetLockWaitTimeout(50 * time.Millisecond)
+
+	//加锁后读到开始之后提交的版本 提交时不冲突
+	txn1, txn2 := s.store.Begin(), s.store.Begin()
+	c.Assert(s.store.Put([]byte("k1"), []byte("x1")), IsNil)
+	c.Assert(txn1.LockKeys(true, []byte("k1")), IsNil)
+	value, err := txn1.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(string(value), Equals, "x1")
+	c.Assert(txn1.Put([]byte("k1"), []byte("y1")), IsNil)
+
+	//排他锁和其他锁不兼容 等锁超时
+	c.Assert(txn2.LockKeys(false, []byte("k1")), Equals, kv.ErrLockWaitTimeout)
+	c.Assert(txn1.Commit(), IsNil)
+	c.Assert(txn2.LockKeys(true, []byte("k1")), IsNil)
+	txn2.Rollback()
+
+	//共享锁互相兼容 只有自己持有共享锁时可以升级
+	txn1, txn2 = s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.LockKeys(false, []byte("k1")), IsNil)
+	c.Assert(txn2.LockKeys(false, []byte("k1")), IsNil)
+	c.Assert(txn1.LockKeys(true, []byte("k1")), Equals, kv.ErrLockWaitTimeout)
+	txn2.Rollback()
+	c.Assert(txn1.LockKeys(true, []byte("k1")), IsNil)
+	txn1.Rollback()
+
+	//提交时写入的键等待其他事务的锁
+	s.store.SetLockWaitTimeout(DefaultLockWaitTimeout)
+	txn1, txn2 = s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.LockKeys(true, []byte("k2")), IsNil)
+	c.Assert(txn2.Put([]byte("k2"), []byte("x2")), IsNil)
+	done := make(chan error)
+	go func() {
+		done <- txn2.Commit()
+	}()
+	s.waitBlocked(txn2)
+	txn1.Rollback()
+	c.Assert(<-done, IsNil)
+
+	//形成环的加锁请求返回死锁 回滚后另一个事务拿到锁
+	txn1, txn2 = s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.LockKeys(true, []byte("k1")), IsNil)
+	c.Assert(txn2.LockKeys(true, []byte("k2")), IsNil)
+	go func() {
+		done <- txn1.LockKeys(true, []byte("k2"))
+	}()
+	s.waitBlocked(txn1)
+	c.Assert(txn2.LockKeys(true, []byte("k1")), Equals, kv.ErrDeadlock)
+	c.Assert(kv.IsRetryable(kv.ErrDeadlock), IsTrue)
+	txn2.Rollback()
+	c.Assert(<-done, IsNil)
+	txn1.Rollback()
+	c.Assert(s.store.lockTable.locks, HasLen, 0)
+}
+
+func (s *MvccSuite) TestRelock(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("10"), []byte("20")}), IsNil)
+
+	//加锁后其他事务提交了修改 再次加锁时不能读取新版本
+	txn1, txn2 := s.store.Begin(), s.store.Begin()
+	c.Assert(txn1.LockKeys(true, []byte("k1")), IsNil)
+	value, err := txn2.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(txn2.Put([]byte("k1"), append(value, '0')), IsNil)
+	c.Assert(txn1.Put([]byte("k1"), []byte("11")), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	err = txn2.LockKeys(true, []byte("k1"))
+	_, ok := err.(*kv.ConflictError)
+	c.Assert(ok, IsTrue)
+	txn2.Rollback()
+
+	//读过的键在加锁前被修改时冲突 没有修改时保持原来的读时间戳
+	txn1 = s.store.Begin()
+	_, err = txn1.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(s.store.Put([]byte("k1"), []byte("12")), IsNil)
+	err = txn1.LockKeys(true, []byte("k1"))
+	_, ok = err.(*kv.ConflictError)
+	c.Assert(ok, IsTrue)
+	txn1.Rollback()
+	txn1 = s.store.Begin()
+	_, err = txn1.Get([]byte("k2"))
+	c.Assert(err, IsNil)
+	c.Assert(txn1.LockKeys(true, []byte("k2")), IsNil)
+	c.Assert(txn1.LockKeys(true, []byte("k2")), IsNil)
+	c.Assert(txn1.Put([]byte("k2"), []byte("21")), IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	value, err = s.store.Get([]byte("k2"))
+	c.Assert(err, IsNil)
+	c.Assert(string(value), Equals, "21")
+}
+
+func (s *MvccSuite) TestWrite(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v2")}), IsNil)
+	txn := s.store.Begin()
+	batch := kv.NewBatch()
+	batch.Put([]byte("k3"), []byte("v3"))
+	batch.Delete([]byte("k1"))
+	c.Assert(s.store.Write(batch), IsNil)
+
+	//一组修改使用同一个提交时间戳
+	ts1, err := s.store.latestTs([]byte("k1"))
+	c.Assert(err, IsNil)
+	ts3, err := s.store.latestTs([]byte("k3"))
+	c.Assert(err, IsNil)
+	c.Assert(ts1, Equals, ts3)
+	c.Assert(collect(s.store.NewScanIterator(nil, nil)), DeepEquals, []string{"k2=v2", "k3=v3"})
+	c.Assert(collect(txn.NewScanIterator(nil, nil)), DeepEquals, []string{"k1=v1", "k2=v2"})
+
+	batch = kv.NewBatch()
+	batch.Delete([]byte("k2"))
+	c.Assert(txn.Write(batch), IsNil)
+	c.Assert(collect(txn.NewScanIterator(nil, nil)), DeepEquals, []string{"k1=v1"})
+	txn.Rollback()
+}
+
+func (s *MvccSuite) TestReopen(c *C) {
+	//重新打开后的时间戳大于之前提交的时间戳 即使系统时间回拨
+	future := uint64(time.Now().Add(time.Hour).UnixNano())
+	s.store.lastTs = future
+	c.Assert(s.store.Put([]byte("k1"), []byte("v1")), IsNil)
+	store, err := NewStore(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(store.Put([]byte("k1"), []byte("v2")), IsNil)
+	ts, err := store.latestTs([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(ts > future+1, IsTrue)
+	value, err := store.Get([]byte("k1"))
+	c.Assert(err, IsNil)
+	c.Assert(string(value), Equals, "v2")
+
+	//没有保存时间戳时从已有的版本中恢复
+	c.Assert(s.db.Delete(lastTsKey), IsNil)
+	store, err = NewStore(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(store.lastTs, Equals, ts)
+	c.Assert(s.versions(), Equals, 2)
+}
+
+func (s *MvccSuite) TestReclaim(c *C) {
+	c.Assert(s.store.BatchPut([][]byte{[]byte("a1"), []byte("k1"), []byte("k2")}, [][]byte{[]byte("v1"), []byte("v1"), []byte("v2")}), IsNil)
+	c.Assert(s.store.Put([]byte("k1"), []byte("x1")), IsNil)
+	c.Assert(s.store.BatchDelete([][]byte{[]byte("a1"), []byte("k1"), []byte("k2")}), IsNil)
+	c.Assert(s.versions(), Equals, 7)
+
+	//只清理范围内的版本
+	deleted, err := s.store.Reclaim([]byte("k"), []byte("l"))
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, 5)
+	c.Assert(s.versions(), Equals, 2)
+}
@@ -0,0 +1,222 @@
+package mvcc
+
+import (
+	"errors"
+
+	"github.com/CDDSCLab/chaosdb/common/kv"
+	"github.com/CDDSCLab/chaosdb/util/stringutil"
+)
+
+//乐观事务 读取开始时间戳的快照和自己的写入 提交时写入新版本
+//提交前检查读过和写入的键 开始之后有其他事务提交了这些键时返回kv.ConflictError
+//加锁前没有访问过的键读取加锁之后的最新版本 冲突检查也从加锁时开始
+type Txn struct {
+	store   *Store
+	startTs uint64
+	buffer  *kv.MemBuffer       //写集合
+	reads   map[string]struct{} //读集合 只记录从快照读到的键
+	locked  map[string]uint64   //加锁的键和加锁后的读时间戳
+	done    bool                //已经提交或回滚
+}
+
+//开始事务
+func (s *Store) Begin() *Txn {
+	return &Txn{
+		store:   s,
+		startTs: s.acquire(),
+		buffer:  kv.NewMemBuffer(),
+		reads:   make(map[string]struct{}),
+		locked:  make(map[string]uint64),
+	}
+}
+
+//事务开始时间戳
+func (txn *Txn) StartTs() uint64 {
+	return txn.startTs
+}
+
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	if value, ok := txn.buffer.Get(key); ok {
+		//事务中删除的键
+		if value == nil {
+			return nil, nil
+		}
+		return stringutil.MakeCopy(value), nil
+	}
+	txn.reads[string(key)] = struct{}{}
+	return txn.store.get(key, txn.readTs(key))
+}
+
+//读取键使用的时间戳 加锁的键读取加锁时的最新版本
+func (txn *Txn) readTs(key []byte) uint64 {
+	if ts, ok := txn.locked[string(key)]; ok {
+		return ts
+	}
+	return txn.startTs
+}
+
+//给键加共享锁或排他锁 锁在事务结束时释放
+//其他事务持有冲突的锁时等待 死锁时返回kv.ErrDeadlock 超时返回kv.ErrLockWaitTimeout
+//加锁前访问过的键在访问之后有其他事务提交时返回kv.ConflictError
+func (txn *Txn) LockKeys(exclusive bool, keys ...[]byte) error {
+	if txn.done {
+		return errors.New("transaction is finished")
+	}
+	err := txn.store.lock(txn.startTs, keys, exclusive)
+	if err != nil {
+		return err
+	}
+	ts := txn.store.currentTs()
+	for _, key := range keys {
+		//加锁前已经读过或写入的键不能改为读取最新版本 否则提交时检查不到期间其他事务的提交
+		if readTs, ok := txn.accessedTs(key); ok {
+			latest, err := txn.store.latestTs(key)
+			if err != nil {
+				return err
+			}
+			if latest > readTs {
+				return &kv.ConflictError{Key: key, StartTs: txn.startTs, ConflictTs: latest}
+			}
+			continue
+		}
+		txn.locked[string(key)] = ts
+	}
+	return nil
+}
+
+//事务已经读过或写入的键使用的读时间戳 没有访问过时第二个返回值为false
+func (txn *Txn) accessedTs(key []byte) (uint64, bool) {
+	if ts, ok := txn.locked[string(key)]; ok {
+		return ts, true
+	}
+	if _, ok := txn.reads[string(key)]; ok {
+		return txn.startTs, true
+	}
+	if _, ok := txn.buffer.Get(key); ok {
+		return txn.startTs, true
+	}
+	return 0, false
+}
+
+func (txn *Txn) BatchGet(keys [][]byte) ([][]byte, error) {
+	var values [][]byte
+	for _, key := range keys {
+		value, err := txn.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (txn *Txn) Scan(startKey, endKey []byte, limit int) []kv.Pair {
+	return scan(txn.NewScanIterator(startKey, endKey), limit)
+}
+
+//迭代器创建后事务中的写入对它不可见
+func (txn *Txn) NewScanIterator(startKey, endKey []byte) kv.RowsIterator {
+	base := txn.store.newIterator(startKey, endKey, txn.startTs, false, nil, txn.reads)
+	return kv.NewUnionIterator(base, txn.buffer.Pairs(startKey, endKey), false)
+}
+
+func (txn *Txn) NewReverseScanIterator(startKey, endKey []byte) kv.RowsIterator {
+	base := txn.store.newIterator(startKey, endKey, txn.startTs, true, nil, txn.reads)
+	return kv.NewUnionIterator(base, txn.buffer.Pairs(startKey, endKey), true)
+}
+
+func (txn *Txn) Put(key, value []byte) error {
+	if value == nil {
+		err := errors.New("value is can not be nil")
+		return err
+	}
+	txn.buffer.Set(stringutil.MakeCopy(key), stringutil.MakeCopy(value))
+	return nil
+}
+
+func (txn *Txn) BatchPut(keys, values [][]byte) error {
+	for i, key := range keys {
+		err := txn.Put(key, values[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (txn *Txn) Delete(key []byte) error {
+	txn.buffer.Set(stringutil.MakeCopy(key), nil)
+	return nil
+}
+
+func (txn *Txn) BatchDelete(keys [][]byte) error {
+	for _, key := range keys {
+		txn.buffer.Set(stringutil.MakeCopy(key), nil)
+	}
+	return nil
+}
+
+func (txn *Txn) Write(batch *kv.Batch) error {
+	for _, pair := range batch.Pairs() {
+		if pair.Value == nil {
+			txn.buffer.Set(stringutil.MakeCopy(pair.Key), nil)
+		} else {
+			txn.buffer.Set(stringutil.MakeCopy(pair.Key), stringutil.MakeCopy(pair.Value))
+		}
+	}
+	return nil
+}
+
+//关闭时丢弃没有提交的写入
+func (txn *Txn) Close() error {
+	txn.Rollback()
+	return nil
+}
+
+//释放快照和锁 之后GC可以清理事务能看到的旧版本
+func (txn *Txn) finish() {
+	if !txn.done {
+		txn.done = true
+		txn.store.unlockAll(txn.startTs)
+		txn.store.release(txn.startTs)
+	}
+}
+
+//只读事务直接结束 快照隔离下不需要检查
+func (txn *Txn) Commit() error {
+	if txn.done {
+		return nil
+	}
+	//检查完成后再释放快照 避免检查时GC清理了开始之后提交的删除标记
+	defer txn.finish()
+	pairs := txn.buffer.Pairs(nil, nil)
+	if len(pairs) == 0 {
+		return nil
+	}
+	//写入的键加排他锁 等待持有锁的事务结束
+	keys := make([][]byte, 0, len(pairs))
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	err := txn.store.lock(txn.startTs, keys, true)
+	if err != nil {
+		return err
+	}
+	checks := make([]conflictCheck, 0, len(pairs)+len(txn.reads))
+	for _, pair := range pairs {
+		checks = append(checks, conflictCheck{key: pair.Key, ts: txn.readTs(pair.Key)})
+	}
+	for key := range txn.reads {
+		if _, ok := txn.buffer.Get([]byte(key)); !ok {
+			checks = append(checks, conflictCheck{key: []byte(key), ts: txn.readTs([]byte(key))})
+		}
+	}
+	return txn.store.commit(pairs, checks)
+}
+
+func (txn *Txn) Rollback() {
+	txn.finish()
+	txn.buffer = kv.NewMemBuffer()
+	txn.reads = make(map[string]struct{})
+	txn.locked = make(map[string]uint64)
+}
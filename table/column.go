@@ -0,0 +1,278 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/types"
+)
+
+//修改表结构不重写已有的行 行按列id编码 解码时按当前表结构处理：
+//已删除列的值被忽略 之后添加的列取添加时的默认值 修改过类型的列转换为新的类型
+
+//列修改前写入的行中没有该列时的取值
+func (c *Column) OriginDatum() (types.Datum, error) {
+	//建表时就有的列
+	if c.Version == 0 {
+		return c.DefaultDatum()
+	}
+	if c.OriginDefault == nil {
+		return types.Datum{}, nil
+	}
+	return c.ParseValue(*c.OriginDefault)
+}
+
+//分配新的列id 删除的列id不会被重新使用
+func (t *MyTableInfo) nextColumnId() uint64 {
+	t.initMaxColumnId()
+	t.MaxColumnId++
+	return t.MaxColumnId
+}
+
+//没有记录最大列id的旧表 列id按建表时的位置分配 取现有的最大值
+//第一次修改表结构之前还没有删除过列
+func (t *MyTableInfo) initMaxColumnId() {
+	if t.MaxColumnId != 0 {
+		return
+	}
+	for _, column := range t.Columns {
+		if column.Idx > t.MaxColumnId {
+			t.MaxColumnId = column.Idx
+		}
+	}
+}
+
+//列在表中的位置 不存在返回-1
+func (t *MyTableInfo) ColumnOffsetByName(name string) int {
+	for i, column := range t.Columns {
+		if column.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//按FIRST和AFTER计算列的插入位置 没有指定时为defaultOffset
+func (t *MyTableInfo) positionOffset(pos *ast.ColumnPosition, defaultOffset int) (int, error) {
+	if pos == nil {
+		return defaultOffset, nil
+	}
+	switch pos.Tp {
+	case ast.ColumnPositionFirst:
+		return 0, nil
+	case ast.ColumnPositionAfter:
+		name := pos.RelativeColumn.Name.L
+		offset := t.ColumnOffsetByName(name)
+		if offset < 0 {
+			errStr := fmt.Sprintf("Unknown column '%s' in '%s'", name, t.TableName)
+			return 0, errors.New(errStr)
+		}
+		return offset + 1, nil
+	}
+	return defaultOffset, nil
+}
+
+//在offset处插入列
+func (t *MyTableInfo) insertColumn(column *Column, offset int) {
+	t.Columns = append(t.Columns, nil)
+	copy(t.Columns[offset+1:], t.Columns[offset:])
+	t.Columns[offset] = column
+}
+
+//删除offset处的列
+func (t *MyTableInfo) removeColumn(offset int) {
+	t.Columns = append(t.Columns[:offset], t.Columns[offset+1:]...)
+}
+
+//添加列 已有的行中该列取添加时的默认值
+func (t *MyTableInfo) AddColumn(column *Column, pos *ast.ColumnPosition) error {
+	if t.ColumnOffsetByName(column.Name) >= 0 {
+		errStr := fmt.Sprintf("Duplicate column name '%s'", column.Name)
+		return errors.New(errStr)
+	}
+	offset, err := t.positionOffset(pos, len(t.Columns))
+	if err != nil {
+		return err
+	}
+	origin, err := column.DefaultDatum()
+	if err != nil {
+		return err
+	}
+	if !origin.IsNull() {
+		value, err := origin.ToString()
+		if err != nil {
+			return err
+		}
+		column.OriginDefault = &value
+	}
+	t.SchemaVersion++
+	column.Idx = t.nextColumnId()
+	column.Version = t.SchemaVersion
+	t.insertColumn(column, offset)
+	t.BuildColumnList()
+	return nil
+}
+
+//删除列 已有的行中该列的值在读取时被忽略
+func (t *MyTableInfo) DropColumn(name string) error {
+	offset := t.ColumnOffsetByName(name)
+	if offset < 0 {
+		errStr := fmt.Sprintf("Can't DROP '%s'; check that column/key exists", name)
+		return errors.New(errStr)
+	}
+	if len(t.Columns) == 1 {
+		return errors.New("You can't delete all columns with ALTER TABLE; use DROP TABLE instead")
+	}
+	column := t.Columns[offset]
+	if t.PriKey != nil && t.PriKey.Idx == column.Idx {
+		errStr := fmt.Sprintf("can't drop primary key column %s", name)
+		return errors.New(errStr)
+	}
+	for _, index := range t.IndexList() {
+		if index.HasColumn(name) {
+			errStr := fmt.Sprintf("can't drop column %s with index %s covered now", name, index.Name)
+			return errors.New(errStr)
+		}
+	}
+	t.initMaxColumnId()
+	t.SchemaVersion++
+	t.removeColumn(offset)
+	t.BuildColumnList()
+	return nil
+}
+
+//修改列的名称 类型 约束和位置 类型只能加宽 已有的行在读取时转换为新的类型
+func (t *MyTableInfo) ModifyColumn(oldName string, column *Column, pos *ast.ColumnPosition) error {
+	offset := t.ColumnOffsetByName(oldName)
+	if offset < 0 {
+		errStr := fmt.Sprintf("Unknown column '%s' in '%s'", oldName, t.TableName)
+		return errors.New(errStr)
+	}
+	old := t.Columns[offset]
+	if column.Name != oldName && t.ColumnOffsetByName(column.Name) >= 0 {
+		errStr := fmt.Sprintf("Duplicate column name '%s'", column.Name)
+		return errors.New(errStr)
+	}
+	isPriKey := t.PriKey != nil && t.PriKey.Idx == old.Idx
+	if isPriKey {
+		//修改列时不能定义自增 保留主键列原有的自增
+		column.MysqlType.Flag |= mysql.NotNullFlag | mysql.PriKeyFlag | old.MysqlType.Flag&mysql.AutoIncrementFlag
+	}
+	err := checkModifyType(old.MysqlType, column.MysqlType)
+	if err != nil {
+		return err
+	}
+	//已有的行中可能有NULL值
+	if column.NotNull() && !old.NotNull() {
+		errStr := fmt.Sprintf("Unsupported modify column: can't set NOT NULL on nullable column %s", oldName)
+		return errors.New(errStr)
+	}
+
+	t.SchemaVersion++
+	column.Idx = old.Idx
+	column.OriginDefault = old.OriginDefault
+	column.Version = old.Version
+	if !sameType(old.MysqlType, column.MysqlType) {
+		column.Version = t.SchemaVersion
+	}
+	t.removeColumn(offset)
+	newOffset, err := t.positionOffset(pos, offset)
+	if err != nil {
+		t.insertColumn(old, offset)
+		return err
+	}
+	t.insertColumn(column, newOffset)
+	if isPriKey {
+		t.PriKey = column
+	}
+	//索引按列名记录
+	if column.Name != oldName {
+		for _, index := range t.Indices {
+			for i, name := range index.Columns {
+				if name == oldName {
+					index.Columns[i] = column.Name
+				}
+			}
+		}
+	}
+	t.BuildColumnList()
+	return nil
+}
+
+//修改列的默认值 defaultValue为nil时删除默认值 不影响已有的行
+func (t *MyTableInfo) SetColumnDefault(name string, defaultValue *string) error {
+	offset := t.ColumnOffsetByName(name)
+	if offset < 0 {
+		errStr := fmt.Sprintf("Unknown column '%s' in '%s'", name, t.TableName)
+		return errors.New(errStr)
+	}
+	column := *t.Columns[offset]
+	column.DefaultValue = defaultValue
+	if t.PriKey != nil && t.PriKey.Idx == column.Idx {
+		t.PriKey = &column
+	}
+	t.Columns[offset] = &column
+	t.SchemaVersion++
+	return nil
+}
+
+func sameType(old, new *field_types.FieldType) bool {
+	return old.Tp == new.Tp && old.Flen == new.Flen && old.Decimal == new.Decimal &&
+		mysql.HasUnsignedFlag(old.Flag) == mysql.HasUnsignedFlag(new.Flag) && old.Charset == new.Charset
+}
+
+//整数类型按取值范围排序
+var integerRanks = map[byte]int{
+	mysql.TypeTiny:     1,
+	mysql.TypeShort:    2,
+	mysql.TypeInt24:    3,
+	mysql.TypeLong:     4,
+	mysql.TypeLonglong: 5,
+}
+
+//只允许不会截断已有数据的修改：整数加宽 FLOAT改为DOUBLE 字符串加长
+//索引键中这些类型的编码不变 修改后不需要重建索引
+func checkModifyType(old, new *field_types.FieldType) error {
+	if sameType(old, new) {
+		return nil
+	}
+	unsupported := func(reason string) error {
+		errStr := fmt.Sprintf("Unsupported modify column: %s", reason)
+		return errors.New(errStr)
+	}
+	if mysql.HasUnsignedFlag(old.Flag) != mysql.HasUnsignedFlag(new.Flag) {
+		return unsupported("can't change unsigned integer to signed or vice versa")
+	}
+	if old.Charset != new.Charset {
+		return unsupported("charset can't be changed")
+	}
+	if oldRank, ok := integerRanks[old.Tp]; ok {
+		newRank, ok := integerRanks[new.Tp]
+		if !ok || newRank < oldRank {
+			return unsupported(fmt.Sprintf("type %s not match origin %s", new, old))
+		}
+		return nil
+	}
+	switch old.Tp {
+	case mysql.TypeFloat, mysql.TypeDouble:
+		if new.Tp != mysql.TypeDouble && new.Tp != old.Tp {
+			return unsupported(fmt.Sprintf("type %s not match origin %s", new, old))
+		}
+		if new.Flen != types.UnspecifiedLength || new.Decimal != types.UnspecifiedLength {
+			return unsupported("precision of float can't be changed")
+		}
+		return nil
+	case mysql.TypeVarchar, mysql.TypeVarString, mysql.TypeString:
+		if new.Tp != mysql.TypeVarchar && new.Tp != mysql.TypeVarString && new.Tp != old.Tp {
+			return unsupported(fmt.Sprintf("type %s not match origin %s", new, old))
+		}
+		if new.Flen < old.Flen {
+			return unsupported(fmt.Sprintf("length %d is less than origin %d", new.Flen, old.Flen))
+		}
+		return nil
+	}
+	return unsupported(fmt.Sprintf("type %s not match origin %s", new, old))
+}
@@ -0,0 +1,53 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//没有指定数据库时使用的数据库 打开时已经存在的表都在这个数据库中
+const DefaultDatabase = "test"
+
+//数据库信息 数据库id为0的默认数据库不单独存储
+type DBInfo struct {
+	Id   uint64 `json:"db_id"`   //数据库的唯一id
+	Name string `json:"db_name"` //数据库名称
+}
+
+//默认数据库的信息
+func DefaultDBInfo() *DBInfo {
+	return &DBInfo{Id: 0, Name: DefaultDatabase}
+}
+
+//按表名存储的元数据使用的名称
+//默认数据库中的表为表名 和没有数据库之前的键相同 其他数据库中的表以"数据库id."为前缀
+func FullTableName(dbId uint64, tableName string) string {
+	if dbId == 0 {
+		return tableName
+	}
+	return fmt.Sprintf("%d.%s", dbId, tableName)
+}
+
+//数据库中表的元数据名称的前缀
+func (db *DBInfo) TablePrefix() string {
+	return FullTableName(db.Id, "")
+}
+
+func (db *DBInfo) FullTableName(tableName string) string {
+	return FullTableName(db.Id, tableName)
+}
+
+//表的元数据名称
+func (t *MyTableInfo) FullName() string {
+	return FullTableName(t.DBId, t.TableName)
+}
+
+//表名中不能有数据库前缀使用的分隔符
+func CheckTableName(tableName string) error {
+	if tableName == "" || strings.Contains(tableName, ".") {
+		errStr := fmt.Sprintf("Incorrect table name '%s'", tableName)
+		return errors.New(errStr)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CDDSCLab/chaosdb/util/codekey"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//联合主键对应的唯一索引名称
+const PrimaryIndexName = "primary"
+
+//索引状态 在已有数据的表上新建的索引回填完成前只写不读
+type IndexState int
+
+const (
+	IndexStatePublic    IndexState = iota //修改数据时维护 查询可以使用 没有记录状态的旧索引都是可用的
+	IndexStateWriteOnly                   //修改数据时维护 查询不使用
+)
+
+//索引结构 一个索引可以包含多个列 每行数据在索引中只有一条记录
+type Index struct {
+	Id      uint64     `json:"id"`      //索引id 在表内唯一
+	Name    string     `json:"name"`    //索引名称
+	Columns []string   `json:"columns"` //索引列名称 按定义顺序排列
+	Unique  bool       `json:"unique"`  //是否为唯一索引
+	State   IndexState `json:"state"`   //索引状态
+}
+
+//回填索引的进度 和回填的索引键在同一个事务中写入
+type BackfillProgress struct {
+	IndexId uint64 `json:"index_id"` //回填的索引
+	NextKey []byte `json:"next_key"` //下一批开始的行键 为空时从第一行开始
+	Rows    uint64 `json:"rows"`     //已经回填的行数
+	Done    bool   `json:"-"`        //全部行都已回填
+}
+
+//添加索引 没有指定索引名称时使用第一列的名称
+func (t *MyTableInfo) AddIndex(name string, columnNames []string, unique bool) (*Index, error) {
+	if len(columnNames) == 0 {
+		return nil, errors.New("index must have at least one column")
+	}
+	for _, columnName := range columnNames {
+		_, err := t.FindCol(t.Columns, columnName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.Indices == nil {
+		t.Indices = make(map[string]*Index)
+	}
+	name = strings.ToLower(name)
+	if name == "" {
+		//和mysql一样 重名时追加序号
+		name = columnNames[0]
+		for i := 2; t.Indices[name] != nil; i++ {
+			name = fmt.Sprintf("%s_%d", columnNames[0], i)
+		}
+	}
+	if _, ok := t.Indices[name]; ok {
+		errStr := fmt.Sprintf("Duplicate key name '%s'", name)
+		return nil, errors.New(errStr)
+	}
+	t.MaxIndexId++
+	index := &Index{Id: t.MaxIndexId, Name: name, Columns: columnNames, Unique: unique}
+	t.Indices[name] = index
+	return index, nil
+}
+
+//按索引id排序的全部索引 保证遍历顺序固定
+func (t *MyTableInfo) IndexList() []*Index {
+	indices := make([]*Index, 0, len(t.Indices))
+	for _, index := range t.Indices {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i].Id < indices[j].Id
+	})
+	return indices
+}
+
+//查询可以使用的索引 按索引id排序
+func (t *MyTableInfo) PublicIndexList() []*Index {
+	var indices []*Index
+	for _, index := range t.IndexList() {
+		if index.State == IndexStatePublic {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+//删除索引 返回删除的索引
+func (t *MyTableInfo) DropIndex(name string) (*Index, error) {
+	name = strings.ToLower(name)
+	index, ok := t.Indices[name]
+	if !ok {
+		errStr := fmt.Sprintf("Can't DROP '%s'; check that column/key exists", name)
+		return nil, errors.New(errStr)
+	}
+	delete(t.Indices, name)
+	return index, nil
+}
+
+//索引是否包含该列
+func (index *Index) HasColumn(name string) bool {
+	for _, columnName := range index.Columns {
+		if columnName == name {
+			return true
+		}
+	}
+	return false
+}
+
+//索引列对应的列信息
+func (t *MyTableInfo) IndexColumns(index *Index) ([]*Column, error) {
+	columns := make([]*Column, 0, len(index.Columns))
+	for _, name := range index.Columns {
+		column, err := t.FindCol(t.Columns, name)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+//取出行中索引列的值
+func (t *MyTableInfo) IndexValues(index *Index, row *Row) ([]types.Datum, error) {
+	columns, err := t.IndexColumns(index)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]types.Datum, 0, len(columns))
+	for _, column := range columns {
+		values = append(values, row.Datums[t.ColumnOffset(column.Idx)])
+	}
+	return values, nil
+}
+
+//行在索引中对应的键
+//唯一索引的键不包含行号 但索引值中有NULL时不受唯一约束 和普通索引一样追加行号
+func (t *MyTableInfo) IndexKey(index *Index, row *Row) ([]byte, error) {
+	values, err := t.IndexValues(index, row)
+	if err != nil {
+		return nil, err
+	}
+	if index.Unique && !hasNull(values) {
+		return codekey.EncodeIndexSeekKey(t.TableId, index.Id, values...)
+	}
+	return codekey.EncodeIndexKey(t.TableId, index.Id, values, row.RowId)
+}
+
+//行在全部索引中对应的键
+func (t *MyTableInfo) IndexKeys(row *Row) ([][]byte, error) {
+	keys := make([][]byte, 0, len(t.Indices))
+	for _, index := range t.IndexList() {
+		key, err := t.IndexKey(index, row)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func hasNull(values []types.Datum) bool {
+	for i := range values {
+		if values[i].IsNull() {
+			return true
+		}
+	}
+	return false
+}
@@ -5,26 +5,45 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/CDDSCLab/chaosdb/util/rowcodec"
+
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/parser/opcode"
 	field_types "github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
 	"github.com/pingcap/tidb/types"
 )
 
+//类型转换和比较使用的上下文 截断按照mysql非严格模式处理
+var StmtCtx = &stmtctx.StatementContext{IgnoreTruncate: true}
+
 //行结构
 type Row struct {
-	RowId       uint64            `json:"row_id"`       //行号
-	ColumnValue map[string]string `json:"column_value"` //行记录
+	RowId  uint64        //行号
+	Datums []types.Datum //行记录 按顺序与表的列(或查询的选择列)一一对应 NULL值为KindNull
+}
+
+//第i列值的字符串形式 NULL值返回"NULL"
+func (r *Row) ValueString(i int) string {
+	d := r.Datums[i]
+	if d.IsNull() {
+		return "NULL"
+	}
+	str, err := d.ToString()
+	if err != nil {
+		return fmt.Sprintf("%v", d.GetValue())
+	}
+	return str
 }
 
 type Rows []*Row
 
 //where条件结构
 type Where struct {
-	Opt        opcode.Op        //操作符
-	LeftColumn string           //条件字段
-	RightType  *field_types.FieldType //右值字段类型
-	RightValue *types.Datum     //右值
+	Opt        opcode.Op    //操作符
+	LeftColumn string       //条件字段
+	RightValue *types.Datum //右值
 }
 
 //limit结构
@@ -35,20 +54,70 @@ type Limit struct {
 
 //列结构
 type Column struct {
-	Idx       uint64           `json:"idx"`        //列的唯一id
-	Name      string           `json:"name"`       //列名称
-	MysqlType *field_types.FieldType `json:"mysql_type"` //列type属性
+	Idx           uint64                 `json:"idx"`            //列的唯一id
+	Name          string                 `json:"name"`           //列名称
+	MysqlType     *field_types.FieldType `json:"mysql_type"`     //列type属性 非空约束记录在Flag中
+	DefaultValue  *string                `json:"default_value"`  //默认值 nil表示没有默认值
+	OriginDefault *string                `json:"origin_default"` //添加列之前写入的行中该列的值 nil表示NULL
+	Version       uint64                 `json:"version"`        //添加列或修改列类型时的表结构版本 建表时的列为0
+}
+
+//列是否有非空约束
+func (c *Column) NotNull() bool {
+	return mysql.HasNotNullFlag(c.MysqlType.Flag)
+}
+
+//写入列的值 转换为列类型并检查非空约束
+func (c *Column) CheckedValue(d types.Datum) (types.Datum, error) {
+	if d.IsNull() {
+		if c.NotNull() {
+			errStr := fmt.Sprintf("Column '%s' cannot be null", c.Name)
+			return d, errors.New(errStr)
+		}
+		return d, nil
+	}
+	return c.CastValue(d)
+}
+
+//插入时省略该列的取值：有默认值取默认值，可以为空取NULL，否则取类型的零值
+func (c *Column) DefaultDatum() (types.Datum, error) {
+	if c.DefaultValue != nil {
+		return c.ParseValue(*c.DefaultValue)
+	}
+	if !c.NotNull() {
+		return types.Datum{}, nil
+	}
+	if types.IsTypeNumeric(c.MysqlType.Tp) {
+		return c.CastValue(types.NewIntDatum(0))
+	}
+	return c.CastValue(types.NewStringDatum(""))
+}
+
+//将datum转换为列类型对应的datum 构造索引键时保证同一列的值编码一致
+func (c *Column) CastValue(d types.Datum) (types.Datum, error) {
+	if d.IsNull() {
+		return d, nil
+	}
+	return d.ConvertTo(StmtCtx, c.MysqlType)
+}
+
+//将字符串形式的列值转换为列类型对应的datum 用于默认值
+func (c *Column) ParseValue(value string) (types.Datum, error) {
+	return c.CastValue(types.NewStringDatum(value))
 }
 
 //表结构
 type MyTableInfo struct {
-	TableId     uint64             `json:"table_id"`     //表的唯一id
-	TableName   string             `json:"table_name"`   //表名称
-	Columns     []*Column          `json:"columns"`      //包含列 列的详细信息
-	ColumnList  string             `json:"column_list"`  //只包含列名称 全部列名称以逗号分隔组成的字符串
-	PriKey      *Column            `json:"pri_key"`      //主键列
-	Indices     map[string]*Column `json:"indices"`      //普通索引列
-	UniqIndices map[string]*Column `json:"uniq_indices"` //唯一索引列
+	TableId       uint64            `json:"table_id"`       //表的唯一id
+	TableName     string            `json:"table_name"`     //表名称
+	DBId          uint64            `json:"db_id"`          //表所在数据库的id 默认数据库为0
+	Columns       []*Column         `json:"columns"`        //包含列 列的详细信息
+	ColumnList    string            `json:"column_list"`    //只包含列名称 全部列名称以逗号分隔组成的字符串
+	PriKey        *Column           `json:"pri_key"`        //主键列
+	Indices       map[string]*Index `json:"indices"`        //索引(包括唯一索引) 键为索引名称
+	MaxIndexId    uint64            `json:"max_index_id"`   //已分配的最大索引id
+	MaxColumnId   uint64            `json:"max_column_id"`  //已分配的最大列id 为0时取现有列的最大id
+	SchemaVersion uint64            `json:"schema_version"` //表结构版本 每次修改列时增加
 	//TableInfo   *model.TableInfo
 }
 
@@ -58,6 +127,30 @@ type MyTableInfoIds struct {
 	RowsCount uint64 `json:"rows"`        //行数
 }
 
+//复制表信息 修改表结构时修改副本 不影响正在使用旧表信息的语句
+func (t *MyTableInfo) Clone() *MyTableInfo {
+	clone := *t
+	clone.Columns = make([]*Column, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		c := *column
+		if column.MysqlType != nil {
+			tp := *column.MysqlType
+			c.MysqlType = &tp
+		}
+		clone.Columns = append(clone.Columns, &c)
+		if t.PriKey != nil && t.PriKey.Idx == column.Idx {
+			clone.PriKey = &c
+		}
+	}
+	clone.Indices = make(map[string]*Index, len(t.Indices))
+	for name, index := range t.Indices {
+		i := *index
+		i.Columns = append([]string{}, index.Columns...)
+		clone.Indices[name] = &i
+	}
+	return &clone
+}
+
 //打印表信息 测试使用
 func (t *MyTableInfo) String() string {
 	if t == nil {
@@ -73,12 +166,8 @@ func (t *MyTableInfo) String() string {
 	ret += fmt.Sprintf("[table]column list:%s\n", t.ColumnList)
 	ret += fmt.Sprintf("[table]prikey:%v\n", t.PriKey)
 	ret += fmt.Sprintf("[table]indices:\n")
-	for k, v := range t.Indices {
-		ret += fmt.Sprintf("key->%s,value->%v\n", k, v)
-	}
-	ret += fmt.Sprintf("[table]unique indices:\n")
-	for k, v := range t.UniqIndices {
-		ret += fmt.Sprintf("key->%s,value->%v\n", k, v)
+	for _, index := range t.IndexList() {
+		ret += fmt.Sprintf("key->%s,value->%v\n", index.Name, index)
 	}
 	return ret
 }
@@ -92,6 +181,52 @@ func (t *MyTableInfo) printColumns() string {
 	return ret
 }
 
+//根据列id获取列在表中的位置 不存在返回-1
+func (t *MyTableInfo) ColumnOffset(idx uint64) int {
+	for i, col := range t.Columns {
+		if col.Idx == idx {
+			return i
+		}
+	}
+	return -1
+}
+
+//按表结构编码一行数据
+func (t *MyTableInfo) EncodeRow(row *Row) ([]byte, error) {
+	if len(row.Datums) != len(t.Columns) {
+		errStr := fmt.Sprintf("row has %d values, table(%s) has %d columns", len(row.Datums), t.TableName, len(t.Columns))
+		return nil, errors.New(errStr)
+	}
+	colIdxs := make([]uint64, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		colIdxs = append(colIdxs, col.Idx)
+	}
+	return rowcodec.EncodeRow(colIdxs, row.Datums)
+}
+
+//按表结构解码一行数据 行中不存在的列按默认值补全
+func (t *MyTableInfo) DecodeRow(rowId uint64, value []byte) (*Row, error) {
+	values, err := rowcodec.DecodeRow(value)
+	if err != nil {
+		return nil, err
+	}
+	row := &Row{RowId: rowId, Datums: make([]types.Datum, len(t.Columns))}
+	for i, col := range t.Columns {
+		d, ok := values[col.Idx]
+		if !ok {
+			d, err = col.OriginDatum()
+		} else if col.Version > 0 {
+			//修改列类型之前写入的值转换为新的类型
+			d, err = col.CastValue(d)
+		}
+		if err != nil {
+			return nil, err
+		}
+		row.Datums[i] = d
+	}
+	return row, nil
+}
+
 //在表中查询列
 func (t *MyTableInfo) FindCol(cols []*Column, name string) (*Column, error) {
 	for _, col := range cols {
@@ -114,41 +249,37 @@ func (t *MyTableInfo) BuildColumnList() {
 
 //解析ast结构中的键约束->转换为我们的表结构要使用的键约束
 func (t *MyTableInfo) ParseTableConstraint(cons *ast.Constraint) error {
+	columnNames := make([]string, 0, len(cons.Keys))
+	for _, indexCol := range cons.Keys {
+		columnNames = append(columnNames, indexCol.Column.Name.L)
+	}
 	//判断类型
 	switch cons.Tp {
 	//主键约束
 	case ast.ConstraintPrimaryKey:
-		for _, indexCol := range cons.Keys {
-			name := indexCol.Column.Name.L
+		for _, name := range columnNames {
 			column, err := t.FindCol(t.Columns, name)
 			if err != nil {
 				return err
 			}
-			t.PriKey = column
+			//主键列不能为空
+			column.MysqlType.Flag |= mysql.NotNullFlag | mysql.PriKeyFlag
 		}
-		return nil
-	//唯一约束
-	case ast.ConstraintKey, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
-		for _, indexCol := range cons.Keys {
-			name := indexCol.Column.Name.L
-			column, err := t.FindCol(t.Columns, name)
-			if err != nil {
-				return err
-			}
-			t.UniqIndices[name] = column
+		//单列主键直接作为行号 联合主键按唯一索引处理
+		if len(columnNames) == 1 {
+			t.PriKey, _ = t.FindCol(t.Columns, columnNames[0])
+			return nil
 		}
-		return nil
+		_, err := t.AddIndex(PrimaryIndexName, columnNames, true)
+		return err
+	//唯一约束
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		_, err := t.AddIndex(cons.Name, columnNames, true)
+		return err
 	//普通索引约束
-	case ast.ConstraintIndex:
-		for _, indexCol := range cons.Keys {
-			name := indexCol.Column.Name.L
-			column, err := t.FindCol(t.Columns, name)
-			if err != nil {
-				return err
-			}
-			t.Indices[name] = column
-		}
-		return nil
+	case ast.ConstraintKey, ast.ConstraintIndex:
+		_, err := t.AddIndex(cons.Name, columnNames, false)
+		return err
 	default:
 		err := errors.New("constraint is not support")
 		return err
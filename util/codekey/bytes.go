@@ -0,0 +1,76 @@
+package codekey
+
+import (
+	"errors"
+)
+
+const (
+	encGroupSize = 8
+	encMarker    = byte(0xFF)
+	encPad       = byte(0x0)
+)
+
+var pads = make([]byte, encGroupSize)
+
+//按memcomparable格式编码字节数组
+//每8个字节为一组，每组后追加一个标记字节(0xFF - 该组填充的字节数)，不足8个字节的组用0填充
+//例子：
+//[] -> [0, 0, 0, 0, 0, 0, 0, 0, 247]
+//[1, 2, 3] -> [1, 2, 3, 0, 0, 0, 0, 0, 250]
+//[1, 2, 3, 0] -> [1, 2, 3, 0, 0, 0, 0, 0, 251]
+//[1, 2, 3, 4, 5, 6, 7, 8] -> [1, 2, 3, 4, 5, 6, 7, 8, 255, 0, 0, 0, 0, 0, 0, 0, 0, 247]
+//编码后的结果可以直接按字节序比较，且不会出现一个值是另一个值前缀的情况
+func EncodeBytes(b []byte, data []byte) []byte {
+	dLen := len(data)
+	reallocSize := (dLen/encGroupSize + 1) * (encGroupSize + 1)
+	if cap(b)-len(b) < reallocSize {
+		nb := make([]byte, len(b), len(b)+reallocSize)
+		copy(nb, b)
+		b = nb
+	}
+	for idx := 0; idx <= dLen; idx += encGroupSize {
+		remain := dLen - idx
+		padCount := 0
+		if remain >= encGroupSize {
+			b = append(b, data[idx:idx+encGroupSize]...)
+		} else {
+			padCount = encGroupSize - remain
+			b = append(b, data[idx:]...)
+			b = append(b, pads[:padCount]...)
+		}
+		b = append(b, encMarker-byte(padCount))
+	}
+	return b
+}
+
+//解码EncodeBytes编码的字节数组 返回剩余字节
+func DecodeBytes(b []byte) ([]byte, []byte, error) {
+	data := make([]byte, 0, len(b))
+	for {
+		if len(b) < encGroupSize+1 {
+			return nil, nil, errors.New("insufficient bytes to decode value")
+		}
+		groupBytes := b[:encGroupSize+1]
+		group := groupBytes[:encGroupSize]
+		marker := groupBytes[encGroupSize]
+
+		padCount := encMarker - marker
+		if padCount > encGroupSize {
+			return nil, nil, errors.New("invalid marker byte")
+		}
+		realGroupSize := encGroupSize - int(padCount)
+		data = append(data, group[:realGroupSize]...)
+		b = b[encGroupSize+1:]
+
+		if padCount != 0 {
+			//填充字节必须全部为0
+			for _, v := range group[realGroupSize:] {
+				if v != encPad {
+					return nil, nil, errors.New("invalid padding byte")
+				}
+			}
+			break
+		}
+	}
+	return b, data, nil
+}
@@ -1,11 +1,217 @@
 package codekey
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"testing"
+
+	"github.com/pingcap/tidb/types"
 )
 
 func TestEncodeKey(t *testing.T) {
 	b := EncodeKey("_", "t", "r", "1", "1", "aa", "bb", "cc")
 	fmt.Println(b.String())
 }
+
+func TestEncodeIntOrder(t *testing.T) {
+	nums := []int64{math.MinInt64, -100, -1, 0, 1, 2, 10, 100, math.MaxInt64}
+	for i := 1; i < len(nums); i++ {
+		a, b := EncodeInt(nil, nums[i-1]), EncodeInt(nil, nums[i])
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("EncodeInt(%d) should be less than EncodeInt(%d)", nums[i-1], nums[i])
+		}
+	}
+	for _, num := range nums {
+		remain, v, err := DecodeInt(EncodeInt(nil, num))
+		if err != nil || v != num || len(remain) != 0 {
+			t.Fatalf("DecodeInt(%d) got %d, err %v", num, v, err)
+		}
+	}
+}
+
+func TestEncodeUintOrder(t *testing.T) {
+	nums := []uint64{0, 1, 2, 9, 10, 11, 255, 256, math.MaxUint64}
+	for i := 1; i < len(nums); i++ {
+		a, b := EncodeUint(nil, nums[i-1]), EncodeUint(nil, nums[i])
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("EncodeUint(%d) should be less than EncodeUint(%d)", nums[i-1], nums[i])
+		}
+		a, b = EncodeUintDesc(nil, nums[i-1]), EncodeUintDesc(nil, nums[i])
+		if bytes.Compare(a, b) <= 0 {
+			t.Fatalf("EncodeUintDesc(%d) should be greater than EncodeUintDesc(%d)", nums[i-1], nums[i])
+		}
+	}
+	_, v, err := DecodeUintDesc(EncodeUintDesc(nil, 42))
+	if err != nil || v != 42 {
+		t.Fatalf("DecodeUintDesc got %d, err %v", v, err)
+	}
+}
+
+func TestEncodeFloatOrder(t *testing.T) {
+	nums := []float64{math.Inf(-1), -1e10, -1.5, -0.1, 0, 0.1, 1.5, 1e10, math.Inf(1)}
+	for i := 1; i < len(nums); i++ {
+		a, b := EncodeFloat(nil, nums[i-1]), EncodeFloat(nil, nums[i])
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("EncodeFloat(%v) should be less than EncodeFloat(%v)", nums[i-1], nums[i])
+		}
+	}
+	for _, num := range nums {
+		_, v, err := DecodeFloat(EncodeFloat(nil, num))
+		if err != nil || v != num {
+			t.Fatalf("DecodeFloat(%v) got %v, err %v", num, v, err)
+		}
+	}
+}
+
+func TestEncodeBytes(t *testing.T) {
+	values := [][]byte{
+		{},
+		{0},
+		{0, 0},
+		[]byte("a"),
+		[]byte("a_b"),
+		[]byte("a_c"),
+		[]byte("ab"),
+		[]byte("abcdefgh"),
+		[]byte("abcdefgh\x00"),
+		[]byte("abcdefghi"),
+		[]byte("b"),
+	}
+	for i := 1; i < len(values); i++ {
+		a, b := EncodeBytes(nil, values[i-1]), EncodeBytes(nil, values[i])
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("EncodeBytes(%q) should be less than EncodeBytes(%q)", values[i-1], values[i])
+		}
+	}
+	for _, value := range values {
+		encoded := EncodeBytes(nil, value)
+		remain, v, err := DecodeBytes(append(encoded, 'x'))
+		if err != nil || !bytes.Equal(v, value) || !bytes.Equal(remain, []byte("x")) {
+			t.Fatalf("DecodeBytes(%q) got %q remain %q, err %v", value, v, remain, err)
+		}
+	}
+}
+
+func TestEncodeDatums(t *testing.T) {
+	//同一列中的值按照类型排序 与数值/字典序一致
+	ordered := [][]types.Datum{
+		{types.Datum{}},
+		{types.NewIntDatum(-10)},
+		{types.NewIntDatum(-1)},
+		{types.NewIntDatum(2)},
+		{types.NewIntDatum(10)},
+	}
+	checkDatumsOrder(t, ordered)
+
+	//组合值 第一个值相同时比较第二个值 包含分隔符的字符串不会影响排序
+	ordered = [][]types.Datum{
+		{types.NewStringDatum("a"), types.NewIntDatum(9)},
+		{types.NewStringDatum("a"), types.NewIntDatum(10)},
+		{types.NewStringDatum("a_1"), types.NewIntDatum(1)},
+		{types.NewStringDatum("a_10"), types.NewIntDatum(1)},
+		{types.NewStringDatum("a_2"), types.NewIntDatum(1)},
+		{types.NewStringDatum("ab"), types.NewIntDatum(1)},
+	}
+	checkDatumsOrder(t, ordered)
+
+	ordered = [][]types.Datum{
+		{types.NewDecimalDatum(types.NewDecFromStringForTest("-12.5"))},
+		{types.NewDecimalDatum(types.NewDecFromStringForTest("-1.25"))},
+		{types.NewDecimalDatum(types.NewDecFromStringForTest("0"))},
+		{types.NewDecimalDatum(types.NewDecFromStringForTest("1.25"))},
+		{types.NewDecimalDatum(types.NewDecFromStringForTest("12.5"))},
+		{types.MaxValueDatum()},
+	}
+	checkDatumsOrder(t, ordered)
+
+	datums := []types.Datum{
+		types.NewIntDatum(-5),
+		types.NewUintDatum(5),
+		types.NewFloat64Datum(1.5),
+		types.NewStringDatum("hello_world"),
+		types.NewDecimalDatum(types.NewDecFromStringForTest("3.14")),
+		{},
+	}
+	b, err := EncodeDatums(nil, datums...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeDatums(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(datums) {
+		t.Fatalf("decode %d datums, expect %d", len(decoded), len(datums))
+	}
+	for i := range datums {
+		cmp, err := decoded[i].CompareDatum(nil, &datums[i])
+		if err != nil || cmp != 0 {
+			t.Fatalf("datum %d decoded as %v, expect %v", i, decoded[i], datums[i])
+		}
+	}
+}
+
+func checkDatumsOrder(t *testing.T, ordered [][]types.Datum) {
+	for i := 1; i < len(ordered); i++ {
+		a, err := EncodeDatums(nil, ordered[i-1]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := EncodeDatums(nil, ordered[i]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("%v should be less than %v", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestTableKey(t *testing.T) {
+	key := EncodeRowKey(3, 12)
+	tableId, rowId, err := DecodeRowKey(key)
+	if err != nil || tableId != 3 || rowId != 12 {
+		t.Fatalf("DecodeRowKey got (%d,%d), err %v", tableId, rowId, err)
+	}
+	//行号按数值排序
+	if bytes.Compare(EncodeRowKey(3, 2), EncodeRowKey(3, 10)) >= 0 {
+		t.Fatal("row key 2 should be less than row key 10")
+	}
+	//行数据和索引数据互不交叉
+	rowPrefix := EncodeRowPrefix(3)
+	indexKey, err := EncodeIndexKey(3, 1, []types.Datum{types.NewStringDatum("x")}, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(indexKey, rowPrefix) {
+		t.Fatal("index key should not have row prefix")
+	}
+	seekKey, err := EncodeIndexSeekKey(3, 1, types.NewStringDatum("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(indexKey, seekKey) || bytes.Compare(indexKey, PrefixNext(seekKey)) >= 0 {
+		t.Fatal("index key should be in range of its seek key")
+	}
+	rowId, err = DecodeIndexValue(EncodeIndexValue(12))
+	if err != nil || rowId != 12 {
+		t.Fatalf("DecodeIndexValue got %d, err %v", rowId, err)
+	}
+}
+
+func TestPrefixNext(t *testing.T) {
+	cases := []struct {
+		key    []byte
+		expect []byte
+	}{
+		{[]byte{1, 2, 3}, []byte{1, 2, 4}},
+		{[]byte{1, 2, 0xFF}, []byte{1, 3}},
+		{[]byte{0xFF, 0xFF}, []byte{}},
+	}
+	for _, c := range cases {
+		if next := PrefixNext(c.key); !bytes.Equal(next, c.expect) {
+			t.Fatalf("PrefixNext(%v) got %v, expect %v", c.key, next, c.expect)
+		}
+	}
+}
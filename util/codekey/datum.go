@@ -0,0 +1,182 @@
+package codekey
+
+import (
+	"errors"
+	"fmt"
+	gotime "time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+//datum编码时的类型标记 标记值本身也参与排序
+const (
+	NilFlag      byte = 0
+	bytesFlag    byte = 1
+	intFlag      byte = 3
+	uintFlag     byte = 4
+	floatFlag    byte = 5
+	decimalFlag  byte = 6
+	durationFlag byte = 7
+	timeFlag     byte = 8
+	maxFlag      byte = 250
+)
+
+//decimal统一按照最大精度编码 保证不同精度的decimal之间也可以按字节序比较
+const (
+	decimalPrecision = mysql.MaxDecimalWidth
+	decimalFrac      = mysql.MaxDecimalScale
+)
+
+//按顺序编码多个datum 编码结果可以按字节序比较
+//NULL最小 MaxValue最大 同类型的值之间按值的大小排序
+func EncodeDatums(b []byte, datums ...types.Datum) ([]byte, error) {
+	var err error
+	for i := range datums {
+		b, err = encodeDatum(b, &datums[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func encodeDatum(b []byte, d *types.Datum) ([]byte, error) {
+	switch d.Kind() {
+	case types.KindNull:
+		b = append(b, NilFlag)
+	case types.KindInt64:
+		b = append(b, intFlag)
+		b = EncodeInt(b, d.GetInt64())
+	case types.KindUint64:
+		b = append(b, uintFlag)
+		b = EncodeUint(b, d.GetUint64())
+	case types.KindFloat32, types.KindFloat64:
+		b = append(b, floatFlag)
+		b = EncodeFloat(b, d.GetFloat64())
+	case types.KindString, types.KindBytes:
+		b = append(b, bytesFlag)
+		b = EncodeBytes(b, d.GetBytes())
+	case types.KindBinaryLiteral, types.KindMysqlBit:
+		b = append(b, bytesFlag)
+		b = EncodeBytes(b, d.GetBinaryLiteral())
+	case types.KindMysqlDecimal:
+		bin, err := encodeDecimal(d.GetMysqlDecimal())
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, decimalFlag)
+		b = append(b, bin...)
+	case types.KindMysqlDuration:
+		b = append(b, durationFlag)
+		b = EncodeInt(b, int64(d.GetMysqlDuration().Duration))
+	case types.KindMysqlTime:
+		packed, err := d.GetMysqlTime().ToPackedUint()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, timeFlag)
+		b = EncodeUint(b, packed)
+	case types.KindMysqlEnum:
+		b = append(b, uintFlag)
+		b = EncodeUint(b, d.GetMysqlEnum().Value)
+	case types.KindMysqlSet:
+		b = append(b, uintFlag)
+		b = EncodeUint(b, d.GetMysqlSet().Value)
+	case types.KindMinNotNull:
+		//只用于范围查询的边界 比任何非NULL值都小
+		b = append(b, bytesFlag)
+	case types.KindMaxValue:
+		b = append(b, maxFlag)
+	default:
+		errStr := fmt.Sprintf("unsupported datum kind(%d) to encode", d.Kind())
+		return nil, errors.New(errStr)
+	}
+	return b, nil
+}
+
+func encodeDecimal(dec *types.MyDecimal) ([]byte, error) {
+	var rounded types.MyDecimal
+	err := dec.Round(&rounded, decimalFrac, types.ModeHalfEven)
+	if err != nil {
+		return nil, err
+	}
+	return rounded.ToBin(decimalPrecision, decimalFrac)
+}
+
+//解码一个datum 返回剩余字节
+//字符串类型统一解码为bytes 由调用方按照列类型转换
+func DecodeDatum(b []byte) ([]byte, types.Datum, error) {
+	var d types.Datum
+	if len(b) < 1 {
+		return nil, d, errInsufficientBytes
+	}
+	flag := b[0]
+	b = b[1:]
+	var err error
+	switch flag {
+	case NilFlag:
+	case intFlag:
+		var v int64
+		b, v, err = DecodeInt(b)
+		d.SetInt64(v)
+	case uintFlag:
+		var v uint64
+		b, v, err = DecodeUint(b)
+		d.SetUint64(v)
+	case floatFlag:
+		var v float64
+		b, v, err = DecodeFloat(b)
+		d.SetFloat64(v)
+	case bytesFlag:
+		var v []byte
+		b, v, err = DecodeBytes(b)
+		d.SetBytes(v)
+	case decimalFlag:
+		dec := new(types.MyDecimal)
+		var binSize int
+		binSize, err = dec.FromBin(b, decimalPrecision, decimalFrac)
+		if err == nil {
+			b = b[binSize:]
+			d.SetMysqlDecimal(dec)
+		}
+	case durationFlag:
+		var v int64
+		b, v, err = DecodeInt(b)
+		d.SetMysqlDuration(types.Duration{Duration: gotime.Duration(v), Fsp: types.MaxFsp})
+	case timeFlag:
+		var v uint64
+		b, v, err = DecodeUint(b)
+		if err == nil {
+			t := types.Time{Type: mysql.TypeDatetime, Fsp: types.MaxFsp}
+			err = t.FromPackedUint(v)
+			d.SetMysqlTime(t)
+		}
+	case maxFlag:
+		d = types.MaxValueDatum()
+	default:
+		errStr := fmt.Sprintf("invalid encoded key flag(%d)", flag)
+		return nil, d, errors.New(errStr)
+	}
+	if err != nil {
+		return nil, d, err
+	}
+	return b, d, nil
+}
+
+//解码EncodeDatums编码的全部datum
+func DecodeDatums(b []byte) ([]types.Datum, error) {
+	datums := make([]types.Datum, 0, 4)
+	for len(b) > 0 {
+		var (
+			d   types.Datum
+			err error
+		)
+		b, d, err = DecodeDatum(b)
+		if err != nil {
+			return nil, err
+		}
+		datums = append(datums, d)
+	}
+	return datums, nil
+}
@@ -0,0 +1,93 @@
+package codekey
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const signMask uint64 = 0x8000000000000000
+
+var errInsufficientBytes = errors.New("insufficient bytes to decode value")
+
+//有符号整数翻转符号位后按大端序存储 负数排在正数前面
+func encodeIntToCmpUint(v int64) uint64 {
+	return uint64(v) ^ signMask
+}
+
+func decodeCmpUintToInt(u uint64) int64 {
+	return int64(u ^ signMask)
+}
+
+//编码int64 编码结果按字节序比较与数值大小顺序一致
+func EncodeInt(b []byte, v int64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], encodeIntToCmpUint(v))
+	return append(b, data[:]...)
+}
+
+//解码int64 返回剩余字节
+func DecodeInt(b []byte) ([]byte, int64, error) {
+	if len(b) < 8 {
+		return nil, 0, errInsufficientBytes
+	}
+	u := binary.BigEndian.Uint64(b[:8])
+	return b[8:], decodeCmpUintToInt(u), nil
+}
+
+//编码uint64 大端序 编码结果按字节序比较与数值大小顺序一致
+func EncodeUint(b []byte, v uint64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], v)
+	return append(b, data[:]...)
+}
+
+//编码uint64 字节序与数值大小顺序相反
+func EncodeUintDesc(b []byte, v uint64) []byte {
+	return EncodeUint(b, ^v)
+}
+
+//解码uint64 返回剩余字节
+func DecodeUint(b []byte) ([]byte, uint64, error) {
+	if len(b) < 8 {
+		return nil, 0, errInsufficientBytes
+	}
+	return b[8:], binary.BigEndian.Uint64(b[:8]), nil
+}
+
+//解码EncodeUintDesc编码的uint64
+func DecodeUintDesc(b []byte) ([]byte, uint64, error) {
+	b, v, err := DecodeUint(b)
+	return b, ^v, err
+}
+
+//浮点数编码：正数翻转符号位 负数全部取反
+func encodeFloatToCmpUint64(f float64) uint64 {
+	u := math.Float64bits(f)
+	if f >= 0 {
+		u |= signMask
+	} else {
+		u = ^u
+	}
+	return u
+}
+
+func decodeCmpUintToFloat(u uint64) float64 {
+	if u&signMask > 0 {
+		u &= ^signMask
+	} else {
+		u = ^u
+	}
+	return math.Float64frombits(u)
+}
+
+//编码float64 编码结果按字节序比较与数值大小顺序一致
+func EncodeFloat(b []byte, v float64) []byte {
+	return EncodeUint(b, encodeFloatToCmpUint64(v))
+}
+
+//解码float64 返回剩余字节
+func DecodeFloat(b []byte) ([]byte, float64, error) {
+	b, u, err := DecodeUint(b)
+	return b, decodeCmpUintToFloat(u), err
+}
@@ -0,0 +1,120 @@
+package codekey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/CDDSCLab/chaosdb/opt/common"
+
+	"github.com/pingcap/tidb/types"
+)
+
+//表数据键的布局 所有整数都按EncodeUint编码 定长8字节
+//行数据：  tb{tableId}_r{rowId}                        => 行记录
+//唯一索引：tb{tableId}_i{indexId}{indexValues}          => rowId
+//普通索引：tb{tableId}_i{indexId}{indexValues}{rowId}   => rowId
+//indexValues按EncodeDatums编码，所以键之间直接按字节序比较即可
+
+var (
+	tablePrefix     = []byte(common.TablePrefix)
+	recordPrefixSep = []byte(common.Separator + common.RowPrefix)
+	indexPrefixSep  = []byte(common.Separator + common.IndexPrefix)
+)
+
+const (
+	idLen           = 8
+	tablePrefixLen  = len(common.TablePrefix) + idLen
+	recordPrefixLen = tablePrefixLen + len(common.Separator+common.RowPrefix)
+	recordRowKeyLen = recordPrefixLen + idLen
+	indexPrefixLen  = tablePrefixLen + len(common.Separator+common.IndexPrefix) + idLen
+)
+
+//表前缀 tb{tableId}
+func EncodeTablePrefix(tableId uint64) []byte {
+	b := make([]byte, 0, tablePrefixLen)
+	b = append(b, tablePrefix...)
+	return EncodeUint(b, tableId)
+}
+
+//行数据前缀 tb{tableId}_r
+func EncodeRowPrefix(tableId uint64) []byte {
+	b := make([]byte, 0, recordRowKeyLen)
+	b = append(b, tablePrefix...)
+	b = EncodeUint(b, tableId)
+	return append(b, recordPrefixSep...)
+}
+
+//行数据键 tb{tableId}_r{rowId}
+func EncodeRowKey(tableId, rowId uint64) []byte {
+	return EncodeUint(EncodeRowPrefix(tableId), rowId)
+}
+
+//从行数据键中解析出表id和行号
+func DecodeRowKey(key []byte) (tableId uint64, rowId uint64, err error) {
+	if len(key) != recordRowKeyLen || !bytes.HasPrefix(key, tablePrefix) {
+		errStr := fmt.Sprintf("invalid row key(%x)", key)
+		return 0, 0, errors.New(errStr)
+	}
+	key = key[len(tablePrefix):]
+	key, tableId, err = DecodeUint(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !bytes.HasPrefix(key, recordPrefixSep) {
+		errStr := fmt.Sprintf("invalid row key(%x)", key)
+		return 0, 0, errors.New(errStr)
+	}
+	_, rowId, err = DecodeUint(key[len(recordPrefixSep):])
+	return tableId, rowId, err
+}
+
+//索引前缀 tb{tableId}_i{indexId}
+func EncodeIndexPrefix(tableId, indexId uint64) []byte {
+	b := make([]byte, 0, indexPrefixLen+16)
+	b = append(b, tablePrefix...)
+	b = EncodeUint(b, tableId)
+	b = append(b, indexPrefixSep...)
+	return EncodeUint(b, indexId)
+}
+
+//唯一索引键 tb{tableId}_i{indexId}{indexValues}
+//也作为普通索引按值查找时的前缀
+func EncodeIndexSeekKey(tableId, indexId uint64, values ...types.Datum) ([]byte, error) {
+	return EncodeDatums(EncodeIndexPrefix(tableId, indexId), values...)
+}
+
+//普通索引键 tb{tableId}_i{indexId}{indexValues}{rowId}
+//追加行号保证相同索引值的键不会互相覆盖
+func EncodeIndexKey(tableId, indexId uint64, values []types.Datum, rowId uint64) ([]byte, error) {
+	b, err := EncodeIndexSeekKey(tableId, indexId, values...)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeUint(b, rowId), nil
+}
+
+//索引键对应的值 即行号
+func EncodeIndexValue(rowId uint64) []byte {
+	return EncodeUint(make([]byte, 0, idLen), rowId)
+}
+
+//从索引值中解析出行号
+func DecodeIndexValue(value []byte) (uint64, error) {
+	_, rowId, err := DecodeUint(value)
+	return rowId, err
+}
+
+//返回比所有以key为前缀的键都大的最小键 用作范围扫描的右边界(开区间)
+//如果key全部由0xFF组成，返回空字节数组表示无上界
+func PrefixNext(key []byte) []byte {
+	next := make([]byte, len(key))
+	copy(next, key)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next[:i+1]
+		}
+	}
+	return []byte{}
+}
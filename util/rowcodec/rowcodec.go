@@ -0,0 +1,328 @@
+package rowcodec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	gotime "time"
+
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/types/json"
+)
+
+//行数据编码格式(版本1)：
+//[version][columnCount]{[columnIdx][datum]}...
+//version:     1字节 编码格式版本号
+//columnCount: uvarint 行中包含的列数
+//columnIdx:   uvarint 列的唯一id(Column.Idx) 不依赖列在表中的位置
+//datum:       1字节类型标记 + 值 值的编码不要求可比较 只追求紧凑
+//行中不存在的列在解码时由调用方按表结构补全(默认值或NULL)
+
+const (
+	//当前行编码版本
+	CodecVer byte = 1
+)
+
+//datum类型标记
+const (
+	nilFlag      byte = 0
+	intFlag      byte = 1
+	uintFlag     byte = 2
+	float32Flag  byte = 3
+	float64Flag  byte = 4
+	stringFlag   byte = 5
+	bytesFlag    byte = 6
+	decimalFlag  byte = 7
+	durationFlag byte = 8
+	timeFlag     byte = 9
+	enumFlag     byte = 10
+	setFlag      byte = 11
+	bitFlag      byte = 12
+	jsonFlag     byte = 13
+)
+
+var errInvalidRow = errors.New("invalid row data")
+
+//按列id编码一行数据 colIdxs与datums一一对应
+func EncodeRow(colIdxs []uint64, datums []types.Datum) ([]byte, error) {
+	if len(colIdxs) != len(datums) {
+		errStr := fmt.Sprintf("column count(%d) is not equal to value count(%d)", len(colIdxs), len(datums))
+		return nil, errors.New(errStr)
+	}
+	b := make([]byte, 0, 1+binary.MaxVarintLen64+len(datums)*10)
+	b = append(b, CodecVer)
+	b = encodeUvarint(b, uint64(len(colIdxs)))
+	var err error
+	for i, idx := range colIdxs {
+		b = encodeUvarint(b, idx)
+		b, err = encodeDatum(b, &datums[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+//解码一行数据 返回列id到datum的映射
+func DecodeRow(b []byte) (map[uint64]types.Datum, error) {
+	if len(b) == 0 {
+		return nil, errInvalidRow
+	}
+	if b[0] != CodecVer {
+		errStr := fmt.Sprintf("unsupported row codec version(%d)", b[0])
+		return nil, errors.New(errStr)
+	}
+	b = b[1:]
+	b, count, err := decodeUvarint(b)
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[uint64]types.Datum, count)
+	for i := uint64(0); i < count; i++ {
+		var (
+			idx uint64
+			d   types.Datum
+		)
+		b, idx, err = decodeUvarint(b)
+		if err != nil {
+			return nil, err
+		}
+		b, d, err = decodeDatum(b)
+		if err != nil {
+			return nil, err
+		}
+		row[idx] = d
+	}
+	if len(b) != 0 {
+		return nil, errInvalidRow
+	}
+	return row, nil
+}
+
+func encodeDatum(b []byte, d *types.Datum) ([]byte, error) {
+	switch d.Kind() {
+	case types.KindNull:
+		b = append(b, nilFlag)
+	case types.KindInt64:
+		b = append(b, intFlag)
+		b = encodeVarint(b, d.GetInt64())
+	case types.KindUint64:
+		b = append(b, uintFlag)
+		b = encodeUvarint(b, d.GetUint64())
+	case types.KindFloat32:
+		b = append(b, float32Flag)
+		b = encodeUint64(b, math.Float64bits(d.GetFloat64()))
+	case types.KindFloat64:
+		b = append(b, float64Flag)
+		b = encodeUint64(b, math.Float64bits(d.GetFloat64()))
+	case types.KindString:
+		b = append(b, stringFlag)
+		b = encodeCompactBytes(b, d.GetBytes())
+	case types.KindBytes:
+		b = append(b, bytesFlag)
+		b = encodeCompactBytes(b, d.GetBytes())
+	case types.KindBinaryLiteral, types.KindMysqlBit:
+		b = append(b, bitFlag)
+		b = encodeCompactBytes(b, d.GetBinaryLiteral())
+	case types.KindMysqlDecimal:
+		dec := d.GetMysqlDecimal()
+		precision, frac := dec.PrecisionAndFrac()
+		bin, err := dec.ToBin(precision, frac)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, decimalFlag, byte(precision), byte(frac))
+		b = append(b, bin...)
+	case types.KindMysqlDuration:
+		dur := d.GetMysqlDuration()
+		b = append(b, durationFlag, byte(dur.Fsp))
+		b = encodeVarint(b, int64(dur.Duration))
+	case types.KindMysqlTime:
+		t := d.GetMysqlTime()
+		packed, err := t.ToPackedUint()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, timeFlag, t.Type, byte(t.Fsp))
+		b = encodeUvarint(b, packed)
+	case types.KindMysqlEnum:
+		enum := d.GetMysqlEnum()
+		b = append(b, enumFlag)
+		b = encodeUvarint(b, enum.Value)
+		b = encodeCompactBytes(b, []byte(enum.Name))
+	case types.KindMysqlSet:
+		set := d.GetMysqlSet()
+		b = append(b, setFlag)
+		b = encodeUvarint(b, set.Value)
+		b = encodeCompactBytes(b, []byte(set.Name))
+	case types.KindMysqlJSON:
+		j := d.GetMysqlJSON()
+		b = append(b, jsonFlag, j.TypeCode)
+		b = encodeCompactBytes(b, j.Value)
+	default:
+		errStr := fmt.Sprintf("unsupported datum kind(%d) to encode", d.Kind())
+		return nil, errors.New(errStr)
+	}
+	return b, nil
+}
+
+func decodeDatum(b []byte) ([]byte, types.Datum, error) {
+	var d types.Datum
+	if len(b) < 1 {
+		return nil, d, errInvalidRow
+	}
+	flag := b[0]
+	b = b[1:]
+	var err error
+	switch flag {
+	case nilFlag:
+	case intFlag:
+		var v int64
+		b, v, err = decodeVarint(b)
+		d.SetInt64(v)
+	case uintFlag:
+		var v uint64
+		b, v, err = decodeUvarint(b)
+		d.SetUint64(v)
+	case float32Flag, float64Flag:
+		var v uint64
+		b, v, err = decodeUint64(b)
+		if flag == float32Flag {
+			d.SetFloat32(float32(math.Float64frombits(v)))
+		} else {
+			d.SetFloat64(math.Float64frombits(v))
+		}
+	case stringFlag, bytesFlag, bitFlag:
+		var v []byte
+		b, v, err = decodeCompactBytes(b)
+		switch flag {
+		case stringFlag:
+			d.SetString(string(v))
+		case bytesFlag:
+			d.SetBytes(v)
+		default:
+			d.SetBinaryLiteral(types.BinaryLiteral(v))
+		}
+	case decimalFlag:
+		if len(b) < 2 {
+			return nil, d, errInvalidRow
+		}
+		precision, frac := int(b[0]), int(b[1])
+		dec := new(types.MyDecimal)
+		var binSize int
+		binSize, err = dec.FromBin(b[2:], precision, frac)
+		if err == nil {
+			b = b[2+binSize:]
+			d.SetMysqlDecimal(dec)
+		}
+	case durationFlag:
+		if len(b) < 1 {
+			return nil, d, errInvalidRow
+		}
+		fsp := int(b[0])
+		var v int64
+		b, v, err = decodeVarint(b[1:])
+		d.SetMysqlDuration(types.Duration{Duration: gotime.Duration(v), Fsp: fsp})
+	case timeFlag:
+		if len(b) < 2 {
+			return nil, d, errInvalidRow
+		}
+		t := types.Time{Type: b[0], Fsp: int(b[1])}
+		var v uint64
+		b, v, err = decodeUvarint(b[2:])
+		if err == nil {
+			err = t.FromPackedUint(v)
+			d.SetMysqlTime(t)
+		}
+	case enumFlag, setFlag:
+		var (
+			v    uint64
+			name []byte
+		)
+		b, v, err = decodeUvarint(b)
+		if err == nil {
+			b, name, err = decodeCompactBytes(b)
+		}
+		if flag == enumFlag {
+			d.SetMysqlEnum(types.Enum{Name: string(name), Value: v})
+		} else {
+			d.SetMysqlSet(types.Set{Name: string(name), Value: v})
+		}
+	case jsonFlag:
+		if len(b) < 1 {
+			return nil, d, errInvalidRow
+		}
+		typeCode := b[0]
+		var v []byte
+		b, v, err = decodeCompactBytes(b[1:])
+		d.SetMysqlJSON(json.BinaryJSON{TypeCode: typeCode, Value: v})
+	default:
+		errStr := fmt.Sprintf("invalid row datum flag(%d)", flag)
+		return nil, d, errors.New(errStr)
+	}
+	if err != nil {
+		return nil, d, err
+	}
+	return b, d, nil
+}
+
+func encodeVarint(b []byte, v int64) []byte {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(data[:], v)
+	return append(b, data[:n]...)
+}
+
+func decodeVarint(b []byte) ([]byte, int64, error) {
+	v, n := binary.Varint(b)
+	if n <= 0 {
+		return nil, 0, errInvalidRow
+	}
+	return b[n:], v, nil
+}
+
+func encodeUvarint(b []byte, v uint64) []byte {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(data[:], v)
+	return append(b, data[:n]...)
+}
+
+func decodeUvarint(b []byte) ([]byte, uint64, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, 0, errInvalidRow
+	}
+	return b[n:], v, nil
+}
+
+func encodeUint64(b []byte, v uint64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], v)
+	return append(b, data[:]...)
+}
+
+func decodeUint64(b []byte) ([]byte, uint64, error) {
+	if len(b) < 8 {
+		return nil, 0, errInvalidRow
+	}
+	return b[8:], binary.BigEndian.Uint64(b[:8]), nil
+}
+
+//长度前缀 + 原始字节
+func encodeCompactBytes(b []byte, data []byte) []byte {
+	b = encodeUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func decodeCompactBytes(b []byte) ([]byte, []byte, error) {
+	b, n, err := decodeUvarint(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(b)) < n {
+		return nil, nil, errInvalidRow
+	}
+	data := make([]byte, n)
+	copy(data, b[:n])
+	return b[n:], data, nil
+}
@@ -0,0 +1,74 @@
+package rowcodec
+
+import (
+	"testing"
+	gotime "time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+func TestRowRoundTrip(t *testing.T) {
+	dec := new(types.MyDecimal)
+	if err := dec.FromString([]byte("-123.456")); err != nil {
+		t.Fatal(err)
+	}
+	tm := types.Time{Time: types.FromDate(2019, 9, 24, 11, 51, 57, 0), Type: mysql.TypeDatetime}
+	datums := []types.Datum{
+		types.NewDatum(nil),
+		types.NewIntDatum(-42),
+		types.NewUintDatum(1 << 63),
+		types.NewFloat32Datum(1.5),
+		types.NewFloat64Datum(-2.25),
+		types.NewStringDatum("abc"),
+		types.NewBytesDatum([]byte{0, 0xff}),
+		types.NewDecimalDatum(dec),
+		types.NewDurationDatum(types.Duration{Duration: 3 * gotime.Hour, Fsp: 2}),
+		types.NewTimeDatum(tm),
+	}
+	colIdxs := make([]uint64, len(datums))
+	for i := range colIdxs {
+		colIdxs[i] = uint64(i*100 + 1)
+	}
+	b, err := EncodeRow(colIdxs, datums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := DecodeRow(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != len(datums) {
+		t.Fatalf("decoded %d columns, want %d", len(row), len(datums))
+	}
+	for i, idx := range colIdxs {
+		got, want := row[idx], datums[i]
+		if got.Kind() != want.Kind() {
+			t.Fatalf("column %d kind %d, want %d", idx, got.Kind(), want.Kind())
+		}
+		cmp, err := got.CompareDatum(nil, &want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmp != 0 {
+			t.Fatalf("column %d value %v, want %v", idx, got.GetValue(), want.GetValue())
+		}
+	}
+}
+
+func TestDecodeInvalidRow(t *testing.T) {
+	if _, err := DecodeRow(nil); err == nil {
+		t.Fatal("expect error for empty row")
+	}
+	b, err := EncodeRow([]uint64{1}, []types.Datum{types.NewStringDatum("abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeRow(b[:len(b)-1]); err == nil {
+		t.Fatal("expect error for truncated row")
+	}
+	b[0] = CodecVer + 1
+	if _, err := DecodeRow(b); err == nil {
+		t.Fatal("expect error for unknown version")
+	}
+}